@@ -4,15 +4,19 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"google.golang.org/grpc"
+
+	redisdb "url-shortner/internal/redis"
 	"url-shortner/internal/server"
 )
 
-func gracefulShutdown(apiServer *http.Server, done chan bool) {
+func gracefulShutdown(apiServer *http.Server, grpcServer *grpc.Server, done chan bool) {
 	// Create context that listens for the interrupt signal from the OS.
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -30,6 +34,18 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 	if err := apiServer.Shutdown(ctx); err != nil {
 		log.Printf("Server forced to shutdown with error: %v", err)
 	}
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+	}
 
 	log.Println("Server exiting")
 
@@ -39,20 +55,63 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 
 func main() {
 
-	server := server.NewServer()
-	log.Printf("Server running on port: %s", server.Addr)
+	cfg, err := server.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The service is opened here rather than by the server so it can be
+	// closed, stopping its background listeners, after the last request.
+	db, err := redisdb.NewWithOptions(cfg.Redis)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	app, err := server.NewServerWithService(db, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := app.HTTPServer()
+	lis, err := app.Listen()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Server running on: %s", app.ListenAddr())
+
+	var grpcServer *grpc.Server
+	if cfg.GRPCPort != 0 {
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
+		if err != nil {
+			log.Fatal(err)
+		}
+		grpcServer = app.GRPCServer()
+		log.Printf("gRPC server running on port: %d", cfg.GRPCPort)
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Printf("grpc server error: %v", err)
+			}
+		}()
+	}
+
 	// Create a done channel to signal when the shutdown is complete
 	done := make(chan bool, 1)
 
 	// Run graceful shutdown in a separate goroutine
-	go gracefulShutdown(server, done)
+	go gracefulShutdown(server, grpcServer, done)
 
-	err := server.ListenAndServe()
+	err = server.Serve(lis)
 	if err != nil && err != http.ErrServerClosed {
 		panic(fmt.Sprintf("http server error: %s", err))
 	}
 
 	// Wait for the graceful shutdown to complete
 	<-done
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := app.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Printf("failed to close redis: %v", err)
+	}
 	log.Println("Graceful shutdown complete.")
 }
@@ -0,0 +1,107 @@
+package redisdb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// encryptedURLPrefix marks a stored url field as ciphertext. Plain
+// destinations always start with http:// or https://, so the two cannot be
+// confused.
+const encryptedURLPrefix = "enc:"
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// urlCipher encrypts stored destinations with AES-GCM. Ciphertexts are
+// stored as enc:{key id}:{base64 nonce+sealed}, so keys can be rotated: new
+// values use the current key while older keys stay available to decrypt.
+type urlCipher struct {
+	currentID string
+	keys      map[string]cipher.AEAD
+}
+
+func newURLCipher(current string, old ...string) (*urlCipher, error) {
+	c := &urlCipher{keys: make(map[string]cipher.AEAD)}
+	for i, entry := range append([]string{current}, old...) {
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("encryption key %d: want {id}:{base64 key} with id matching %s", i+1, keyIDPattern)
+		}
+		if _, dup := c.keys[id]; dup {
+			return nil, fmt.Errorf("encryption key id %q is listed twice", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", id, err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", id, err)
+		}
+		if i == 0 {
+			c.currentID = id
+		}
+		c.keys[id] = aead
+	}
+	return c, nil
+}
+
+func (c *urlCipher) encrypt(plaintext string) (string, error) {
+	aead := c.keys[c.currentID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedURLPrefix + c.currentID + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (c *urlCipher) decrypt(stored string) (string, error) {
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(stored, encryptedURLPrefix), ":")
+	if !ok {
+		return "", errors.New("malformed encrypted url")
+	}
+	aead, ok := c.keys[id]
+	if !ok {
+		return "", fmt.Errorf("url encrypted with unknown key %q", id)
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted url")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt url with key %q: %w", id, err)
+	}
+	return string(plaintext), nil
+}
+
+// sealURL returns the url field value to store for longURL.
+func (s *service) sealURL(longURL string) (string, error) {
+	if s.urls == nil {
+		return longURL, nil
+	}
+	return s.urls.encrypt(longURL)
+}
+
+// openURL reverses sealURL. Values stored before encryption was enabled are
+// returned as they are.
+func (s *service) openURL(stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedURLPrefix) {
+		return stored, nil
+	}
+	if s.urls == nil {
+		return "", errors.New("url is encrypted but URL_ENCRYPTION is disabled")
+	}
+	return s.urls.decrypt(stored)
+}
@@ -0,0 +1,113 @@
+package redisdb
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func testKey(id string, fill byte) string {
+	return id + ":" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(fill), 32)))
+}
+
+func TestURLCipherRoundTrip(t *testing.T) {
+	c, err := newURLCipher(testKey("k1", 'a'))
+	if err != nil {
+		t.Fatalf("newURLCipher failed: %v", err)
+	}
+
+	const target = "https://example.com/private?token=abc"
+	sealed, err := c.encrypt(target)
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	if !strings.HasPrefix(sealed, "enc:k1:") || strings.Contains(sealed, "example.com") {
+		t.Fatalf("expected an opaque ciphertext tagged with its key id, got %q", sealed)
+	}
+	if again, _ := c.encrypt(target); again == sealed {
+		t.Fatal("expected a fresh nonce for every encryption")
+	}
+
+	opened, err := c.decrypt(sealed)
+	if err != nil {
+		t.Fatalf("decrypt failed: %v", err)
+	}
+	if opened != target {
+		t.Fatalf("expected %q, got %q", target, opened)
+	}
+
+	tampered := sealed[:len(sealed)-2] + "AA"
+	if _, err := c.decrypt(tampered); err == nil {
+		t.Fatal("expected tampered ciphertext to be rejected")
+	}
+}
+
+func TestURLCipherKeyRotation(t *testing.T) {
+	before, err := newURLCipher(testKey("k1", 'a'))
+	if err != nil {
+		t.Fatalf("newURLCipher failed: %v", err)
+	}
+	old, err := before.encrypt("https://example.com/old")
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+
+	after, err := newURLCipher(testKey("k2", 'b'), testKey("k1", 'a'))
+	if err != nil {
+		t.Fatalf("newURLCipher failed: %v", err)
+	}
+	if opened, err := after.decrypt(old); err != nil || opened != "https://example.com/old" {
+		t.Fatalf("expected the retired key to still decrypt, got %q (%v)", opened, err)
+	}
+	fresh, err := after.encrypt("https://example.com/new")
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	if !strings.HasPrefix(fresh, "enc:k2:") {
+		t.Fatalf("expected new values to use the current key, got %q", fresh)
+	}
+
+	if _, err := before.decrypt(fresh); err == nil || !strings.Contains(err.Error(), "unknown key") {
+		t.Fatalf("expected an unknown key error, got %v", err)
+	}
+}
+
+func TestNewURLCipherRejectsBadKeys(t *testing.T) {
+	for _, entries := range [][]string{
+		{"missing-id"},
+		{"bad id:" + base64.StdEncoding.EncodeToString(make([]byte, 32))},
+		{"k1:not base64!"},
+		{"k1:" + base64.StdEncoding.EncodeToString(make([]byte, 10))},
+		{testKey("k1", 'a'), testKey("k1", 'b')},
+	} {
+		if _, err := newURLCipher(entries[0], entries[1:]...); err == nil {
+			t.Fatalf("expected %q to be rejected", entries)
+		}
+	}
+}
+
+func TestOpenURL(t *testing.T) {
+	c, err := newURLCipher(testKey("k1", 'a'))
+	if err != nil {
+		t.Fatalf("newURLCipher failed: %v", err)
+	}
+	encrypted := &service{urls: c}
+	plain := &service{}
+
+	sealed, err := encrypted.sealURL("https://example.com")
+	if err != nil {
+		t.Fatalf("sealURL failed: %v", err)
+	}
+	if opened, err := encrypted.openURL(sealed); err != nil || opened != "https://example.com" {
+		t.Fatalf("expected round trip, got %q (%v)", opened, err)
+	}
+	if opened, err := encrypted.openURL("https://example.com/legacy"); err != nil || opened != "https://example.com/legacy" {
+		t.Fatalf("expected plain values stored earlier to pass through, got %q (%v)", opened, err)
+	}
+	if stored, _ := plain.sealURL("https://example.com"); stored != "https://example.com" {
+		t.Fatalf("expected plain text by default, got %q", stored)
+	}
+	if _, err := plain.openURL(sealed); err == nil {
+		t.Fatal("expected ciphertext to fail without a key")
+	}
+}
@@ -0,0 +1,215 @@
+package redisdb
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	expiryHandleTimeout = 5 * time.Second
+	expirySweepBatch    = 200
+)
+
+// expireScript cleans up after a link that Redis has expired. KEYS[1] is its
+// expiry record, KEYS[2] the link key, KEYS[3] the summary, KEYS[4] its
+// history and KEYS[5..] the index sets to drop ARGV[1] from; ARGV[2] is its
+// final visit count. Deleting the record first makes the cleanup happen once
+// even when several listeners see the same event. A link recreated under the
+// same code since is left alone. Returns 1 when it cleaned up.
+var expireScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+if redis.call('DEL', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HINCRBY', KEYS[3], 'links', -1)
+redis.call('HINCRBY', KEYS[3], 'visits', -tonumber(ARGV[2]))
+redis.call('DEL', KEYS[4])
+for i = 5, #KEYS do
+	redis.call('SREM', KEYS[i], ARGV[1])
+end
+return 1
+`)
+
+// Summary holds running totals across every live link.
+type Summary struct {
+	Links  int64 `json:"links"`
+	Visits int64 `json:"visits"`
+}
+
+// GetSummary returns the totals maintained as links are created, visited and
+// deleted. Expired links are only subtracted while TrackExpiry is enabled.
+func (s *service) GetSummary(ctx context.Context) (Summary, error) {
+	values, err := s.redis.HMGet(ctx, summaryKey, "links", "visits").Result()
+	if err != nil {
+		return Summary{}, fmt.Errorf("get summary: %w", err)
+	}
+	var summary Summary
+	if v, ok := values[0].(string); ok {
+		summary.Links, _ = strconv.ParseInt(v, 10, 64)
+	}
+	if v, ok := values[1].(string); ok {
+		summary.Visits, _ = strconv.ParseInt(v, 10, 64)
+	}
+	return summary, nil
+}
+
+// Close stops the expiry listener, if any, and closes the Redis connection.
+func (s *service) Close() error {
+	if s.stopListener != nil {
+		s.stopListener()
+		s.listener.Wait()
+	}
+	return s.redis.Close()
+}
+
+// startExpiryListener runs listenForExpiry until Close.
+func (s *service) startExpiryListener() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopListener = cancel
+	s.listener.Add(1)
+	go func() {
+		defer s.listener.Done()
+		s.listenForExpiry(ctx)
+	}()
+}
+
+// listenForExpiry subscribes to the expired key events of this database and
+// cleans up after every expired link: its code leaves the tag, owner, group,
+// campaign and host sets, its history is deleted and the summary counters drop
+// its link and visits. Links that expired while no listener was running are
+// swept once the subscription is up.
+func (s *service) listenForExpiry(ctx context.Context) {
+	s.checkKeyspaceEvents(ctx)
+
+	pubsub := s.redis.Subscribe(ctx, fmt.Sprintf("__keyevent@%d__:expired", s.redis.Options().DB))
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		if ctx.Err() == nil {
+			log.Printf("expiry listener: subscribe: %v", err)
+		}
+		return
+	}
+
+	if err := s.sweepExpired(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("expiry listener: sweep: %v", err)
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			stored, ok := strings.CutPrefix(msg.Payload, shortURLKeyPrefix)
+			if !ok {
+				continue
+			}
+			if err := s.handleExpired(ctx, stored); err != nil && ctx.Err() == nil {
+				log.Printf("expiry listener: %s: %v", msg.Payload, err)
+			}
+		}
+	}
+}
+
+// checkKeyspaceEvents warns when the server is not configured to publish
+// expired key events, in which case the listener never hears anything.
+func (s *service) checkKeyspaceEvents(ctx context.Context) {
+	config, err := s.redis.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		log.Printf("expiry listener: cannot read notify-keyspace-events (%v); it must include Ex", err)
+		return
+	}
+	flags := config["notify-keyspace-events"]
+	if !strings.Contains(flags, "E") || !strings.ContainsAny(flags, "xA") {
+		log.Printf("expiry listener: notify-keyspace-events is %q; set it to include Ex or expired links will not be cleaned up", flags)
+	}
+}
+
+// sweepExpired handles every expiry record whose link no longer exists. The
+// cursor is walked by hand rather than with an Iterator, which keeps fetching
+// empty pages internally, so ctx is checked before every SCAN and every record
+// and a cancelled sweep returns ctx's error promptly.
+func (s *service) sweepExpired(ctx context.Context) error {
+	var cursor uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		keys, next, err := s.redis.Scan(ctx, cursor, expiringKeyPrefix+"*", expirySweepBatch).Result()
+		if err != nil {
+			return fmt.Errorf("scan expiry records: %w", err)
+		}
+		for _, key := range keys {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			stored := strings.TrimPrefix(key, expiringKeyPrefix)
+			exists, err := s.redis.Exists(ctx, shortURLKeyPrefix+stored).Result()
+			if err != nil {
+				return err
+			}
+			if exists == 1 {
+				continue
+			}
+			if err := s.handleExpired(ctx, stored); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// handleExpired cleans up after the link stored under stored, the code as it
+// appears in key names, using its expiry record. Links without a record,
+// permanent ones or those created before TrackExpiry was enabled, are skipped.
+func (s *service) handleExpired(ctx context.Context, stored string) error {
+	ctx, cancel := context.WithTimeout(ctx, expiryHandleTimeout)
+	defer cancel()
+
+	recordKey := expiringKeyPrefix + stored
+	record, err := s.redis.HGetAll(ctx, recordKey).Result()
+	if err != nil {
+		return fmt.Errorf("get expiry record: %w", err)
+	}
+	if len(record) == 0 {
+		return nil
+	}
+
+	code := record["code"]
+	keys := []string{recordKey, shortURLKeyPrefix + stored, summaryKey, historyKeyPrefix + stored}
+	for _, tag := range splitTags(record["tags"]) {
+		keys = append(keys, tagKey(tag))
+	}
+	if record["owner"] != "" {
+		keys = append(keys, ownerKey(record["owner"]))
+	}
+	if record["group"] != "" {
+		keys = append(keys, groupKey(record["group"]))
+	}
+	if record["campaign"] != "" {
+		keys = append(keys, campaignKey(record["campaign"]))
+	}
+	if record["host"] != "" {
+		keys = append(keys, hostKey(record["host"]))
+	}
+	visits, _ := strconv.ParseInt(record["visits"], 10, 64)
+
+	if err := expireScript.Run(ctx, s.redis, keys, code, visits).Err(); err != nil {
+		return fmt.Errorf("clean up expired link: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const exportScanBatch = 500
+
+// ErrCodesHashed is returned by ScanURLs when key names hold digests of the
+// codes, which cannot be turned back into codes.
+var ErrCodesHashed = errors.New("codes are not recoverable while key hashing is enabled")
+
+// ScanURLs calls fn with the stats of every link, in no particular order. It
+// SCANs the keyspace in batches and reads each batch in one pipelined round
+// trip, so memory stays bounded by a batch however many links there are.
+// Reservations are skipped. It stops with the first error from fn, or with
+// ctx's error once ctx is done.
+func (s *service) ScanURLs(ctx context.Context, fn func(URLStats) error) error {
+	if s.hashKeys {
+		return ErrCodesHashed
+	}
+
+	var cursor uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		keys, next, err := s.redis.Scan(ctx, cursor, shortURLKeyPrefix+"*", exportScanBatch).Result()
+		if err != nil {
+			return fmt.Errorf("scan urls: %w", err)
+		}
+		if err := s.emitStats(ctx, keys, fn); err != nil {
+			return err
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// emitStats reads the link hashes in keys with their TTLs in one pipeline and
+// passes each to fn. Keys that vanished since the SCAN, and links that cannot
+// be read, are skipped.
+func (s *service) emitStats(ctx context.Context, keys []string, fn func(URLStats) error) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	pipe := s.redis.Pipeline()
+	hashes := make([]*redis.MapStringStringCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	for i, key := range keys {
+		hashes[i] = pipe.HGetAll(ctx, key)
+		ttls[i] = pipe.TTL(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("read urls: %w", err)
+	}
+
+	for i, key := range keys {
+		values := hashes[i].Val()
+		if len(values) == 0 || values["state"] == stateReserved {
+			continue
+		}
+		stats, err := s.statsFromHash(strings.TrimPrefix(key, shortURLKeyPrefix), values, ttls[i].Val())
+		if err != nil {
+			// One link stored under other settings, such as an encrypted
+			// URL without the key, should not end the whole scan.
+			log.Printf("scan urls: skipping %s: %v", key, err)
+			continue
+		}
+		if err := fn(stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
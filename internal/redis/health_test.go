@@ -0,0 +1,57 @@
+package redisdb
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func upHook() *scriptedHook {
+	return &scriptedHook{reply: func(cmd redis.Cmder) {
+		switch cmd := cmd.(type) {
+		case *redis.StatusCmd:
+			cmd.SetVal("PONG")
+		case *redis.StringCmd:
+			cmd.SetVal("redis_version:7.2.4\r\nuptime_in_seconds:7200\r\n")
+		}
+	}}
+}
+
+func downHook() *scriptedHook {
+	return &scriptedHook{failures: math.MaxInt, err: errors.New("connection refused")}
+}
+
+func TestHealthSingleDependencyKeepsShape(t *testing.T) {
+	stats := newScriptedService(upHook()).Health()
+
+	if stats["redis_status"] != "up" || stats["redis_version"] != "7.2.4" {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+	if _, ok := stats["status"]; ok {
+		t.Fatalf("expected no aggregate status with a single dependency, got %v", stats)
+	}
+}
+
+func TestHealthAggregatesDependencies(t *testing.T) {
+	srv := newScriptedService(upHook())
+	analytics := newScriptedService(downHook()).redis
+	srv.dependencies = []healthDependency{{name: "analytics", client: analytics}}
+
+	stats := srv.Health()
+	if stats["status"] != "down" {
+		t.Fatalf("expected the overall status to be down, got %v", stats)
+	}
+	if stats["redis_status"] != "up" || stats["redis_version"] != "7.2.4" {
+		t.Fatalf("expected the primary store to be reported up, got %v", stats)
+	}
+	if stats["analytics_status"] != "down" || stats["analytics_message"] == "" {
+		t.Fatalf("expected the analytics store to be reported down, got %v", stats)
+	}
+
+	srv.dependencies[0].client = newScriptedService(upHook()).redis
+	if stats := srv.Health(); stats["status"] != "up" || stats["analytics_status"] != "up" {
+		t.Fatalf("expected every dependency up, got %v", stats)
+	}
+}
@@ -0,0 +1,96 @@
+package redisdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// maxHistoryEvents caps each link's history; the oldest events are dropped
+// first.
+const maxHistoryEvents = 100
+
+// Lifecycle events recorded in a link's history.
+const (
+	EventCreate  = "create"
+	EventUpdate  = "update"
+	EventDisable = "disable"
+	EventEnable  = "enable"
+	EventRotate  = "rotate"
+)
+
+// HistoryEvent is one entry of a link's lifecycle timeline.
+type HistoryEvent struct {
+	Type string    `json:"type"`
+	At   time.Time `json:"at"`
+}
+
+// recordEventScript appends ARGV[1] to the KEYS[1] history of the KEYS[2]
+// link and keeps only its last ARGV[2] entries, expiring along with the
+// link. A create (ARGV[3] = 1) starts a fresh history, so a code reused after
+// expiry does not inherit the old link's. Nothing is recorded once the link
+// is gone.
+var recordEventScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	return 0
+end
+if ARGV[3] == '1' then
+	redis.call('DEL', KEYS[1])
+end
+redis.call('RPUSH', KEYS[1], ARGV[1])
+redis.call('LTRIM', KEYS[1], -tonumber(ARGV[2]), -1)
+local pttl = redis.call('PTTL', KEYS[2])
+if pttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], pttl)
+else
+	redis.call('PERSIST', KEYS[1])
+end
+return 1
+`)
+
+// queueEvent adds the recording of event for code to pipe, so it is written
+// together with the change it describes.
+func (s *service) queueEvent(ctx context.Context, pipe redis.Pipeliner, code, event string) {
+	keys, args := s.eventArgs(code, event)
+	recordEventScript.Eval(ctx, pipe, keys, args...)
+}
+
+// recordEvent records event for code after the change it describes has been
+// made. The change stands either way, so a failure is only logged.
+func (s *service) recordEvent(ctx context.Context, code, event string) {
+	keys, args := s.eventArgs(code, event)
+	if err := recordEventScript.Run(ctx, s.redis, keys, args...).Err(); err != nil {
+		log.Printf("failed to record %s event for %s: %v", event, code, err)
+	}
+}
+
+func (s *service) eventArgs(code, event string) ([]string, []any) {
+	entry, _ := json.Marshal(HistoryEvent{Type: event, At: time.Now().UTC()})
+	fresh := 0
+	if event == EventCreate {
+		fresh = 1
+	}
+	return []string{s.historyKey(code), s.shortURLKey(code)}, []any{entry, maxHistoryEvents, fresh}
+}
+
+// GetHistory returns the recorded lifecycle events of code, oldest first. A
+// link with no history, or no link at all, has none.
+func (s *service) GetHistory(ctx context.Context, code string) ([]HistoryEvent, error) {
+	entries, err := s.redis.LRange(ctx, s.historyKey(code), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get history: %w", err)
+	}
+	events := make([]HistoryEvent, 0, len(entries))
+	for _, entry := range entries {
+		var event HistoryEvent
+		if err := json.Unmarshal([]byte(entry), &event); err != nil {
+			return nil, fmt.Errorf("get history: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
@@ -0,0 +1,37 @@
+package redisdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const rateLimitKeyPrefix = "short:rate:"
+
+// rateLimitScript counts a request in the KEYS[1] window, which starts with
+// its first request and lasts ARGV[1] milliseconds. Returns the requests so
+// far in the window and the milliseconds left of it.
+var rateLimitScript = redis.NewScript(`
+local hits = redis.call('INCR', KEYS[1])
+if hits == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return {hits, redis.call('PTTL', KEYS[1])}
+`)
+
+// AllowRequest counts a request against key, which allows limit requests per
+// window. The count lives in Redis, so every instance sharing the database
+// draws from the same allowance. When the limit is used up it returns false
+// and how long until the window resets.
+func (s *service) AllowRequest(ctx context.Context, key string, limit int64, window time.Duration) (bool, time.Duration, error) {
+	values, err := rateLimitScript.Run(ctx, s.redis, []string{rateLimitKeyPrefix + key}, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("rate limit: %w", err)
+	}
+	if values[0] <= limit {
+		return true, 0, nil
+	}
+	return false, time.Duration(max(values[1], 0)) * time.Millisecond, nil
+}
@@ -2,13 +2,22 @@ package redisdb
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"math"
+	"math/rand/v2"
 	"os"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
@@ -16,34 +25,729 @@ import (
 )
 
 const (
-	shortURLKeyPrefix = "short:url:"
+	shortURLKeyPrefix   = "short:url:"
+	tagKeyPrefix        = "short:tag:"
+	referrerKeyPrefix   = "short:ref:"
+	geoKeyPrefix        = "short:geo:"
+	clicksChannelPrefix = "short:clicks:"
+	ownerKeyPrefix      = "short:owner:"
+	quotaKeyPrefix      = "short:quota:"
+	burstKeyPrefix      = "short:burst:"
+	groupKeyPrefix      = "short:group:"
+	campaignKeyPrefix   = "short:campaign:"
+	hostKeyPrefix       = "short:host:"
+	groupsKey           = "short:groups"
+	hostsKey            = "short:hosts"
+	caseFoldsKey        = "short:folds"
+	denylistKey         = "short:denylist"
+	summaryKey          = "short:summary"
+	expiringKeyPrefix   = "short:expiring:"
+	historyKeyPrefix    = "short:audit:"
 )
 
+// stateReserved is the state field of a reservation: a link hash holding a
+// code for later use, with no url yet.
+const stateReserved = "reserved"
+
+// ReservationTTL is how long a reservation holds its code before it is
+// released unfilled.
+const ReservationTTL = 30 * 24 * time.Hour
+
+// MaxTags is the most tags a link may carry.
+const MaxTags = 10
+
+// trackExpiryLua defines track(link, record, code), which copies what the
+// expiry listener needs to clean up after link into the permanent record
+// hash: the code itself (key names may hold a digest), its index entries, and
+// its visit count.
+const trackExpiryLua = `
+local function track(link, record, code)
+	local values = redis.call('HMGET', link, 'tags', 'owner', 'group', 'visits', 'campaign', 'host')
+	redis.call('HSET', record, 'code', code, 'tags', values[1] or '', 'owner', values[2] or '',
+		'group', values[3] or '', 'visits', values[4] or 0, 'campaign', values[5] or '', 'host', values[6] or '')
+end
+`
+
+// maxReferrerHosts caps the distinct referrer hosts kept per link. The
+// Referer header is up to the client, so past the cap the least counted host
+// is folded into the OtherReferrers member rather than letting the set grow.
+const maxReferrerHosts = 1000
+
+// OtherReferrers is the referrer member holding the visits of hosts folded
+// away by the maxReferrerHosts cap.
+const OtherReferrers = "(other)"
+
+// countReferrerLua defines countReferrer(key, referrer, weight), which adds
+// weight to referrer in the key sorted set and then folds the least counted
+// host into OtherReferrers if the set has grown past maxReferrerHosts.
+var countReferrerLua = `
+local function countReferrer(key, referrer, weight)
+	redis.call('ZINCRBY', key, weight, referrer)
+	if redis.call('ZCARD', key) <= ` + strconv.Itoa(maxReferrerHosts+1) + ` then
+		return
+	end
+	local lowest = redis.call('ZRANGE', key, 0, 1, 'WITHSCORES')
+	local member, score = lowest[1], lowest[2]
+	if member == '` + OtherReferrers + `' then
+		member, score = lowest[3], lowest[4]
+	end
+	redis.call('ZREM', key, member)
+	redis.call('ZINCRBY', key, score, '` + OtherReferrers + `')
+end
+`
+
+// recordReferrerScript counts one visit from ARGV[1] in the KEYS[1] referrer
+// set with countReferrer and keeps the set expiring with the KEYS[2] link.
+var recordReferrerScript = redis.NewScript(countReferrerLua + `
+countReferrer(KEYS[1], ARGV[1], 1)
+local pttl = redis.call('PTTL', KEYS[2])
+if pttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], pttl)
+end
+return 1
+`)
+
+// createScript creates a link hash only if it does not exist yet, applies its
+// TTL, counts it in the KEYS[3] summary, and adds the code to every index set
+// in KEYS[6..] (owner first, then tags, group, campaign, host). ARGV[1] is the
+// code, ARGV[2] the TTL in milliseconds (0 for none), ARGV[3] a group name to
+// record in the KEYS[2] name index (empty for none), ARGV[4] is 1 to write the
+// KEYS[4] expiry record for an expiring link, ARGV[5] is 1 to replace a
+// reservation of the code held by no one or by owner ARGV[6], ARGV[7] a
+// destination host to record in the KEYS[5] name index (empty for none),
+// ARGV[8] the most links the KEYS[6] owner set may hold (0 for no limit), and
+// the rest are the hash's field/value pairs. Returns 0 on conflict and -1 when
+// the owner is at its limit; filling the owner's own reservation needs no room.
+var createScript = redis.NewScript(trackExpiryLua + `
+local filled = false
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	local held = redis.call('HMGET', KEYS[1], 'state', 'owner')
+	if ARGV[5] ~= '1' or held[1] ~= 'reserved' or (held[2] and held[2] ~= ARGV[6]) then
+		return 0
+	end
+	filled = held[2] == ARGV[6]
+end
+local limit = tonumber(ARGV[8])
+if limit > 0 and not filled and redis.call('SCARD', KEYS[6]) >= limit then
+	return -1
+end
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], unpack(ARGV, 9))
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+if ARGV[3] ~= '' then
+	redis.call('SADD', KEYS[2], ARGV[3])
+end
+if ARGV[7] ~= '' then
+	redis.call('SADD', KEYS[5], ARGV[7])
+end
+for i = 6, #KEYS do
+	redis.call('SADD', KEYS[i], ARGV[1])
+end
+redis.call('HINCRBY', KEYS[3], 'links', 1)
+if ttl > 0 and ARGV[4] == '1' then
+	track(KEYS[1], KEYS[4], ARGV[1])
+end
+return 1
+`)
+
+// pruneGroupsScript drops each name in ARGV from the KEYS[1] name index when
+// its group (or host) set, the matching KEYS[i+1], no longer exists. Checking and
+// removing together keeps a concurrent create from losing its group name.
+var pruneGroupsScript = redis.NewScript(`
+local pruned = 0
+for i = 1, #ARGV do
+	if redis.call('EXISTS', KEYS[i + 1]) == 0 then
+		pruned = pruned + redis.call('SREM', KEYS[1], ARGV[i])
+	end
+end
+return pruned
+`)
+
+// refreshTTLScript re-applies the stored ttl_seconds to a sliding link and its
+// referrer, geo, and history keys in a single round trip. It returns 1 when
+// the TTL was reset.
+var refreshTTLScript = redis.NewScript(`
+local values = redis.call('HMGET', KEYS[1], 'sliding', 'ttl_seconds')
+if values[1] ~= '1' then
+	return 0
+end
+local ttl = tonumber(values[2])
+if not ttl or ttl <= 0 then
+	return 0
+end
+redis.call('EXPIRE', KEYS[1], ttl)
+redis.call('EXPIRE', KEYS[2], ttl)
+redis.call('EXPIRE', KEYS[3], ttl)
+redis.call('EXPIRE', KEYS[4], ttl)
+return 1
+`)
+
+// setExpirationScript moves a link and its analytics and KEYS[5] history keys
+// to a new TTL in milliseconds, or makes them permanent when ARGV[1] is not
+// positive. A sliding link keeps sliding over the new window; a permanent link
+// cannot slide, so the flag is dropped. A permanent link needs no KEYS[4]
+// expiry record; an expiring one gets one when ARGV[3] is 1, recording ARGV[2]
+// as its code.
+var setExpirationScript = redis.NewScript(trackExpiryLua + `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local ttl = tonumber(ARGV[1])
+if ttl <= 0 then
+	redis.call('PERSIST', KEYS[1])
+	redis.call('PERSIST', KEYS[2])
+	redis.call('PERSIST', KEYS[3])
+	redis.call('PERSIST', KEYS[5])
+	redis.call('HDEL', KEYS[1], 'sliding', 'ttl_seconds')
+	redis.call('DEL', KEYS[4])
+	return 1
+end
+redis.call('PEXPIRE', KEYS[1], ttl)
+redis.call('PEXPIRE', KEYS[2], ttl)
+redis.call('PEXPIRE', KEYS[3], ttl)
+redis.call('PEXPIRE', KEYS[5], ttl)
+if ARGV[3] == '1' and redis.call('EXISTS', KEYS[4]) == 0 then
+	track(KEYS[1], KEYS[4], ARGV[2])
+end
+if redis.call('HGET', KEYS[1], 'sliding') == '1' then
+	redis.call('HSET', KEYS[1], 'ttl_seconds', math.max(1, math.floor(ttl / 1000)))
+end
+return 1
+`)
+
+// resolveScript returns the target URL of a link along with its remaining
+// TTL in milliseconds (negative when permanent), its one-time flag, and its
+// query forwarding flag. A one-time link is marked consumed by the same call,
+// so concurrent visitors cannot both get the URL; later calls return 0
+// instead. Before its starts_at, later than ARGV[1] in Unix milliseconds, or
+// while it is disabled, a link returns -1 and is left untouched.
+var resolveScript = redis.NewScript(`
+local values = redis.call('HMGET', KEYS[1], 'url', 'one_time', 'consumed', 'forward_query', 'starts_at', 'disabled')
+if not values[1] then
+	return false
+end
+if values[6] == '1' or (values[5] and tonumber(values[5]) > tonumber(ARGV[1])) then
+	return -1
+end
+local oneTime = 0
+if values[2] == '1' then
+	if values[3] == '1' then
+		return 0
+	end
+	redis.call('HSET', KEYS[1], 'consumed', 1)
+	oneTime = 1
+end
+local forward = 0
+if values[4] == '1' then
+	forward = 1
+end
+return {values[1], redis.call('PTTL', KEYS[1]), oneTime, forward}
+`)
+
+// visitScript is the whole redirect hot path in one round trip: it resolves a
+// link like resolveScript, counts the visit, records ARGV[1] as the referrer
+// and ARGV[2] as the country (skipped when empty), and keeps the referrer,
+// geo, and history keys (KEYS[2], KEYS[3], KEYS[7]) expiring with the link,
+// sliding its TTL when enabled. When ARGV[3] is positive, KEYS[4] counts this
+// visitor's hits over a window of ARGV[4] milliseconds and hits beyond ARGV[3]
+// still resolve but are not counted. A counted visit adds ARGV[5] to the
+// visits, referrer, and country counts, to the KEYS[5] summary, and to the
+// KEYS[6] expiry record when the link has one; 0 leaves the visit out and more
+// than 1 marks the link sampled. ARGV[6] is the current time for the starts_at
+// check, as in resolveScript. A link with variants redirects to the one whose
+// share of the total weight ARGV[8] falls in, or ARGV[9] for sticky_variants
+// links, both fractions in [0, 1), and a counted visit is also added to its
+// variant_visits:{index} field. Returns {url, pttl, oneTime, forward, visits,
+// counted, interstitial, variant} (variant is -1 without variants), 0 for a
+// consumed link, -1 for one not active yet or disabled, -2 for a require_https
+// link visited over plain HTTP (ARGV[7] is 1), or nil when the link is
+// missing. A refused visit leaves the link untouched.
+var visitScript = redis.NewScript(countReferrerLua + `
+local values = redis.call('HMGET', KEYS[1], 'url', 'one_time', 'consumed', 'sliding', 'ttl_seconds', 'visits', 'forward_query', 'starts_at', 'disabled', 'require_https', 'interstitial_seconds', 'variants', 'sticky_variants')
+if not values[1] then
+	return false
+end
+if values[9] == '1' or (values[8] and tonumber(values[8]) > tonumber(ARGV[6])) then
+	return -1
+end
+if values[10] == '1' and ARGV[7] == '1' then
+	return -2
+end
+local oneTime = 0
+if values[2] == '1' then
+	if values[3] == '1' then
+		return 0
+	end
+	redis.call('HSET', KEYS[1], 'consumed', 1)
+	oneTime = 1
+end
+local url = values[1]
+local variant = -1
+if values[12] then
+	local variants = cjson.decode(values[12])
+	local roll = tonumber(ARGV[8])
+	if values[13] == '1' then
+		roll = tonumber(ARGV[9])
+	end
+	local total = 0
+	for _, v in ipairs(variants) do
+		total = total + v.weight
+	end
+	local point = roll * total
+	for i, v in ipairs(variants) do
+		point = point - v.weight
+		if point < 0 or i == #variants then
+			variant = i - 1
+			url = v.url
+			break
+		end
+	end
+end
+local counted = 1
+local maxBurst = tonumber(ARGV[3])
+if maxBurst > 0 then
+	local hits = redis.call('INCR', KEYS[4])
+	if hits == 1 then
+		redis.call('PEXPIRE', KEYS[4], ARGV[4])
+	end
+	if hits > maxBurst then
+		counted = 0
+	end
+end
+local weight = tonumber(ARGV[5])
+if weight == 0 then
+	counted = 0
+end
+local visits = tonumber(values[6]) or 0
+if counted == 1 then
+	visits = redis.call('HINCRBY', KEYS[1], 'visits', weight)
+	if weight > 1 then
+		redis.call('HSET', KEYS[1], 'sampled', 1)
+	end
+	if variant >= 0 then
+		redis.call('HINCRBY', KEYS[1], 'variant_visits:' .. variant, weight)
+	end
+	redis.call('HINCRBY', KEYS[5], 'visits', weight)
+	if redis.call('EXISTS', KEYS[6]) == 1 then
+		redis.call('HINCRBY', KEYS[6], 'visits', weight)
+	end
+	if ARGV[1] ~= '' then
+		countReferrer(KEYS[2], ARGV[1], weight)
+	end
+	if ARGV[2] ~= '' then
+		redis.call('HINCRBY', KEYS[3], ARGV[2], weight)
+	end
+end
+local window = tonumber(values[5])
+if values[4] == '1' and window and window > 0 then
+	redis.call('EXPIRE', KEYS[1], window)
+end
+local pttl = redis.call('PTTL', KEYS[1])
+if pttl > 0 then
+	redis.call('PEXPIRE', KEYS[2], pttl)
+	redis.call('PEXPIRE', KEYS[3], pttl)
+	redis.call('PEXPIRE', KEYS[7], pttl)
+end
+local forward = 0
+if values[7] == '1' then
+	forward = 1
+end
+return {url, pttl, oneTime, forward, visits, counted, tonumber(values[11]) or 0, variant}
+`)
+
+// rotateScript moves a link from KEYS[1] to KEYS[2] together with its
+// referrer (KEYS[3] to KEYS[4]), geo (KEYS[5] to KEYS[6]), expiry record
+// (KEYS[7] to KEYS[8]) and history (KEYS[9] to KEYS[10]) keys, and swaps
+// ARGV[1] for ARGV[2] in every index set in KEYS[12..]. When the old code
+// holds its ARGV[3] field of the KEYS[11] case folds hash (as ARGV[4]), the
+// new code takes over its own ARGV[5] field (as ARGV[6]) unless another code
+// holds it. RENAME keeps values and TTLs. Returns 0 when the old link is
+// missing and -1 when the new code is taken.
+var rotateScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return -1
+end
+redis.call('RENAME', KEYS[1], KEYS[2])
+if redis.call('EXISTS', KEYS[3]) == 1 then
+	redis.call('RENAME', KEYS[3], KEYS[4])
+end
+if redis.call('EXISTS', KEYS[5]) == 1 then
+	redis.call('RENAME', KEYS[5], KEYS[6])
+end
+if redis.call('EXISTS', KEYS[7]) == 1 then
+	redis.call('RENAME', KEYS[7], KEYS[8])
+	redis.call('HSET', KEYS[8], 'code', ARGV[2])
+end
+if redis.call('EXISTS', KEYS[9]) == 1 then
+	redis.call('RENAME', KEYS[9], KEYS[10])
+end
+if redis.call('HGET', KEYS[11], ARGV[3]) == ARGV[4] then
+	redis.call('HDEL', KEYS[11], ARGV[3])
+	redis.call('HSETNX', KEYS[11], ARGV[5], ARGV[6])
+end
+for i = 12, #KEYS do
+	if redis.call('SREM', KEYS[i], ARGV[1]) == 1 then
+		redis.call('SADD', KEYS[i], ARGV[2])
+	end
+end
+return 1
+`)
+
+// incrVisitsIfExistsScript adds ARGV[1] to a link's visits only while the
+// link exists, so a late count cannot recreate an expired or deleted hash.
+// Reservations have no url and are not counted either. The KEYS[2] summary
+// and the KEYS[3] expiry record, if any, follow.
+var incrVisitsIfExistsScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], 'url') == 0 then
+	return false
+end
+redis.call('HINCRBY', KEYS[2], 'visits', ARGV[1])
+if redis.call('EXISTS', KEYS[3]) == 1 then
+	redis.call('HINCRBY', KEYS[3], 'visits', ARGV[1])
+end
+return redis.call('HINCRBY', KEYS[1], 'visits', ARGV[1])
+`)
+
+// deleteScript removes a link or reservation with its referrer, geo and
+// history keys (KEYS[2], KEYS[3], KEYS[6]), drops its ARGV[2] field from the
+// KEYS[7] case folds hash while it holds it (as ARGV[3]), and drops ARGV[1]
+// from every index set in KEYS[8..].
+// Only when a link still existed are its KEYS[5] expiry record removed and
+// the KEYS[4] summary reduced; otherwise the expiry listener does that.
+// Returns the number of keys deleted.
+var deleteScript = redis.NewScript(`
+local values = redis.call('HMGET', KEYS[1], 'url', 'visits')
+local visits = tonumber(values[2]) or 0
+local deleted = redis.call('DEL', KEYS[1])
+redis.call('DEL', KEYS[2], KEYS[3], KEYS[6])
+if redis.call('HGET', KEYS[7], ARGV[2]) == ARGV[3] then
+	redis.call('HDEL', KEYS[7], ARGV[2])
+end
+for i = 8, #KEYS do
+	redis.call('SREM', KEYS[i], ARGV[1])
+end
+if deleted == 1 and values[1] then
+	redis.call('DEL', KEYS[5])
+	redis.call('HINCRBY', KEYS[4], 'links', -1)
+	redis.call('HINCRBY', KEYS[4], 'visits', -visits)
+end
+return deleted
+`)
+
+// hsetIfExistsScript sets hash fields only when the key still exists, so a
+// late background write cannot resurrect a deleted or expired link.
+var hsetIfExistsScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV))
+return 1
+`)
+
+// reserveScript creates a reservation hash, marked state=reserved and with no
+// url, for every code in KEYS[2..] that is still free, all in one step, each
+// expiring after ARGV[3] milliseconds. ARGV[1] is the creation time, ARGV[2]
+// the reserving owner (empty for none), whose KEYS[1] owner set each reserved
+// code, from ARGV[4..], is added to. Returns 1 for each key reserved and 0
+// for each already taken, in order.
+var reserveScript = redis.NewScript(`
+local results = {}
+for i = 2, #KEYS do
+	if redis.call('EXISTS', KEYS[i]) == 1 then
+		results[i - 1] = 0
+	else
+		redis.call('HSET', KEYS[i], 'state', 'reserved', 'created_at', ARGV[1])
+		redis.call('PEXPIRE', KEYS[i], ARGV[3])
+		if ARGV[2] ~= '' then
+			redis.call('HSET', KEYS[i], 'owner', ARGV[2])
+			redis.call('SADD', KEYS[1], ARGV[i + 2])
+		end
+		results[i - 1] = 1
+	end
+end
+return results
+`)
+
 var (
 	ErrNotFound = errors.New("short url not found")
 	ErrConflict = errors.New("short code already exists")
+	ErrGone     = errors.New("short url already used")
+	// ErrNotActive is returned when resolving a link before its StartsAt or
+	// while it is disabled.
+	ErrNotActive = errors.New("short url not active yet")
+	// ErrReadOnly wraps errors from Redis refusing a write because it is a
+	// read-only replica, out of memory, or unable to persist.
+	ErrReadOnly = errors.New("redis is refusing writes")
+	// ErrInsecure is returned by VisitURL for a RequireHTTPS link visited
+	// over plain HTTP.
+	ErrInsecure = errors.New("short url requires https")
+	// ErrQuotaExceeded is returned by CreateShortURL when the owner already
+	// has CreateOptions.OwnerLimit links.
+	ErrQuotaExceeded = errors.New("link quota exceeded")
+	// ErrTooManyTags is returned by AddTags when the link would end up
+	// with more than MaxTags tags.
+	ErrTooManyTags = fmt.Errorf("at most %d tags are allowed", MaxTags)
 )
 
 type URLStats struct {
-	Code      string     `json:"code"`
-	LongURL   string     `json:"long_url"`
-	CreatedAt time.Time  `json:"created_at"`
-	Visits    int64      `json:"visits"`
-	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Code       string     `json:"code"`
+	LongURL    string     `json:"long_url,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Visits     int64      `json:"visits"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	StartsAt   *time.Time `json:"starts_at,omitempty"`
+	TTLSeconds *int64     `json:"ttl_seconds,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+	Sliding    bool       `json:"sliding_expiration,omitempty"`
+	OneTime    bool       `json:"one_time,omitempty"`
+	Consumed   bool       `json:"consumed,omitempty"`
+	Disabled   bool       `json:"disabled,omitempty"`
+	// ForwardQuery links pass the redirect request's query on to LongURL.
+	ForwardQuery bool `json:"forward_query,omitempty"`
+	// RequireHTTPS links refuse to redirect visits made over plain HTTP.
+	RequireHTTPS bool `json:"require_https,omitempty"`
+	// InterstitialSeconds is how long browsers see a countdown page before
+	// being redirected; 0 redirects at once.
+	InterstitialSeconds int `json:"interstitial_seconds,omitempty"`
+	// Variants split redirects across several destinations by weight, with
+	// the visits each one received. LongURL is the first of them.
+	Variants       []Variant `json:"variants,omitempty"`
+	StickyVariants bool      `json:"sticky_variants,omitempty"`
+	// Sampled means some visits were counted by sampling (see
+	// Visit.SampleRate), so Visits and the analytics are estimates.
+	Sampled bool `json:"sampled,omitempty"`
+	// ExpiringSoon is set by the server when TTLSeconds is under its
+	// configured warning threshold.
+	ExpiringSoon bool `json:"expiring_soon,omitempty"`
+	// VisitsBucket is set by the server when Visits has been rounded down
+	// to its order of magnitude for a public reader, as in "100+".
+	VisitsBucket string `json:"visits_bucket,omitempty"`
+
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+
+	Group string `json:"group,omitempty"`
+	// Owner identifies the API key that created the link; it is never
+	// rendered.
+	Owner string `json:"-"`
+	// Campaign is the id of the campaign the link was created in, if any.
+	Campaign string `json:"campaign,omitempty"`
+
+	// Destination is the result of the last destination check, if any.
+	Destination *DestinationHealth `json:"destination,omitempty"`
+}
+
+// DestinationHealth records whether a link's target was reachable when it was
+// last checked.
+type DestinationHealth struct {
+	// Status is the final HTTP status, 0 when no response was received.
+	Status    int       `json:"status,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Healthy   bool      `json:"healthy"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// ClickEvent is published every time a short URL is visited.
+type ClickEvent struct {
+	Code     string    `json:"code"`
+	Visits   int64     `json:"visits"`
+	Referrer string    `json:"referrer"`
+	At       time.Time `json:"at"`
+}
+
+// ReferrerCount is the number of visits attributed to a single referrer host.
+type ReferrerCount struct {
+	Referrer string `json:"referrer"`
+	Count    int64  `json:"count"`
+}
+
+// ReferrerStats holds the busiest referrers for a code, most visits first, and
+// the combined count of every referrer outside that top slice.
+type ReferrerStats struct {
+	Top    []ReferrerCount `json:"top"`
+	Others int64           `json:"others"`
+}
+
+// ResolvedURL is a redirect target together with how long it stays valid.
+type ResolvedURL struct {
+	URL string
+	// TTL is the time left before the link expires, zero for permanent links.
+	TTL     time.Duration
+	OneTime bool
+	// ForwardQuery is set for links that merge the redirect request's query
+	// into URL.
+	ForwardQuery bool
+	// InterstitialSeconds is the link's countdown before redirecting
+	// browsers; only VisitURL sets it.
+	InterstitialSeconds int
+	// Variant is the index of the variant URL was picked from, or -1 for
+	// links without variants; only VisitURL picks one, so it is always -1
+	// otherwise.
+	Variant int
+	// Visits is the visit count including this visit; only VisitURL sets it.
+	Visits int64
+	// Counted is false when VisitURL skipped counting a visit because its
+	// visitor exceeded the burst limit or sampling left it out.
+	Counted bool
+}
+
+// Visit describes a single click recorded by VisitURL. Empty fields are not
+// recorded.
+type Visit struct {
+	Referrer string
+	Country  string
+
+	// Visitor identifies the client, typically its IP. With MaxBurst > 0,
+	// visits beyond MaxBurst from the same visitor within BurstWindow still
+	// resolve but are left out of the visit count and analytics.
+	Visitor     string
+	MaxBurst    int
+	BurstWindow time.Duration
+
+	// SampleRate > 1 counts a random one in SampleRate visits, each as
+	// SampleRate visits, so a very busy link costs a fraction of the writes.
+	// Its visit, referrer, and country counts become estimates and its stats
+	// are marked Sampled. 0 and 1 count every visit exactly.
+	SampleRate int
+
+	// PlainHTTP marks a visit that did not arrive over TLS. RequireHTTPS
+	// links refuse it with ErrInsecure, without counting it.
+	PlainHTTP bool
+
+	// VariantRoll and StickyRoll, in [0, 1), pick the variant of a link
+	// with variants: VariantRoll should be random, and StickyRoll the same
+	// for every visit from one client, for StickyVariants links.
+	VariantRoll float64
+	StickyRoll  float64
+}
+
+// CreateOptions holds the optional settings applied when a short URL is created.
+type CreateOptions struct {
+	TTL  time.Duration
+	Tags []string
+	// Sliding resets the TTL to its original length on every redirect. It
+	// has no effect without a TTL.
+	Sliding bool
+	// OneTime links redirect only once; later visits get ErrGone.
+	OneTime bool
+	// ForwardQuery merges the query of each redirect request into the
+	// destination's, for affiliate and campaign tracking.
+	ForwardQuery bool
+	// RequireHTTPS refuses redirects for visits made over plain HTTP.
+	RequireHTTPS bool
+	// InterstitialSeconds shows browsers a countdown page for that long
+	// before redirecting them. Zero redirects at once.
+	InterstitialSeconds int
+	// Variants split redirects across several destinations by weight;
+	// StickyVariants sends each client to the same one every time.
+	Variants       []Variant
+	StickyVariants bool
+	// StartsAt embargoes the link: until then it resolves to ErrNotActive
+	// without counting visits. Zero activates it at once.
+	StartsAt time.Time
+
+	Title       string
+	Description string
+
+	// Owner identifies the API key that created the link, for quotas.
+	Owner string
+	// OwnerLimit, when positive, refuses the create with ErrQuotaExceeded
+	// once Owner already has that many links or reservations. The check and
+	// the create happen together, so concurrent creates cannot overshoot it.
+	OwnerLimit int64
+
+	// ManagementTokenHash is the digest of the token that changes to the
+	// link must present, stored as management_token_hash. The token itself
+	// is never stored.
+	ManagementTokenHash string
+
+	// Group is the single folder the link is filed under, if any.
+	Group string
+	// Campaign files the link under a campaign id for bulk operations; see
+	// CodesByCampaign.
+	Campaign string
+
+	// FillReservation lets the link take over a reservation of its code made
+	// by the same owner, or by no one. Without it a reserved code conflicts.
+	FillReservation bool
 }
 
 type Service interface {
 	Health() map[string]string
-	CreateShortURL(ctx context.Context, code, longURL string, ttl time.Duration) error
+	CreateShortURL(ctx context.Context, code, longURL string, opts CreateOptions) error
 	GetLongURL(ctx context.Context, code string) (string, error)
+	GetLongURLs(ctx context.Context, codes []string) (map[string]string, error)
+	ResolveURL(ctx context.Context, code string) (ResolvedURL, error)
+	VisitURL(ctx context.Context, code string, visit Visit) (ResolvedURL, error)
+	GetRaw(ctx context.Context, code string) (map[string]string, time.Duration, error)
 	IncrementVisits(ctx context.Context, code string) (int64, error)
+	IncrementVisitsBy(ctx context.Context, code string, delta int64) (int64, error)
+	IncrementVisitsBatch(ctx context.Context, deltas map[string]int64) (map[string]int64, error)
+	VisitCounts(ctx context.Context, codes []string) (map[string]int64, error)
 	GetStats(ctx context.Context, code string) (URLStats, error)
+	ScanURLs(ctx context.Context, fn func(URLStats) error) error
 	DeleteShortURL(ctx context.Context, code string) error
 	ShortCodeExists(ctx context.Context, code string) (bool, error)
+	ReserveAliases(ctx context.Context, codes []string, owner string) (map[string]bool, error)
+	IsReserved(ctx context.Context, code string) (bool, error)
+	ClaimCaseFold(ctx context.Context, code string) (bool, error)
+	Denylisted(ctx context.Context, entries []string) (bool, error)
+	ShortCodeExistsBatch(ctx context.Context, codes []string) (map[string]bool, error)
+	AddTags(ctx context.Context, code string, tags []string) error
+	RemoveTags(ctx context.Context, code string, tags []string) error
+	CodesByTags(ctx context.Context, tags []string) ([]string, error)
+	CodesByGroup(ctx context.Context, group string) ([]string, error)
+	CodesByCampaign(ctx context.Context, campaign string) ([]string, error)
+	SearchDestinations(ctx context.Context, query string, limit int) ([]string, error)
+	ListGroups(ctx context.Context) ([]string, error)
+	SetMetadata(ctx context.Context, code, title, description, image string) error
+	SetDestinationHealth(ctx context.Context, code string, health DestinationHealth) error
+	RotateCode(ctx context.Context, oldCode, newCode string) error
+	RefreshTTL(ctx context.Context, code string) (bool, error)
+	SetExpiration(ctx context.Context, code string, ttl time.Duration) error
+	UpdateLink(ctx context.Context, code string, update LinkUpdate) error
+	RecordReferrer(ctx context.Context, code, referrer string) error
+	CountOwnerLinks(ctx context.Context, owner string) (int64, error)
+	GetOwnerQuota(ctx context.Context, owner string) (int64, bool, error)
+	SetOwnerQuota(ctx context.Context, owner string, limit int64) error
+	PublishClick(ctx context.Context, event ClickEvent) error
+	SubscribeClicks(ctx context.Context, code string) (<-chan ClickEvent, error)
+	GetReferrers(ctx context.Context, code string, top int) (ReferrerStats, error)
+	RecordCountry(ctx context.Context, code, country string) error
+	GetCountries(ctx context.Context, code string) (map[string]int64, error)
+	GetSummary(ctx context.Context) (Summary, error)
+	GetHistory(ctx context.Context, code string) ([]HistoryEvent, error)
+	AllowRequest(ctx context.Context, key string, limit int64, window time.Duration) (bool, time.Duration, error)
+	Close() error
 }
 
 type service struct {
 	redis *redis.Client
+
+	// hashKeys stores codes in key names as digests, keyed by keySecret when
+	// one is set, so the keyspace does not list live codes.
+	hashKeys  bool
+	keySecret []byte
+
+	// urls encrypts the stored destination; nil stores it in plain text.
+	urls *urlCipher
+
+	// trackExpiry keeps an expiry record for every expiring link, which the
+	// listener uses to clean up after it; see listenForExpiry.
+	trackExpiry  bool
+	stopListener context.CancelFunc
+	listener     sync.WaitGroup
+
+	// dependencies are Redis databases besides the primary store that Health
+	// reports on, such as a separate analytics database.
+	dependencies []healthDependency
 }
 
 var (
@@ -53,93 +757,660 @@ var (
 	database = os.Getenv("BLUEPRINT_DB_DATABASE")
 )
 
+// Options configures a Service. Zero pool sizes and timeouts keep the
+// go-redis defaults.
+type Options struct {
+	Addr     string
+	Password string
+	DB       int
+
+	PoolSize     int
+	MinIdleConns int
+	PoolTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// HashKeys stores codes in key names as digests, keyed by KeySecret when
+	// it is set.
+	HashKeys  bool
+	KeySecret string
+
+	// EncryptionKey enables encryption of stored destinations, as
+	// {id}:{base64 AES key}; OldEncryptionKeys are retired keys kept for
+	// decryption.
+	EncryptionKey     string
+	OldEncryptionKeys []string
+
+	// TrackExpiry records what each expiring link leaves behind and starts a
+	// listener that cleans up after it once Redis expires it. It needs
+	// notify-keyspace-events to include Ex on the Redis server and should be
+	// set on every instance sharing the database.
+	TrackExpiry bool
+
+	// HealthDependencies are further Redis servers the service relies on,
+	// such as a separate analytics database, as redis:// URLs by name. Health
+	// reports each under keys prefixed with its name.
+	HealthDependencies map[string]string
+}
+
+// OptionsFromEnv reads Options from the BLUEPRINT_DB_* and URL_ENCRYPTION*
+// environment variables. An unset database number selects database 0.
+func OptionsFromEnv() (Options, error) {
+	num := 0
+	if database != "" {
+		var err error
+		if num, err = strconv.Atoi(database); err != nil {
+			return Options{}, fmt.Errorf("database incorrect %v", err)
+		}
+	}
+
+	opts := Options{
+		Addr:     fmt.Sprintf("%s:%s", address, port),
+		Password: password,
+		DB:       num,
+
+		PoolSize:     envInt("BLUEPRINT_DB_POOL_SIZE"),
+		MinIdleConns: envInt("BLUEPRINT_DB_MIN_IDLE_CONNS"),
+		PoolTimeout:  envDuration("BLUEPRINT_DB_POOL_TIMEOUT"),
+		ReadTimeout:  envDuration("BLUEPRINT_DB_READ_TIMEOUT"),
+		WriteTimeout: envDuration("BLUEPRINT_DB_WRITE_TIMEOUT"),
+
+		HashKeys:  envBool("BLUEPRINT_DB_HASH_KEYS"),
+		KeySecret: os.Getenv("BLUEPRINT_DB_HASH_KEYS_SECRET"),
+
+		TrackExpiry: envBool("BLUEPRINT_DB_TRACK_EXPIRY"),
+	}
+
+	for _, entry := range strings.Split(os.Getenv("BLUEPRINT_DB_HEALTH_DEPENDENCIES"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, url, ok := strings.Cut(entry, "=")
+		if !ok {
+			return Options{}, fmt.Errorf("BLUEPRINT_DB_HEALTH_DEPENDENCIES entry %q: want name=redis://host:port", entry)
+		}
+		if opts.HealthDependencies == nil {
+			opts.HealthDependencies = make(map[string]string)
+		}
+		opts.HealthDependencies[strings.TrimSpace(name)] = strings.TrimSpace(url)
+	}
+
+	if envBool("URL_ENCRYPTION") {
+		opts.EncryptionKey = os.Getenv("URL_ENCRYPTION_KEY")
+		if opts.EncryptionKey == "" {
+			return Options{}, errors.New("URL_ENCRYPTION_KEY is required when URL_ENCRYPTION is enabled")
+		}
+		for _, entry := range strings.Split(os.Getenv("URL_ENCRYPTION_OLD_KEYS"), ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				opts.OldEncryptionKeys = append(opts.OldEncryptionKeys, entry)
+			}
+		}
+	}
+
+	return opts, nil
+}
+
+// New connects to Redis as configured by the environment, exiting the
+// process when the configuration is invalid.
 func New() Service {
-	num, err := strconv.Atoi(database)
+	opts, err := OptionsFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv, err := NewWithOptions(opts)
 	if err != nil {
-		log.Fatalf("database incorrect %v", err)
+		log.Fatal(err)
+	}
+	return srv
+}
+
+// NewWithOptions returns a Service for the Redis server described by opts.
+// The connection is made lazily, so an unreachable server is not an error
+// here.
+func NewWithOptions(opts Options) (Service, error) {
+	if opts.DB < 0 {
+		return nil, fmt.Errorf("database must not be negative, got %d", opts.DB)
 	}
 
-	fullAddress := fmt.Sprintf("%s:%s", address, port)
+	var urls *urlCipher
+	if opts.EncryptionKey != "" {
+		var err error
+		if urls, err = newURLCipher(opts.EncryptionKey, opts.OldEncryptionKeys...); err != nil {
+			return nil, fmt.Errorf("url encryption: %w", err)
+		}
+	}
 
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     fullAddress,
-		Password: password,
-		DB:       num,
-	})
+	var dependencies []healthDependency
+	for _, name := range slices.Sorted(maps.Keys(opts.HealthDependencies)) {
+		if !validDependencyName(name) {
+			return nil, fmt.Errorf("health dependency %q: name must be lowercase letters, digits, or underscores, and not redis", name)
+		}
+		clientOpts, err := redis.ParseURL(opts.HealthDependencies[name])
+		if err != nil {
+			return nil, fmt.Errorf("health dependency %s: %w", name, err)
+		}
+		dependencies = append(dependencies, healthDependency{name: name, client: redis.NewClient(clientOpts)})
+	}
 
-	return &service{redis: rdb}
+	srv := &service{
+		redis:        redis.NewClient(opts.clientOptions()),
+		hashKeys:     opts.HashKeys,
+		keySecret:    []byte(opts.KeySecret),
+		urls:         urls,
+		trackExpiry:  opts.TrackExpiry,
+		dependencies: dependencies,
+	}
+	if srv.trackExpiry {
+		srv.startExpiryListener()
+	}
+	return srv, nil
 }
 
-func shortURLKey(code string) string {
-	return shortURLKeyPrefix + code
+func (opts Options) clientOptions() *redis.Options {
+	return &redis.Options{
+		Addr:     opts.Addr,
+		Password: opts.Password,
+		DB:       opts.DB,
+
+		PoolSize:     opts.PoolSize,
+		MinIdleConns: opts.MinIdleConns,
+		PoolTimeout:  opts.PoolTimeout,
+		ReadTimeout:  opts.ReadTimeout,
+		WriteTimeout: opts.WriteTimeout,
+	}
 }
 
-func (s *service) CreateShortURL(ctx context.Context, code, longURL string, ttl time.Duration) error {
-	key := shortURLKey(code)
-	createdAt := time.Now().UTC().Format(time.RFC3339Nano)
+// envBool reports whether the named environment variable is set to a true
+// value as understood by strconv.ParseBool.
+func envBool(key string) bool {
+	enabled, err := strconv.ParseBool(os.Getenv(key))
+	return err == nil && enabled
+}
 
-	created, err := s.redis.HSetNX(ctx, key, "url", longURL).Result()
-	if err != nil {
-		return fmt.Errorf("create short url: %w", err)
+// envInt returns the positive integer in the named environment variable, or 0
+// when it is unset or invalid.
+func envInt(key string) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return 0
 	}
-	if !created {
-		return ErrConflict
+	parsed, err := strconv.Atoi(v)
+	if err != nil || parsed <= 0 {
+		log.Printf("ignoring %s=%q: want a positive integer", key, v)
+		return 0
+	}
+	return parsed
+}
+
+// envDuration returns the positive duration in the named environment
+// variable, or 0 when it is unset or invalid.
+func envDuration(key string) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return 0
+	}
+	parsed, err := time.ParseDuration(v)
+	if err != nil || parsed <= 0 {
+		log.Printf("ignoring %s=%q: want a positive duration such as 3s", key, v)
+		return 0
+	}
+	return parsed
+}
+
+// storedCode is how code appears in Redis key names: the code itself, or its
+// hex-encoded SHA-256 (HMAC-SHA-256 with a secret) when key hashing is on.
+func (s *service) storedCode(code string) string {
+	if !s.hashKeys {
+		return code
+	}
+	var sum []byte
+	if len(s.keySecret) > 0 {
+		mac := hmac.New(sha256.New, s.keySecret)
+		mac.Write([]byte(code))
+		sum = mac.Sum(nil)
+	} else {
+		digest := sha256.Sum256([]byte(code))
+		sum = digest[:]
 	}
+	return hex.EncodeToString(sum)
+}
+
+func (s *service) shortURLKey(code string) string {
+	return shortURLKeyPrefix + s.storedCode(code)
+}
+
+func (s *service) referrerKey(code string) string {
+	return referrerKeyPrefix + s.storedCode(code)
+}
+
+func (s *service) geoKey(code string) string {
+	return geoKeyPrefix + s.storedCode(code)
+}
+
+func (s *service) clicksChannel(code string) string {
+	return clicksChannelPrefix + s.storedCode(code)
+}
+
+func (s *service) expiringKey(code string) string {
+	return expiringKeyPrefix + s.storedCode(code)
+}
+
+func (s *service) historyKey(code string) string {
+	return historyKeyPrefix + s.storedCode(code)
+}
+
+func (s *service) burstKey(code, visitor string) string {
+	return burstKeyPrefix + s.storedCode(code) + ":" + visitor
+}
+
+func tagKey(tag string) string {
+	return tagKeyPrefix + tag
+}
+
+func ownerKey(owner string) string {
+	return ownerKeyPrefix + owner
+}
+
+func quotaKey(owner string) string {
+	return quotaKeyPrefix + owner
+}
+
+func groupKey(group string) string {
+	return groupKeyPrefix + group
+}
+
+func campaignKey(campaign string) string {
+	return campaignKeyPrefix + campaign
+}
+
+func hostKey(host string) string {
+	return hostKeyPrefix + host
+}
 
-	if _, err := s.redis.HSet(ctx, key,
-		"created_at", createdAt,
+// CreateShortURL stores a new short URL in a single scripted round trip, so the
+// key never exists without its metadata, TTL, or index entries. It returns
+// ErrConflict if the code is already taken and ErrQuotaExceeded if the owner
+// is at opts.OwnerLimit.
+func (s *service) CreateShortURL(ctx context.Context, code, longURL string, opts CreateOptions) error {
+	storedURL, err := s.sealURL(longURL)
+	if err != nil {
+		return fmt.Errorf("encrypt long url: %w", err)
+	}
+	fields := []any{
+		"url", storedURL,
+		"created_at", time.Now().UTC().Format(time.RFC3339Nano),
 		"visits", 0,
-	).Result(); err != nil {
-		return fmt.Errorf("create short url metadata: %w", err)
+	}
+	if opts.Title != "" {
+		fields = append(fields, "title", opts.Title)
+	}
+	if opts.Description != "" {
+		fields = append(fields, "description", opts.Description)
+	}
+	if opts.Owner != "" {
+		fields = append(fields, "owner", opts.Owner)
+	}
+	if opts.ManagementTokenHash != "" {
+		fields = append(fields, "management_token_hash", opts.ManagementTokenHash)
+	}
+	if opts.OneTime {
+		fields = append(fields, "one_time", 1)
+	}
+	if opts.ForwardQuery {
+		fields = append(fields, "forward_query", 1)
+	}
+	if opts.RequireHTTPS {
+		fields = append(fields, "require_https", 1)
+	}
+	if opts.InterstitialSeconds > 0 {
+		fields = append(fields, "interstitial_seconds", opts.InterstitialSeconds)
+	}
+	if len(opts.Variants) > 0 {
+		variants, err := s.sealVariants(opts.Variants)
+		if err != nil {
+			return fmt.Errorf("encrypt variants: %w", err)
+		}
+		fields = append(fields, "variants", variants)
+		if opts.StickyVariants {
+			fields = append(fields, "sticky_variants", 1)
+		}
+	}
+	if !opts.StartsAt.IsZero() {
+		fields = append(fields, "starts_at", opts.StartsAt.UnixMilli())
+	}
+	if opts.TTL > 0 && opts.Sliding {
+		fields = append(fields, "sliding", 1, "ttl_seconds", int64(opts.TTL/time.Second))
 	}
 
-	if ttl > 0 {
-		if err := s.redis.Expire(ctx, key, ttl).Err(); err != nil {
-			return fmt.Errorf("set short url ttl: %w", err)
+	keys := []string{s.shortURLKey(code), groupsKey, summaryKey, s.expiringKey(code), hostsKey}
+	var ownerLimit int64
+	if opts.Owner != "" {
+		keys = append(keys, ownerKey(opts.Owner))
+		ownerLimit = max(opts.OwnerLimit, 0)
+	}
+	tags := mergeTags(nil, opts.Tags)
+	if len(tags) > 0 {
+		fields = append(fields, "tags", strings.Join(tags, ","))
+		for _, tag := range tags {
+			keys = append(keys, tagKey(tag))
 		}
 	}
+	if opts.Group != "" {
+		fields = append(fields, "group", opts.Group)
+		keys = append(keys, groupKey(opts.Group))
+	}
+	if opts.Campaign != "" {
+		fields = append(fields, "campaign", opts.Campaign)
+		keys = append(keys, campaignKey(opts.Campaign))
+	}
+	host := s.indexedHost(longURL)
+	if host != "" {
+		fields = append(fields, "host", host)
+		keys = append(keys, hostKey(host))
+	}
+
+	args := append([]any{code, opts.TTL.Milliseconds(), opts.Group, s.trackExpiry, opts.FillReservation, opts.Owner, host, ownerLimit}, fields...)
+	created, err := withRetry(ctx, func() (int, error) {
+		return createScript.Run(ctx, s.redis, keys, args...).Int()
+	})
+	if err != nil {
+		return fmt.Errorf("create short url: %w", err)
+	}
+	switch created {
+	case 0:
+		return ErrConflict
+	case -1:
+		return ErrQuotaExceeded
+	}
 
+	s.recordEvent(ctx, code, EventCreate)
 	return nil
 }
 
+// GetLongURL resolves code to its target URL. Resolving a one-time link
+// consumes it: exactly one caller gets the URL and the rest get ErrGone.
 func (s *service) GetLongURL(ctx context.Context, code string) (string, error) {
-	url, err := s.redis.HGet(ctx, shortURLKey(code), "url").Result()
+	resolved, err := s.ResolveURL(ctx, code)
+	if err != nil {
+		return "", err
+	}
+	return resolved.URL, nil
+}
+
+// GetLongURLs looks up the target URLs of many codes in one pipelined round
+// trip. Unlike GetLongURL it does not count visits, so one-time links are
+// left out of the result rather than handing their destination out without
+// consuming them, along with missing, reserved, disabled, and not yet
+// active codes.
+func (s *service) GetLongURLs(ctx context.Context, codes []string) (map[string]string, error) {
+	result := make(map[string]string, len(codes))
+	if len(codes) == 0 {
+		return result, nil
+	}
+
+	pipe := s.redis.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(codes))
+	for i, code := range codes {
+		cmds[i] = pipe.HMGet(ctx, s.shortURLKey(code), "url", "one_time", "starts_at", "disabled")
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("get long urls: %w", err)
+	}
+	now := time.Now()
+
+	for i, code := range codes {
+		values := cmds[i].Val()
+		stored, _ := values[0].(string)
+		if stored == "" || values[1] == "1" || values[3] == "1" || notActive(values[2], now) {
+			continue
+		}
+		longURL, err := s.openURL(stored)
+		if err != nil {
+			return nil, fmt.Errorf("get long urls: %w", err)
+		}
+		result[code] = longURL
+	}
+	return result, nil
+}
+
+// notActive reports whether a stored starts_at, in Unix milliseconds, is
+// still after now.
+func notActive(startsAt any, now time.Time) bool {
+	raw, _ := startsAt.(string)
+	ms, err := strconv.ParseInt(raw, 10, 64)
+	return err == nil && ms > now.UnixMilli()
+}
+
+// ResolveURL is GetLongURL plus the expiry details the redirect path uses to
+// choose caching headers, fetched in the same round trip.
+func (s *service) ResolveURL(ctx context.Context, code string) (ResolvedURL, error) {
+	result, err := withRetry(ctx, func() (any, error) {
+		return resolveScript.Run(ctx, s.redis, []string{s.shortURLKey(code)}, time.Now().UnixMilli()).Result()
+	})
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			return "", ErrNotFound
+			return ResolvedURL{}, ErrNotFound
 		}
-		return "", fmt.Errorf("get long url: %w", err)
+		return ResolvedURL{}, fmt.Errorf("get long url: %w", err)
+	}
+	if result == int64(-1) {
+		return ResolvedURL{}, ErrNotActive
+	}
+
+	values, ok := result.([]any)
+	if !ok || len(values) != 4 {
+		return ResolvedURL{}, ErrGone
 	}
 
-	return url, nil
+	resolved := parseResolved(values)
+	if resolved.URL, err = s.openURL(resolved.URL); err != nil {
+		return ResolvedURL{}, fmt.Errorf("get long url: %w", err)
+	}
+	return resolved, nil
 }
 
-func (s *service) IncrementVisits(ctx context.Context, code string) (int64, error) {
-	exists, err := s.ShortCodeExists(ctx, code)
+// VisitURL resolves code and records a visit to it in a single scripted
+// round trip: the visit count, the referrer and country breakdowns, and the
+// sliding TTL are all updated together. One-time links are consumed exactly as
+// with ResolveURL. Visits over the visitor's burst limit are resolved without
+// being counted, and RequireHTTPS links refuse PlainHTTP visits with
+// ErrInsecure.
+func (s *service) VisitURL(ctx context.Context, code string, visit Visit) (ResolvedURL, error) {
+	maxBurst := visit.MaxBurst
+	if visit.Visitor == "" || visit.BurstWindow <= 0 {
+		maxBurst = 0
+	}
+	keys := []string{
+		s.shortURLKey(code), s.referrerKey(code), s.geoKey(code), s.burstKey(code, visit.Visitor),
+		summaryKey, s.expiringKey(code), s.historyKey(code),
+	}
+	args := []any{
+		visit.Referrer, visit.Country, maxBurst, visit.BurstWindow.Milliseconds(), visitWeight(visit.SampleRate),
+		time.Now().UnixMilli(), visit.PlainHTTP,
+		strconv.FormatFloat(visit.VariantRoll, 'f', -1, 64), strconv.FormatFloat(visit.StickyRoll, 'f', -1, 64),
+	}
+	result, err := withRetry(ctx, func() (any, error) {
+		return visitScript.Run(ctx, s.redis, keys, args...).Result()
+	})
 	if err != nil {
-		return 0, err
+		if errors.Is(err, redis.Nil) {
+			return ResolvedURL{}, ErrNotFound
+		}
+		return ResolvedURL{}, fmt.Errorf("visit url: %w", err)
 	}
-	if !exists {
-		return 0, ErrNotFound
+	if result == int64(-1) {
+		return ResolvedURL{}, ErrNotActive
+	}
+	if result == int64(-2) {
+		return ResolvedURL{}, ErrInsecure
 	}
 
-	visits, err := s.redis.HIncrBy(ctx, shortURLKey(code), "visits", 1).Result()
+	values, ok := result.([]any)
+	if !ok || len(values) != 8 {
+		return ResolvedURL{}, ErrGone
+	}
+
+	resolved := parseResolved(values)
+	if resolved.URL, err = s.openURL(resolved.URL); err != nil {
+		return ResolvedURL{}, fmt.Errorf("visit url: %w", err)
+	}
+	resolved.Visits, _ = values[4].(int64)
+	counted, _ := values[5].(int64)
+	resolved.Counted = counted == 1
+	interstitial, _ := values[6].(int64)
+	resolved.InterstitialSeconds = int(interstitial)
+	variant, _ := values[7].(int64)
+	resolved.Variant = int(variant)
+	return resolved, nil
+}
+
+// visitWeight is how many visits one visit counts as at sampleRate: 1 when
+// every visit counts, otherwise sampleRate with probability 1/sampleRate and
+// 0 the rest of the time, which keeps the expected total exact.
+func visitWeight(sampleRate int) int {
+	if sampleRate <= 1 {
+		return 1
+	}
+	if rand.IntN(sampleRate) != 0 {
+		return 0
+	}
+	return sampleRate
+}
+
+// parseResolved reads the {url, pttl, oneTime, forward} prefix shared by the
+// resolve and visit scripts.
+func parseResolved(values []any) ResolvedURL {
+	url, _ := values[0].(string)
+	ttl, _ := values[1].(int64)
+	oneTime, _ := values[2].(int64)
+	forward, _ := values[3].(int64)
+
+	resolved := ResolvedURL{URL: url, OneTime: oneTime == 1, ForwardQuery: forward == 1, Variant: -1}
+	if ttl > 0 {
+		resolved.TTL = time.Duration(ttl) * time.Millisecond
+	}
+	return resolved
+}
+
+func (s *service) IncrementVisits(ctx context.Context, code string) (int64, error) {
+	visits, err := withRetry(ctx, func() (int64, error) {
+		return incrVisitsIfExistsScript.Run(ctx, s.redis, s.visitCountKeys(code), 1).Int64()
+	})
 	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, ErrNotFound
+		}
 		return 0, fmt.Errorf("increment visits: %w", err)
 	}
 	return visits, nil
 }
 
-func (s *service) GetStats(ctx context.Context, code string) (URLStats, error) {
-	key := shortURLKey(code)
-	values, err := s.redis.HGetAll(ctx, key).Result()
+// IncrementVisitsBy adds delta to the visit count of an existing code and
+// returns the new total.
+func (s *service) IncrementVisitsBy(ctx context.Context, code string, delta int64) (int64, error) {
+	visits, err := incrVisitsIfExistsScript.Run(ctx, s.redis, s.visitCountKeys(code), delta).Int64()
 	if err != nil {
-		return URLStats{}, fmt.Errorf("get stats: %w", err)
+		if errors.Is(err, redis.Nil) {
+			return 0, ErrNotFound
+		}
+		return 0, fmt.Errorf("increment visits: %w", err)
+	}
+	return visits, nil
+}
+
+// visitCountKeys are the keys incrVisitsIfExistsScript updates for code.
+func (s *service) visitCountKeys(code string) []string {
+	return []string{s.shortURLKey(code), summaryKey, s.expiringKey(code)}
+}
+
+// IncrementVisitsBatch applies many visit deltas in one pipelined round trip
+// and returns the new totals. Codes that do not exist are left out of the
+// result rather than failing the batch.
+func (s *service) IncrementVisitsBatch(ctx context.Context, deltas map[string]int64) (map[string]int64, error) {
+	if len(deltas) == 0 {
+		return map[string]int64{}, nil
+	}
+	if err := incrVisitsIfExistsScript.Load(ctx, s.redis).Err(); err != nil {
+		return nil, fmt.Errorf("load increment script: %w", err)
+	}
+
+	pipe := s.redis.Pipeline()
+	cmds := make(map[string]*redis.Cmd, len(deltas))
+	for code, delta := range deltas {
+		cmds[code] = incrVisitsIfExistsScript.EvalSha(ctx, pipe, s.visitCountKeys(code), delta)
 	}
-	if len(values) == 0 {
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("increment visits batch: %w", err)
+	}
+
+	totals := make(map[string]int64, len(deltas))
+	for code, cmd := range cmds {
+		visits, err := cmd.Int64()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("increment visits for %s: %w", code, err)
+		}
+		totals[code] = visits
+	}
+	return totals, nil
+}
+
+// VisitCounts reads the visit counts of many codes in one pipelined round
+// trip. Codes without a link, including reservations, are left out of the
+// result, so its size is the number of live links.
+func (s *service) VisitCounts(ctx context.Context, codes []string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(codes))
+	if len(codes) == 0 {
+		return counts, nil
+	}
+
+	pipe := s.redis.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(codes))
+	for i, code := range codes {
+		cmds[i] = pipe.HMGet(ctx, s.shortURLKey(code), "url", "visits")
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("visit counts: %w", err)
+	}
+
+	for i, code := range codes {
+		values := cmds[i].Val()
+		if values[0] == nil {
+			continue
+		}
+		raw, _ := values[1].(string)
+		counts[code], _ = strconv.ParseInt(raw, 10, 64)
+	}
+	return counts, nil
+}
+
+// GetStats reads a link's hash and TTL in one pipelined round trip. A
+// missing key is not an error to Redis: it shows up as an empty hash, which
+// is reported as ErrNotFound, while any failed command fails the call.
+func (s *service) GetStats(ctx context.Context, code string) (URLStats, error) {
+	key := s.shortURLKey(code)
+
+	pipe := s.redis.Pipeline()
+	hash := pipe.HGetAll(ctx, key)
+	ttl := pipe.TTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		if hash.Err() != nil {
+			return URLStats{}, fmt.Errorf("get stats: %w", hash.Err())
+		}
+		return URLStats{}, fmt.Errorf("get ttl: %w", err)
+	}
+
+	values := hash.Val()
+	if len(values) == 0 || values["state"] == stateReserved {
 		return URLStats{}, ErrNotFound
 	}
+	return s.statsFromHash(code, values, ttl.Val())
+}
 
+// statsFromHash builds URLStats from a link hash and its remaining TTL.
+func (s *service) statsFromHash(code string, values map[string]string, ttl time.Duration) (URLStats, error) {
 	createdAt, err := time.Parse(time.RFC3339Nano, values["created_at"])
 	if err != nil {
 		return URLStats{}, fmt.Errorf("parse created_at: %w", err)
@@ -150,120 +1421,942 @@ func (s *service) GetStats(ctx context.Context, code string) (URLStats, error) {
 		return URLStats{}, fmt.Errorf("parse visits: %w", err)
 	}
 
-	ttl, err := s.redis.TTL(ctx, key).Result()
+	longURL, err := s.openURL(values["url"])
 	if err != nil {
-		return URLStats{}, fmt.Errorf("get ttl: %w", err)
+		return URLStats{}, fmt.Errorf("get stats: %w", err)
 	}
 
 	stats := URLStats{
 		Code:      code,
-		LongURL:   values["url"],
+		LongURL:   longURL,
 		CreatedAt: createdAt,
 		Visits:    visits,
+		Tags:      splitTags(values["tags"]),
+		Sliding:   values["sliding"] == "1",
+		OneTime:   values["one_time"] == "1",
+		Consumed:  values["consumed"] == "1",
+		Disabled:  values["disabled"] == "1",
+		Sampled:   values["sampled"] == "1",
+
+		ForwardQuery: values["forward_query"] == "1",
+		RequireHTTPS: values["require_https"] == "1",
+
+		Title:       values["title"],
+		Description: values["description"],
+		Image:       values["image"],
+
+		Group:    values["group"],
+		Owner:    values["owner"],
+		Campaign: values["campaign"],
+	}
+	stats.InterstitialSeconds, _ = strconv.Atoi(values["interstitial_seconds"])
+	if values["variants"] != "" {
+		if stats.Variants, err = s.openVariants(values["variants"]); err != nil {
+			return URLStats{}, fmt.Errorf("get stats: %w", err)
+		}
+		for i := range stats.Variants {
+			stats.Variants[i].Visits, _ = strconv.ParseInt(values[variantVisitsField(i)], 10, 64)
+		}
+		stats.StickyVariants = values["sticky_variants"] == "1"
 	}
 
 	if ttl > 0 {
 		expiresAt := time.Now().UTC().Add(ttl)
 		stats.ExpiresAt = &expiresAt
+		seconds := int64(ttl / time.Second)
+		stats.TTLSeconds = &seconds
+	}
+
+	if ms, err := strconv.ParseInt(values["starts_at"], 10, 64); err == nil {
+		startsAt := time.UnixMilli(ms).UTC()
+		stats.StartsAt = &startsAt
+	}
+
+	if checkedAt, err := time.Parse(time.RFC3339Nano, values["dest_checked_at"]); err == nil {
+		status, _ := strconv.Atoi(values["dest_status"])
+		stats.Destination = &DestinationHealth{
+			Status:    status,
+			Error:     values["dest_error"],
+			Healthy:   values["dest_healthy"] == "1",
+			CheckedAt: checkedAt,
+		}
 	}
 
 	return stats, nil
 }
 
+// GetRaw returns every field stored in the code's hash, unfiltered, plus the
+// key's remaining TTL (negative when the key never expires). It is meant for
+// debugging; callers must redact secrets before exposing the result.
+func (s *service) GetRaw(ctx context.Context, code string) (map[string]string, time.Duration, error) {
+	key := s.shortURLKey(code)
+
+	pipe := s.redis.Pipeline()
+	fields := pipe.HGetAll(ctx, key)
+	ttl := pipe.TTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, 0, fmt.Errorf("get raw short url: %w", err)
+	}
+	if len(fields.Val()) == 0 {
+		return nil, 0, ErrNotFound
+	}
+
+	return fields.Val(), ttl.Val(), nil
+}
+
 func (s *service) DeleteShortURL(ctx context.Context, code string) error {
-	removed, err := s.redis.Del(ctx, shortURLKey(code)).Result()
+	key := s.shortURLKey(code)
+	values, err := s.redis.HMGet(ctx, key, "tags", "owner", "group", "campaign", "host").Result()
+	if err != nil {
+		return fmt.Errorf("get short url indexes: %w", err)
+	}
+	tags, _ := values[0].(string)
+	owner, _ := values[1].(string)
+	group, _ := values[2].(string)
+	campaign, _ := values[3].(string)
+	host, _ := values[4].(string)
+
+	keys := []string{key, s.referrerKey(code), s.geoKey(code), summaryKey, s.expiringKey(code), s.historyKey(code), caseFoldsKey}
+	for _, tag := range splitTags(tags) {
+		keys = append(keys, tagKey(tag))
+	}
+	if owner != "" {
+		keys = append(keys, ownerKey(owner))
+	}
+	if group != "" {
+		keys = append(keys, groupKey(group))
+	}
+	if campaign != "" {
+		keys = append(keys, campaignKey(campaign))
+	}
+	if host != "" {
+		keys = append(keys, hostKey(host))
+	}
+	field, holder := s.caseFold(code)
+	deleted, err := withRetry(ctx, func() (int, error) {
+		return deleteScript.Run(ctx, s.redis, keys, code, field, holder).Int()
+	})
 	if err != nil {
 		return fmt.Errorf("delete short url: %w", err)
 	}
-	if removed == 0 {
+	if deleted == 0 {
 		return ErrNotFound
 	}
 
 	return nil
 }
 
+// RotateCode moves a link, with its visits, analytics and index entries, from
+// oldCode to newCode. The old code stops resolving. It returns ErrNotFound
+// when oldCode is missing and ErrConflict when newCode is already taken.
+func (s *service) RotateCode(ctx context.Context, oldCode, newCode string) error {
+	values, err := s.redis.HMGet(ctx, s.shortURLKey(oldCode), "tags", "owner", "group", "campaign", "host").Result()
+	if err != nil {
+		return fmt.Errorf("get short url indexes: %w", err)
+	}
+	tags, _ := values[0].(string)
+	owner, _ := values[1].(string)
+	group, _ := values[2].(string)
+	campaign, _ := values[3].(string)
+	host, _ := values[4].(string)
+
+	keys := []string{
+		s.shortURLKey(oldCode), s.shortURLKey(newCode),
+		s.referrerKey(oldCode), s.referrerKey(newCode),
+		s.geoKey(oldCode), s.geoKey(newCode),
+		s.expiringKey(oldCode), s.expiringKey(newCode),
+		s.historyKey(oldCode), s.historyKey(newCode),
+		caseFoldsKey,
+	}
+	for _, tag := range splitTags(tags) {
+		keys = append(keys, tagKey(tag))
+	}
+	if owner != "" {
+		keys = append(keys, ownerKey(owner))
+	}
+	if group != "" {
+		keys = append(keys, groupKey(group))
+	}
+	if campaign != "" {
+		keys = append(keys, campaignKey(campaign))
+	}
+	if host != "" {
+		keys = append(keys, hostKey(host))
+	}
+
+	oldField, oldHolder := s.caseFold(oldCode)
+	newField, newHolder := s.caseFold(newCode)
+	rotated, err := withRetry(ctx, func() (int, error) {
+		return rotateScript.Run(ctx, s.redis, keys, oldCode, newCode, oldField, oldHolder, newField, newHolder).Int()
+	})
+	if err != nil {
+		return fmt.Errorf("rotate short code: %w", err)
+	}
+	switch rotated {
+	case 0:
+		return ErrNotFound
+	case -1:
+		return ErrConflict
+	}
+	s.recordEvent(ctx, newCode, EventRotate)
+	return nil
+}
+
 func (s *service) ShortCodeExists(ctx context.Context, code string) (bool, error) {
-	exists, err := s.redis.Exists(ctx, shortURLKey(code)).Result()
+	exists, err := s.redis.Exists(ctx, s.shortURLKey(code)).Result()
 	if err != nil {
 		return false, fmt.Errorf("check short code exists: %w", err)
 	}
 	return exists == 1, nil
 }
 
-// Health returns the health status and statistics of the Redis server.
+// ReserveAliases holds every free code in codes for owner (empty for anyone)
+// without a destination, atomically. Reserved codes count as taken, and
+// toward owner's links, but do not resolve until CreateShortURL fills them
+// with FillReservation; unfilled reservations expire after ReservationTTL.
+// The result reports, per code, whether it was reserved (false when already
+// taken).
+func (s *service) ReserveAliases(ctx context.Context, codes []string, owner string) (map[string]bool, error) {
+	if len(codes) == 0 {
+		return map[string]bool{}, nil
+	}
+	keys := []string{ownerKey(owner)}
+	args := []any{time.Now().UTC().Format(time.RFC3339Nano), owner, ReservationTTL.Milliseconds()}
+	for _, code := range codes {
+		keys = append(keys, s.shortURLKey(code))
+		args = append(args, code)
+	}
+	results, err := withRetry(ctx, func() ([]int64, error) {
+		return reserveScript.Run(ctx, s.redis, keys, args...).Int64Slice()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reserve aliases: %w", err)
+	}
+
+	reserved := make(map[string]bool, len(codes))
+	for i, code := range codes {
+		// A code listed twice is reserved by its first entry.
+		reserved[code] = reserved[code] || results[i] == 1
+	}
+	return reserved, nil
+}
+
+// IsReserved reports whether code is held by a reservation that has not been
+// filled yet.
+func (s *service) IsReserved(ctx context.Context, code string) (bool, error) {
+	state, err := s.redis.HGet(ctx, s.shortURLKey(code), "state").Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("check reservation: %w", err)
+	}
+	return state == stateReserved, nil
+}
+
+// ClaimCaseFold records code as the holder of its lowercased form in the
+// short:folds hash, so later codes differing only in case can be refused. It
+// returns false, claiming nothing, while another existing link holds the
+// form. Deleting a link releases its form and rotating it moves the claim to
+// the new code; a holder that has since expired no longer counts, and its
+// field is taken over by the next claim. Checking and claiming are two steps:
+// two variants claimed at the same moment can both succeed.
+func (s *service) ClaimCaseFold(ctx context.Context, code string) (bool, error) {
+	field, holder := s.caseFold(code)
+	current, err := s.redis.HGet(ctx, caseFoldsKey, field).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return false, fmt.Errorf("claim case fold: %w", err)
+	}
+	if current != "" && current != holder {
+		exists, err := s.redis.Exists(ctx, shortURLKeyPrefix+current).Result()
+		if err != nil {
+			return false, fmt.Errorf("claim case fold: %w", err)
+		}
+		if exists == 1 {
+			return false, nil
+		}
+	}
+	if err := s.redis.HSet(ctx, caseFoldsKey, field, holder).Err(); err != nil {
+		return false, fmt.Errorf("claim case fold: %w", err)
+	}
+	return true, nil
+}
+
+// caseFold returns the short:folds field for code's lowercased form and the
+// value recording code as its holder, both as they appear in key names.
+func (s *service) caseFold(code string) (string, string) {
+	return s.storedCode(strings.ToLower(code)), s.storedCode(code)
+}
+
+// Denylisted reports whether any of entries is a member of the short:denylist
+// set, which is populated outside the service, in one SMISMEMBER.
+func (s *service) Denylisted(ctx context.Context, entries []string) (bool, error) {
+	if len(entries) == 0 {
+		return false, nil
+	}
+	members := make([]any, len(entries))
+	for i, entry := range entries {
+		members[i] = entry
+	}
+	found, err := s.redis.SMIsMember(ctx, denylistKey, members...).Result()
+	if err != nil {
+		return false, fmt.Errorf("check denylist: %w", err)
+	}
+	return slices.Contains(found, true), nil
+}
+
+// ShortCodeExistsBatch checks many codes in a single pipelined round trip and
+// returns whether each one exists.
+func (s *service) ShortCodeExistsBatch(ctx context.Context, codes []string) (map[string]bool, error) {
+	result := make(map[string]bool, len(codes))
+	if len(codes) == 0 {
+		return result, nil
+	}
+
+	pipe := s.redis.Pipeline()
+	cmds := make([]*redis.IntCmd, len(codes))
+	for i, code := range codes {
+		cmds[i] = pipe.Exists(ctx, s.shortURLKey(code))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("check short codes exist: %w", err)
+	}
+
+	for i, code := range codes {
+		result[code] = cmds[i].Val() == 1
+	}
+	return result, nil
+}
+
+// AddTags attaches tags to an existing short URL, recording them on the hash
+// and adding the code to each per-tag set. It returns ErrTooManyTags when the
+// link would end up with more than MaxTags.
+func (s *service) AddTags(ctx context.Context, code string, tags []string) error {
+	return s.retag(ctx, code, func(current []string) ([]string, error) {
+		merged := mergeTags(current, tags)
+		if len(merged) > MaxTags {
+			return nil, ErrTooManyTags
+		}
+		return merged, nil
+	})
+}
+
+// RemoveTags detaches tags from an existing short URL and drops the code from
+// each per-tag set.
+func (s *service) RemoveTags(ctx context.Context, code string, tags []string) error {
+	return s.retag(ctx, code, func(current []string) ([]string, error) {
+		return removeTags(current, tags), nil
+	})
+}
+
+// retag replaces a link's tags with what change makes of its current ones,
+// keeping the per-tag sets and the expiry record in step. Like UpdateLink it
+// watches the link while reading, so concurrent changes start over instead of
+// losing tags, and a link deleted or expired meanwhile is not recreated.
+func (s *service) retag(ctx context.Context, code string, change func(current []string) ([]string, error)) error {
+	key := s.shortURLKey(code)
+	apply := func(tx *redis.Tx) error {
+		values, err := tx.HMGet(ctx, key, "url", "tags").Result()
+		if err != nil {
+			return err
+		}
+		if values[0] == nil {
+			return ErrNotFound
+		}
+		raw, _ := values[1].(string)
+		current := splitTags(raw)
+		tags, err := change(current)
+		if err != nil {
+			return err
+		}
+
+		joined := strings.Join(tags, ",")
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if len(tags) == 0 {
+				pipe.HDel(ctx, key, "tags")
+			} else {
+				pipe.HSet(ctx, key, "tags", joined)
+			}
+			hsetIfExistsScript.Eval(ctx, pipe, []string{s.expiringKey(code)}, "tags", joined)
+			for _, tag := range current {
+				if !slices.Contains(tags, tag) {
+					pipe.SRem(ctx, tagKey(tag), code)
+				}
+			}
+			for _, tag := range tags {
+				pipe.SAdd(ctx, tagKey(tag), code)
+			}
+			s.queueEvent(ctx, pipe, code, EventUpdate)
+			return nil
+		})
+		return err
+	}
+
+	for range maxUpdateAttempts {
+		err := s.redis.Watch(ctx, apply, key)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrTooManyTags) {
+			return fmt.Errorf("update tags: %w", refusedWrite(err))
+		}
+		return err
+	}
+	return fmt.Errorf("update tags: %w", redis.TxFailedErr)
+}
+
+// CodesByTags returns the codes carrying every one of the given tags. Tag sets
+// are not expired alongside their links, so callers should expect codes that
+// no longer resolve.
+func (s *service) CodesByTags(ctx context.Context, tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = tagKey(tag)
+	}
+
+	codes, err := s.redis.SInter(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("codes by tags: %w", err)
+	}
+	sort.Strings(codes)
+	return codes, nil
+}
+
+// CodesByGroup returns the live codes filed under group, sorted. Codes whose
+// keys have expired are pruned from the group as a side effect.
+func (s *service) CodesByGroup(ctx context.Context, group string) ([]string, error) {
+	codes, err := s.liveMembers(ctx, groupKey(group))
+	if err != nil {
+		return nil, fmt.Errorf("codes by group: %w", err)
+	}
+	return codes, nil
+}
+
+// CodesByCampaign returns the live codes created in campaign, sorted, pruning
+// expired ones like CodesByGroup. It returns ErrNotFound once none are left.
+func (s *service) CodesByCampaign(ctx context.Context, campaign string) ([]string, error) {
+	codes, err := s.liveMembers(ctx, campaignKey(campaign))
+	if err != nil {
+		return nil, fmt.Errorf("codes by campaign: %w", err)
+	}
+	if len(codes) == 0 {
+		return nil, ErrNotFound
+	}
+	return codes, nil
+}
+
+// liveMembers returns the codes in the index set at key whose links still
+// exist, sorted, and removes the rest from the set.
+func (s *service) liveMembers(ctx context.Context, key string) ([]string, error) {
+	codes, err := s.redis.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := s.ShortCodeExistsBatch(ctx, codes)
+	if err != nil {
+		return nil, err
+	}
+
+	live := make([]string, 0, len(codes))
+	var stale []any
+	for _, code := range codes {
+		if exists[code] {
+			live = append(live, code)
+		} else {
+			stale = append(stale, code)
+		}
+	}
+
+	if len(stale) > 0 {
+		if err := s.redis.SRem(ctx, key, stale...).Err(); err != nil {
+			return nil, fmt.Errorf("prune stale codes: %w", err)
+		}
+	}
+
+	sort.Strings(live)
+	return live, nil
+}
+
+// ListGroups returns the names of groups that still hold links, sorted.
+// Names whose group set is gone are dropped from the index as a side effect.
+func (s *service) ListGroups(ctx context.Context) ([]string, error) {
+	names, err := s.redis.SMembers(ctx, groupsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("list groups: %w", err)
+	}
+	if len(names) == 0 {
+		return []string{}, nil
+	}
+
+	pipe := s.redis.Pipeline()
+	cmds := make([]*redis.IntCmd, len(names))
+	for i, name := range names {
+		cmds[i] = pipe.Exists(ctx, groupKey(name))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("list groups: %w", err)
+	}
+
+	groups := make([]string, 0, len(names))
+	keys := []string{groupsKey}
+	var empty []any
+	for i, name := range names {
+		if cmds[i].Val() == 1 {
+			groups = append(groups, name)
+		} else {
+			keys = append(keys, groupKey(name))
+			empty = append(empty, name)
+		}
+	}
+
+	if len(empty) > 0 {
+		if err := pruneGroupsScript.Run(ctx, s.redis, keys, empty...).Err(); err != nil {
+			return nil, fmt.Errorf("prune groups: %w", err)
+		}
+	}
+
+	sort.Strings(groups)
+	return groups, nil
+}
+
+// SetMetadata updates the title, description and preview image of an
+// existing short URL.
+// Empty values leave the corresponding field unchanged.
+func (s *service) SetMetadata(ctx context.Context, code, title, description, image string) error {
+	var fields []any
+	if title != "" {
+		fields = append(fields, "title", title)
+	}
+	if description != "" {
+		fields = append(fields, "description", description)
+	}
+	if image != "" {
+		fields = append(fields, "image", image)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	updated, err := hsetIfExistsScript.Run(ctx, s.redis, []string{s.shortURLKey(code)}, fields...).Int()
+	if err != nil {
+		return fmt.Errorf("set metadata: %w", err)
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetDestinationHealth stores the outcome of a destination check on an
+// existing short URL, replacing any earlier result.
+func (s *service) SetDestinationHealth(ctx context.Context, code string, health DestinationHealth) error {
+	healthy := 0
+	if health.Healthy {
+		healthy = 1
+	}
+	fields := []any{
+		"dest_status", health.Status,
+		"dest_error", health.Error,
+		"dest_healthy", healthy,
+		"dest_checked_at", health.CheckedAt.UTC().Format(time.RFC3339Nano),
+	}
+
+	updated, err := hsetIfExistsScript.Run(ctx, s.redis, []string{s.shortURLKey(code)}, fields...).Int()
+	if err != nil {
+		return fmt.Errorf("set destination health: %w", err)
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RefreshTTL resets a sliding-expiration link's TTL to its original length,
+// reporting whether a refresh happened. Links without sliding expiration or
+// without a TTL are left untouched.
+func (s *service) RefreshTTL(ctx context.Context, code string) (bool, error) {
+	refreshed, err := refreshTTLScript.Run(ctx, s.redis, []string{s.shortURLKey(code), s.referrerKey(code), s.geoKey(code), s.historyKey(code)}).Int()
+	if err != nil {
+		return false, fmt.Errorf("refresh ttl: %w", err)
+	}
+	return refreshed == 1, nil
+}
+
+// SetExpiration replaces the TTL of an existing short URL. A ttl <= 0 removes
+// the expiration entirely. The referrer and geo keys follow the same expiry.
+func (s *service) SetExpiration(ctx context.Context, code string, ttl time.Duration) error {
+	keys := []string{s.shortURLKey(code), s.referrerKey(code), s.geoKey(code), s.expiringKey(code), s.historyKey(code)}
+	updated, err := withRetry(ctx, func() (int, error) {
+		return setExpirationScript.Run(ctx, s.redis, keys, ttl.Milliseconds(), code, s.trackExpiry).Int()
+	})
+	if err != nil {
+		return fmt.Errorf("set expiration: %w", err)
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+	s.recordEvent(ctx, code, EventUpdate)
+	return nil
+}
+
+// RecordReferrer counts a visit from referrer in the code's referrer sorted set
+// and keeps that set's expiry in line with the short URL itself.
+func (s *service) RecordReferrer(ctx context.Context, code, referrer string) error {
+	keys := []string{s.referrerKey(code), s.shortURLKey(code)}
+	if err := recordReferrerScript.Run(ctx, s.redis, keys, referrer).Err(); err != nil {
+		return fmt.Errorf("record referrer: %w", err)
+	}
+	return nil
+}
+
+// CountOwnerLinks returns how many live links owner has. Codes whose keys have
+// expired since they were added are pruned from the owner set as a side effect.
+func (s *service) CountOwnerLinks(ctx context.Context, owner string) (int64, error) {
+	key := ownerKey(owner)
+	codes, err := s.redis.SMembers(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("list owner links: %w", err)
+	}
+
+	exists, err := s.ShortCodeExistsBatch(ctx, codes)
+	if err != nil {
+		return 0, err
+	}
+
+	var live int64
+	var stale []any
+	for _, code := range codes {
+		if exists[code] {
+			live++
+		} else {
+			stale = append(stale, code)
+		}
+	}
+
+	if len(stale) > 0 {
+		if err := s.redis.SRem(ctx, key, stale...).Err(); err != nil {
+			return 0, fmt.Errorf("prune owner links: %w", err)
+		}
+	}
+
+	return live, nil
+}
+
+// GetOwnerQuota returns the per-owner link limit override, if one is set.
+func (s *service) GetOwnerQuota(ctx context.Context, owner string) (int64, bool, error) {
+	limit, err := s.redis.Get(ctx, quotaKey(owner)).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("get owner quota: %w", err)
+	}
+	return limit, true, nil
+}
+
+// SetOwnerQuota overrides the link limit for owner. A negative limit removes
+// the override so the global limit applies again.
+func (s *service) SetOwnerQuota(ctx context.Context, owner string, limit int64) error {
+	var err error
+	if limit < 0 {
+		err = s.redis.Del(ctx, quotaKey(owner)).Err()
+	} else {
+		err = s.redis.Set(ctx, quotaKey(owner), limit, 0).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("set owner quota: %w", err)
+	}
+	return nil
+}
+
+// PublishClick announces a visit on the code's clicks channel.
+func (s *service) PublishClick(ctx context.Context, event ClickEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encode click event: %w", err)
+	}
+	if err := s.redis.Publish(ctx, s.clicksChannel(event.Code), payload).Err(); err != nil {
+		return fmt.Errorf("publish click: %w", err)
+	}
+	return nil
+}
+
+// SubscribeClicks streams click events for code until ctx is cancelled, at
+// which point the subscription is closed and the returned channel with it.
+func (s *service) SubscribeClicks(ctx context.Context, code string) (<-chan ClickEvent, error) {
+	pubsub := s.redis.Subscribe(ctx, s.clicksChannel(code))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("subscribe clicks: %w", err)
+	}
+
+	events := make(chan ClickEvent)
+	go func() {
+		defer close(events)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var event ClickEvent
+				if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+					log.Printf("dropping malformed click event on %s: %v", msg.Channel, err)
+					continue
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// GetReferrers returns the top referrers for code by visit count along with
+// the total of the remaining tail, which includes the hosts folded into
+// OtherReferrers.
+func (s *service) GetReferrers(ctx context.Context, code string, top int) (ReferrerStats, error) {
+	exists, err := s.ShortCodeExists(ctx, code)
+	if err != nil {
+		return ReferrerStats{}, err
+	}
+	if !exists {
+		return ReferrerStats{}, ErrNotFound
+	}
+
+	key := s.referrerKey(code)
+	pipe := s.redis.Pipeline()
+	// One extra, in case OtherReferrers is among the top.
+	head := pipe.ZRevRangeWithScores(ctx, key, 0, int64(top))
+	tail := pipe.ZRevRangeWithScores(ctx, key, int64(top+1), -1)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return ReferrerStats{}, fmt.Errorf("get referrers: %w", err)
+	}
+
+	stats := ReferrerStats{Top: make([]ReferrerCount, 0, min(len(head.Val()), top))}
+	for _, z := range head.Val() {
+		if referrer := z.Member.(string); referrer != OtherReferrers && len(stats.Top) < top {
+			stats.Top = append(stats.Top, ReferrerCount{Referrer: referrer, Count: int64(z.Score)})
+		} else {
+			stats.Others += int64(z.Score)
+		}
+	}
+	for _, z := range tail.Val() {
+		stats.Others += int64(z.Score)
+	}
+
+	return stats, nil
+}
+
+// RecordCountry counts a visit from country in the code's geo hash, keeping
+// the hash's expiry in line with the short URL.
+func (s *service) RecordCountry(ctx context.Context, code, country string) error {
+	key := s.geoKey(code)
+
+	pipe := s.redis.TxPipeline()
+	pipe.HIncrBy(ctx, key, country, 1)
+	ttl := pipe.PTTL(ctx, s.shortURLKey(code))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("record country: %w", err)
+	}
+
+	if ttl.Val() > 0 {
+		if err := s.redis.PExpire(ctx, key, ttl.Val()).Err(); err != nil {
+			return fmt.Errorf("set geo ttl: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetCountries returns visit counts keyed by ISO country code.
+func (s *service) GetCountries(ctx context.Context, code string) (map[string]int64, error) {
+	values, err := s.redis.HGetAll(ctx, s.geoKey(code)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get countries: %w", err)
+	}
+
+	countries := make(map[string]int64, len(values))
+	for country, raw := range values {
+		count, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse country count: %w", err)
+		}
+		countries[country] = count
+	}
+	return countries, nil
+}
+
+func splitTags(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	return strings.Split(raw, ",")
+}
+
+func mergeTags(current, added []string) []string {
+	seen := make(map[string]bool, len(current)+len(added))
+	merged := make([]string, 0, len(current)+len(added))
+	for _, tag := range append(append([]string{}, current...), added...) {
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		merged = append(merged, tag)
+	}
+	return merged
+}
+
+func removeTags(current, removed []string) []string {
+	drop := make(map[string]bool, len(removed))
+	for _, tag := range removed {
+		drop[tag] = true
+	}
+
+	remaining := make([]string, 0, len(current))
+	for _, tag := range current {
+		if !drop[tag] {
+			remaining = append(remaining, tag)
+		}
+	}
+	return remaining
+}
+
+// healthDependency is a Redis the service depends on, reported by Health
+// under keys starting with name and an underscore.
+type healthDependency struct {
+	name   string
+	client *redis.Client
+}
+
+// validDependencyName reports whether name can prefix a dependency's Health
+// keys without clashing with the primary store's.
+func validDependencyName(name string) bool {
+	if name == "" || name == "redis" {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// healthDependencies lists the Redis databases Health checks. The primary
+// store is always first and reported as "redis".
+func (s *service) healthDependencies() []healthDependency {
+	return append([]healthDependency{{name: "redis", client: s.redis}}, s.dependencies...)
+}
+
+// Health returns the health status and statistics of every Redis the service
+// depends on, checked concurrently. With only the primary store configured
+// the result is the same redis_* map as ever; with more, each dependency adds
+// its own prefixed keys and "status" is "down" if any of them is down.
 func (s *service) Health() map[string]string {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	stats := make(map[string]string)
-	stats = s.checkRedisHealth(ctx, stats)
+	deps := s.healthDependencies()
+	results := make([]map[string]string, len(deps))
+	var wg sync.WaitGroup
+	for i, dep := range deps {
+		wg.Go(func() {
+			results[i] = checkRedisHealth(ctx, dep.client, dep.name+"_", make(map[string]string))
+		})
+	}
+	wg.Wait()
 
+	if len(deps) == 1 {
+		return results[0]
+	}
+	stats := map[string]string{"status": "up"}
+	for i, dep := range deps {
+		maps.Copy(stats, results[i])
+		if results[i][dep.name+"_status"] != "up" {
+			stats["status"] = "down"
+		}
+	}
 	return stats
 }
 
-// checkRedisHealth checks the health of the Redis server and adds the relevant statistics to the stats map.
-func (s *service) checkRedisHealth(ctx context.Context, stats map[string]string) map[string]string {
-	pong, err := s.redis.Ping(ctx).Result()
+// checkRedisHealth checks the health of client and adds the relevant statistics to the stats map, each key starting with prefix.
+func checkRedisHealth(ctx context.Context, client *redis.Client, prefix string, stats map[string]string) map[string]string {
+	pong, err := client.Ping(ctx).Result()
 	if err != nil {
-		stats["redis_status"] = "down"
-		stats["redis_message"] = fmt.Sprintf("Redis ping failed: %v", err)
+		stats[prefix+"status"] = "down"
+		stats[prefix+"message"] = fmt.Sprintf("Redis ping failed: %v", err)
 		return stats
 	}
 
-	stats["redis_status"] = "up"
-	stats["redis_message"] = "It's healthy"
-	stats["redis_ping_response"] = pong
+	stats[prefix+"status"] = "up"
+	stats[prefix+"message"] = "It's healthy"
+	stats[prefix+"ping_response"] = pong
 
-	info, err := s.redis.Info(ctx).Result()
+	info, err := client.Info(ctx).Result()
 	if err != nil {
-		stats["redis_message"] = fmt.Sprintf("Failed to retrieve Redis info: %v", err)
+		stats[prefix+"message"] = fmt.Sprintf("Failed to retrieve Redis info: %v", err)
 		return stats
 	}
 
 	redisInfo := parseRedisInfo(info)
-	poolStats := s.redis.PoolStats()
-
-	stats["redis_version"] = redisInfo["redis_version"]
-	stats["redis_mode"] = redisInfo["redis_mode"]
-	stats["redis_connected_clients"] = redisInfo["connected_clients"]
-	stats["redis_used_memory"] = redisInfo["used_memory"]
-	stats["redis_used_memory_peak"] = redisInfo["used_memory_peak"]
-	stats["redis_uptime_in_seconds"] = redisInfo["uptime_in_seconds"]
-	stats["redis_hits_connections"] = strconv.FormatUint(uint64(poolStats.Hits), 10)
-	stats["redis_misses_connections"] = strconv.FormatUint(uint64(poolStats.Misses), 10)
-	stats["redis_timeouts_connections"] = strconv.FormatUint(uint64(poolStats.Timeouts), 10)
-	stats["redis_total_connections"] = strconv.FormatUint(uint64(poolStats.TotalConns), 10)
-	stats["redis_idle_connections"] = strconv.FormatUint(uint64(poolStats.IdleConns), 10)
-	stats["redis_stale_connections"] = strconv.FormatUint(uint64(poolStats.StaleConns), 10)
-	stats["redis_max_memory"] = redisInfo["maxmemory"]
+	poolStats := client.PoolStats()
+
+	stats[prefix+"version"] = redisInfo["redis_version"]
+	stats[prefix+"mode"] = redisInfo["redis_mode"]
+	stats[prefix+"connected_clients"] = redisInfo["connected_clients"]
+	stats[prefix+"used_memory"] = redisInfo["used_memory"]
+	stats[prefix+"used_memory_peak"] = redisInfo["used_memory_peak"]
+	stats[prefix+"uptime_in_seconds"] = redisInfo["uptime_in_seconds"]
+	stats[prefix+"hits_connections"] = strconv.FormatUint(uint64(poolStats.Hits), 10)
+	stats[prefix+"misses_connections"] = strconv.FormatUint(uint64(poolStats.Misses), 10)
+	stats[prefix+"timeouts_connections"] = strconv.FormatUint(uint64(poolStats.Timeouts), 10)
+	stats[prefix+"total_connections"] = strconv.FormatUint(uint64(poolStats.TotalConns), 10)
+	stats[prefix+"idle_connections"] = strconv.FormatUint(uint64(poolStats.IdleConns), 10)
+	stats[prefix+"stale_connections"] = strconv.FormatUint(uint64(poolStats.StaleConns), 10)
+	stats[prefix+"max_memory"] = redisInfo["maxmemory"]
 
 	activeConns := uint64(math.Max(float64(poolStats.TotalConns-poolStats.IdleConns), 0))
-	stats["redis_active_connections"] = strconv.FormatUint(activeConns, 10)
+	stats[prefix+"active_connections"] = strconv.FormatUint(activeConns, 10)
 
-	poolSize := s.redis.Options().PoolSize
+	poolSize := client.Options().PoolSize
 	connectedClients, _ := strconv.Atoi(redisInfo["connected_clients"])
 	if poolSize > 0 {
 		poolSizePercentage := float64(connectedClients) / float64(poolSize) * 100
-		stats["redis_pool_size_percentage"] = fmt.Sprintf("%.2f%%", poolSizePercentage)
+		stats[prefix+"pool_size_percentage"] = fmt.Sprintf("%.2f%%", poolSizePercentage)
 	}
 
-	return s.evaluateRedisStats(redisInfo, stats)
+	return evaluateRedisStats(client, prefix, redisInfo, stats)
 }
 
 // evaluateRedisStats evaluates the Redis server statistics and updates the stats map with relevant messages.
-func (s *service) evaluateRedisStats(redisInfo, stats map[string]string) map[string]string {
-	poolSize := s.redis.Options().PoolSize
-	poolStats := s.redis.PoolStats()
+func evaluateRedisStats(client *redis.Client, prefix string, redisInfo, stats map[string]string) map[string]string {
+	poolSize := client.Options().PoolSize
+	poolStats := client.PoolStats()
 	connectedClients, _ := strconv.Atoi(redisInfo["connected_clients"])
 	highConnectionThreshold := int(float64(poolSize) * 0.8)
 
 	if connectedClients > highConnectionThreshold {
-		stats["redis_message"] = "Redis has a high number of connected clients"
+		stats[prefix+"message"] = "Redis has a high number of connected clients"
 	}
 
 	minStaleConnectionsThreshold := 500
 	if int(poolStats.StaleConns) > minStaleConnectionsThreshold {
-		stats["redis_message"] = fmt.Sprintf("Redis has %d stale connections.", poolStats.StaleConns)
+		stats[prefix+"message"] = fmt.Sprintf("Redis has %d stale connections.", poolStats.StaleConns)
 	}
 
 	usedMemory, _ := strconv.ParseInt(redisInfo["used_memory"], 10, 64)
@@ -271,26 +2364,26 @@ func (s *service) evaluateRedisStats(redisInfo, stats map[string]string) map[str
 	if maxMemory > 0 {
 		usedMemoryPercentage := float64(usedMemory) / float64(maxMemory) * 100
 		if usedMemoryPercentage >= 90 {
-			stats["redis_message"] = "Redis is using a significant amount of memory"
+			stats[prefix+"message"] = "Redis is using a significant amount of memory"
 		}
 	}
 
 	uptimeInSeconds, _ := strconv.ParseInt(redisInfo["uptime_in_seconds"], 10, 64)
 	if uptimeInSeconds < 3600 {
-		stats["redis_message"] = "Redis has been recently restarted"
+		stats[prefix+"message"] = "Redis has been recently restarted"
 	}
 
 	idleConns := int(poolStats.IdleConns)
 	highIdleConnectionThreshold := int(float64(poolSize) * 0.7)
 	if idleConns > highIdleConnectionThreshold {
-		stats["redis_message"] = "Redis has a high number of idle connections"
+		stats[prefix+"message"] = "Redis has a high number of idle connections"
 	}
 
 	if poolSize > 0 {
 		poolUtilization := float64(poolStats.TotalConns-poolStats.IdleConns) / float64(poolSize) * 100
 		highPoolUtilizationThreshold := 90.0
 		if poolUtilization > highPoolUtilizationThreshold {
-			stats["redis_message"] = "Redis connection pool utilization is high"
+			stats[prefix+"message"] = "Redis connection pool utilization is high"
 		}
 	}
 
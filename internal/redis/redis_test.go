@@ -3,10 +3,16 @@ package redisdb
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	goredis "github.com/redis/go-redis/v9"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/redis"
 )
@@ -73,7 +79,7 @@ func TestMain(m *testing.M) {
 	}
 }
 
-func requireIntegration(t *testing.T) {
+func requireIntegration(t testing.TB) {
 	t.Helper()
 	if !integrationReady {
 		t.Skip("integration environment unavailable")
@@ -89,6 +95,186 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewAppliesPoolOptions(t *testing.T) {
+	t.Setenv("BLUEPRINT_DB_POOL_SIZE", "64")
+	t.Setenv("BLUEPRINT_DB_MIN_IDLE_CONNS", "8")
+	t.Setenv("BLUEPRINT_DB_POOL_TIMEOUT", "2s")
+	t.Setenv("BLUEPRINT_DB_READ_TIMEOUT", "750ms")
+	t.Setenv("BLUEPRINT_DB_WRITE_TIMEOUT", "1500ms")
+
+	defer func(db string) { database = db }(database)
+	database = "3"
+
+	srv := New().(*service)
+	defer srv.redis.Close()
+
+	opts := srv.redis.Options()
+	if opts.PoolSize != 64 || opts.MinIdleConns != 8 || opts.DB != 3 {
+		t.Fatalf("unexpected pool options: size=%d idle=%d db=%d", opts.PoolSize, opts.MinIdleConns, opts.DB)
+	}
+	if opts.PoolTimeout != 2*time.Second || opts.ReadTimeout != 750*time.Millisecond || opts.WriteTimeout != 1500*time.Millisecond {
+		t.Fatalf("unexpected timeouts: pool=%s read=%s write=%s", opts.PoolTimeout, opts.ReadTimeout, opts.WriteTimeout)
+	}
+}
+
+func TestNewWithOptionsRejectsInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "negative database", opts: Options{Addr: "localhost:6379", DB: -1}},
+		{name: "malformed encryption key", opts: Options{Addr: "localhost:6379", EncryptionKey: "k1"}},
+		{name: "short encryption key", opts: Options{Addr: "localhost:6379", EncryptionKey: "k1:c2hvcnQ="}},
+		{name: "malformed health dependency", opts: Options{Addr: "localhost:6379", HealthDependencies: map[string]string{"analytics": "localhost:6380"}}},
+		{name: "health dependency named redis", opts: Options{Addr: "localhost:6379", HealthDependencies: map[string]string{"redis": "redis://localhost:6380"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWithOptions(tt.opts); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestHealthDependenciesFromEnv(t *testing.T) {
+	t.Setenv("BLUEPRINT_DB_HEALTH_DEPENDENCIES", "sessions=redis://localhost:6381/2, analytics=redis://:secret@localhost:6380/1")
+
+	opts, err := OptionsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := NewWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deps := srv.(*service).healthDependencies()
+	if len(deps) != 3 || deps[0].name != "redis" || deps[1].name != "analytics" || deps[2].name != "sessions" {
+		t.Fatalf("unexpected dependencies: %+v", deps)
+	}
+	if got := deps[1].client.Options(); got.Addr != "localhost:6380" || got.DB != 1 || got.Password != "secret" {
+		t.Fatalf("unexpected analytics client options: %s db %d", got.Addr, got.DB)
+	}
+
+	t.Setenv("BLUEPRINT_DB_HEALTH_DEPENDENCIES", "analytics")
+	if _, err := OptionsFromEnv(); err == nil {
+		t.Fatal("expected an entry without a URL to be rejected")
+	}
+}
+
+func TestNewKeepsDefaultsForInvalidPoolOptions(t *testing.T) {
+	t.Setenv("BLUEPRINT_DB_POOL_SIZE", "-1")
+	t.Setenv("BLUEPRINT_DB_READ_TIMEOUT", "soon")
+
+	defaults := goredis.NewClient(&goredis.Options{})
+	defer defaults.Close()
+	opts, err := OptionsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := goredis.NewClient(opts.clientOptions())
+	defer client.Close()
+
+	if got, want := client.Options().PoolSize, defaults.Options().PoolSize; got != want {
+		t.Fatalf("expected default pool size %d, got %d", want, got)
+	}
+	if got, want := client.Options().ReadTimeout, defaults.Options().ReadTimeout; got != want {
+		t.Fatalf("expected default read timeout %s, got %s", want, got)
+	}
+}
+
+func TestStoredCode(t *testing.T) {
+	plain := &service{}
+	if got := plain.shortURLKey("abc1234"); got != "short:url:abc1234" {
+		t.Fatalf("expected plaintext key by default, got %q", got)
+	}
+
+	hashed := &service{hashKeys: true}
+	key := hashed.shortURLKey("abc1234")
+	if key == plain.shortURLKey("abc1234") || len(key) != len(shortURLKeyPrefix)+64 {
+		t.Fatalf("expected a hex SHA-256 key, got %q", key)
+	}
+	if key != hashed.shortURLKey("abc1234") {
+		t.Fatal("expected hashing to be deterministic")
+	}
+	if hashed.shortURLKey("abc1234") == hashed.shortURLKey("abc1235") {
+		t.Fatal("expected different codes to hash differently")
+	}
+
+	keyed := &service{hashKeys: true, keySecret: []byte("pepper")}
+	if keyed.shortURLKey("abc1234") == key {
+		t.Fatal("expected the secret to change the key")
+	}
+	if keyed.referrerKey("abc1234")[len(referrerKeyPrefix):] != keyed.shortURLKey("abc1234")[len(shortURLKeyPrefix):] {
+		t.Fatal("expected every per-code key to use the same digest")
+	}
+}
+
+func TestHashedKeysEndToEnd(t *testing.T) {
+	requireIntegration(t)
+	t.Setenv("BLUEPRINT_DB_HASH_KEYS", "true")
+	t.Setenv("BLUEPRINT_DB_HASH_KEYS_SECRET", "pepper")
+
+	srv := New()
+	rdb := srv.(*service).redis
+	ctx := context.Background()
+
+	const code = "hidn001"
+	if err := srv.CreateShortURL(ctx, code, "https://example.com/secret", CreateOptions{TTL: time.Hour, Sliding: true, Tags: []string{"hashed"}}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := srv.CreateShortURL(ctx, code, "https://example.com/other", CreateOptions{}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if exists, err := srv.ShortCodeExists(ctx, code); err != nil || !exists {
+		t.Fatalf("expected code to exist, got %v (%v)", exists, err)
+	}
+
+	resolved, err := srv.VisitURL(ctx, code, Visit{Referrer: "news.example.com", Country: "FR"})
+	if err != nil || resolved.URL != "https://example.com/secret" || resolved.Visits != 1 {
+		t.Fatalf("unexpected visit: %+v (%v)", resolved, err)
+	}
+	if err := srv.SetMetadata(ctx, code, "Hidden", "", ""); err != nil {
+		t.Fatalf("SetMetadata failed: %v", err)
+	}
+	stats, err := srv.GetStats(ctx, code)
+	if err != nil || stats.Code != code || stats.Visits != 1 || stats.Title != "Hidden" {
+		t.Fatalf("unexpected stats: %+v (%v)", stats, err)
+	}
+	if refs, err := srv.GetReferrers(ctx, code, 10); err != nil || len(refs.Top) != 1 {
+		t.Fatalf("unexpected referrers: %+v (%v)", refs, err)
+	}
+	if countries, err := srv.GetCountries(ctx, code); err != nil || countries["FR"] != 1 {
+		t.Fatalf("unexpected countries: %v (%v)", countries, err)
+	}
+	if codes, err := srv.CodesByTags(ctx, []string{"hashed"}); err != nil || !slices.Equal(codes, []string{code}) {
+		t.Fatalf("unexpected tag lookup: %v (%v)", codes, err)
+	}
+
+	keys, err := rdb.Keys(ctx, "short:*").Result()
+	if err != nil {
+		t.Fatalf("KEYS failed: %v", err)
+	}
+	for _, key := range keys {
+		if strings.Contains(key, code) {
+			t.Fatalf("expected no key to contain the plaintext code, found %q", key)
+		}
+	}
+	if n := rdb.Exists(ctx, srv.(*service).shortURLKey(code)).Val(); n != 1 {
+		t.Fatal("expected the link to live under its hashed key")
+	}
+
+	if err := srv.DeleteShortURL(ctx, code); err != nil {
+		t.Fatalf("DeleteShortURL failed: %v", err)
+	}
+	if _, err := srv.GetLongURL(ctx, code); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+	if n := rdb.Exists(ctx, srv.(*service).referrerKey(code), srv.(*service).geoKey(code)).Val(); n != 0 {
+		t.Fatal("expected delete to remove hashed analytics keys")
+	}
+}
+
 func TestHealth(t *testing.T) {
 	requireIntegration(t)
 
@@ -109,11 +295,11 @@ func TestCRUDAndVisits(t *testing.T) {
 	srv := New()
 	ctx := context.Background()
 
-	if err := srv.CreateShortURL(ctx, "abc1234", "https://example.com", time.Hour); err != nil {
+	if err := srv.CreateShortURL(ctx, "abc1234", "https://example.com", CreateOptions{TTL: time.Hour}); err != nil {
 		t.Fatalf("CreateShortURL failed: %v", err)
 	}
 
-	if err := srv.CreateShortURL(ctx, "abc1234", "https://example.com/dup", time.Hour); !errors.Is(err, ErrConflict) {
+	if err := srv.CreateShortURL(ctx, "abc1234", "https://example.com/dup", CreateOptions{TTL: time.Hour}); !errors.Is(err, ErrConflict) {
 		t.Fatalf("expected ErrConflict, got %v", err)
 	}
 
@@ -152,3 +338,1835 @@ func TestCRUDAndVisits(t *testing.T) {
 		t.Fatalf("expected ErrNotFound after delete, got %v", err)
 	}
 }
+
+func TestTagsAndDeleteCleanup(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+
+	if err := srv.CreateShortURL(ctx, "tag0001", "https://example.com/1", CreateOptions{Tags: []string{"marketing", "spring"}}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := srv.CreateShortURL(ctx, "tag0002", "https://example.com/2", CreateOptions{Tags: []string{"marketing"}}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	codes, err := srv.CodesByTags(ctx, []string{"marketing"})
+	if err != nil {
+		t.Fatalf("CodesByTags failed: %v", err)
+	}
+	if !slices.Equal(codes, []string{"tag0001", "tag0002"}) {
+		t.Fatalf("unexpected marketing codes: %v", codes)
+	}
+
+	codes, err = srv.CodesByTags(ctx, []string{"marketing", "spring"})
+	if err != nil {
+		t.Fatalf("CodesByTags failed: %v", err)
+	}
+	if !slices.Equal(codes, []string{"tag0001"}) {
+		t.Fatalf("unexpected intersection: %v", codes)
+	}
+
+	if err := srv.AddTags(ctx, "tag0002", []string{"summer"}); err != nil {
+		t.Fatalf("AddTags failed: %v", err)
+	}
+	if err := srv.RemoveTags(ctx, "tag0001", []string{"spring"}); err != nil {
+		t.Fatalf("RemoveTags failed: %v", err)
+	}
+
+	stats, err := srv.GetStats(ctx, "tag0002")
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if !slices.Equal(stats.Tags, []string{"marketing", "summer"}) {
+		t.Fatalf("unexpected tags: %v", stats.Tags)
+	}
+
+	if err := srv.AddTags(ctx, "missing", []string{"x"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := srv.DeleteShortURL(ctx, "tag0001"); err != nil {
+		t.Fatalf("DeleteShortURL failed: %v", err)
+	}
+
+	codes, err = srv.CodesByTags(ctx, []string{"marketing"})
+	if err != nil {
+		t.Fatalf("CodesByTags failed: %v", err)
+	}
+	if !slices.Equal(codes, []string{"tag0002"}) {
+		t.Fatalf("expected deleted code removed from tag set, got %v", codes)
+	}
+}
+
+func TestAddTagsIsAtomic(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	rdb := srv.(*service).redis
+	ctx := context.Background()
+
+	tags := []string{"cap1", "cap2", "cap3", "cap4", "cap5", "cap6", "cap7", "cap8"}
+	if err := srv.CreateShortURL(ctx, "tagcap1", "https://example.com", CreateOptions{Tags: tags}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for _, tag := range []string{"cap9", "cap10"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := srv.AddTags(ctx, "tagcap1", []string{tag}); err != nil {
+				t.Errorf("AddTags %s failed: %v", tag, err)
+			}
+		}()
+	}
+	wg.Wait()
+	stats, err := srv.GetStats(ctx, "tagcap1")
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if len(stats.Tags) != MaxTags {
+		t.Fatalf("expected concurrent adds to keep every tag, got %v", stats.Tags)
+	}
+
+	if err := srv.AddTags(ctx, "tagcap1", []string{"cap1", "cap11"}); !errors.Is(err, ErrTooManyTags) {
+		t.Fatalf("expected ErrTooManyTags past the cap, got %v", err)
+	}
+	if rdb.SIsMember(ctx, tagKey("cap11"), "tagcap1").Val() {
+		t.Fatal("expected a refused add to leave the tag sets alone")
+	}
+
+	if err := srv.DeleteShortURL(ctx, "tagcap1"); err != nil {
+		t.Fatalf("DeleteShortURL failed: %v", err)
+	}
+	if err := srv.AddTags(ctx, "tagcap1", []string{"cap1"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+	if rdb.Exists(ctx, srv.(*service).shortURLKey("tagcap1")).Val() != 0 {
+		t.Fatal("expected AddTags not to recreate a deleted link")
+	}
+}
+
+func TestReferrers(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+
+	if err := srv.CreateShortURL(ctx, "ref0001", "https://example.com", CreateOptions{TTL: time.Hour}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	for referrer, n := range map[string]int{"a.com": 4, "b.com": 2, "c.com": 1, "direct": 1} {
+		for i := 0; i < n; i++ {
+			if err := srv.RecordReferrer(ctx, "ref0001", referrer); err != nil {
+				t.Fatalf("RecordReferrer failed: %v", err)
+			}
+		}
+	}
+
+	stats, err := srv.GetReferrers(ctx, "ref0001", 2)
+	if err != nil {
+		t.Fatalf("GetReferrers failed: %v", err)
+	}
+	want := []ReferrerCount{{Referrer: "a.com", Count: 4}, {Referrer: "b.com", Count: 2}}
+	if !slices.Equal(stats.Top, want) {
+		t.Fatalf("expected %v, got %v", want, stats.Top)
+	}
+	if stats.Others != 2 {
+		t.Fatalf("expected others=2, got %d", stats.Others)
+	}
+
+	if err := srv.DeleteShortURL(ctx, "ref0001"); err != nil {
+		t.Fatalf("DeleteShortURL failed: %v", err)
+	}
+	if _, err := srv.GetReferrers(ctx, "ref0001", 2); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestReferrersCapped(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	rdb := srv.(*service).redis
+	ctx := context.Background()
+	if err := srv.CreateShortURL(ctx, "ref0002", "https://example.com", CreateOptions{}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	for range 3 {
+		if err := srv.RecordReferrer(ctx, "ref0002", "news.example.com"); err != nil {
+			t.Fatalf("RecordReferrer failed: %v", err)
+		}
+	}
+	for i := range maxReferrerHosts + 50 {
+		if _, err := srv.VisitURL(ctx, "ref0002", Visit{Referrer: fmt.Sprintf("spam%d.example.net", i)}); err != nil {
+			t.Fatalf("VisitURL failed: %v", err)
+		}
+	}
+
+	if n := rdb.ZCard(ctx, srv.(*service).referrerKey("ref0002")).Val(); n > maxReferrerHosts+1 {
+		t.Fatalf("expected at most %d referrer members, got %d", maxReferrerHosts+1, n)
+	}
+	stats, err := srv.GetReferrers(ctx, "ref0002", 1)
+	if err != nil {
+		t.Fatalf("GetReferrers failed: %v", err)
+	}
+	if len(stats.Top) != 1 || stats.Top[0] != (ReferrerCount{Referrer: "news.example.com", Count: 3}) {
+		t.Fatalf("expected the busiest host to survive the cap, got %v", stats.Top)
+	}
+	if stats.Others != maxReferrerHosts+50 {
+		t.Fatalf("expected folded hosts to keep their visits, got others=%d", stats.Others)
+	}
+}
+
+func TestRefreshTTLSliding(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	rdb := srv.(*service).redis
+	ctx := context.Background()
+
+	if err := srv.CreateShortURL(ctx, "slide01", "https://example.com", CreateOptions{TTL: time.Hour, Sliding: true}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := srv.CreateShortURL(ctx, "fixed01", "https://example.com", CreateOptions{TTL: time.Hour}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := srv.CreateShortURL(ctx, "perm001", "https://example.com", CreateOptions{Sliding: true}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	for _, code := range []string{"slide01", "fixed01"} {
+		if err := rdb.Expire(ctx, srv.(*service).shortURLKey(code), time.Minute).Err(); err != nil {
+			t.Fatalf("Expire failed: %v", err)
+		}
+	}
+
+	for code, want := range map[string]bool{"slide01": true, "fixed01": false, "perm001": false} {
+		refreshed, err := srv.RefreshTTL(ctx, code)
+		if err != nil {
+			t.Fatalf("RefreshTTL(%s) failed: %v", code, err)
+		}
+		if refreshed != want {
+			t.Fatalf("RefreshTTL(%s) = %v, want %v", code, refreshed, want)
+		}
+	}
+
+	if ttl := rdb.TTL(ctx, srv.(*service).shortURLKey("slide01")).Val(); ttl < 59*time.Minute {
+		t.Fatalf("expected sliding ttl to be reset to ~1h, got %s", ttl)
+	}
+	if ttl := rdb.TTL(ctx, srv.(*service).shortURLKey("fixed01")).Val(); ttl > time.Minute {
+		t.Fatalf("expected fixed ttl to stay at ~1m, got %s", ttl)
+	}
+	if ttl := rdb.TTL(ctx, srv.(*service).shortURLKey("perm001")).Val(); ttl != -1 {
+		t.Fatalf("expected permanent link to stay without ttl, got %s", ttl)
+	}
+}
+
+func TestShortCodeExistsBatch(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+
+	for _, code := range []string{"batch01", "batch03"} {
+		if err := srv.CreateShortURL(ctx, code, "https://example.com", CreateOptions{}); err != nil {
+			t.Fatalf("CreateShortURL failed: %v", err)
+		}
+	}
+
+	codes := []string{"batch01", "batch02", "batch03", "batch04"}
+	batch, err := srv.ShortCodeExistsBatch(ctx, codes)
+	if err != nil {
+		t.Fatalf("ShortCodeExistsBatch failed: %v", err)
+	}
+	if len(batch) != len(codes) {
+		t.Fatalf("expected %d results, got %d", len(codes), len(batch))
+	}
+
+	for _, code := range codes {
+		exists, err := srv.ShortCodeExists(ctx, code)
+		if err != nil {
+			t.Fatalf("ShortCodeExists failed: %v", err)
+		}
+		if batch[code] != exists {
+			t.Fatalf("batch result for %s = %v, individual = %v", code, batch[code], exists)
+		}
+	}
+	if !batch["batch01"] || batch["batch02"] {
+		t.Fatalf("unexpected batch results: %v", batch)
+	}
+
+	empty, err := srv.ShortCodeExistsBatch(ctx, nil)
+	if err != nil || len(empty) != 0 {
+		t.Fatalf("expected empty result for no codes, got %v, %v", empty, err)
+	}
+}
+
+func TestGetLongURLs(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+
+	if err := srv.CreateShortURL(ctx, "resb001", "https://example.com/one", CreateOptions{}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := srv.CreateShortURL(ctx, "resb002", "https://example.com/once", CreateOptions{OneTime: true}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := srv.CreateShortURL(ctx, "resb003", "https://example.com/used", CreateOptions{OneTime: true}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if _, err := srv.GetLongURL(ctx, "resb003"); err != nil {
+		t.Fatalf("GetLongURL failed: %v", err)
+	}
+	if _, err := srv.ReserveAliases(ctx, []string{"resb004"}, ""); err != nil {
+		t.Fatalf("ReserveAliases failed: %v", err)
+	}
+
+	urls, err := srv.GetLongURLs(ctx, []string{"resb001", "resb002", "resb003", "resb004", "resb005"})
+	if err != nil {
+		t.Fatalf("GetLongURLs failed: %v", err)
+	}
+	if len(urls) != 1 || urls["resb001"] != "https://example.com/one" {
+		t.Fatalf("expected only the live reusable link, got %v", urls)
+	}
+
+	stats, err := srv.GetStats(ctx, "resb002")
+	if err != nil || stats.Consumed || stats.Visits != 0 {
+		t.Fatalf("expected the one-time link to be untouched, got %+v (%v)", stats, err)
+	}
+
+	empty, err := srv.GetLongURLs(ctx, nil)
+	if err != nil || len(empty) != 0 {
+		t.Fatalf("expected empty result for no codes, got %v, %v", empty, err)
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+
+	opts := CreateOptions{Title: "Launch post", Description: "All about the launch"}
+	if err := srv.CreateShortURL(ctx, "meta001", "https://example.com/post", opts); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	stats, err := srv.GetStats(ctx, "meta001")
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if stats.Title != opts.Title || stats.Description != opts.Description {
+		t.Fatalf("unexpected metadata: %+v", stats)
+	}
+}
+
+func TestSetMetadata(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+
+	if err := srv.CreateShortURL(ctx, "meta002", "https://example.com", CreateOptions{Title: "Mine"}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := srv.SetMetadata(ctx, "meta002", "", "Discovered", "https://example.com/og.png"); err != nil {
+		t.Fatalf("SetMetadata failed: %v", err)
+	}
+
+	stats, err := srv.GetStats(ctx, "meta002")
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if stats.Title != "Mine" || stats.Description != "Discovered" || stats.Image != "https://example.com/og.png" {
+		t.Fatalf("unexpected metadata: %+v", stats)
+	}
+
+	if err := srv.SetMetadata(ctx, "missing", "t", "d", ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if exists, _ := srv.ShortCodeExists(ctx, "missing"); exists {
+		t.Fatal("SetMetadata must not create missing keys")
+	}
+}
+
+func TestSetDestinationHealth(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+
+	if err := srv.CreateShortURL(ctx, "dest002", "https://example.com", CreateOptions{}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	stats, err := srv.GetStats(ctx, "dest002")
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if stats.Destination != nil {
+		t.Fatalf("expected no destination check before one runs, got %+v", stats.Destination)
+	}
+
+	checked := time.Now().UTC().Truncate(time.Second)
+	health := DestinationHealth{Status: 404, Healthy: false, CheckedAt: checked}
+	if err := srv.SetDestinationHealth(ctx, "dest002", health); err != nil {
+		t.Fatalf("SetDestinationHealth failed: %v", err)
+	}
+
+	stats, err = srv.GetStats(ctx, "dest002")
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if stats.Destination == nil || stats.Destination.Status != 404 || stats.Destination.Healthy || !stats.Destination.CheckedAt.Equal(checked) {
+		t.Fatalf("unexpected destination health: %+v", stats.Destination)
+	}
+
+	if err := srv.SetDestinationHealth(ctx, "missing", health); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPublishAndSubscribeClicks(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events, err := srv.SubscribeClicks(ctx, "live001")
+	if err != nil {
+		t.Fatalf("SubscribeClicks failed: %v", err)
+	}
+
+	sent := ClickEvent{Code: "live001", Visits: 3, Referrer: "direct", At: time.Now().UTC().Truncate(time.Second)}
+	if err := srv.PublishClick(ctx, sent); err != nil {
+		t.Fatalf("PublishClick failed: %v", err)
+	}
+
+	select {
+	case got := <-events:
+		if got.Code != sent.Code || got.Visits != sent.Visits || !got.At.Equal(sent.At) {
+			t.Fatalf("unexpected event: %+v", got)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for click event")
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestOwnerLinksAndQuota(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	rdb := srv.(*service).redis
+	ctx := context.Background()
+
+	for _, code := range []string{"own0001", "own0002", "own0003"} {
+		if err := srv.CreateShortURL(ctx, code, "https://example.com", CreateOptions{Owner: "owner-a"}); err != nil {
+			t.Fatalf("CreateShortURL failed: %v", err)
+		}
+	}
+
+	if err := srv.DeleteShortURL(ctx, "own0001"); err != nil {
+		t.Fatalf("DeleteShortURL failed: %v", err)
+	}
+	// Simulate expiry, which leaves the code behind in the owner set.
+	if err := rdb.Del(ctx, srv.(*service).shortURLKey("own0002")).Err(); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+
+	count, err := srv.CountOwnerLinks(ctx, "owner-a")
+	if err != nil {
+		t.Fatalf("CountOwnerLinks failed: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 live link, got %d", count)
+	}
+	if members := rdb.SMembers(ctx, ownerKey("owner-a")).Val(); !slices.Equal(members, []string{"own0003"}) {
+		t.Fatalf("expected stale codes to be pruned, got %v", members)
+	}
+
+	if _, ok, err := srv.GetOwnerQuota(ctx, "owner-a"); err != nil || ok {
+		t.Fatalf("expected no quota override, got ok=%v err=%v", ok, err)
+	}
+	if err := srv.SetOwnerQuota(ctx, "owner-a", 5); err != nil {
+		t.Fatalf("SetOwnerQuota failed: %v", err)
+	}
+	if limit, ok, err := srv.GetOwnerQuota(ctx, "owner-a"); err != nil || !ok || limit != 5 {
+		t.Fatalf("expected quota 5, got %d ok=%v err=%v", limit, ok, err)
+	}
+	if err := srv.SetOwnerQuota(ctx, "owner-a", -1); err != nil {
+		t.Fatalf("SetOwnerQuota failed: %v", err)
+	}
+	if _, ok, _ := srv.GetOwnerQuota(ctx, "owner-a"); ok {
+		t.Fatal("expected quota override to be cleared")
+	}
+}
+
+func TestCreateShortURLOwnerLimit(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+
+	limited := CreateOptions{Owner: "owner-lim", OwnerLimit: 2}
+	if _, err := srv.ReserveAliases(ctx, []string{"olim001"}, "owner-lim"); err != nil {
+		t.Fatalf("ReserveAliases failed: %v", err)
+	}
+	if err := srv.CreateShortURL(ctx, "olim002", "https://example.com", limited); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := srv.CreateShortURL(ctx, "olim003", "https://example.com", limited); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded at the limit, got %v", err)
+	}
+	if exists, _ := srv.ShortCodeExists(ctx, "olim003"); exists {
+		t.Fatal("expected a refused create to store nothing")
+	}
+	if err := srv.CreateShortURL(ctx, "olim003", "https://example.com", CreateOptions{Owner: "owner-lim"}); err != nil {
+		t.Fatalf("expected a create without OwnerLimit to succeed, got %v", err)
+	}
+
+	fill := limited
+	fill.FillReservation = true
+	if err := srv.CreateShortURL(ctx, "olim001", "https://example.com", fill); err != nil {
+		t.Fatalf("expected filling the owner's reservation to need no room, got %v", err)
+	}
+}
+
+func TestSetExpiration(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	rdb := srv.(*service).redis
+	ctx := context.Background()
+
+	if err := srv.CreateShortURL(ctx, "expi001", "https://example.com", CreateOptions{TTL: time.Hour, Sliding: true}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := srv.RecordReferrer(ctx, "expi001", "news.example.com"); err != nil {
+		t.Fatalf("RecordReferrer failed: %v", err)
+	}
+
+	// Extend: both keys follow, and sliding now refreshes to the new window.
+	if err := srv.SetExpiration(ctx, "expi001", 48*time.Hour); err != nil {
+		t.Fatalf("SetExpiration failed: %v", err)
+	}
+	for _, key := range []string{srv.(*service).shortURLKey("expi001"), srv.(*service).referrerKey("expi001")} {
+		if ttl := rdb.TTL(ctx, key).Val(); ttl < 47*time.Hour {
+			t.Fatalf("expected %s ttl ~48h, got %s", key, ttl)
+		}
+	}
+	if got := rdb.HGet(ctx, srv.(*service).shortURLKey("expi001"), "ttl_seconds").Val(); got != "172800" {
+		t.Fatalf("expected sliding window of 172800s, got %q", got)
+	}
+
+	// Shorten.
+	if err := srv.SetExpiration(ctx, "expi001", time.Minute); err != nil {
+		t.Fatalf("SetExpiration failed: %v", err)
+	}
+	if ttl := rdb.TTL(ctx, srv.(*service).referrerKey("expi001")).Val(); ttl > time.Minute {
+		t.Fatalf("expected referrer ttl <= 1m, got %s", ttl)
+	}
+
+	// Remove.
+	if err := srv.SetExpiration(ctx, "expi001", 0); err != nil {
+		t.Fatalf("SetExpiration failed: %v", err)
+	}
+	for _, key := range []string{srv.(*service).shortURLKey("expi001"), srv.(*service).referrerKey("expi001")} {
+		if ttl := rdb.TTL(ctx, key).Val(); ttl != -1 {
+			t.Fatalf("expected %s to be persistent, got %s", key, ttl)
+		}
+	}
+	stats, err := srv.GetStats(ctx, "expi001")
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if stats.ExpiresAt != nil || stats.Sliding {
+		t.Fatalf("expected a permanent, non-sliding link, got %+v", stats)
+	}
+
+	if err := srv.SetExpiration(ctx, "missing", time.Hour); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestOneTimeLinkConcurrentResolve(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+
+	if err := srv.CreateShortURL(ctx, "once001", "https://example.com/secret", CreateOptions{OneTime: true}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	const visitors = 50
+	var (
+		wg      sync.WaitGroup
+		winners atomic.Int64
+		gone    atomic.Int64
+	)
+	start := make(chan struct{})
+	for i := 0; i < visitors; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			url, err := srv.GetLongURL(ctx, "once001")
+			switch {
+			case err == nil && url == "https://example.com/secret":
+				winners.Add(1)
+			case errors.Is(err, ErrGone):
+				gone.Add(1)
+			default:
+				t.Errorf("unexpected result: url=%q err=%v", url, err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if winners.Load() != 1 || gone.Load() != visitors-1 {
+		t.Fatalf("expected exactly 1 winner and %d gone, got %d and %d", visitors-1, winners.Load(), gone.Load())
+	}
+
+	stats, err := srv.GetStats(ctx, "once001")
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if !stats.OneTime || !stats.Consumed {
+		t.Fatalf("expected a consumed one-time link, got %+v", stats)
+	}
+
+	// Regular links keep resolving.
+	if err := srv.CreateShortURL(ctx, "many001", "https://example.com", CreateOptions{}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := srv.GetLongURL(ctx, "many001"); err != nil {
+			t.Fatalf("GetLongURL on regular link failed: %v", err)
+		}
+	}
+}
+
+func TestCreateConflictLeavesOriginalUntouched(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	rdb := srv.(*service).redis
+	ctx := context.Background()
+
+	original := CreateOptions{TTL: time.Hour, Tags: []string{"docs"}, Title: "Original", Owner: "owner-orig"}
+	if err := srv.CreateShortURL(ctx, "atom001", "https://example.com/original", original); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	before, err := srv.GetStats(ctx, "atom001")
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+
+	conflicting := CreateOptions{Tags: []string{"spam"}, Title: "Hijacked", Owner: "owner-other", OneTime: true}
+	if err := srv.CreateShortURL(ctx, "atom001", "https://example.com/other", conflicting); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+
+	after, err := srv.GetStats(ctx, "atom001")
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if after.LongURL != before.LongURL || after.Title != "Original" || after.OneTime ||
+		!slices.Equal(after.Tags, []string{"docs"}) || !after.CreatedAt.Equal(before.CreatedAt) {
+		t.Fatalf("conflicting create changed the original: before=%+v after=%+v", before, after)
+	}
+	if after.ExpiresAt == nil {
+		t.Fatal("expected original TTL to be kept")
+	}
+	if rdb.SIsMember(ctx, tagKey("spam"), "atom001").Val() {
+		t.Fatal("conflicting create must not index the code under its tags")
+	}
+	if rdb.SIsMember(ctx, ownerKey("owner-other"), "atom001").Val() {
+		t.Fatal("conflicting create must not index the code under its owner")
+	}
+	if !rdb.SIsMember(ctx, tagKey("docs"), "atom001").Val() || !rdb.SIsMember(ctx, ownerKey("owner-orig"), "atom001").Val() {
+		t.Fatal("expected the original create to index the code in one step")
+	}
+}
+
+func TestCountries(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	rdb := srv.(*service).redis
+	ctx := context.Background()
+
+	if err := srv.CreateShortURL(ctx, "geo0001", "https://example.com", CreateOptions{TTL: time.Hour}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	for _, country := range []string{"DE", "DE", "US"} {
+		if err := srv.RecordCountry(ctx, "geo0001", country); err != nil {
+			t.Fatalf("RecordCountry failed: %v", err)
+		}
+	}
+
+	countries, err := srv.GetCountries(ctx, "geo0001")
+	if err != nil {
+		t.Fatalf("GetCountries failed: %v", err)
+	}
+	if countries["DE"] != 2 || countries["US"] != 1 || len(countries) != 2 {
+		t.Fatalf("unexpected countries: %v", countries)
+	}
+	if ttl := rdb.TTL(ctx, srv.(*service).geoKey("geo0001")).Val(); ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("expected geo ttl to follow the link, got %s", ttl)
+	}
+
+	if err := srv.DeleteShortURL(ctx, "geo0001"); err != nil {
+		t.Fatalf("DeleteShortURL failed: %v", err)
+	}
+	if n := rdb.Exists(ctx, srv.(*service).geoKey("geo0001")).Val(); n != 0 {
+		t.Fatal("expected geo key to be removed on delete")
+	}
+}
+
+func TestStatsTTLSeconds(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+
+	if err := srv.CreateShortURL(ctx, "ttls001", "https://example.com", CreateOptions{TTL: time.Hour}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := srv.CreateShortURL(ctx, "ttls002", "https://example.com", CreateOptions{}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	stats, err := srv.GetStats(ctx, "ttls001")
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if stats.TTLSeconds == nil || *stats.TTLSeconds <= 3590 || *stats.TTLSeconds > 3600 {
+		t.Fatalf("expected ttl_seconds close to 3600, got %v", stats.TTLSeconds)
+	}
+
+	stats, err = srv.GetStats(ctx, "ttls002")
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if stats.TTLSeconds != nil {
+		t.Fatalf("expected nil ttl_seconds for a permanent link, got %d", *stats.TTLSeconds)
+	}
+}
+
+func TestResolveURL(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+
+	if err := srv.CreateShortURL(ctx, "resv001", "https://example.com/perm", CreateOptions{}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := srv.CreateShortURL(ctx, "resv002", "https://example.com/temp", CreateOptions{TTL: time.Hour, OneTime: true}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	resolved, err := srv.ResolveURL(ctx, "resv001")
+	if err != nil {
+		t.Fatalf("ResolveURL failed: %v", err)
+	}
+	if resolved.URL != "https://example.com/perm" || resolved.TTL != 0 || resolved.OneTime {
+		t.Fatalf("unexpected permanent resolution: %+v", resolved)
+	}
+
+	resolved, err = srv.ResolveURL(ctx, "resv002")
+	if err != nil {
+		t.Fatalf("ResolveURL failed: %v", err)
+	}
+	if resolved.URL != "https://example.com/temp" || resolved.TTL <= 59*time.Minute || !resolved.OneTime {
+		t.Fatalf("unexpected expiring resolution: %+v", resolved)
+	}
+
+	if _, err := srv.ResolveURL(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestGetRaw(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+
+	if err := srv.CreateShortURL(ctx, "rawr001", "https://example.com", CreateOptions{TTL: time.Hour, Owner: "owner-a", OneTime: true}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	fields, ttl, err := srv.GetRaw(ctx, "rawr001")
+	if err != nil {
+		t.Fatalf("GetRaw failed: %v", err)
+	}
+	for field, want := range map[string]string{"url": "https://example.com", "owner": "owner-a", "one_time": "1", "visits": "0"} {
+		if fields[field] != want {
+			t.Fatalf("expected %s=%q, got %q", field, want, fields[field])
+		}
+	}
+	if ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("expected ttl within an hour, got %s", ttl)
+	}
+
+	if _, _, err := srv.GetRaw(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestIncrementVisitsByAndBatch(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	rdb := srv.(*service).redis
+	ctx := context.Background()
+
+	for _, code := range []string{"batc001", "batc002"} {
+		if err := srv.CreateShortURL(ctx, code, "https://example.com", CreateOptions{}); err != nil {
+			t.Fatalf("CreateShortURL failed: %v", err)
+		}
+	}
+
+	visits, err := srv.IncrementVisitsBy(ctx, "batc001", 10)
+	if err != nil || visits != 10 {
+		t.Fatalf("expected 10 visits, got %d (%v)", visits, err)
+	}
+	if _, err := srv.IncrementVisitsBy(ctx, "missing", 3); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	totals, err := srv.IncrementVisitsBatch(ctx, map[string]int64{"batc001": 5, "batc002": 7, "nothere": 9})
+	if err != nil {
+		t.Fatalf("IncrementVisitsBatch failed: %v", err)
+	}
+	if len(totals) != 2 || totals["batc001"] != 15 || totals["batc002"] != 7 {
+		t.Fatalf("unexpected totals: %v", totals)
+	}
+	if n := rdb.Exists(ctx, srv.(*service).shortURLKey("nothere")).Val(); n != 0 {
+		t.Fatal("batch increments must not create missing codes")
+	}
+
+	counts, err := srv.VisitCounts(ctx, []string{"batc001", "batc002", "nothere"})
+	if err != nil || len(counts) != 2 || counts["batc001"] != 15 || counts["batc002"] != 7 {
+		t.Fatalf("unexpected visit counts: %v (%v)", counts, err)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	rdb := srv.(*service).redis
+	ctx := context.Background()
+
+	for code, group := range map[string]string{"grpa001": "alpha", "grpa002": "alpha", "grpb001": "beta"} {
+		if err := srv.CreateShortURL(ctx, code, "https://example.com", CreateOptions{Group: group}); err != nil {
+			t.Fatalf("CreateShortURL failed: %v", err)
+		}
+	}
+
+	stats, err := srv.GetStats(ctx, "grpa001")
+	if err != nil || stats.Group != "alpha" {
+		t.Fatalf("expected group to be stored, got %+v (%v)", stats, err)
+	}
+	codes, err := srv.CodesByGroup(ctx, "alpha")
+	if err != nil || !slices.Equal(codes, []string{"grpa001", "grpa002"}) {
+		t.Fatalf("unexpected alpha members: %v (%v)", codes, err)
+	}
+	groups, err := srv.ListGroups(ctx)
+	if err != nil || !slices.Contains(groups, "alpha") || !slices.Contains(groups, "beta") {
+		t.Fatalf("unexpected groups: %v (%v)", groups, err)
+	}
+
+	if err := srv.DeleteShortURL(ctx, "grpb001"); err != nil {
+		t.Fatalf("DeleteShortURL failed: %v", err)
+	}
+	if n := rdb.Exists(ctx, groupKey("beta")).Val(); n != 0 {
+		t.Fatal("expected deleting the last member to remove the group set")
+	}
+	if groups, _ := srv.ListGroups(ctx); slices.Contains(groups, "beta") {
+		t.Fatalf("expected empty group to be dropped, got %v", groups)
+	}
+	if rdb.SIsMember(ctx, groupsKey, "beta").Val() {
+		t.Fatal("expected empty group name to be pruned from the index")
+	}
+
+	if err := rdb.Del(ctx, srv.(*service).shortURLKey("grpa002")).Err(); err != nil {
+		t.Fatalf("Del failed: %v", err)
+	}
+	if codes, _ := srv.CodesByGroup(ctx, "alpha"); !slices.Equal(codes, []string{"grpa001"}) {
+		t.Fatalf("expected expired member to be skipped, got %v", codes)
+	}
+	if rdb.SIsMember(ctx, groupKey("alpha"), "grpa002").Val() {
+		t.Fatal("expected expired member to be pruned from the group")
+	}
+}
+
+func TestCampaigns(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	rdb := srv.(*service).redis
+	ctx := context.Background()
+
+	for _, code := range []string{"cmpa001", "cmpa002"} {
+		if err := srv.CreateShortURL(ctx, code, "https://example.com", CreateOptions{Campaign: "camp00000001"}); err != nil {
+			t.Fatalf("CreateShortURL failed: %v", err)
+		}
+	}
+
+	stats, err := srv.GetStats(ctx, "cmpa001")
+	if err != nil || stats.Campaign != "camp00000001" {
+		t.Fatalf("expected campaign to be stored, got %+v (%v)", stats, err)
+	}
+	if err := srv.RotateCode(ctx, "cmpa002", "cmpa003"); err != nil {
+		t.Fatalf("RotateCode failed: %v", err)
+	}
+	codes, err := srv.CodesByCampaign(ctx, "camp00000001")
+	if err != nil || !slices.Equal(codes, []string{"cmpa001", "cmpa003"}) {
+		t.Fatalf("unexpected campaign members: %v (%v)", codes, err)
+	}
+
+	for _, code := range codes {
+		if err := srv.DeleteShortURL(ctx, code); err != nil {
+			t.Fatalf("DeleteShortURL failed: %v", err)
+		}
+	}
+	if n := rdb.Exists(ctx, campaignKey("camp00000001")).Val(); n != 0 {
+		t.Fatal("expected deleting every link to remove the campaign set")
+	}
+	if _, err := srv.CodesByCampaign(ctx, "camp00000001"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for an empty campaign, got %v", err)
+	}
+}
+
+func TestSearchDestinations(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	rdb := srv.(*service).redis
+	ctx := context.Background()
+
+	for code, target := range map[string]string{
+		"srch001": "https://Docs.Example.com/guide/setup",
+		"srch002": "https://docs.example.com:8443/pricing",
+		"srch003": "https://blog.example.org/guide/setup",
+	} {
+		if err := srv.CreateShortURL(ctx, code, target, CreateOptions{}); err != nil {
+			t.Fatalf("CreateShortURL failed: %v", err)
+		}
+	}
+
+	for query, want := range map[string][]string{
+		"docs.example.com":  {"srch001", "srch002"},
+		"/guide/setup":      {"srch001", "srch003"},
+		"example.org/guide": {"srch003"},
+	} {
+		codes, err := srv.SearchDestinations(ctx, query, 10)
+		if err != nil || !slices.Equal(codes, want) {
+			t.Fatalf("%q: expected %v, got %v (%v)", query, want, codes, err)
+		}
+	}
+	if codes, err := srv.SearchDestinations(ctx, "example", 1); err != nil || len(codes) != 1 {
+		t.Fatalf("expected the limit to bound results, got %v (%v)", codes, err)
+	}
+
+	newURL := "https://blog.example.org/pricing"
+	if err := srv.UpdateLink(ctx, "srch002", LinkUpdate{URL: &newURL}); err != nil {
+		t.Fatalf("UpdateLink failed: %v", err)
+	}
+	if err := srv.RotateCode(ctx, "srch001", "srch004"); err != nil {
+		t.Fatalf("RotateCode failed: %v", err)
+	}
+	codes, err := srv.SearchDestinations(ctx, "blog.example.org", 10)
+	if err != nil || !slices.Equal(codes, []string{"srch002", "srch003"}) {
+		t.Fatalf("expected the updated link under its new host, got %v (%v)", codes, err)
+	}
+	codes, err = srv.SearchDestinations(ctx, "docs.example.com", 10)
+	if err != nil || !slices.Equal(codes, []string{"srch004"}) {
+		t.Fatalf("expected the rotated code, got %v (%v)", codes, err)
+	}
+
+	if err := srv.DeleteShortURL(ctx, "srch004"); err != nil {
+		t.Fatalf("DeleteShortURL failed: %v", err)
+	}
+	if codes, err := srv.SearchDestinations(ctx, "docs.example.com", 10); err != nil || len(codes) != 0 {
+		t.Fatalf("expected no matches after deleting, got %v (%v)", codes, err)
+	}
+	if rdb.SIsMember(ctx, hostsKey, "docs.example.com").Val() {
+		t.Fatal("expected the emptied host to be pruned from the name index")
+	}
+}
+
+func TestVisitURL(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	rdb := srv.(*service).redis
+	ctx := context.Background()
+
+	if err := srv.CreateShortURL(ctx, "visi001", "https://example.com/slide", CreateOptions{TTL: time.Hour, Sliding: true}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := srv.CreateShortURL(ctx, "visi002", "https://example.com/once", CreateOptions{OneTime: true}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := rdb.Expire(ctx, srv.(*service).shortURLKey("visi001"), time.Minute).Err(); err != nil {
+		t.Fatalf("Expire failed: %v", err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		resolved, err := srv.VisitURL(ctx, "visi001", Visit{Referrer: "news.example.com", Country: "DE"})
+		if err != nil {
+			t.Fatalf("VisitURL failed: %v", err)
+		}
+		if resolved.URL != "https://example.com/slide" || resolved.Visits != int64(i) || resolved.TTL <= 59*time.Minute {
+			t.Fatalf("unexpected visit %d: %+v", i, resolved)
+		}
+	}
+	if _, err := srv.VisitURL(ctx, "visi001", Visit{}); err != nil {
+		t.Fatalf("VisitURL failed: %v", err)
+	}
+
+	stats, err := srv.GetStats(ctx, "visi001")
+	if err != nil || stats.Visits != 3 {
+		t.Fatalf("expected 3 visits, got %+v (%v)", stats, err)
+	}
+	referrers, err := srv.GetReferrers(ctx, "visi001", 10)
+	if err != nil || len(referrers.Top) != 1 || referrers.Top[0].Count != 2 {
+		t.Fatalf("unexpected referrers: %+v (%v)", referrers, err)
+	}
+	countries, err := srv.GetCountries(ctx, "visi001")
+	if err != nil || len(countries) != 1 || countries["DE"] != 2 {
+		t.Fatalf("unexpected countries: %v (%v)", countries, err)
+	}
+	for _, key := range []string{srv.(*service).referrerKey("visi001"), srv.(*service).geoKey("visi001")} {
+		if ttl := rdb.TTL(ctx, key).Val(); ttl <= 59*time.Minute {
+			t.Fatalf("expected %s to expire with the link, got %s", key, ttl)
+		}
+	}
+
+	if resolved, err := srv.VisitURL(ctx, "visi002", Visit{}); err != nil || !resolved.OneTime || resolved.Visits != 1 {
+		t.Fatalf("unexpected one-time visit: %+v (%v)", resolved, err)
+	}
+	if _, err := srv.VisitURL(ctx, "visi002", Visit{}); !errors.Is(err, ErrGone) {
+		t.Fatalf("expected ErrGone, got %v", err)
+	}
+	if _, err := srv.VisitURL(ctx, "missing", Visit{}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if n := rdb.Exists(ctx, srv.(*service).referrerKey("missing"), srv.(*service).geoKey("missing")).Val(); n != 0 {
+		t.Fatal("VisitURL must not create analytics keys for missing codes")
+	}
+}
+
+func TestVisitURLBurstLimit(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+
+	if err := srv.CreateShortURL(ctx, "burs001", "https://example.com", CreateOptions{}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	visit := Visit{Referrer: "direct", Visitor: "203.0.113.7", MaxBurst: 2, BurstWindow: time.Minute}
+	for i := 1; i <= 4; i++ {
+		resolved, err := srv.VisitURL(ctx, "burs001", visit)
+		if err != nil {
+			t.Fatalf("VisitURL failed: %v", err)
+		}
+		if resolved.URL != "https://example.com" {
+			t.Fatalf("expected over-limit visits to still resolve, got %+v", resolved)
+		}
+		if want := i <= 2; resolved.Counted != want || resolved.Visits != int64(min(i, 2)) {
+			t.Fatalf("visit %d: unexpected result %+v", i, resolved)
+		}
+	}
+
+	visit.Visitor = "198.51.100.2"
+	if resolved, err := srv.VisitURL(ctx, "burs001", visit); err != nil || !resolved.Counted || resolved.Visits != 3 {
+		t.Fatalf("expected another visitor to be counted, got %+v (%v)", resolved, err)
+	}
+
+	referrers, err := srv.GetReferrers(ctx, "burs001", 10)
+	if err != nil || len(referrers.Top) != 1 || referrers.Top[0].Count != 3 {
+		t.Fatalf("unexpected referrers: %+v (%v)", referrers, err)
+	}
+}
+
+func TestStartsAtWindow(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+	start := time.Now().Add(500 * time.Millisecond)
+	if err := srv.CreateShortURL(ctx, "strt001", "https://example.com/launch", CreateOptions{StartsAt: start, TTL: time.Hour, OneTime: true}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	stats, err := srv.GetStats(ctx, "strt001")
+	if err != nil || stats.StartsAt == nil || stats.StartsAt.UnixMilli() != start.UnixMilli() {
+		t.Fatalf("expected starts_at in stats, got %+v (%v)", stats, err)
+	}
+	if _, err := srv.VisitURL(ctx, "strt001", Visit{}); !errors.Is(err, ErrNotActive) {
+		t.Fatalf("expected ErrNotActive from VisitURL before the start, got %v", err)
+	}
+	if _, err := srv.ResolveURL(ctx, "strt001"); !errors.Is(err, ErrNotActive) {
+		t.Fatalf("expected ErrNotActive from ResolveURL before the start, got %v", err)
+	}
+	if urls, err := srv.GetLongURLs(ctx, []string{"strt001"}); err != nil || len(urls) != 0 {
+		t.Fatalf("expected batch lookups to skip an inactive link, got %v (%v)", urls, err)
+	}
+	if stats, _ := srv.GetStats(ctx, "strt001"); stats.Visits != 0 || stats.Consumed {
+		t.Fatalf("expected the embargoed link to be untouched, got %+v", stats)
+	}
+
+	time.Sleep(time.Until(start) + 50*time.Millisecond)
+	resolved, err := srv.VisitURL(ctx, "strt001", Visit{})
+	if err != nil || resolved.URL != "https://example.com/launch" || resolved.Visits != 1 || resolved.TTL <= 0 {
+		t.Fatalf("expected the link to redirect once active, still expiring, got %+v (%v)", resolved, err)
+	}
+}
+
+func TestForwardQueryFlag(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+	if err := srv.CreateShortURL(ctx, "fwdq001", "https://example.com?a=1", CreateOptions{ForwardQuery: true}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := srv.CreateShortURL(ctx, "fwdq002", "https://example.com", CreateOptions{}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	for code, want := range map[string]bool{"fwdq001": true, "fwdq002": false} {
+		resolved, err := srv.ResolveURL(ctx, code)
+		if err != nil || resolved.ForwardQuery != want {
+			t.Fatalf("%s: expected ResolveURL forward_query=%t, got %+v (%v)", code, want, resolved, err)
+		}
+		visited, err := srv.VisitURL(ctx, code, Visit{})
+		if err != nil || visited.ForwardQuery != want || visited.Visits != 1 || !visited.Counted {
+			t.Fatalf("%s: expected VisitURL forward_query=%t, got %+v (%v)", code, want, visited, err)
+		}
+		stats, err := srv.GetStats(ctx, code)
+		if err != nil || stats.ForwardQuery != want {
+			t.Fatalf("%s: expected stats forward_query=%t, got %+v (%v)", code, want, stats, err)
+		}
+	}
+}
+
+func TestRequireHTTPS(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+	if err := srv.CreateShortURL(ctx, "tls0001", "https://example.com", CreateOptions{RequireHTTPS: true, OneTime: true}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	if _, err := srv.VisitURL(ctx, "tls0001", Visit{PlainHTTP: true}); !errors.Is(err, ErrInsecure) {
+		t.Fatalf("expected ErrInsecure for a plain HTTP visit, got %v", err)
+	}
+	stats, err := srv.GetStats(ctx, "tls0001")
+	if err != nil || !stats.RequireHTTPS || stats.Visits != 0 || stats.Consumed {
+		t.Fatalf("expected the refused visit to leave the link untouched, got %+v (%v)", stats, err)
+	}
+	if visited, err := srv.VisitURL(ctx, "tls0001", Visit{}); err != nil || !visited.Counted {
+		t.Fatalf("expected an HTTPS visit to resolve, got %+v (%v)", visited, err)
+	}
+}
+
+func TestInterstitialSeconds(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+	if err := srv.CreateShortURL(ctx, "wait001", "https://example.com", CreateOptions{InterstitialSeconds: 5}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	visited, err := srv.VisitURL(ctx, "wait001", Visit{})
+	if err != nil || visited.InterstitialSeconds != 5 || !visited.Counted {
+		t.Fatalf("expected the visit to carry the interstitial, got %+v (%v)", visited, err)
+	}
+	if stats, err := srv.GetStats(ctx, "wait001"); err != nil || stats.InterstitialSeconds != 5 {
+		t.Fatalf("expected interstitial_seconds in the stats, got %+v (%v)", stats, err)
+	}
+}
+
+func TestDenylisted(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	rdb := srv.(*service).redis
+	ctx := context.Background()
+
+	if denied, err := srv.Denylisted(ctx, []string{"bad.example.net", "example.net"}); err != nil || denied {
+		t.Fatalf("expected an empty denylist to deny nothing, got %v (%v)", denied, err)
+	}
+	if err := rdb.SAdd(ctx, denylistKey, "example.net").Err(); err != nil {
+		t.Fatalf("SAdd failed: %v", err)
+	}
+	t.Cleanup(func() { rdb.Del(ctx, denylistKey) })
+
+	if denied, err := srv.Denylisted(ctx, []string{"bad.example.net", "example.net"}); err != nil || !denied {
+		t.Fatalf("expected a listed parent domain to deny, got %v (%v)", denied, err)
+	}
+	if denied, err := srv.Denylisted(ctx, []string{"example.org"}); err != nil || denied {
+		t.Fatalf("expected an unlisted domain to pass, got %v (%v)", denied, err)
+	}
+}
+
+func TestVariants(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+	variants := []Variant{{URL: "https://a.example.com", Weight: 75}, {URL: "https://b.example.com", Weight: 25}}
+	if err := srv.CreateShortURL(ctx, "split01", variants[0].URL, CreateOptions{Variants: variants}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	for roll, want := range map[float64]int{0: 0, 0.5: 0, 0.8: 1, 0.99: 1} {
+		visited, err := srv.VisitURL(ctx, "split01", Visit{VariantRoll: roll})
+		if err != nil || visited.Variant != want || visited.URL != variants[want].URL {
+			t.Fatalf("roll %v: expected variant %d, got %+v (%v)", roll, want, visited, err)
+		}
+	}
+
+	stats, err := srv.GetStats(ctx, "split01")
+	if err != nil || len(stats.Variants) != 2 || stats.Variants[0].Visits != 2 || stats.Variants[1].Visits != 2 {
+		t.Fatalf("expected two visits per variant, got %+v (%v)", stats.Variants, err)
+	}
+}
+
+func TestVisitWeight(t *testing.T) {
+	for _, rate := range []int{0, 1} {
+		for range 100 {
+			if weight := visitWeight(rate); weight != 1 {
+				t.Fatalf("rate %d: expected every visit to count once, got %d", rate, weight)
+			}
+		}
+	}
+	seen := map[int]bool{}
+	for range 1000 {
+		weight := visitWeight(4)
+		if weight != 0 && weight != 4 {
+			t.Fatalf("rate 4: expected a weight of 0 or 4, got %d", weight)
+		}
+		seen[weight] = true
+	}
+	if !seen[0] || !seen[4] {
+		t.Fatalf("expected both sampled-in and sampled-out visits, got %v", seen)
+	}
+}
+
+func TestVisitURLSampling(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+	for _, code := range []string{"samp001", "samp002"} {
+		if err := srv.CreateShortURL(ctx, code, "https://example.com", CreateOptions{}); err != nil {
+			t.Fatalf("CreateShortURL failed: %v", err)
+		}
+	}
+
+	exact := Visit{Referrer: "direct", SampleRate: 1}
+	for i := 1; i <= 50; i++ {
+		resolved, err := srv.VisitURL(ctx, "samp001", exact)
+		if err != nil || !resolved.Counted || resolved.Visits != int64(i) {
+			t.Fatalf("visit %d: expected an exact count at rate 1, got %+v (%v)", i, resolved, err)
+		}
+	}
+	if stats, err := srv.GetStats(ctx, "samp001"); err != nil || stats.Visits != 50 || stats.Sampled {
+		t.Fatalf("expected 50 exact visits, got %+v (%v)", stats, err)
+	}
+
+	sampled := Visit{Referrer: "direct", SampleRate: 10}
+	counted := 0
+	for range 300 {
+		resolved, err := srv.VisitURL(ctx, "samp002", sampled)
+		if err != nil || resolved.URL != "https://example.com" {
+			t.Fatalf("expected sampled-out visits to still resolve, got %+v (%v)", resolved, err)
+		}
+		if resolved.Counted {
+			counted++
+		}
+	}
+	stats, err := srv.GetStats(ctx, "samp002")
+	if err != nil || stats.Visits != int64(counted*10) || !stats.Sampled || counted == 0 || counted == 300 {
+		t.Fatalf("expected %d sampled visits counted as ten each, got %+v (%v)", counted, stats, err)
+	}
+	referrers, err := srv.GetReferrers(ctx, "samp002", 10)
+	if err != nil || len(referrers.Top) != 1 || referrers.Top[0].Count != stats.Visits {
+		t.Fatalf("expected referrer counts scaled like visits, got %+v (%v)", referrers, err)
+	}
+}
+
+// BenchmarkRedirectPath compares recording a click with the separate calls
+// the redirect handler used to make against the single VisitURL script.
+func BenchmarkRedirectPath(b *testing.B) {
+	requireIntegration(b)
+
+	srv := New()
+	ctx := context.Background()
+	if err := srv.CreateShortURL(ctx, "bench01", "https://example.com", CreateOptions{TTL: time.Hour, Sliding: true}); err != nil {
+		b.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	b.Run("separate_calls", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := srv.ResolveURL(ctx, "bench01"); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := srv.IncrementVisits(ctx, "bench01"); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := srv.RefreshTTL(ctx, "bench01"); err != nil {
+				b.Fatal(err)
+			}
+			if err := srv.RecordReferrer(ctx, "bench01", "news.example.com"); err != nil {
+				b.Fatal(err)
+			}
+			if err := srv.RecordCountry(ctx, "bench01", "DE"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("visit_script", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := srv.VisitURL(ctx, "bench01", Visit{Referrer: "news.example.com", Country: "DE"}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestRotateCode(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	rdb := srv.(*service).redis
+	ctx := context.Background()
+
+	opts := CreateOptions{TTL: time.Hour, Tags: []string{"rotate"}, Owner: "rotowner", Group: "rotgroup"}
+	if err := srv.CreateShortURL(ctx, "rot0001", "https://example.com/rotate", opts); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := srv.CreateShortURL(ctx, "rottkn1", "https://example.com/taken", CreateOptions{}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if _, err := srv.VisitURL(ctx, "rot0001", Visit{Referrer: "news.example", Country: "DE"}); err != nil {
+		t.Fatalf("VisitURL failed: %v", err)
+	}
+
+	if err := srv.RotateCode(ctx, "rot0001", "rottkn1"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if err := srv.RotateCode(ctx, "rot0001", "rot0002"); err != nil {
+		t.Fatalf("RotateCode failed: %v", err)
+	}
+
+	if _, err := srv.GetLongURL(ctx, "rot0001"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the old code to be gone, got %v", err)
+	}
+	stats, err := srv.GetStats(ctx, "rot0002")
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if stats.Visits != 1 || stats.TTLSeconds == nil || stats.Group != "rotgroup" {
+		t.Fatalf("expected stats and TTL to carry over, got %+v", stats)
+	}
+	referrers, err := srv.GetReferrers(ctx, "rot0002", 10)
+	if err != nil || len(referrers.Top) != 1 || referrers.Top[0].Referrer != "news.example" {
+		t.Fatalf("expected referrers to carry over, got %+v (%v)", referrers, err)
+	}
+	if countries, err := srv.GetCountries(ctx, "rot0002"); err != nil || countries["DE"] != 1 {
+		t.Fatalf("expected countries to carry over, got %v (%v)", countries, err)
+	}
+
+	for _, key := range []string{tagKey("rotate"), ownerKey("rotowner"), groupKey("rotgroup")} {
+		if !rdb.SIsMember(ctx, key, "rot0002").Val() || rdb.SIsMember(ctx, key, "rot0001").Val() {
+			t.Fatalf("expected %s to list the new code only", key)
+		}
+	}
+
+	if err := srv.RotateCode(ctx, "rot0001", "rot0003"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestEncryptedURLsEndToEnd(t *testing.T) {
+	requireIntegration(t)
+
+	c, err := newURLCipher(testKey("k1", 'a'))
+	if err != nil {
+		t.Fatalf("newURLCipher failed: %v", err)
+	}
+	srv := New().(*service)
+	srv.urls = c
+	ctx := context.Background()
+
+	const target = "https://example.com/confidential"
+	if err := srv.CreateShortURL(ctx, "crypt01", target, CreateOptions{}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+
+	stored := srv.redis.HGet(ctx, srv.shortURLKey("crypt01"), "url").Val()
+	if !strings.HasPrefix(stored, encryptedURLPrefix) || strings.Contains(stored, "example.com") {
+		t.Fatalf("expected the destination to be encrypted at rest, got %q", stored)
+	}
+
+	if got, err := srv.GetLongURL(ctx, "crypt01"); err != nil || got != target {
+		t.Fatalf("GetLongURL: expected %q, got %q (%v)", target, got, err)
+	}
+	if resolved, err := srv.VisitURL(ctx, "crypt01", Visit{}); err != nil || resolved.URL != target {
+		t.Fatalf("VisitURL: expected %q, got %q (%v)", target, resolved.URL, err)
+	}
+	if stats, err := srv.GetStats(ctx, "crypt01"); err != nil || stats.LongURL != target {
+		t.Fatalf("GetStats: expected %q, got %q (%v)", target, stats.LongURL, err)
+	}
+}
+
+func TestExpiryListenerCleansUpExpiredLinks(t *testing.T) {
+	requireIntegration(t)
+
+	opts, err := OptionsFromEnv()
+	if err != nil {
+		t.Fatalf("OptionsFromEnv failed: %v", err)
+	}
+	opts.TrackExpiry = true
+	svc, err := NewWithOptions(opts)
+	if err != nil {
+		t.Fatalf("NewWithOptions failed: %v", err)
+	}
+	defer svc.Close()
+	srv := svc.(*service)
+	rdb := srv.redis
+	ctx := context.Background()
+
+	before, err := srv.GetSummary(ctx)
+	if err != nil {
+		t.Fatalf("GetSummary failed: %v", err)
+	}
+
+	create := CreateOptions{TTL: time.Hour, Tags: []string{"expiring"}, Owner: "expowner", Group: "expgroup"}
+	if err := srv.CreateShortURL(ctx, "exp0001", "https://example.com/expiring", create); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := srv.CreateShortURL(ctx, "exp0002", "https://example.com/permanent", CreateOptions{}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	for range 2 {
+		if _, err := srv.VisitURL(ctx, "exp0001", Visit{}); err != nil {
+			t.Fatalf("VisitURL failed: %v", err)
+		}
+	}
+	if _, err := srv.IncrementVisitsBy(ctx, "exp0001", 3); err != nil {
+		t.Fatalf("IncrementVisitsBy failed: %v", err)
+	}
+	if rdb.Exists(ctx, srv.expiringKey("exp0002")).Val() != 0 {
+		t.Fatal("expected no expiry record for a permanent link")
+	}
+
+	summary, _ := srv.GetSummary(ctx)
+	if summary.Links-before.Links != 2 || summary.Visits-before.Visits != 5 {
+		t.Fatalf("expected 2 links and 5 visits added, got %+v then %+v", before, summary)
+	}
+
+	// Stand in for Redis expiring the key: drop it and publish the expired
+	// event it would send, until the listener has subscribed and handled it.
+	rdb.Del(ctx, srv.shortURLKey("exp0001"))
+	channel := "__keyevent@" + database + "__:expired"
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		rdb.Publish(ctx, channel, srv.shortURLKey("exp0001"))
+		summary, _ = srv.GetSummary(ctx)
+		if summary.Links-before.Links == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the expired link to be subtracted, got %+v then %+v", before, summary)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if summary.Visits != before.Visits {
+		t.Fatalf("expected the expired link's visits to be subtracted, got %+v then %+v", before, summary)
+	}
+	for _, key := range []string{tagKey("expiring"), ownerKey("expowner"), groupKey("expgroup")} {
+		if rdb.SIsMember(ctx, key, "exp0001").Val() {
+			t.Fatalf("expected %s to drop the expired code", key)
+		}
+	}
+	if rdb.Exists(ctx, srv.expiringKey("exp0001")).Val() != 0 {
+		t.Fatal("expected the expiry record to be removed")
+	}
+
+	if err := srv.DeleteShortURL(ctx, "exp0002"); err != nil {
+		t.Fatalf("DeleteShortURL failed: %v", err)
+	}
+	if summary, _ = srv.GetSummary(ctx); summary != before {
+		t.Fatalf("expected deleting to restore the summary %+v, got %+v", before, summary)
+	}
+}
+
+func TestReserveAliases(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+
+	if err := srv.CreateShortURL(ctx, "rsvtkn1", "https://example.com/taken", CreateOptions{}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	before, _ := srv.GetSummary(ctx)
+
+	reserved, err := srv.ReserveAliases(ctx, []string{"rsv0001", "rsvtkn1", "rsv0002", "rsv0001"}, "rsvowner")
+	if err != nil {
+		t.Fatalf("ReserveAliases failed: %v", err)
+	}
+	if !reserved["rsv0001"] || !reserved["rsv0002"] || reserved["rsvtkn1"] {
+		t.Fatalf("unexpected reservations: %v", reserved)
+	}
+	if ok, err := srv.IsReserved(ctx, "rsv0001"); err != nil || !ok {
+		t.Fatalf("expected rsv0001 to be reserved, got %v (%v)", ok, err)
+	}
+	if ok, _ := srv.IsReserved(ctx, "rsvtkn1"); ok {
+		t.Fatal("expected a link not to count as a reservation")
+	}
+	if exists, _ := srv.ShortCodeExists(ctx, "rsv0001"); !exists {
+		t.Fatal("expected a reservation to hold its code")
+	}
+	if ttl := srv.(*service).redis.PTTL(ctx, srv.(*service).shortURLKey("rsv0002")).Val(); ttl <= 0 || ttl > ReservationTTL {
+		t.Fatalf("expected an unfilled reservation to expire, got ttl %s", ttl)
+	}
+	if count, err := srv.CountOwnerLinks(ctx, "rsvowner"); err != nil || count != 2 {
+		t.Fatalf("expected both reservations to count toward the owner, got %d (%v)", count, err)
+	}
+	if _, err := srv.VisitURL(ctx, "rsv0001", Visit{}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected a reservation not to resolve, got %v", err)
+	}
+	if _, err := srv.GetStats(ctx, "rsv0001"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected a reservation to have no stats, got %v", err)
+	}
+	if _, err := srv.IncrementVisitsBy(ctx, "rsv0001", 2); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected a reservation not to count visits, got %v", err)
+	}
+
+	fill := CreateOptions{Owner: "rsvowner", FillReservation: true}
+	if err := srv.CreateShortURL(ctx, "rsv0001", "https://example.com/a", CreateOptions{Owner: "rsvowner"}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected a reservation to conflict without FillReservation, got %v", err)
+	}
+	if err := srv.CreateShortURL(ctx, "rsv0001", "https://example.com/a", CreateOptions{Owner: "someone", FillReservation: true}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected another owner's reservation to conflict, got %v", err)
+	}
+	if err := srv.CreateShortURL(ctx, "rsv0001", "https://example.com/a", fill); err != nil {
+		t.Fatalf("filling the reservation failed: %v", err)
+	}
+	if url, err := srv.GetLongURL(ctx, "rsv0001"); err != nil || url != "https://example.com/a" {
+		t.Fatalf("expected the filled link to resolve, got %q (%v)", url, err)
+	}
+	if ttl := srv.(*service).redis.TTL(ctx, srv.(*service).shortURLKey("rsv0001")).Val(); ttl != -1 {
+		t.Fatalf("expected the filled permanent link to lose the reservation's expiry, got %s", ttl)
+	}
+	if err := srv.CreateShortURL(ctx, "rsv0001", "https://example.com/b", fill); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected a filled link not to be replaced, got %v", err)
+	}
+
+	if err := srv.DeleteShortURL(ctx, "rsv0002"); err != nil {
+		t.Fatalf("releasing the reservation failed: %v", err)
+	}
+	if summary, _ := srv.GetSummary(ctx); summary.Links-before.Links != 1 {
+		t.Fatalf("expected only the filled reservation to count as a link, got %+v then %+v", before, summary)
+	}
+}
+
+func TestClaimCaseFold(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+	claim := func(code string) bool {
+		t.Helper()
+		claimed, err := srv.ClaimCaseFold(ctx, code)
+		if err != nil {
+			t.Fatalf("ClaimCaseFold failed: %v", err)
+		}
+		return claimed
+	}
+
+	if !claim("FoldOne") {
+		t.Fatal("expected a free form to be claimed")
+	}
+	if err := srv.CreateShortURL(ctx, "FoldOne", "https://example.com", CreateOptions{}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if claim("foldone") {
+		t.Fatal("expected a case variant of a live link to be refused")
+	}
+
+	if err := srv.RotateCode(ctx, "FoldOne", "FoldTwo"); err != nil {
+		t.Fatalf("RotateCode failed: %v", err)
+	}
+	if !claim("foldone") {
+		t.Fatal("expected rotating away to release the old form")
+	}
+	if claim("FOLDTWO") {
+		t.Fatal("expected the rotated link to hold its new form")
+	}
+
+	if err := srv.DeleteShortURL(ctx, "FoldTwo"); err != nil {
+		t.Fatalf("DeleteShortURL failed: %v", err)
+	}
+	field, _ := srv.(*service).caseFold("FoldTwo")
+	if srv.(*service).redis.HExists(ctx, caseFoldsKey, field).Val() {
+		t.Fatal("expected delete to drop the link's field")
+	}
+}
+
+func TestScanURLs(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+
+	want := map[string]string{}
+	for i := range 3 {
+		code := fmt.Sprintf("scan%03d", i)
+		want[code] = "https://example.com/" + code
+		if err := srv.CreateShortURL(ctx, code, want[code], CreateOptions{Tags: []string{"scan"}}); err != nil {
+			t.Fatalf("CreateShortURL failed: %v", err)
+		}
+	}
+	if _, err := srv.ReserveAliases(ctx, []string{"scanrsv"}, ""); err != nil {
+		t.Fatalf("ReserveAliases failed: %v", err)
+	}
+
+	seen := map[string]string{}
+	err := srv.ScanURLs(ctx, func(stats URLStats) error {
+		if stats.Code == "scanrsv" {
+			t.Fatal("expected reservations to be skipped")
+		}
+		if strings.HasPrefix(stats.Code, "scan") {
+			seen[stats.Code] = stats.LongURL
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ScanURLs failed: %v", err)
+	}
+	for code, longURL := range want {
+		if seen[code] != longURL {
+			t.Fatalf("expected %s -> %s in the scan, got %v", code, longURL, seen)
+		}
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = srv.ScanURLs(ctx, func(URLStats) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("expected the callback error to stop the scan, got %v after %d calls", err, calls)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := srv.ScanURLs(cancelled, func(URLStats) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestUpdateLink(t *testing.T) {
+	requireIntegration(t)
+
+	c, err := newURLCipher(testKey("k1", 'a'))
+	if err != nil {
+		t.Fatalf("newURLCipher failed: %v", err)
+	}
+	srv := New().(*service)
+	srv.urls = c
+	rdb := srv.redis
+	ctx := context.Background()
+
+	opts := CreateOptions{Tags: []string{"old", "kept"}, Group: "grpa", Title: "Title", Description: "Desc"}
+	if err := srv.CreateShortURL(ctx, "upd0001", "https://example.com/v1", opts); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if err := srv.SetDestinationHealth(ctx, "upd0001", DestinationHealth{Status: 200, Healthy: true, CheckedAt: time.Now()}); err != nil {
+		t.Fatalf("SetDestinationHealth failed: %v", err)
+	}
+
+	newURL, tags, group, empty := "https://example.com/v2", []string{"kept", "new"}, "grpb", ""
+	ttl, sliding := 2*time.Hour, true
+	update := LinkUpdate{URL: &newURL, Tags: &tags, Group: &group, Description: &empty, TTL: &ttl, Sliding: &sliding}
+	if err := srv.UpdateLink(ctx, "upd0001", update); err != nil {
+		t.Fatalf("UpdateLink failed: %v", err)
+	}
+
+	stats, err := srv.GetStats(ctx, "upd0001")
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if stats.LongURL != newURL || stats.Title != "Title" || stats.Description != "" || stats.Group != "grpb" || !stats.Sliding || stats.ExpiresAt == nil {
+		t.Fatalf("unexpected stats after update: %+v", stats)
+	}
+	if !slices.Equal(stats.Tags, []string{"kept", "new"}) || stats.Destination != nil {
+		t.Fatalf("expected replaced tags and no stale destination check, got %+v", stats)
+	}
+	if stored := rdb.HGet(ctx, srv.shortURLKey("upd0001"), "url").Val(); !strings.HasPrefix(stored, encryptedURLPrefix) {
+		t.Fatalf("expected the new destination to be encrypted at rest, got %q", stored)
+	}
+	if got := rdb.HGet(ctx, srv.shortURLKey("upd0001"), "ttl_seconds").Val(); got != "7200" {
+		t.Fatalf("expected a sliding window of 7200s, got %q", got)
+	}
+
+	for key, want := range map[string]bool{tagKey("old"): false, tagKey("kept"): true, tagKey("new"): true, groupKey("grpa"): false, groupKey("grpb"): true} {
+		if got := rdb.SIsMember(ctx, key, "upd0001").Val(); got != want {
+			t.Fatalf("expected membership of %s to be %v, got %v", key, want, got)
+		}
+	}
+	if !rdb.SIsMember(ctx, groupsKey, "grpb").Val() {
+		t.Fatal("expected the new group in the group index")
+	}
+
+	if err := srv.UpdateLink(ctx, "upd-missing", LinkUpdate{Title: &empty}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestLinkHistory(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+	if err := srv.CreateShortURL(ctx, "hist001", "https://example.com/history", CreateOptions{}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	disabled := true
+	if err := srv.UpdateLink(ctx, "hist001", LinkUpdate{Disabled: &disabled}); err != nil {
+		t.Fatalf("UpdateLink failed: %v", err)
+	}
+
+	events, err := srv.GetHistory(ctx, "hist001")
+	if err != nil || len(events) != 2 {
+		t.Fatalf("expected two history entries, got %+v (%v)", events, err)
+	}
+	if events[0].Type != EventCreate || events[1].Type != EventDisable || events[1].At.Before(events[0].At) {
+		t.Fatalf("expected create then disable, got %+v", events)
+	}
+	if _, err := srv.VisitURL(ctx, "hist001", Visit{}); !errors.Is(err, ErrNotActive) {
+		t.Fatalf("expected ErrNotActive for a disabled link, got %v", err)
+	}
+	if stats, _ := srv.GetStats(ctx, "hist001"); !stats.Disabled {
+		t.Fatalf("expected stats to show the link disabled, got %+v", stats)
+	}
+
+	if err := srv.RotateCode(ctx, "hist001", "hist002"); err != nil {
+		t.Fatalf("RotateCode failed: %v", err)
+	}
+	events, _ = srv.GetHistory(ctx, "hist002")
+	if len(events) != 3 || events[2].Type != EventRotate {
+		t.Fatalf("expected the history to move with the link, got %+v", events)
+	}
+
+	if err := srv.DeleteShortURL(ctx, "hist002"); err != nil {
+		t.Fatalf("DeleteShortURL failed: %v", err)
+	}
+	if events, _ := srv.GetHistory(ctx, "hist002"); len(events) != 0 {
+		t.Fatalf("expected delete to clear the history, got %+v", events)
+	}
+}
+
+func TestLinkHistoryCapped(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	ctx := context.Background()
+	if err := srv.CreateShortURL(ctx, "hist003", "https://example.com", CreateOptions{}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	for range maxHistoryEvents {
+		if err := srv.AddTags(ctx, "hist003", []string{"capped"}); err != nil {
+			t.Fatalf("AddTags failed: %v", err)
+		}
+	}
+
+	events, err := srv.GetHistory(ctx, "hist003")
+	if err != nil || len(events) != maxHistoryEvents {
+		t.Fatalf("expected %d events, got %d (%v)", maxHistoryEvents, len(events), err)
+	}
+	if events[0].Type != EventUpdate {
+		t.Fatalf("expected the oldest event to be dropped first, got %+v", events[0])
+	}
+}
+
+func TestLinkHistoryExpiresWithLink(t *testing.T) {
+	requireIntegration(t)
+
+	srv := New()
+	rdb := srv.(*service).redis
+	ctx := context.Background()
+	if err := srv.CreateShortURL(ctx, "hist004", "https://example.com", CreateOptions{TTL: time.Hour}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	key := srv.(*service).historyKey("hist004")
+	if ttl := rdb.PTTL(ctx, key).Val(); ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("expected the history to expire with the link, got %s", ttl)
+	}
+
+	if err := srv.SetExpiration(ctx, "hist004", 48*time.Hour); err != nil {
+		t.Fatalf("SetExpiration failed: %v", err)
+	}
+	if ttl := rdb.PTTL(ctx, key).Val(); ttl < 47*time.Hour {
+		t.Fatalf("expected the history ttl to follow the link to ~48h, got %s", ttl)
+	}
+
+	permanent := time.Duration(0)
+	if err := srv.UpdateLink(ctx, "hist004", LinkUpdate{TTL: &permanent}); err != nil {
+		t.Fatalf("UpdateLink failed: %v", err)
+	}
+	if ttl := rdb.TTL(ctx, key).Val(); ttl != -1 {
+		t.Fatalf("expected the history of a permanent link to be persistent, got %s", ttl)
+	}
+}
+
+func TestAllowRequestSharedAcrossClients(t *testing.T) {
+	requireIntegration(t)
+
+	first, second := New(), New()
+	ctx := context.Background()
+	for i, srv := range []Service{first, second, first} {
+		allowed, _, err := srv.AllowRequest(ctx, "test|198.51.100.7", 3, time.Minute)
+		if err != nil || !allowed {
+			t.Fatalf("expected request %d to be allowed, got %t (%v)", i+1, allowed, err)
+		}
+	}
+	allowed, wait, err := second.AllowRequest(ctx, "test|198.51.100.7", 3, time.Minute)
+	if err != nil || allowed || wait <= 0 || wait > time.Minute {
+		t.Fatalf("expected the shared limit to be used up, got %t after %v (%v)", allowed, wait, err)
+	}
+	if allowed, _, _ := first.AllowRequest(ctx, "test|198.51.100.8", 3, time.Minute); !allowed {
+		t.Fatal("expected another key to have its own allowance")
+	}
+}
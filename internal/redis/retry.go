@@ -0,0 +1,76 @@
+package redisdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	transientRetries = 3
+	transientBackoff = 50 * time.Millisecond
+)
+
+// transientErrorPrefixes are replies Redis sends when it cannot serve a
+// command right now but will shortly: while loading its dataset, during a
+// failover, or while cluster slots move. The command was not executed, so it
+// is safe to send again.
+var transientErrorPrefixes = []string{"LOADING", "MOVED", "ASK", "TRYAGAIN", "CLUSTERDOWN", "MASTERDOWN"}
+
+// writeRefusedPrefixes are replies for writes Redis rejects until an operator
+// intervenes: a replica promoted away from, maxmemory reached under
+// noeviction, or failing RDB snapshots. Reads still work.
+var writeRefusedPrefixes = []string{"READONLY", "OOM", "MISCONF"}
+
+func isTransientError(err error) bool {
+	for _, prefix := range transientErrorPrefixes {
+		if redis.HasErrorPrefix(err, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWriteRefused(err error) bool {
+	for _, prefix := range writeRefusedPrefixes {
+		if redis.HasErrorPrefix(err, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// refusedWrite wraps err in ErrReadOnly when it is Redis refusing a write,
+// for writes that cannot be retried, such as pipelines.
+func refusedWrite(err error) error {
+	if isWriteRefused(err) {
+		return fmt.Errorf("%w: %w", ErrReadOnly, err)
+	}
+	return err
+}
+
+// withRetry runs op, retrying up to transientRetries times with a linear
+// backoff while it fails with a transient Redis error. Any other error,
+// including ErrNotFound, is returned immediately; refused writes are wrapped
+// in ErrReadOnly.
+func withRetry[T any](ctx context.Context, op func() (T, error)) (T, error) {
+	for attempt := 0; ; attempt++ {
+		value, err := op()
+		if isWriteRefused(err) {
+			return value, refusedWrite(err)
+		}
+		if err == nil || attempt == transientRetries || !isTransientError(err) {
+			return value, err
+		}
+
+		timer := time.NewTimer(transientBackoff * time.Duration(attempt+1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return value, err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisReplyError mimics an error reply from the server.
+type redisReplyError string
+
+func (e redisReplyError) Error() string { return string(e) }
+func (redisReplyError) RedisError()     {}
+
+// scriptedHook answers every command without a server: the first failures
+// calls get err, and later calls are completed by reply, which may fail them
+// with SetErr.
+type scriptedHook struct {
+	failures int
+	err      error
+	reply    func(redis.Cmder)
+	calls    int
+}
+
+func (h *scriptedHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("dial disabled in tests")
+	}
+}
+
+func (h *scriptedHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.calls++
+		if h.calls <= h.failures {
+			return h.err
+		}
+		h.reply(cmd)
+		return cmd.Err()
+	}
+}
+
+func (h *scriptedHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	process := h.ProcessHook(nil)
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			if err := process(ctx, cmd); err != nil {
+				cmd.SetErr(err)
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func newScriptedService(hook *scriptedHook) *service {
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+	rdb.AddHook(hook)
+	return &service{redis: rdb}
+}
+
+func TestGetLongURLRetriesTransientErrors(t *testing.T) {
+	for _, reply := range []string{"LOADING Redis is loading the dataset in memory", "MOVED 3999 127.0.0.1:6381"} {
+		hook := &scriptedHook{
+			failures: 2,
+			err:      redisReplyError(reply),
+			reply: func(cmd redis.Cmder) {
+				cmd.(*redis.Cmd).SetVal([]any{"https://example.com", int64(-1), int64(0), int64(0)})
+			},
+		}
+		srv := newScriptedService(hook)
+
+		url, err := srv.GetLongURL(context.Background(), "abc1234")
+		if err != nil {
+			t.Fatalf("%s: expected retry to succeed, got %v", reply, err)
+		}
+		if url != "https://example.com" {
+			t.Fatalf("%s: unexpected url %q", reply, url)
+		}
+		if hook.calls != 3 {
+			t.Fatalf("%s: expected 3 attempts, got %d", reply, hook.calls)
+		}
+	}
+}
+
+func TestIncrementVisitsRetriesTransientErrors(t *testing.T) {
+	hook := &scriptedHook{
+		failures: 1,
+		err:      redisReplyError("LOADING Redis is loading the dataset in memory"),
+		reply:    func(cmd redis.Cmder) { cmd.(*redis.Cmd).SetVal(int64(1)) },
+	}
+	srv := newScriptedService(hook)
+
+	visits, err := srv.IncrementVisits(context.Background(), "abc1234")
+	if err != nil {
+		t.Fatalf("expected retry to succeed, got %v", err)
+	}
+	if visits != 1 {
+		t.Fatalf("expected visits=1, got %d", visits)
+	}
+}
+
+func TestRetryGivesUpAndSkipsPermanentErrors(t *testing.T) {
+	hook := &scriptedHook{failures: 100, err: redisReplyError("LOADING Redis is loading the dataset in memory")}
+	srv := newScriptedService(hook)
+	if _, err := srv.GetLongURL(context.Background(), "abc1234"); !isTransientError(err) {
+		t.Fatalf("expected the transient error after exhausting retries, got %v", err)
+	}
+	if hook.calls != transientRetries+1 {
+		t.Fatalf("expected %d attempts, got %d", transientRetries+1, hook.calls)
+	}
+
+	hook = &scriptedHook{failures: 100, err: redisReplyError("WRONGTYPE Operation against a key holding the wrong kind of value")}
+	srv = newScriptedService(hook)
+	if _, err := srv.GetLongURL(context.Background(), "abc1234"); err == nil || isTransientError(err) {
+		t.Fatalf("expected a permanent error, got %v", err)
+	}
+	if hook.calls != 1 {
+		t.Fatalf("expected permanent errors not to be retried, got %d attempts", hook.calls)
+	}
+
+	hook = &scriptedHook{failures: 1, err: redis.Nil}
+	srv = newScriptedService(hook)
+	if _, err := srv.IncrementVisits(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if hook.calls != 1 {
+		t.Fatalf("expected ErrNotFound not to be retried, got %d attempts", hook.calls)
+	}
+}
+
+func TestRefusedWritesReturnErrReadOnly(t *testing.T) {
+	for _, reply := range []string{
+		"READONLY You can't write against a read only replica.",
+		"OOM command not allowed when used memory > 'maxmemory'.",
+	} {
+		hook := &scriptedHook{failures: 100, err: redisReplyError(reply)}
+		srv := newScriptedService(hook)
+
+		err := srv.CreateShortURL(context.Background(), "abc1234", "https://example.com", CreateOptions{})
+		if !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("%s: expected ErrReadOnly, got %v", reply, err)
+		}
+		if hook.calls != 1 {
+			t.Fatalf("%s: expected refused writes not to be retried, got %d attempts", reply, hook.calls)
+		}
+	}
+}
+
+// readOnlyReplica answers like a read-only replica holding a link: reads and
+// transaction control succeed, and every write is refused.
+func readOnlyReplica() *scriptedHook {
+	return &scriptedHook{
+		reply: func(cmd redis.Cmder) {
+			switch cmd.Name() {
+			case "hmget":
+				values := make([]any, len(cmd.Args())-2)
+				for i := range values {
+					values[i] = "x"
+				}
+				cmd.(*redis.SliceCmd).SetVal(values)
+			case "watch", "unwatch", "multi":
+				cmd.(*redis.StatusCmd).SetVal("OK")
+			default:
+				cmd.SetErr(redisReplyError("READONLY You can't write against a read only replica."))
+			}
+		},
+	}
+}
+
+func TestLinkWritesReturnErrReadOnly(t *testing.T) {
+	srv := newScriptedService(readOnlyReplica())
+	ctx := context.Background()
+	disabled := true
+
+	for name, write := range map[string]func() error{
+		"delete":         func() error { return srv.DeleteShortURL(ctx, "abc1234") },
+		"rotate":         func() error { return srv.RotateCode(ctx, "abc1234", "def5678") },
+		"set expiration": func() error { return srv.SetExpiration(ctx, "abc1234", time.Hour) },
+		"add tags":       func() error { return srv.AddTags(ctx, "abc1234", []string{"docs"}) },
+		"remove tags":    func() error { return srv.RemoveTags(ctx, "abc1234", []string{"x"}) },
+		"update":         func() error { return srv.UpdateLink(ctx, "abc1234", LinkUpdate{Disabled: &disabled}) },
+	} {
+		if err := write(); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("%s: expected ErrReadOnly, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// endlessScanService answers every SCAN with an empty page and a cursor that
+// never reaches 0, like a huge keyspace, and cancels the returned context on
+// the third SCAN.
+func endlessScanService(t *testing.T) (*service, context.Context, *int) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	scans := 0
+	hook := &scriptedHook{reply: func(cmd redis.Cmder) {
+		if cmd, ok := cmd.(*redis.ScanCmd); ok {
+			scans++
+			cmd.SetVal(nil, uint64(scans))
+			if scans == 3 {
+				cancel()
+			}
+		}
+	}}
+	return newScriptedService(hook), ctx, &scans
+}
+
+func TestScansStopWhenContextIsCancelled(t *testing.T) {
+	scans := map[string]func(*service, context.Context) error{
+		"ScanURLs": func(s *service, ctx context.Context) error {
+			return s.ScanURLs(ctx, func(URLStats) error { return nil })
+		},
+		"sweepExpired": (*service).sweepExpired,
+	}
+	for name, scan := range scans {
+		srv, ctx, calls := endlessScanService(t)
+
+		result := make(chan error, 1)
+		go func() { result <- scan(srv, ctx) }()
+		select {
+		case err := <-result:
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("%s: expected context.Canceled, got %v", name, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: kept scanning after the context was cancelled", name)
+		}
+		if *calls != 3 {
+			t.Fatalf("%s: expected the scan to stop after 3 SCANs, got %d", name, *calls)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// searchScanLimit bounds how many indexed links one search reads.
+	searchScanLimit = 10000
+	searchBatch     = 500
+)
+
+// ErrURLsEncrypted is returned by SearchDestinations while URL encryption is
+// enabled: destinations are not indexed then, so there is nothing to search.
+var ErrURLsEncrypted = errors.New("destinations are not searchable while URL encryption is enabled")
+
+// indexedHost is the host longURL is indexed under in short:host:{host},
+// lowercased and without a port, or "" when it is not indexed. Nothing is
+// indexed while URLs are encrypted, since the key names would give the
+// destinations away.
+func (s *service) indexedHost(longURL string) string {
+	if s.urls != nil {
+		return ""
+	}
+	parsed, err := url.Parse(longURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// SearchDestinations returns the codes of up to limit links whose destination
+// contains query, ignoring case, sorted. A query without a slash is matched
+// against destination hosts and answered from the host index alone. One with
+// a slash is matched against the whole URL, reading only links on hosts that
+// contain the part before the slash (every host when it starts with one). At
+// most searchScanLimit links are read, so a broad query may miss matches.
+// Links created before the host index existed are not found.
+func (s *service) SearchDestinations(ctx context.Context, query string, limit int) ([]string, error) {
+	if s.urls != nil {
+		return nil, ErrURLsEncrypted
+	}
+
+	query = strings.ToLower(query)
+	hostPart := query
+	if _, rest, ok := strings.Cut(hostPart, "://"); ok {
+		hostPart = rest
+	}
+	hostPart, _, matchURL := strings.Cut(hostPart, "/")
+
+	names, err := s.redis.SMembers(ctx, hostsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("search destinations: %w", err)
+	}
+	names = slices.DeleteFunc(names, func(host string) bool { return !strings.Contains(host, hostPart) })
+	slices.Sort(names)
+
+	codes, err := s.hostMembers(ctx, names)
+	if err != nil {
+		return nil, fmt.Errorf("search destinations: %w", err)
+	}
+
+	matches := []string{}
+	for start := 0; start < len(codes) && start < searchScanLimit && len(matches) < limit; start += searchBatch {
+		batch := codes[start:min(start+searchBatch, len(codes), searchScanLimit)]
+		urls, err := s.storedURLs(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("search destinations: %w", err)
+		}
+		for _, code := range batch {
+			longURL, ok := urls[code]
+			if !ok || matchURL && !strings.Contains(strings.ToLower(longURL), query) {
+				continue
+			}
+			matches = append(matches, code)
+			if len(matches) == limit {
+				break
+			}
+		}
+	}
+	return matches, nil
+}
+
+// hostMembers returns the codes indexed under every host in hosts, sorted.
+// Hosts whose set is gone are dropped from the host name index on the way.
+func (s *service) hostMembers(ctx context.Context, hosts []string) ([]string, error) {
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+
+	pipe := s.redis.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(hosts))
+	for i, host := range hosts {
+		cmds[i] = pipe.SMembers(ctx, hostKey(host))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	keys := []string{hostsKey}
+	var empty []any
+	for i, host := range hosts {
+		if members := cmds[i].Val(); len(members) > 0 {
+			codes = append(codes, members...)
+		} else {
+			keys = append(keys, hostKey(host))
+			empty = append(empty, host)
+		}
+	}
+	if len(empty) > 0 {
+		if err := pruneGroupsScript.Run(ctx, s.redis, keys, empty...).Err(); err != nil {
+			return nil, fmt.Errorf("prune hosts: %w", err)
+		}
+	}
+
+	slices.Sort(codes)
+	return slices.Compact(codes), nil
+}
+
+// storedURLs reads the destinations of codes in one pipelined round trip,
+// leaving out codes whose link no longer exists.
+func (s *service) storedURLs(ctx context.Context, codes []string) (map[string]string, error) {
+	pipe := s.redis.Pipeline()
+	cmds := make([]*redis.StringCmd, len(codes))
+	for i, code := range codes {
+		cmds[i] = pipe.HGet(ctx, s.shortURLKey(code), "url")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	urls := make(map[string]string, len(codes))
+	for i, code := range codes {
+		if stored := cmds[i].Val(); stored != "" {
+			urls[code] = stored
+		}
+	}
+	return urls, nil
+}
@@ -0,0 +1,129 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// roundTripHook answers HGETALL and TTL without a server, counting every
+// command or pipeline sent as one round trip.
+type roundTripHook struct {
+	hash       map[string]string
+	ttl        time.Duration
+	ttlErr     error
+	roundTrips int
+}
+
+func (h *roundTripHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("dial disabled in tests")
+	}
+}
+
+func (h *roundTripHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.roundTrips++
+		h.answer(cmd)
+		return cmd.Err()
+	}
+}
+
+func (h *roundTripHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		h.roundTrips++
+		var first error
+		for _, cmd := range cmds {
+			h.answer(cmd)
+			if first == nil {
+				first = cmd.Err()
+			}
+		}
+		return first
+	}
+}
+
+func (h *roundTripHook) answer(cmd redis.Cmder) {
+	switch cmd := cmd.(type) {
+	case *redis.MapStringStringCmd:
+		cmd.SetVal(h.hash)
+	case *redis.DurationCmd:
+		if h.ttlErr != nil {
+			cmd.SetErr(h.ttlErr)
+			return
+		}
+		cmd.SetVal(h.ttl)
+	}
+}
+
+func newRoundTripService(hook *roundTripHook) *service {
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+	rdb.AddHook(hook)
+	return &service{redis: rdb}
+}
+
+func TestGetStatsSingleRoundTrip(t *testing.T) {
+	hash := map[string]string{
+		"url":         "https://example.com/docs",
+		"created_at":  "2030-01-02T03:04:05Z",
+		"visits":      "42",
+		"tags":        "docs,launch",
+		"title":       "Docs",
+		"group":       "marketing",
+		"one_time":    "1",
+		"description": "The docs",
+	}
+	hook := &roundTripHook{hash: hash, ttl: -1}
+	srv := newRoundTripService(hook)
+
+	stats, err := srv.GetStats(context.Background(), "docs01")
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	want := URLStats{
+		Code:        "docs01",
+		LongURL:     "https://example.com/docs",
+		CreatedAt:   time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+		Visits:      42,
+		Tags:        []string{"docs", "launch"},
+		OneTime:     true,
+		Title:       "Docs",
+		Description: "The docs",
+		Group:       "marketing",
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("unexpected stats:\n got %+v\nwant %+v", stats, want)
+	}
+	if hook.roundTrips != 1 {
+		t.Fatalf("expected one round trip, got %d", hook.roundTrips)
+	}
+
+	hook.ttl = 90 * time.Second
+	stats, err = srv.GetStats(context.Background(), "docs01")
+	if err != nil || stats.TTLSeconds == nil || *stats.TTLSeconds != 90 || stats.ExpiresAt == nil {
+		t.Fatalf("expected a 90s TTL with an expiry time, got %+v (%v)", stats, err)
+	}
+}
+
+func TestGetStatsErrors(t *testing.T) {
+	for name, hash := range map[string]map[string]string{
+		"missing":  {},
+		"reserved": {"state": stateReserved},
+	} {
+		srv := newRoundTripService(&roundTripHook{hash: hash, ttl: -2})
+		if _, err := srv.GetStats(context.Background(), "gone01"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%s: expected ErrNotFound, got %v", name, err)
+		}
+	}
+
+	hook := &roundTripHook{hash: map[string]string{"url": "https://example.com"}, ttlErr: redisReplyError("ERR boom")}
+	_, err := newRoundTripService(hook).GetStats(context.Background(), "docs01")
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected a failed TTL to be a real error, got %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package redisdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// maxUpdateAttempts bounds how often UpdateLink retries when the link changes
+// between reading it and writing the update.
+const maxUpdateAttempts = 5
+
+// destinationFields are the results of the last destination check, which no
+// longer apply once the destination changes.
+var destinationFields = []string{"dest_status", "dest_error", "dest_healthy", "dest_checked_at"}
+
+// LinkUpdate lists the changes UpdateLink applies to a link. Nil fields are
+// left as they are; a pointer to the zero value clears the setting.
+type LinkUpdate struct {
+	URL         *string
+	Title       *string
+	Description *string
+	// Tags replaces every tag of the link.
+	Tags *[]string
+	// Group moves the link to another group; "" removes it from its group.
+	Group *string
+	// TTL is applied as by SetExpiration: <= 0 makes the link permanent.
+	TTL *time.Duration
+	// Sliding turns sliding expiration on or off. Turning it on needs a TTL
+	// in the same update.
+	Sliding *bool
+	// Disabled stops or resumes redirects without deleting the link. A
+	// disabled link resolves to ErrNotActive.
+	Disabled *bool
+}
+
+// UpdateLink applies update to an existing link as one transaction, keeping
+// the tag, group and host indexes, the expiry record and the history in step.
+// The link is watched while its current tags, group and host are read, so a
+// concurrent change makes the update start over rather than index the wrong
+// values. A write Redis refuses is returned as ErrReadOnly.
+func (s *service) UpdateLink(ctx context.Context, code string, update LinkUpdate) error {
+	storedURL := ""
+	if update.URL != nil {
+		var err error
+		if storedURL, err = s.sealURL(*update.URL); err != nil {
+			return fmt.Errorf("encrypt long url: %w", err)
+		}
+	}
+
+	key := s.shortURLKey(code)
+	apply := func(tx *redis.Tx) error {
+		values, err := tx.HMGet(ctx, key, "url", "tags", "group", "host").Result()
+		if err != nil {
+			return err
+		}
+		if values[0] == nil {
+			return ErrNotFound
+		}
+		currentTags, _ := values[1].(string)
+		currentGroup, _ := values[2].(string)
+		currentHost, _ := values[3].(string)
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			s.queueUpdate(ctx, pipe, code, update, storedURL, splitTags(currentTags), currentGroup, currentHost)
+			return nil
+		})
+		return err
+	}
+
+	for range maxUpdateAttempts {
+		err := s.redis.Watch(ctx, apply, key)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("update short url: %w", refusedWrite(err))
+		}
+		return err
+	}
+	return fmt.Errorf("update short url: %w", redis.TxFailedErr)
+}
+
+// queueUpdate adds the writes for update to pipe, given the link's current
+// tags, group and destination host.
+func (s *service) queueUpdate(ctx context.Context, pipe redis.Pipeliner, code string, update LinkUpdate, storedURL string, currentTags []string, currentGroup, currentHost string) {
+	key := s.shortURLKey(code)
+	var set []any
+	var del []string
+	text := func(field string, value *string) {
+		switch {
+		case value == nil:
+		case *value == "":
+			del = append(del, field)
+		default:
+			set = append(set, field, *value)
+		}
+	}
+
+	if update.URL != nil {
+		set = append(set, "url", storedURL)
+		del = append(del, destinationFields...)
+		// A new destination replaces a split one.
+		del = append(del, "variants", "sticky_variants")
+		if host := s.indexedHost(*update.URL); host != currentHost {
+			text("host", &host)
+			if currentHost != "" {
+				pipe.SRem(ctx, hostKey(currentHost), code)
+			}
+			if host != "" {
+				pipe.SAdd(ctx, hostKey(host), code)
+				pipe.SAdd(ctx, hostsKey, host)
+			}
+			hsetIfExistsScript.Eval(ctx, pipe, []string{s.expiringKey(code)}, "host", host)
+		}
+	}
+	text("title", update.Title)
+	text("description", update.Description)
+	text("group", update.Group)
+
+	if update.Tags != nil {
+		tags := mergeTags(nil, *update.Tags)
+		joined := strings.Join(tags, ",")
+		text("tags", &joined)
+		for _, tag := range currentTags {
+			if !slices.Contains(tags, tag) {
+				pipe.SRem(ctx, tagKey(tag), code)
+			}
+		}
+		for _, tag := range tags {
+			pipe.SAdd(ctx, tagKey(tag), code)
+		}
+		hsetIfExistsScript.Eval(ctx, pipe, []string{s.expiringKey(code)}, "tags", joined)
+	}
+	if update.Group != nil && *update.Group != currentGroup {
+		if currentGroup != "" {
+			pipe.SRem(ctx, groupKey(currentGroup), code)
+		}
+		if *update.Group != "" {
+			pipe.SAdd(ctx, groupKey(*update.Group), code)
+			pipe.SAdd(ctx, groupsKey, *update.Group)
+		}
+		hsetIfExistsScript.Eval(ctx, pipe, []string{s.expiringKey(code)}, "group", *update.Group)
+	}
+
+	if update.Sliding != nil {
+		if *update.Sliding {
+			set = append(set, "sliding", 1)
+		} else {
+			del = append(del, "sliding", "ttl_seconds")
+		}
+	}
+
+	if update.Disabled != nil {
+		if *update.Disabled {
+			set = append(set, "disabled", 1)
+		} else {
+			del = append(del, "disabled")
+		}
+	}
+
+	if len(del) > 0 {
+		pipe.HDel(ctx, key, del...)
+	}
+	if len(set) > 0 {
+		pipe.HSet(ctx, key, set...)
+	}
+	// Last, so a sliding flag set above gets its ttl_seconds.
+	if update.TTL != nil {
+		keys := []string{key, s.referrerKey(code), s.geoKey(code), s.expiringKey(code), s.historyKey(code)}
+		setExpirationScript.Eval(ctx, pipe, keys, update.TTL.Milliseconds(), code, s.trackExpiry)
+	}
+
+	for _, event := range update.events() {
+		s.queueEvent(ctx, pipe, code, event)
+	}
+}
+
+// events returns the history events update records: an update for any
+// change of settings, then a disable or enable.
+func (u LinkUpdate) events() []string {
+	var events []string
+	if u.URL != nil || u.Title != nil || u.Description != nil || u.Tags != nil ||
+		u.Group != nil || u.TTL != nil || u.Sliding != nil {
+		events = append(events, EventUpdate)
+	}
+	if u.Disabled != nil {
+		if *u.Disabled {
+			events = append(events, EventDisable)
+		} else {
+			events = append(events, EventEnable)
+		}
+	}
+	return events
+}
@@ -0,0 +1,67 @@
+package redisdb
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// Variant is one destination of a link that splits its redirects. Weight is
+// its share of the visits relative to the other variants'.
+type Variant struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+	Visits int64  `json:"visits,omitempty"`
+}
+
+// PickVariant returns the index of the variant that roll, in [0, 1), falls
+// on by weight, as VisitURL picks it, or -1 when there are none.
+func PickVariant(variants []Variant, roll float64) int {
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+	point := roll * float64(total)
+	for i, v := range variants {
+		point -= float64(v.Weight)
+		if point < 0 || i == len(variants)-1 {
+			return i
+		}
+	}
+	return -1
+}
+
+// variantVisitsField is the link hash field counting visits to variant i.
+func variantVisitsField(i int) string {
+	return "variant_visits:" + strconv.Itoa(i)
+}
+
+// sealVariants encodes variants for the variants field, with each URL sealed
+// like the url field. Visit counts are kept in their own fields.
+func (s *service) sealVariants(variants []Variant) (string, error) {
+	stored := make([]Variant, len(variants))
+	for i, v := range variants {
+		sealed, err := s.sealURL(v.URL)
+		if err != nil {
+			return "", err
+		}
+		stored[i] = Variant{URL: sealed, Weight: v.Weight}
+	}
+	data, err := json.Marshal(stored)
+	return string(data), err
+}
+
+// openVariants reverses sealVariants.
+func (s *service) openVariants(stored string) ([]Variant, error) {
+	var variants []Variant
+	if err := json.Unmarshal([]byte(stored), &variants); err != nil {
+		return nil, err
+	}
+	for i := range variants {
+		url, err := s.openURL(variants[i].URL)
+		if err != nil {
+			return nil, err
+		}
+		variants[i].URL = url
+	}
+	return variants, nil
+}
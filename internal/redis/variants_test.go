@@ -0,0 +1,15 @@
+package redisdb
+
+import "testing"
+
+func TestPickVariant(t *testing.T) {
+	variants := []Variant{{Weight: 60}, {Weight: 30}, {Weight: 10}}
+	for roll, want := range map[float64]int{0: 0, 0.59: 0, 0.6: 1, 0.89: 1, 0.9: 2, 0.999: 2} {
+		if got := PickVariant(variants, roll); got != want {
+			t.Fatalf("roll %v: expected variant %d, got %d", roll, want, got)
+		}
+	}
+	if got := PickVariant(nil, 0.5); got != -1 {
+		t.Fatalf("expected -1 without variants, got %d", got)
+	}
+}
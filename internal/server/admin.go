@@ -0,0 +1,88 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+// redactedHashFields maps stored fields that must never leave the server to
+// the boolean presence flag reported in their place.
+var redactedHashFields = map[string]string{
+	"password_hash":      "has_password",
+	managementTokenField: "has_management_token",
+}
+
+type rawURLResponse struct {
+	Code       string            `json:"code"`
+	Fields     map[string]string `json:"fields"`
+	Flags      map[string]bool   `json:"flags,omitempty"`
+	TTLSeconds *int64            `json:"ttl_seconds"`
+}
+
+// requireAdmin only lets requests carrying "Authorization: Bearer
+// <ADMIN_TOKEN>" through. Without a configured token the admin API is off.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" {
+			s.writeError(w, http.StatusForbidden, "admin API is disabled")
+			return
+		}
+		if !s.isAdmin(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			s.writeError(w, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// isAdmin reports whether r carries the configured admin token.
+func (s *Server) isAdmin(r *http.Request) bool {
+	if s.adminToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1
+}
+
+// adminRawURLHandler returns everything stored for a code, with secrets
+// replaced by presence flags.
+func (s *Server) adminRawURLHandler(w http.ResponseWriter, r *http.Request) {
+	code := s.pathCode(r)
+	if code == "" {
+		s.writeError(w, http.StatusNotFound, "short code not found")
+		return
+	}
+
+	fields, ttl, err := s.db.GetRaw(r.Context(), code)
+	if err != nil {
+		if errors.Is(err, redisdb.ErrNotFound) {
+			s.writeError(w, http.StatusNotFound, "short code not found")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch raw URL")
+		return
+	}
+
+	response := rawURLResponse{Code: code, Fields: make(map[string]string, len(fields))}
+	for field, value := range fields {
+		if flag, ok := redactedHashFields[field]; ok {
+			if response.Flags == nil {
+				response.Flags = make(map[string]bool)
+			}
+			response.Flags[flag] = value != ""
+			continue
+		}
+		response.Fields[field] = value
+	}
+	if ttl > 0 {
+		seconds := int64(ttl.Seconds())
+		response.TTLSeconds = &seconds
+	}
+
+	s.writeJSON(w, http.StatusOK, response)
+}
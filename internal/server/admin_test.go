@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestAdminRawURLRedactsSecrets(t *testing.T) {
+	db := newMockDB()
+	opts := redisdb.CreateOptions{TTL: time.Hour, Owner: "owner-hash"}
+	if err := db.CreateShortURL(context.Background(), "raw0001", "https://example.com", opts); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	db.extra["raw0001"] = map[string]string{
+		"password_hash": "$2a$10$abcdefghijklmnopqrstuv",
+		"one_time":      "1",
+	}
+
+	s := &Server{db: db, adminToken: "s3cret"}
+	h := s.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/urls/raw0001/raw", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+
+	var out rawURLResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if _, leaked := out.Fields["password_hash"]; leaked {
+		t.Fatal("password_hash must be redacted")
+	}
+	if !out.Flags["has_password"] {
+		t.Fatalf("expected has_password flag, got %v", out.Flags)
+	}
+	for _, field := range []string{"url", "created_at", "visits", "owner", "one_time"} {
+		if _, ok := out.Fields[field]; !ok {
+			t.Fatalf("expected field %q in %v", field, out.Fields)
+		}
+	}
+	if out.TTLSeconds == nil || *out.TTLSeconds <= 0 {
+		t.Fatalf("expected a positive ttl, got %v", out.TTLSeconds)
+	}
+}
+
+func TestAdminRawURLRequiresToken(t *testing.T) {
+	db := newMockDB()
+	db.store["raw0002"] = redisdb.URLStats{Code: "raw0002", LongURL: "https://example.com"}
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		status int
+	}{
+		{name: "disabled", header: "Bearer anything", status: http.StatusForbidden},
+		{name: "missing header", token: "s3cret", status: http.StatusUnauthorized},
+		{name: "wrong token", token: "s3cret", header: "Bearer nope", status: http.StatusUnauthorized},
+		{name: "valid token", token: "s3cret", header: "Bearer s3cret", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{db: db, adminToken: tt.token}
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/urls/raw0002/raw", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			res := httptest.NewRecorder()
+			s.RegisterRoutes().ServeHTTP(res, req)
+			if res.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, res.Code)
+			}
+		})
+	}
+}
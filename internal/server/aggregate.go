@@ -0,0 +1,71 @@
+package server
+
+import "net/http"
+
+// aggregateStats totals the visits of every live link carrying a tag or
+// filed under a group. Unique visitors are not tracked, so only total visits
+// are reported.
+type aggregateStats struct {
+	Tag    string `json:"tag,omitempty"`
+	Group  string `json:"group,omitempty"`
+	Links  int    `json:"links"`
+	Visits int64  `json:"visits"`
+	// VisitsBucket is set when Visits is rounded for BUCKET_PUBLIC_VISITS.
+	VisitsBucket string `json:"visits_bucket,omitempty"`
+}
+
+func (s *Server) tagStatsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := normalizeTags([]string{r.PathValue("tag")})
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(tags) == 0 {
+		s.writeError(w, http.StatusNotFound, "tag not found")
+		return
+	}
+
+	codes, err := s.db.CodesByTags(r.Context(), tags)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch tag stats")
+		return
+	}
+	s.writeAggregate(w, r, aggregateStats{Tag: tags[0]}, codes)
+}
+
+func (s *Server) groupStatsHandler(w http.ResponseWriter, r *http.Request) {
+	group, err := normalizeGroup(r.PathValue("group"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if group == "" {
+		s.writeError(w, http.StatusNotFound, "group not found")
+		return
+	}
+
+	codes, err := s.db.CodesByGroup(r.Context(), group)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch group stats")
+		return
+	}
+	s.writeAggregate(w, r, aggregateStats{Group: group}, codes)
+}
+
+// writeAggregate fills in stats from the visit counts of codes, read in one
+// round trip. Codes whose links are gone are not counted.
+func (s *Server) writeAggregate(w http.ResponseWriter, r *http.Request, stats aggregateStats, codes []string) {
+	counts, err := s.db.VisitCounts(r.Context(), codes)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch visit counts")
+		return
+	}
+	stats.Links = len(counts)
+	for _, visits := range counts {
+		stats.Visits += visits
+	}
+	if s.bucketPublicVisits && !s.isAdmin(r) {
+		stats.Visits, stats.VisitsBucket = visitBucket(stats.Visits)
+	}
+	s.writeJSON(w, http.StatusOK, stats)
+}
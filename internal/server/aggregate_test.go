@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestAggregateStats(t *testing.T) {
+	db := newMockDB()
+	ctx := context.Background()
+	links := []struct {
+		code   string
+		opts   redisdb.CreateOptions
+		visits int64
+	}{
+		{"agg0001", redisdb.CreateOptions{Tags: []string{"spring"}, Group: "launch"}, 5},
+		{"agg0002", redisdb.CreateOptions{Tags: []string{"spring", "email"}, Group: "launch"}, 7},
+		{"agg0003", redisdb.CreateOptions{Tags: []string{"spring"}}, 30},
+		{"agg0004", redisdb.CreateOptions{Tags: []string{"autumn"}, Group: "launch"}, 100},
+	}
+	for _, link := range links {
+		if err := db.CreateShortURL(ctx, link.code, "https://example.com/"+link.code, link.opts); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		if _, err := db.IncrementVisitsBy(ctx, link.code, link.visits); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	h := (&Server{db: db}).RegisterRoutes()
+
+	for target, want := range map[string]aggregateStats{
+		"/api/v1/tags/Spring/stats":   {Tag: "spring", Links: 3, Visits: 42},
+		"/api/v1/tags/unused/stats":   {Tag: "unused", Links: 0, Visits: 0},
+		"/api/v1/groups/launch/stats": {Group: "launch", Links: 3, Visits: 112},
+	} {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, target, nil))
+		var got aggregateStats
+		if err := json.Unmarshal(res.Body.Bytes(), &got); err != nil || res.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected response %d: %s", target, res.Code, res.Body.String())
+		}
+		if got != want {
+			t.Fatalf("%s: expected %+v, got %+v", target, want, got)
+		}
+	}
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/tags/not%20a%20tag/stats", nil))
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected an invalid tag to be rejected, got %d", res.Code)
+	}
+}
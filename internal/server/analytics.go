@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+// analyticsEventsDropped counts click events discarded because the analytics
+// queue was full or already shut down.
+var analyticsEventsDropped = expvar.NewInt("analytics_events_dropped")
+
+const (
+	// dropNew discards the event that found the queue full.
+	dropNew = "drop-new"
+	// dropOldest discards the longest-waiting event to make room.
+	dropOldest = "drop-oldest"
+
+	defaultAnalyticsQueueSize = 1024
+	// analyticsPublishTimeout bounds each publish, so a stalled Redis stalls
+	// the queue rather than leaking goroutines.
+	analyticsPublishTimeout = 5 * time.Second
+)
+
+// analyticsQueue publishes click events from one background worker, off the
+// redirect path. It holds at most its capacity: when a click flood outpaces
+// the worker, events are dropped by policy and counted instead of piling up,
+// and redirects never wait on it.
+type analyticsQueue struct {
+	events  chan redisdb.ClickEvent
+	policy  string
+	publish func(context.Context, redisdb.ClickEvent) error
+	done    chan struct{}
+
+	// mu guards closed, so no enqueue can send on events once shutdown has
+	// closed it. Enqueues never block, so holding it costs them nothing.
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newAnalyticsQueue(size int, policy string, publish func(context.Context, redisdb.ClickEvent) error) *analyticsQueue {
+	q := &analyticsQueue{
+		events:  make(chan redisdb.ClickEvent, size),
+		policy:  policy,
+		publish: publish,
+		done:    make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+func (q *analyticsQueue) run() {
+	defer close(q.done)
+	for event := range q.events {
+		ctx, cancel := context.WithTimeout(context.Background(), analyticsPublishTimeout)
+		if err := q.publish(ctx, event); err != nil {
+			log.Printf("failed to publish click for %s: %v", event.Code, err)
+		}
+		cancel()
+	}
+}
+
+// enqueue adds event without blocking, dropping one event when the queue is
+// full. After shutdown, as for a redirect still running when the HTTP server
+// gave up waiting for it, the event is dropped.
+func (q *analyticsQueue) enqueue(event redisdb.ClickEvent) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		analyticsEventsDropped.Add(1)
+		return
+	}
+	select {
+	case q.events <- event:
+		return
+	default:
+	}
+	if q.policy == dropOldest {
+		select {
+		case <-q.events:
+		default:
+		}
+		select {
+		case q.events <- event:
+		default:
+			// Other callers refilled the slot; this event loses instead.
+		}
+	}
+	analyticsEventsDropped.Add(1)
+}
+
+// shutdown stops accepting events and waits until the queued ones are
+// published or ctx is done.
+func (q *analyticsQueue) shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.events)
+	}
+	q.mu.Unlock()
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// publishClick hands a counted visit to the analytics queue. Servers built
+// without one, as in tests, publish before returning.
+func (s *Server) publishClick(ctx context.Context, event redisdb.ClickEvent) {
+	if s.clicks != nil {
+		s.clicks.enqueue(event)
+		return
+	}
+	if err := s.db.PublishClick(ctx, event); err != nil {
+		log.Printf("failed to publish click for %s: %v", event.Code, err)
+	}
+}
+
+// Shutdown drains the analytics queue, publishing the clicks still waiting
+// in it, and makes a last attempt to save any links created while Redis was
+// unreachable. Call it after the HTTP and gRPC servers have stopped taking
+// requests and before closing the database.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var errs []error
+	if s.clicks != nil {
+		if err := s.clicks.shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("dropped queued analytics: %w", err))
+		}
+	}
+	if s.createBuffer != nil {
+		if err := s.createBuffer.close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("lost buffered links: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+// stalledPublisher blocks every publish until release is closed, like a
+// Redis that has stopped answering, and records what it published.
+type stalledPublisher struct {
+	started   chan struct{}
+	release   chan struct{}
+	published chan redisdb.ClickEvent
+}
+
+func newStalledPublisher() *stalledPublisher {
+	return &stalledPublisher{started: make(chan struct{}, 1), release: make(chan struct{}), published: make(chan redisdb.ClickEvent, 100)}
+}
+
+func (p *stalledPublisher) publish(_ context.Context, event redisdb.ClickEvent) error {
+	select {
+	case p.started <- struct{}{}:
+	default:
+	}
+	<-p.release
+	p.published <- event
+	return nil
+}
+
+func TestAnalyticsQueueDropsWhenFull(t *testing.T) {
+	db := newMockDB()
+	for i := range 5 {
+		code := fmt.Sprintf("flood%02d", i)
+		if err := db.CreateShortURL(context.Background(), code, "https://docs.example.org/"+code, redisdb.CreateOptions{}); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	pub := newStalledPublisher()
+	s := &Server{db: db, clicks: newAnalyticsQueue(2, dropNew, pub.publish)}
+	h := s.RegisterRoutes()
+
+	redirect := func(code string) {
+		t.Helper()
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/"+code, nil))
+		if res.Code != http.StatusFound {
+			t.Fatalf("expected %s to redirect while analytics is backed up, got %d", code, res.Code)
+		}
+	}
+
+	droppedBefore := analyticsEventsDropped.Value()
+	// The worker takes the first event and stalls on it, two more fill the
+	// queue, and the last two are dropped.
+	redirect("flood00")
+	<-pub.started
+	for i := 1; i < 5; i++ {
+		redirect(fmt.Sprintf("flood%02d", i))
+	}
+	if got := analyticsEventsDropped.Value() - droppedBefore; got != 2 {
+		t.Fatalf("expected 2 dropped events, got %d", got)
+	}
+
+	close(pub.release)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	close(pub.published)
+	var codes []string
+	for event := range pub.published {
+		codes = append(codes, event.Code)
+	}
+	if fmt.Sprint(codes) != "[flood00 flood01 flood02]" {
+		t.Fatalf("expected the first three clicks to be published, got %v", codes)
+	}
+}
+
+func TestAnalyticsQueueDropOldest(t *testing.T) {
+	pub := newStalledPublisher()
+	q := newAnalyticsQueue(2, dropOldest, pub.publish)
+
+	droppedBefore := analyticsEventsDropped.Value()
+	q.enqueue(redisdb.ClickEvent{Code: "first"})
+	<-pub.started
+	for _, code := range []string{"a", "b", "c", "d"} {
+		q.enqueue(redisdb.ClickEvent{Code: code})
+	}
+	if got := analyticsEventsDropped.Value() - droppedBefore; got != 2 {
+		t.Fatalf("expected 2 dropped events, got %d", got)
+	}
+
+	close(pub.release)
+	if err := q.shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	close(pub.published)
+	var codes []string
+	for event := range pub.published {
+		codes = append(codes, event.Code)
+	}
+	if fmt.Sprint(codes) != "[first c d]" {
+		t.Fatalf("expected the newest events to survive, got %v", codes)
+	}
+}
+
+func TestAnalyticsQueueDropsAfterShutdown(t *testing.T) {
+	q := newAnalyticsQueue(2, dropNew, func(context.Context, redisdb.ClickEvent) error { return nil })
+	if err := q.shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+
+	droppedBefore := analyticsEventsDropped.Value()
+	// A redirect outliving the HTTP server's shutdown must not panic.
+	q.enqueue(redisdb.ClickEvent{Code: "late"})
+	if got := analyticsEventsDropped.Value() - droppedBefore; got != 1 {
+		t.Fatalf("expected the late event to be dropped, got %d", got)
+	}
+	if err := q.shutdown(context.Background()); err != nil {
+		t.Fatalf("second shutdown failed: %v", err)
+	}
+}
+
+func TestAnalyticsDropPolicyConfig(t *testing.T) {
+	if err := (Config{Port: 8080, AnalyticsDropPolicy: "drop-random"}).withDefaults().validate(); err == nil {
+		t.Fatal("expected an unknown drop policy to be rejected")
+	}
+	cfg := Config{Port: 8080}.withDefaults()
+	if cfg.AnalyticsQueueSize != defaultAnalyticsQueueSize || cfg.AnalyticsDropPolicy != dropNew {
+		t.Fatalf("unexpected defaults: %d %q", cfg.AnalyticsQueueSize, cfg.AnalyticsDropPolicy)
+	}
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/datamatrix"
+	"github.com/boombuler/barcode/qr"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+const (
+	defaultImageSize = 256
+	minImageSize     = 64
+	maxImageSize     = 1024
+)
+
+// barcodeKinds are the symbologies /image can draw, with the quiet zone in
+// modules each one needs around it to scan reliably.
+var barcodeKinds = map[string]struct {
+	encode    func(content string) (barcode.Barcode, error)
+	quietZone int
+}{
+	"qr":         {encode: func(content string) (barcode.Barcode, error) { return qr.Encode(content, qr.M, qr.Auto) }, quietZone: 4},
+	"datamatrix": {encode: datamatrix.Encode, quietZone: 1},
+}
+
+type dataURIResponse struct {
+	DataURI string `json:"data_uri"`
+}
+
+// imageHandler draws the short URL of code as a QR or Data Matrix symbol, as
+// PNG, SVG, or a PNG data URI in JSON that can go straight into an <img src>.
+// size is the image width and height in pixels.
+func (s *Server) imageHandler(w http.ResponseWriter, r *http.Request) {
+	code := s.pathCode(r)
+	if code == "" {
+		s.writeError(w, http.StatusNotFound, "short code not found")
+		return
+	}
+
+	query := r.URL.Query()
+	kind, ok := barcodeKinds[cmp.Or(query.Get("type"), "qr")]
+	if !ok {
+		s.writeError(w, http.StatusBadRequest, "type must be qr or datamatrix")
+		return
+	}
+	format := cmp.Or(query.Get("format"), "png")
+	if format != "png" && format != "svg" && format != "datauri" {
+		s.writeError(w, http.StatusBadRequest, "format must be png, svg, or datauri")
+		return
+	}
+	size := defaultImageSize
+	if raw := query.Get("size"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < minImageSize || parsed > maxImageSize {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("size must be between %d and %d", minImageSize, maxImageSize))
+			return
+		}
+		size = parsed
+	}
+
+	stats, err := s.sharedStats(r.Context(), code)
+	if err != nil {
+		if errors.Is(err, redisdb.ErrNotFound) {
+			s.writeError(w, http.StatusNotFound, "short code not found")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch URL stats")
+		return
+	}
+	if stats.Consumed {
+		s.writeError(w, http.StatusGone, "short url already used")
+		return
+	}
+
+	symbol, err := kind.encode(fmt.Sprintf("%s/%s", s.shortBaseURL(r), code))
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to encode short URL")
+		return
+	}
+	grid := newModuleGrid(symbol, kind.quietZone)
+
+	if format == "svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(grid.svg(size))
+		return
+	}
+	body, err := grid.png(size)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to render image")
+		return
+	}
+	if format == "datauri" {
+		s.writeJSON(w, http.StatusOK, dataURIResponse{DataURI: "data:image/png;base64," + base64.StdEncoding.EncodeToString(body)})
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(body)
+}
+
+// moduleGrid is a symbol's dark modules surrounded by its quiet zone.
+type moduleGrid struct {
+	width, height int
+	dark          [][]bool
+}
+
+func newModuleGrid(symbol barcode.Barcode, quietZone int) moduleGrid {
+	bounds := symbol.Bounds()
+	grid := moduleGrid{width: bounds.Dx() + 2*quietZone, height: bounds.Dy() + 2*quietZone}
+	grid.dark = make([][]bool, grid.height)
+	for y := range grid.dark {
+		grid.dark[y] = make([]bool, grid.width)
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gray := color.GrayModel.Convert(symbol.At(x, y)).(color.Gray)
+			grid.dark[y-bounds.Min.Y+quietZone][x-bounds.Min.X+quietZone] = gray.Y < 128
+		}
+	}
+	return grid
+}
+
+// png draws the grid with whole pixels per module, as large as fits in size,
+// centred on a white size×size canvas.
+func (g moduleGrid) png(size int) ([]byte, error) {
+	scale := max(size/max(g.width, g.height), 1)
+	size = max(size, scale*max(g.width, g.height))
+	offX, offY := (size-scale*g.width)/2, (size-scale*g.height)/2
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{color.White, color.Black})
+	for y, row := range g.dark {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := range scale {
+				for dx := range scale {
+					img.SetColorIndex(offX+x*scale+dx, offY+y*scale+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// svg draws the grid as one path in module units, scaled by the viewer to
+// size×size.
+func (g moduleGrid) svg(size int) []byte {
+	var path strings.Builder
+	for y, row := range g.dark {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	return fmt.Appendf(nil, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="%s"/></svg>`,
+		size, size, g.width, g.height, path.String())
+}
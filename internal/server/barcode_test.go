@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestImageFormats(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "img0001", "https://docs.example.org/image", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	h := (&Server{db: db}).RegisterRoutes()
+
+	for _, kind := range []string{"qr", "datamatrix"} {
+		for _, format := range []string{"png", "svg", "datauri"} {
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/img0001/image?type="+kind+"&format="+format+"&size=200", nil))
+			if res.Code != http.StatusOK || res.Body.Len() == 0 {
+				t.Fatalf("%s/%s: expected an image, got %d %q", kind, format, res.Code, res.Body.String())
+			}
+
+			body := res.Body.Bytes()
+			switch format {
+			case "svg":
+				if res.Header().Get("Content-Type") != "image/svg+xml" || !bytes.HasPrefix(body, []byte("<svg")) || !bytes.Contains(body, []byte(`d="M`)) {
+					t.Fatalf("%s/svg: unexpected body %q", kind, body)
+				}
+				continue
+			case "datauri":
+				var out dataURIResponse
+				if err := json.Unmarshal(body, &out); err != nil {
+					t.Fatalf("%s/datauri: failed to decode response: %v", kind, err)
+				}
+				encoded, ok := strings.CutPrefix(out.DataURI, "data:image/png;base64,")
+				if !ok {
+					t.Fatalf("%s/datauri: unexpected data URI %q", kind, out.DataURI)
+				}
+				var err error
+				if body, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+					t.Fatalf("%s/datauri: invalid base64: %v", kind, err)
+				}
+			case "png":
+				if res.Header().Get("Content-Type") != "image/png" {
+					t.Fatalf("%s/png: unexpected content type %q", kind, res.Header().Get("Content-Type"))
+				}
+			}
+
+			img, err := png.Decode(bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("%s/%s: invalid PNG: %v", kind, format, err)
+			}
+			if b := img.Bounds(); b.Dx() != 200 || b.Dy() != 200 {
+				t.Fatalf("%s/%s: expected a 200x200 image, got %v", kind, format, b)
+			}
+		}
+	}
+}
+
+func TestImageValidatesParams(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "img0001", "https://docs.example.org/image", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	h := (&Server{db: db}).RegisterRoutes()
+
+	tests := map[string]int{
+		"/api/v1/urls/img0001/image":                 http.StatusOK,
+		"/api/v1/urls/img0001/image?type=aztec":      http.StatusBadRequest,
+		"/api/v1/urls/img0001/image?format=gif":      http.StatusBadRequest,
+		"/api/v1/urls/img0001/image?size=32":         http.StatusBadRequest,
+		"/api/v1/urls/img0001/image?size=4096":       http.StatusBadRequest,
+		"/api/v1/urls/img0001/image?size=big":        http.StatusBadRequest,
+		"/api/v1/urls/missing1/image?format=datauri": http.StatusNotFound,
+	}
+	for path, want := range tests {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+		if res.Code != want {
+			t.Errorf("%s: expected status %d, got %d", path, want, res.Code)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+const (
+	maxCampaignSize  = 100
+	campaignIDLength = 12
+)
+
+var campaignIDPattern = regexp.MustCompile(`^[0-9a-z]{12}$`)
+
+// createCampaignRequest creates one link per URL, all sharing the same
+// expiry, tags and group.
+type createCampaignRequest struct {
+	URLs           []string `json:"urls"`
+	ExpirationDays int      `json:"expiration_days,omitempty"`
+	ExpiresIn      string   `json:"expires_in,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	Group          string   `json:"group,omitempty"`
+}
+
+type campaignFailure struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+type createCampaignResponse struct {
+	CampaignID string                   `json:"campaign_id"`
+	Links      []createShortURLResponse `json:"links"`
+	Failed     []campaignFailure        `json:"failed,omitempty"`
+	// ManagementToken unlocks every link of the campaign, and the campaign
+	// itself, with MANAGEMENT_TOKENS. It is only ever returned here.
+	ManagementToken string `json:"management_token,omitempty"`
+}
+
+type updateCampaignRequest struct {
+	Disabled *bool `json:"disabled"`
+}
+
+type campaignUpdateResponse struct {
+	CampaignID string `json:"campaign_id"`
+	Updated    int    `json:"updated"`
+}
+
+// createCampaignHandler shortens a list of URLs in one request under a new
+// campaign id, which later bulk operations take. URLs that fail validation
+// are reported per URL rather than failing the rest; when none succeed the
+// first failure is the response.
+func (s *Server) createCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	var req createCampaignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if len(req.URLs) == 0 {
+		s.writeError(w, http.StatusBadRequest, "urls must not be empty")
+		return
+	}
+	if len(req.URLs) > maxCampaignSize {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d urls per campaign", maxCampaignSize))
+		return
+	}
+
+	id, err := generateShortCode(campaignIDLength, lowerCaseAlphabet)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to create campaign")
+		return
+	}
+	response := createCampaignResponse{CampaignID: id, Links: []createShortURLResponse{}}
+
+	var tokenHash string
+	if s.managementTokens {
+		if response.ManagementToken, tokenHash, err = newManagementToken(); err != nil {
+			s.writeError(w, http.StatusInternalServerError, "failed to create campaign")
+			return
+		}
+	}
+
+	owner, host := ownerFromRequest(r), s.requestHost(r)
+	var firstErr error
+	for _, rawURL := range req.URLs {
+		link, err := s.createLink(r.Context(), createShortURLRequest{
+			URL:            rawURL,
+			ExpirationDays: req.ExpirationDays,
+			ExpiresIn:      req.ExpiresIn,
+			Tags:           req.Tags,
+			Group:          req.Group,
+
+			campaign:            id,
+			managementTokenHash: tokenHash,
+		}, owner, host)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			response.Failed = append(response.Failed, campaignFailure{URL: rawURL, Error: campaignFailureMessage(err)})
+			continue
+		}
+		link.ShortURL = fmt.Sprintf("%s/%s", s.shortBaseURL(r), link.ShortCode)
+		response.Links = append(response.Links, link)
+	}
+
+	if len(response.Links) == 0 {
+		s.writeCreateError(w, firstErr)
+		return
+	}
+	s.writeJSON(w, http.StatusCreated, response)
+}
+
+func (s *Server) campaignURLsHandler(w http.ResponseWriter, r *http.Request) {
+	codes, ok := s.campaignCodes(w, r)
+	if !ok {
+		return
+	}
+	s.writeURLList(w, r, codes)
+}
+
+// updateCampaignHandler disables or re-enables every link of a campaign.
+func (s *Server) updateCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	var req updateCampaignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if req.Disabled == nil {
+		s.writeError(w, http.StatusBadRequest, "disabled is required")
+		return
+	}
+
+	codes, ok := s.managedCampaignCodes(w, r)
+	if !ok {
+		return
+	}
+
+	updated := 0
+	for _, code := range codes {
+		err := s.db.UpdateLink(r.Context(), code, redisdb.LinkUpdate{Disabled: req.Disabled})
+		s.noteWrite(err)
+		switch {
+		case err == nil:
+			updated++
+		case errors.Is(err, redisdb.ErrNotFound):
+		case errors.Is(err, redisdb.ErrReadOnly):
+			s.writeReadOnlyError(w)
+			return
+		default:
+			s.writeError(w, http.StatusInternalServerError, "failed to update campaign")
+			return
+		}
+	}
+	s.writeJSON(w, http.StatusOK, campaignUpdateResponse{CampaignID: r.PathValue("campaign"), Updated: updated})
+}
+
+// deleteCampaignHandler deletes every link of a campaign.
+func (s *Server) deleteCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	codes, ok := s.managedCampaignCodes(w, r)
+	if !ok {
+		return
+	}
+
+	for _, code := range codes {
+		err := s.db.DeleteShortURL(r.Context(), code)
+		s.noteWrite(err)
+		switch {
+		case err == nil, errors.Is(err, redisdb.ErrNotFound):
+		case errors.Is(err, redisdb.ErrReadOnly):
+			s.writeReadOnlyError(w)
+			return
+		default:
+			s.writeError(w, http.StatusInternalServerError, "failed to delete campaign")
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// campaignCodes returns the live codes of the {campaign} in the path, or
+// answers the request itself and returns false.
+func (s *Server) campaignCodes(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	id := r.PathValue("campaign")
+	if !campaignIDPattern.MatchString(id) {
+		s.writeError(w, http.StatusNotFound, "campaign not found")
+		return nil, false
+	}
+	codes, err := s.db.CodesByCampaign(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, redisdb.ErrNotFound) {
+			s.writeError(w, http.StatusNotFound, "campaign not found")
+			return nil, false
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch campaign")
+		return nil, false
+	}
+	return codes, true
+}
+
+// managedCampaignCodes is campaignCodes for bulk changes: like
+// requireManagementToken, every link with a management token must be unlocked
+// by X-Management-Token, or the admin token, before anything is changed.
+func (s *Server) managedCampaignCodes(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	codes, ok := s.campaignCodes(w, r)
+	if !ok || s.isAdmin(r) {
+		return codes, ok
+	}
+	token := r.Header.Get(managementTokenHeader)
+	for _, code := range codes {
+		if err := s.checkManagementToken(r.Context(), code, token); err != nil {
+			if errors.Is(err, errManagementToken) {
+				s.writeError(w, http.StatusForbidden, err.Error())
+				return nil, false
+			}
+			s.writeError(w, http.StatusInternalServerError, "failed to check management token")
+			return nil, false
+		}
+	}
+	return codes, true
+}
+
+// campaignFailureMessage is the per-URL error reported for a failed
+// createLink.
+func campaignFailureMessage(err error) string {
+	var createErr *createError
+	switch {
+	case errors.As(err, &createErr):
+		return createErr.message
+	case errors.Is(err, redisdb.ErrReadOnly):
+		return "service is temporarily read-only"
+	default:
+		return "failed to store short URL"
+	}
+}
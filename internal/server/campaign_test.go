@@ -0,0 +1,169 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createCampaign(t *testing.T, h http.Handler, body string) createCampaignResponse {
+	t.Helper()
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/campaigns", strings.NewReader(body)))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("create campaign: expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+	var created createCampaignResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return created
+}
+
+func TestCreateCampaignSharesSettings(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db}).RegisterRoutes()
+
+	created := createCampaign(t, h, `{
+		"urls": ["https://shop.example.com/a", "https://shop.example.com/b", "not a url"],
+		"expiration_days": 7,
+		"tags": ["Spring"],
+		"group": "launch"
+	}`)
+
+	if !campaignIDPattern.MatchString(created.CampaignID) {
+		t.Fatalf("unexpected campaign id %q", created.CampaignID)
+	}
+	if len(created.Links) != 2 || len(created.Failed) != 1 || created.Failed[0].URL != "not a url" {
+		t.Fatalf("expected two links and one failure, got %+v", created)
+	}
+	for _, link := range created.Links {
+		stats := db.store[link.ShortCode]
+		if stats.Campaign != created.CampaignID || stats.Group != "launch" || len(stats.Tags) != 1 || stats.Tags[0] != "spring" {
+			t.Fatalf("expected shared settings on %s, got %+v", link.ShortCode, stats)
+		}
+		if ttl := db.ttls[link.ShortCode]; ttl != 7*24*time.Hour {
+			t.Fatalf("expected a 7 day TTL on %s, got %s", link.ShortCode, ttl)
+		}
+		if link.ShortURL == "" || link.ManagementToken != "" {
+			t.Fatalf("unexpected link in response: %+v", link)
+		}
+	}
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/campaigns/"+created.CampaignID+"/urls", nil))
+	var listed pagedResponse[json.RawMessage]
+	if err := json.Unmarshal(res.Body.Bytes(), &listed); err != nil || res.Code != http.StatusOK || len(listed.Items) != 2 {
+		t.Fatalf("expected the campaign to list its two links, got %d: %s", res.Code, res.Body.String())
+	}
+}
+
+func TestCreateCampaignRejectsBadRequests(t *testing.T) {
+	h := (&Server{db: newMockDB()}).RegisterRoutes()
+
+	tooMany := `{"urls":[` + strings.Repeat(`"https://example.com",`, maxCampaignSize) + `"https://example.com"]}`
+	for name, body := range map[string]string{
+		"empty":        `{"urls":[]}`,
+		"too many":     tooMany,
+		"all invalid":  `{"urls":["ftp://example.com"]}`,
+		"shared error": `{"urls":["https://example.com"],"expiration_days":-1}`,
+	} {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/campaigns", strings.NewReader(body)))
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d: %s", name, res.Code, res.Body.String())
+		}
+	}
+}
+
+func TestCampaignBulkDisableAndDelete(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db}).RegisterRoutes()
+	created := createCampaign(t, h, `{"urls":["https://shop.example.com/a","https://shop.example.com/b"]}`)
+	other := createCampaign(t, h, `{"urls":["https://shop.example.com/c"]}`)
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPatch, "/api/v1/campaigns/"+created.CampaignID, strings.NewReader(`{"disabled":true}`)))
+	var updated campaignUpdateResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &updated); err != nil || res.Code != http.StatusOK || updated.Updated != 2 {
+		t.Fatalf("expected both links disabled, got %d: %s", res.Code, res.Body.String())
+	}
+	for _, link := range created.Links {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/"+link.ShortCode, nil))
+		if res.Code != http.StatusNotFound {
+			t.Fatalf("expected disabled %s to stop redirecting, got %d", link.ShortCode, res.Code)
+		}
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodDelete, "/api/v1/campaigns/"+created.CampaignID, nil))
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("expected the campaign to be deleted, got %d", res.Code)
+	}
+	for _, link := range created.Links {
+		if _, ok := db.store[link.ShortCode]; ok {
+			t.Fatalf("expected %s to be deleted", link.ShortCode)
+		}
+	}
+	if _, ok := db.store[other.Links[0].ShortCode]; !ok {
+		t.Fatal("expected links of other campaigns to be left alone")
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/campaigns/"+created.CampaignID+"/urls", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected an emptied campaign to 404, got %d", res.Code)
+	}
+}
+
+func TestCampaignSharesManagementToken(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db, managementTokens: true}).RegisterRoutes()
+	created := createCampaign(t, h, `{"urls":["https://shop.example.com/a","https://shop.example.com/b"]}`)
+	if created.ManagementToken == "" {
+		t.Fatal("expected one management token for the campaign")
+	}
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodDelete, "/api/v1/campaigns/"+created.CampaignID, nil))
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("expected a bulk delete without the token to be refused, got %d", res.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/urls/"+created.Links[0].ShortCode, nil)
+	req.Header.Set(managementTokenHeader, created.ManagementToken)
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("expected the campaign token to unlock its links, got %d", res.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/campaigns/"+created.CampaignID, nil)
+	req.Header.Set(managementTokenHeader, created.ManagementToken)
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusNoContent || len(db.store) != 0 {
+		t.Fatalf("expected the token to delete the campaign, got %d", res.Code)
+	}
+}
+
+func TestCampaignDeleteReadOnly(t *testing.T) {
+	db := &readOnlyDB{mockDB: newMockDB()}
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+	created := createCampaign(t, h, `{"urls":["https://shop.example.com/a"]}`)
+
+	db.refuse = true
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodDelete, "/api/v1/campaigns/"+created.CampaignID, nil))
+	if res.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d while Redis refuses writes, got %d: %s", http.StatusServiceUnavailable, res.Code, res.Body.String())
+	}
+	if !s.readOnly.Load() {
+		t.Fatal("expected a refused bulk delete to turn on read-only mode")
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReserveCaseVariants(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db, reserveCaseVariants: true}).RegisterRoutes()
+
+	if res := shorten(h, `{"url":"https://docs.example.org/MyLink","custom_alias":"MyLink"}`, ""); res.Code != http.StatusCreated {
+		t.Fatalf("expected the alias to be created, got %d: %s", res.Code, res.Body.String())
+	}
+	for _, variant := range []string{"mylink", "MYLINK"} {
+		res := shorten(h, `{"url":"https://docs.example.org/`+variant+`","custom_alias":"`+variant+`"}`, "")
+		if res.Code != http.StatusConflict || !strings.Contains(res.Body.String(), "differs only in case") {
+			t.Fatalf("expected %s to be refused, got %d: %s", variant, res.Code, res.Body.String())
+		}
+	}
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/mylink", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected redirects to stay case-sensitive, got %d", res.Code)
+	}
+
+	delete(db.store, "MyLink")
+	if res := shorten(h, `{"url":"https://docs.example.org/mylink","custom_alias":"mylink"}`, ""); res.Code != http.StatusCreated {
+		t.Fatalf("expected a variant to be free once the holder is gone, got %d: %s", res.Code, res.Body.String())
+	}
+}
+
+func TestReserveCaseVariantsDryRun(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db, reserveCaseVariants: true}).RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten",
+		strings.NewReader(`{"url":"https://docs.example.org/","custom_alias":"MyLink","dry_run":true}`)))
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected the dry run to pass, got %d: %s", res.Code, res.Body.String())
+	}
+	if len(db.folds) != 0 {
+		t.Fatalf("expected a dry run to claim nothing, got %v", db.folds)
+	}
+	if res := shorten(h, `{"url":"https://docs.example.org/mylink","custom_alias":"mylink"}`, ""); res.Code != http.StatusCreated {
+		t.Fatalf("expected the variant to stay free after a dry run, got %d: %s", res.Code, res.Body.String())
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodDelete, "/api/v1/urls/mylink", nil))
+	if res.Code != http.StatusNoContent || len(db.folds) != 0 {
+		t.Fatalf("expected delete to release the claim, got %d with %v", res.Code, db.folds)
+	}
+}
+
+func TestCaseVariantsAllowedByDefault(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db}).RegisterRoutes()
+
+	for _, alias := range []string{"MyLink", "mylink"} {
+		if res := shorten(h, `{"url":"https://docs.example.org/`+alias+`","custom_alias":"`+alias+`"}`, ""); res.Code != http.StatusCreated {
+			t.Fatalf("expected %s to be created, got %d: %s", alias, res.Code, res.Body.String())
+		}
+	}
+	if len(db.store) != 2 {
+		t.Fatalf("expected two distinct links, got %d", len(db.store))
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+type cloneURLRequest struct {
+	CustomAlias string `json:"custom_alias,omitempty"`
+	PreferAlias bool   `json:"prefer_alias,omitempty"`
+}
+
+// cloneURLHandler creates a new code with the destination and settings of an
+// existing one. Visits, analytics and ownership start fresh, and secrets such
+// as a password hash or management token are never copied; the clone gets a
+// management token of its own.
+func (s *Server) cloneURLHandler(w http.ResponseWriter, r *http.Request) {
+	source := s.pathCode(r)
+	if source == "" {
+		s.writeError(w, http.StatusNotFound, "short code not found")
+		return
+	}
+
+	var req cloneURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+
+	stats, err := s.db.GetStats(r.Context(), source)
+	if err != nil {
+		if errors.Is(err, redisdb.ErrNotFound) {
+			s.writeError(w, http.StatusNotFound, "short code not found")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch source URL")
+		return
+	}
+	// A clone of a used one-time link or a disabled link would be a fresh
+	// working copy of it.
+	if stats.Consumed {
+		s.writeError(w, http.StatusGone, "short url already used")
+		return
+	}
+	if stats.Disabled {
+		s.writeError(w, http.StatusForbidden, "short url is disabled")
+		return
+	}
+
+	destinations := []string{stats.LongURL}
+	for _, v := range stats.Variants {
+		destinations = append(destinations, v.URL)
+	}
+	for _, destination := range destinations {
+		target, err := url.Parse(destination)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, "failed to parse source URL")
+			return
+		}
+		if err := s.checkTargetDomain(target); err != nil {
+			s.writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		if err := s.checkDenylist(r.Context(), target); err != nil {
+			s.writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+
+	ttl, err := s.cloneTTL(r, stats)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch source URL")
+		return
+	}
+
+	owner := ownerFromRequest(r)
+	ownerLimit, exceeded, err := s.ownerQuotaExceeded(r.Context(), owner)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to check link quota")
+		return
+	}
+	if exceeded {
+		s.writeError(w, http.StatusTooManyRequests, "link quota exceeded")
+		return
+	}
+
+	code, strategy, err := s.resolveShortCode(r.Context(), strings.TrimSpace(req.CustomAlias), req.PreferAlias, false)
+	if err != nil {
+		s.writeCodeError(w, err)
+		return
+	}
+
+	opts := redisdb.CreateOptions{
+		TTL:         ttl,
+		Tags:        slices.Clone(stats.Tags),
+		Sliding:     stats.Sliding && ttl > 0,
+		OneTime:     stats.OneTime,
+		Title:       stats.Title,
+		Description: stats.Description,
+		Owner:       owner,
+		OwnerLimit:  ownerLimit,
+		Group:       stats.Group,
+
+		ForwardQuery: stats.ForwardQuery,
+		RequireHTTPS: stats.RequireHTTPS,
+
+		InterstitialSeconds: stats.InterstitialSeconds,
+		StickyVariants:      stats.StickyVariants,
+	}
+	for _, v := range stats.Variants {
+		opts.Variants = append(opts.Variants, redisdb.Variant{URL: v.URL, Weight: v.Weight})
+	}
+	if stats.StartsAt != nil {
+		opts.StartsAt = *stats.StartsAt
+	}
+	var managementToken string
+	if s.managementTokens {
+		if managementToken, opts.ManagementTokenHash, err = newManagementToken(); err != nil {
+			s.writeError(w, http.StatusInternalServerError, "failed to store short URL")
+			return
+		}
+	}
+	err = s.db.CreateShortURL(r.Context(), code, stats.LongURL, opts)
+	s.noteWrite(err)
+	if err != nil {
+		if errors.Is(err, redisdb.ErrConflict) {
+			s.writeError(w, http.StatusConflict, "short code already exists")
+			return
+		}
+		if errors.Is(err, redisdb.ErrQuotaExceeded) {
+			s.writeError(w, http.StatusTooManyRequests, "link quota exceeded")
+			return
+		}
+		if errors.Is(err, redisdb.ErrReadOnly) {
+			s.writeReadOnlyError(w)
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to store short URL")
+		return
+	}
+	if stats.Image != "" {
+		if err := s.db.SetMetadata(r.Context(), code, "", "", stats.Image); err != nil {
+			log.Printf("failed to copy preview image to %s: %v", code, err)
+		}
+	}
+
+	response := createShortURLResponse{
+		ShortCode: code,
+		ShortURL:  fmt.Sprintf("%s/%s", s.shortBaseURL(r), code),
+		LongURL:   stats.LongURL,
+		Strategy:  strategy,
+
+		ManagementToken: managementToken,
+
+		epochMillis: s.epochMillis,
+	}
+	if ttl > 0 {
+		exp := time.Now().UTC().Add(ttl)
+		response.ExpiresAt = &exp
+	}
+
+	s.writeJSON(w, http.StatusCreated, response)
+}
+
+// cloneTTL is the TTL a clone of stats starts with: the full window for a
+// sliding link, otherwise whatever the source has left so both expire
+// together.
+func (s *Server) cloneTTL(r *http.Request, stats redisdb.URLStats) (time.Duration, error) {
+	if stats.Sliding {
+		fields, _, err := s.db.GetRaw(r.Context(), stats.Code)
+		if err != nil {
+			return 0, err
+		}
+		if seconds, err := strconv.ParseInt(fields["ttl_seconds"], 10, 64); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second, nil
+		}
+	}
+	if stats.TTLSeconds != nil && *stats.TTLSeconds > 0 {
+		return time.Duration(*stats.TTLSeconds) * time.Second, nil
+	}
+	return 0, nil
+}
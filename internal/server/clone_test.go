@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestCloneURL(t *testing.T) {
+	db := newMockDB()
+	opts := redisdb.CreateOptions{TTL: 48 * time.Hour, Sliding: true, Tags: []string{"launch"}, Title: "Launch", Owner: "someone-else"}
+	if err := db.CreateShortURL(context.Background(), "src0001", "https://example.com/landing", opts); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	db.extra["src0001"] = map[string]string{"password_hash": "$2a$10$abcdefghijklmnopqrstuv"}
+
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/src0001", nil))
+	if res.Code != http.StatusFound {
+		t.Fatalf("expected source redirect, got %d", res.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/urls/src0001/clone", bytes.NewBufferString(`{"custom_alias":"variant-b"}`))
+	req.Host = "short.local"
+	req.Header.Set("X-API-Key", "cloner")
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, res.Code, res.Body.String())
+	}
+	var created createShortURLResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if created.ShortCode != "variant-b" || created.ShortURL != "http://short.local/variant-b" || created.Strategy != strategyAlias {
+		t.Fatalf("unexpected clone response: %+v", created)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/variant-b", nil))
+	if res.Code != http.StatusFound || res.Header().Get("Location") != "https://example.com/landing" {
+		t.Fatalf("expected clone to redirect to the source destination, got %d %s", res.Code, res.Header().Get("Location"))
+	}
+
+	source, _ := db.GetStats(context.Background(), "src0001")
+	clone, _ := db.GetStats(context.Background(), "variant-b")
+	if source.Visits != 1 || clone.Visits != 1 {
+		t.Fatalf("expected independent visit counts, got source=%d clone=%d", source.Visits, clone.Visits)
+	}
+	if !slices.Equal(clone.Tags, []string{"launch"}) || clone.Title != "Launch" || !clone.Sliding {
+		t.Fatalf("expected settings to be copied, got %+v", clone)
+	}
+	if db.ttls["variant-b"] != 48*time.Hour {
+		t.Fatalf("expected the sliding window to be copied, got %s", db.ttls["variant-b"])
+	}
+	if db.owners["variant-b"] != ownerFromRequest(req) {
+		t.Fatalf("expected the clone to belong to the caller, got %q", db.owners["variant-b"])
+	}
+	raw, _, _ := db.GetRaw(context.Background(), "variant-b")
+	if _, ok := raw["password_hash"]; ok {
+		t.Fatal("expected secrets not to be cloned")
+	}
+}
+
+func TestCloneURLErrors(t *testing.T) {
+	db := newMockDB()
+	db.store["src0002"] = redisdb.URLStats{Code: "src0002", LongURL: "https://example.com", CreatedAt: time.Now().UTC()}
+	db.store["used002"] = redisdb.URLStats{Code: "used002", LongURL: "https://example.com", CreatedAt: time.Now().UTC(), OneTime: true, Consumed: true}
+	db.store["off0002"] = redisdb.URLStats{Code: "off0002", LongURL: "https://example.com", CreatedAt: time.Now().UTC(), Disabled: true}
+	h := (&Server{db: db}).RegisterRoutes()
+
+	tests := []struct {
+		path   string
+		body   string
+		status int
+	}{
+		{path: "/api/v1/urls/missing/clone", status: http.StatusNotFound},
+		{path: "/api/v1/urls/used002/clone", status: http.StatusGone},
+		{path: "/api/v1/urls/off0002/clone", status: http.StatusForbidden},
+		{path: "/api/v1/urls/src0002/clone", body: `{"custom_alias":"src0002"}`, status: http.StatusConflict},
+		{path: "/api/v1/urls/src0002/clone", body: `{"custom_alias":"no"}`, status: http.StatusBadRequest},
+		{path: "/api/v1/urls/src0002/clone", body: `{`, status: http.StatusBadRequest},
+		{path: "/api/v1/urls/src0002/clone", status: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(tt.body))
+		req.Host = "short.local"
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+
+		if res.Code != tt.status {
+			t.Fatalf("%s %s: expected status %d, got %d: %s", tt.path, tt.body, tt.status, res.Code, res.Body.String())
+		}
+	}
+}
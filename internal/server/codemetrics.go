@@ -0,0 +1,46 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// codeMetricsHandler exposes one link's counters in the Prometheus text
+// exposition format, so a scrape job can target the links it cares about
+// instead of the service exporting every code as a label. Unique visitors are
+// not tracked, so only the total visit count is reported.
+func (s *Server) codeMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	code := s.pathCode(r)
+	if code == "" {
+		s.writeError(w, http.StatusNotFound, "short code not found")
+		return
+	}
+
+	stats, err := s.sharedStats(r.Context(), code)
+	if err != nil {
+		if errors.Is(err, redisdb.ErrNotFound) {
+			s.writeError(w, http.StatusNotFound, "short code not found")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch URL metrics")
+		return
+	}
+
+	label := promLabelEscaper.Replace(code)
+	var b strings.Builder
+	b.WriteString("# HELP urlshortner_link_visits_total Redirects served for the short code.\n")
+	b.WriteString("# TYPE urlshortner_link_visits_total counter\n")
+	fmt.Fprintf(&b, "urlshortner_link_visits_total{code=\"%s\"} %d\n", label, stats.Visits)
+
+	w.Header().Set("Content-Type", prometheusContentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(b.String()))
+}
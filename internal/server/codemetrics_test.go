@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestCodeMetricsHandler(t *testing.T) {
+	db := newMockDB()
+	ctx := context.Background()
+	if err := db.CreateShortURL(ctx, "docs01", "https://example.com", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	for range 3 {
+		if _, err := db.IncrementVisits(ctx, "docs01"); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	h := (&Server{db: db}).RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/docs01/metrics", nil))
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+	if got := res.Header().Get("Content-Type"); got != prometheusContentType {
+		t.Fatalf("expected content type %q, got %q", prometheusContentType, got)
+	}
+
+	expected := "# HELP urlshortner_link_visits_total Redirects served for the short code.\n" +
+		"# TYPE urlshortner_link_visits_total counter\n" +
+		"urlshortner_link_visits_total{code=\"docs01\"} 3\n"
+	if res.Body.String() != expected {
+		t.Fatalf("unexpected exposition:\n%s", res.Body.String())
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/missing/metrics", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, res.Code)
+	}
+}
+
+func TestKeyspaceSaturation(t *testing.T) {
+	// 36 characters, 2 long: 1296 codes, of which 13 are taken.
+	if got := keyspaceSaturation(13, 36, 2); math.Abs(got-1.003) > 0.001 {
+		t.Fatalf("expected about 1.003%%, got %v", got)
+	}
+	if got := codeEntropyBits(64, 7); got != 42 {
+		t.Fatalf("expected 42 bits, got %v", got)
+	}
+}
+
+func TestMetricsReportsSaturationAndWarnsOnce(t *testing.T) {
+	db := newMockDB()
+	s := &Server{db: db, caseInsensitiveCodes: true}
+	h := s.RegisterRoutes()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	scrape := func() string {
+		t.Helper()
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if res.Code != http.StatusOK || res.Header().Get("Content-Type") != prometheusContentType {
+			t.Fatalf("unexpected response %d %v", res.Code, res.Header())
+		}
+		return res.Body.String()
+	}
+
+	for i := range 3 {
+		if err := db.CreateShortURL(context.Background(), fmt.Sprintf("sat%04d", i), "https://docs.example.org", redisdb.CreateOptions{}); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	body := scrape()
+	for _, want := range []string{"urlshortner_links 3\n", "# TYPE urlshortner_code_space_saturation_percent gauge\n", "urlshortner_code_space_size 7.8364164096e+10\n"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %q in metrics, got:\n%s", want, body)
+		}
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("expected no warning for a nearly empty code space, got %q", logs.String())
+	}
+
+	// 1% of 36^7 is about 7.8e8 links, too many to create, so the summary
+	// is faked past the threshold; the second scrape must not warn again.
+	s.db = &summaryDB{mockDB: db, links: 800_000_000}
+	scrape()
+	scrape()
+	if n := strings.Count(logs.String(), "code space"); n != 1 {
+		t.Fatalf("expected one saturation warning, got %d: %q", n, logs.String())
+	}
+}
+
+// summaryDB reports a fixed link count.
+type summaryDB struct {
+	*mockDB
+	links int64
+}
+
+func (db *summaryDB) GetSummary(context.Context) (redisdb.Summary, error) {
+	return redisdb.Summary{Links: db.links}, nil
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"url-shortner/pkg/linkrules"
+)
+
+// codePrefixPattern bounds SHORT_CODE_PREFIX so prefixed codes stay short and
+// safe in URLs and Redis key names.
+var codePrefixPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,16}$`)
+
+// hasCodePrefix reports whether code belongs to this server's namespace: it
+// starts with the code prefix and has something after it. Every code does when
+// no prefix is configured.
+func (s *Server) hasCodePrefix(code string) bool {
+	if s.codePrefix == "" {
+		return code != ""
+	}
+	body, ok := strings.CutPrefix(code, s.codePrefix)
+	return ok && body != ""
+}
+
+// qualifyAlias turns a canonical custom alias into the code it is stored
+// under. The code prefix is added unless the alias already starts with it, and
+// the rest must pass linkrules.ValidateAlias. A reserved word is fine after a
+// prefix; only the prefixed code must not be reserved.
+func (s *Server) qualifyAlias(alias string) (string, error) {
+	body := strings.TrimPrefix(alias, s.codePrefix)
+	code := s.codePrefix + body
+	if err := linkrules.ValidateAlias(body); err != nil && !linkrules.IsReserved(body) {
+		return code, err
+	}
+	if linkrules.IsReserved(code) {
+		return code, fmt.Errorf("custom_alias %q is reserved", code)
+	}
+	return code, nil
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestCodePrefixRoundTrip(t *testing.T) {
+	db := newMockDB()
+	s := &Server{db: db, codePrefix: "team1-"}
+	h := s.RegisterRoutes()
+
+	create := func(body string) createShortURLResponse {
+		t.Helper()
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(body)))
+		if res.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, res.Code, res.Body.String())
+		}
+		var out createShortURLResponse
+		if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return out
+	}
+
+	generated := create(`{"url":"https://docs.example.org/generated"}`)
+	if !strings.HasPrefix(generated.ShortCode, "team1-") || len(generated.ShortCode) != len("team1-")+shortCodeLength {
+		t.Fatalf("expected a prefixed generated code, got %q", generated.ShortCode)
+	}
+	if !strings.HasSuffix(generated.ShortURL, "/"+generated.ShortCode) {
+		t.Fatalf("expected short_url to carry the prefix, got %q", generated.ShortURL)
+	}
+
+	for alias, want := range map[string]string{"docs": "team1-docs", "team1-blog": "team1-blog"} {
+		if got := create(`{"url":"https://docs.example.org/` + alias + `","custom_alias":"` + alias + `"}`).ShortCode; got != want {
+			t.Fatalf("custom_alias %q: expected code %q, got %q", alias, want, got)
+		}
+	}
+
+	for _, code := range []string{generated.ShortCode, "team1-docs"} {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/"+code, nil))
+		if res.Code != http.StatusFound {
+			t.Fatalf("expected %s to redirect, got %d", code, res.Code)
+		}
+	}
+}
+
+func TestCodePrefixRejectsForeignCodes(t *testing.T) {
+	db := newMockDB()
+	ctx := context.Background()
+	// Links another team created in the same Redis.
+	for _, code := range []string{"team2-abc1234", "docs", "team1-"} {
+		if err := db.CreateShortURL(ctx, code, "https://docs.example.org/"+code, redisdb.CreateOptions{}); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	s := &Server{db: db, codePrefix: "team1-"}
+	h := s.RegisterRoutes()
+
+	for _, path := range []string{"/team2-abc1234", "/docs", "/team1-", "/api/v1/urls/team2-abc1234"} {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+		if res.Code != http.StatusNotFound {
+			t.Fatalf("expected %s to be rejected with %d, got %d", path, http.StatusNotFound, res.Code)
+		}
+	}
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodDelete, "/api/v1/urls/team2-abc1234", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected deleting a foreign code to return %d, got %d", http.StatusNotFound, res.Code)
+	}
+	if _, ok := db.store["team2-abc1234"]; !ok {
+		t.Fatal("expected the foreign link to be left alone")
+	}
+}
+
+func TestCodePrefixConfig(t *testing.T) {
+	for _, prefix := range []string{"team/1", "a-prefix-that-is-too-long"} {
+		if err := (Config{Port: 8080, CodePrefix: prefix}).withDefaults().validate(); err == nil {
+			t.Fatalf("expected code prefix %q to be rejected", prefix)
+		}
+	}
+
+	app, err := NewServerWithService(newMockDB(), Config{Port: 8080, CodePrefix: "Team1-", CaseInsensitiveCodes: true})
+	if err != nil {
+		t.Fatalf("NewServerWithService failed: %v", err)
+	}
+	if app.codePrefix != "team1-" {
+		t.Fatalf("expected the prefix to be lowercased with case-insensitive codes, got %q", app.codePrefix)
+	}
+}
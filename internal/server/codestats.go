@@ -0,0 +1,56 @@
+package server
+
+import (
+	"math"
+	"net/http"
+)
+
+type codeStatsResponse struct {
+	Links        int64   `json:"links"`
+	CodeLength   int     `json:"code_length"`
+	CodePrefix   string  `json:"code_prefix,omitempty"`
+	Alphabet     string  `json:"alphabet"`
+	AlphabetSize int     `json:"alphabet_size"`
+	KeyspaceSize float64 `json:"keyspace_size"`
+	// CollisionProbability is the chance that one random candidate is
+	// already taken at the current fill; ExpectedAttempts follows from it.
+	CollisionProbability float64 `json:"collision_probability"`
+	ExpectedAttempts     float64 `json:"expected_attempts"`
+	// Generations, AverageAttempts and AllocationFailures are observed by
+	// this instance since it started.
+	Generations        int64   `json:"generations"`
+	AverageAttempts    float64 `json:"average_attempts"`
+	AllocationFailures int64   `json:"allocation_failures"`
+}
+
+// codeStatsHandler reports how full the generated code space is, for
+// deciding when codes need to get longer: the estimate from the link count,
+// and the attempts code generation has actually needed.
+func (s *Server) codeStatsHandler(w http.ResponseWriter, r *http.Request) {
+	summary, err := s.db.GetSummary(r.Context())
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch code stats")
+		return
+	}
+
+	alphabet := s.codeAlphabet()
+	probability := min(keyspaceSaturation(summary.Links, len(alphabet), shortCodeLength)/100, 1)
+	response := codeStatsResponse{
+		Links:        summary.Links,
+		CodeLength:   shortCodeLength,
+		CodePrefix:   s.codePrefix,
+		Alphabet:     alphabet,
+		AlphabetSize: len(alphabet),
+		KeyspaceSize: math.Pow(float64(len(alphabet)), shortCodeLength),
+
+		CollisionProbability: probability,
+		ExpectedAttempts:     math.Min(1/(1-probability), maxCodeAttempts),
+
+		Generations:        s.codeGenerations.Load(),
+		AllocationFailures: s.codeFailures.Load(),
+	}
+	if response.Generations > 0 {
+		response.AverageAttempts = float64(s.codeAttempts.Load()) / float64(response.Generations)
+	}
+	s.writeJSON(w, http.StatusOK, response)
+}
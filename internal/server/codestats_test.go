@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestCodeStats(t *testing.T) {
+	db := newMockDB()
+	for i := range 4 {
+		code := fmt.Sprintf("link%03d", i)
+		db.store[code] = redisdb.URLStats{Code: code, LongURL: "https://docs.example.org", CreatedAt: time.Now().UTC()}
+	}
+	s := &Server{db: collidingDB{db}, adminToken: "s3cret", caseInsensitiveCodes: true}
+	if _, err := s.generateUniqueCode(context.Background(), shortCodeLength); !errors.Is(err, ErrCodeSpaceExhausted) {
+		t.Fatalf("expected ErrCodeSpaceExhausted, got %v", err)
+	}
+	s.db = db
+	if _, err := s.generateUniqueCode(context.Background(), shortCodeLength); err != nil {
+		t.Fatalf("generateUniqueCode: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/codes/stats", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	res := httptest.NewRecorder()
+	s.RegisterRoutes().ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body.String())
+	}
+
+	var stats codeStatsResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode code stats: %v", err)
+	}
+	keyspace := math.Pow(36, 7)
+	want := codeStatsResponse{
+		Links:        4,
+		CodeLength:   7,
+		Alphabet:     lowerCaseAlphabet,
+		AlphabetSize: 36,
+		KeyspaceSize: keyspace,
+
+		CollisionProbability: 4 / keyspace,
+		ExpectedAttempts:     1 / (1 - 4/keyspace),
+
+		Generations:        2,
+		AverageAttempts:    float64(maxCodeAttempts+1) / 2,
+		AllocationFailures: 1,
+	}
+	if stats != want {
+		t.Fatalf("expected %+v, got %+v", want, stats)
+	}
+}
+
+func TestCodeStatsRequiresAdmin(t *testing.T) {
+	h := (&Server{db: newMockDB(), adminToken: "s3cret"}).RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/admin/codes/stats", nil))
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without the admin token, got %d", res.Code)
+	}
+}
@@ -0,0 +1,365 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+// Feature names a group of optional endpoints that can be switched off.
+type Feature string
+
+const (
+	// FeatureAnalytics covers per-code analytics, Prometheus metrics and the
+	// live click stream.
+	FeatureAnalytics Feature = "analytics"
+	// FeatureTags covers tag listing and tag edits.
+	FeatureTags Feature = "tags"
+	// FeatureGroups covers group listings.
+	FeatureGroups Feature = "groups"
+	// FeaturePreview covers unfurl previews.
+	FeaturePreview Feature = "preview"
+	// FeatureClone covers copying a link to a new code.
+	FeatureClone Feature = "clone"
+	// FeatureRotate covers moving a link to a new code.
+	FeatureRotate Feature = "rotate"
+	// FeatureChecks covers destination health checks and redirect-chain
+	// resolution, the endpoints that make outbound requests.
+	FeatureChecks Feature = "checks"
+	// FeatureAdmin covers the admin-token routes.
+	FeatureAdmin Feature = "admin"
+	// FeatureDebug covers /debug/vars and /metrics.
+	FeatureDebug Feature = "debug"
+)
+
+var knownFeatures = []Feature{
+	FeatureAnalytics, FeatureTags, FeatureGroups, FeaturePreview, FeatureClone,
+	FeatureRotate, FeatureChecks, FeatureAdmin, FeatureDebug,
+}
+
+// Config holds every server setting. LoadConfig reads it from the environment
+// once at startup; the handlers never read the environment themselves.
+type Config struct {
+	Port int
+	// GRPCPort is where cmd/api serves GRPCServer; 0 disables gRPC.
+	GRPCPort int
+	// ListenSocket, when set, is the path of a unix domain socket that
+	// Listen serves HTTP on instead of Port.
+	ListenSocket string
+
+	// Redis configures the connection NewServerWithConfig opens. It is
+	// ignored when Service is set.
+	Redis redisdb.Options
+	// Service is the storage backend to use instead of connecting to Redis.
+	Service redisdb.Service
+
+	// ResponseEnvelope wraps every JSON response in {"data", "error"}.
+	ResponseEnvelope bool
+	// BaseURL builds short_url in responses instead of the request host.
+	BaseURL *url.URL
+	// TimeFormat is timeFormatRFC3339 or timeFormatEpochMillis.
+	TimeFormat string
+	// JSONP wraps stats in ?callback= for script-tag widgets; see
+	// writeJSONP.
+	JSONP bool
+	// BucketPublicVisits rounds visit counts in stats down to their order
+	// of magnitude for everyone but the link's owner and the admin.
+	BucketPublicVisits bool
+
+	AdminToken     string
+	TrustedProxies []netip.Prefix
+	ForceHTTPS     bool
+	// ManagementTokens returns a token with every new link that deleting,
+	// updating or rotating it then requires.
+	ManagementTokens bool
+	// RedactLoggedURLs logs destinations as scheme and host only.
+	RedactLoggedURLs bool
+	// ResponseSigningKey, when set, signs shorten responses with
+	// HMAC-SHA256 in X-Signature.
+	ResponseSigningKey string
+
+	AllowedDomains []string
+	BlockedDomains []string
+	// DenylistFile lists malicious domains and URL hashes to refuse as
+	// targets; see loadDenylist. DenylistRedis also checks the externally
+	// populated short:denylist set.
+	DenylistFile  string
+	DenylistRedis bool
+
+	RootRedirectURL *url.URL
+	RootHTML        bool
+
+	// RejectSchemelessTargets answers 500 for stored destinations without a
+	// scheme instead of redirecting to them over https.
+	RejectSchemelessTargets bool
+	// TrailingSlashRedirect answers /{code}/ with a 301 to /{code} instead
+	// of resolving it in place.
+	TrailingSlashRedirect bool
+
+	// ErrorPageTemplate is the path of an html/template replacing the
+	// built-in error page.
+	ErrorPageTemplate string
+	ErrorPageMessage  string
+
+	// RobotsTxtPath replaces the built-in robots.txt, which disallows
+	// everything. FaviconPath is served as /favicon.ico, which otherwise
+	// answers 204.
+	RobotsTxtPath string
+	FaviconPath   string
+
+	MaxLinksPerOwner     int
+	CaseInsensitiveCodes bool
+	// ReserveCaseVariants refuses custom aliases that differ only in case
+	// from an existing one while lookups stay case-sensitive.
+	ReserveCaseVariants bool
+	// CodePrefix namespaces every code this server creates or serves, e.g.
+	// "team1-" for team1-abc1234; codes without it answer 404.
+	CodePrefix string
+
+	CollisionWarnThreshold int
+	MaxInFlight            int
+	// GlobalRateLimit caps requests per second across every client; 0
+	// disables it. GlobalRateBurst defaults to one second's worth.
+	GlobalRateLimit int
+	GlobalRateBurst int
+	// RedirectCacheMaxAge is the max-age sent on redirects for links that
+	// never expire; 0 sends no-store for every redirect.
+	RedirectCacheMaxAge time.Duration
+	VisitBurstLimit     int
+	VisitBurstWindow    time.Duration
+	// VisitSampleRate counts one redirect in N, each as N visits; 1 counts
+	// every visit exactly.
+	VisitSampleRate int
+	// QueryForwardPrecedence is queryPrecedenceLink or
+	// queryPrecedenceRequest: which side wins when a forward_query link's
+	// destination and the redirect request set the same parameter.
+	QueryForwardPrecedence string
+	// RateLimit caps the requests each client IP makes to a route per
+	// RateLimitWindow, counted in Redis across instances; 0 disables it.
+	RateLimit       int
+	RateLimitWindow time.Duration
+	// ExpiringSoonThreshold is the time left under which stats mark a link
+	// expiring_soon.
+	ExpiringSoonThreshold time.Duration
+	// CreateBufferSize, when positive, keeps up to that many links created
+	// while Redis is unreachable in memory until they can be written; see
+	// createBuffer for what that risks.
+	CreateBufferSize int
+	// AnalyticsQueueSize bounds the click events waiting to be published;
+	// AnalyticsDropPolicy is dropNew or dropOldest for when it is full.
+	AnalyticsQueueSize  int
+	AnalyticsDropPolicy string
+
+	// GeoIPDBPath is a MaxMind country database; empty disables GeoIP.
+	GeoIPDBPath string
+
+	ReadHeaderTimeout time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	H2C               bool
+
+	// Maintenance starts the server in maintenance mode, which the admin
+	// API can switch off at runtime.
+	Maintenance bool
+	// SelfTest makes building the server fail unless a throwaway link can
+	// be written, read, counted and deleted; see selfTest.
+	SelfTest bool
+
+	// DisabledFeatures switches off optional endpoint groups, which are
+	// otherwise all registered.
+	DisabledFeatures []Feature
+}
+
+// LoadConfig reads the server configuration from the environment, applying
+// defaults for unset or invalid values. Only an invalid Redis configuration is
+// an error.
+func LoadConfig() (Config, error) {
+	port := 8080
+	if v := os.Getenv("PORT"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil {
+			port = parsed
+		}
+	}
+
+	redisOpts, err := redisdb.OptionsFromEnv()
+	if err != nil {
+		return Config{}, err
+	}
+
+	return Config{
+		Port:     port,
+		GRPCPort: envInt("GRPC_PORT", 0),
+		Redis:    redisOpts,
+
+		ListenSocket: os.Getenv("LISTEN_SOCKET"),
+
+		ResponseEnvelope: envBool("RESPONSE_ENVELOPE"),
+		BaseURL:          envURL("SHORT_BASE_URL"),
+		TimeFormat:       envTimeFormat("TIME_FORMAT"),
+
+		JSONP:              envBool("ENABLE_JSONP"),
+		BucketPublicVisits: envBool("BUCKET_PUBLIC_VISITS"),
+
+		AdminToken:         os.Getenv("ADMIN_TOKEN"),
+		ManagementTokens:   envBool("MANAGEMENT_TOKENS"),
+		ResponseSigningKey: os.Getenv("RESPONSE_SIGNING_KEY"),
+		TrustedProxies:     envPrefixes("TRUSTED_PROXIES"),
+		ForceHTTPS:         envBool("FORCE_HTTPS"),
+		RedactLoggedURLs:   envBool("REDACT_LOGGED_URLS"),
+
+		AllowedDomains: envList("ALLOWED_TARGET_DOMAINS"),
+		BlockedDomains: envList("BLOCKED_TARGET_DOMAINS"),
+		DenylistFile:   os.Getenv("DENYLIST_FILE"),
+		DenylistRedis:  envBool("DENYLIST_REDIS"),
+
+		RootRedirectURL: envURL("ROOT_REDIRECT_URL"),
+		RootHTML:        envBool("ROOT_HTML"),
+
+		RejectSchemelessTargets: envBool("REJECT_SCHEMELESS_TARGETS"),
+		TrailingSlashRedirect:   envBool("TRAILING_SLASH_REDIRECT"),
+
+		ErrorPageTemplate: os.Getenv("ERROR_PAGE_TEMPLATE"),
+		ErrorPageMessage:  os.Getenv("ERROR_PAGE_MESSAGE"),
+
+		RobotsTxtPath: os.Getenv("ROBOTS_TXT_PATH"),
+		FaviconPath:   os.Getenv("FAVICON_PATH"),
+
+		MaxLinksPerOwner:       envInt("MAX_LINKS_PER_OWNER", 0),
+		CaseInsensitiveCodes:   envBool("CASE_INSENSITIVE_CODES"),
+		ReserveCaseVariants:    envBool("RESERVE_CASE_VARIANTS"),
+		CodePrefix:             os.Getenv("SHORT_CODE_PREFIX"),
+		CollisionWarnThreshold: envInt("COLLISION_WARN_THRESHOLD", defaultCollisionWarnThreshold),
+		MaxInFlight:            envInt("MAX_INFLIGHT_REQUESTS", 0),
+		GlobalRateLimit:        envInt("GLOBAL_RATE_LIMIT", 0),
+		GlobalRateBurst:        envInt("GLOBAL_RATE_BURST", 0),
+		RateLimit:              envInt("RATE_LIMIT", 0),
+		RateLimitWindow:        envDuration("RATE_LIMIT_WINDOW", defaultRateLimitWindow),
+		RedirectCacheMaxAge:    envDurationOrZero("REDIRECT_CACHE_MAX_AGE", defaultRedirectCacheMaxAge),
+		VisitBurstLimit:        envInt("VISIT_BURST_LIMIT", 0),
+		VisitBurstWindow:       envDuration("VISIT_BURST_WINDOW", defaultVisitBurstWindow),
+		VisitSampleRate:        envInt("VISIT_SAMPLE_RATE", 1),
+		QueryForwardPrecedence: os.Getenv("QUERY_FORWARD_PRECEDENCE"),
+		ExpiringSoonThreshold:  envDuration("EXPIRING_SOON_THRESHOLD", defaultExpiringSoonThreshold),
+		CreateBufferSize:       envInt("CREATE_BUFFER_SIZE", 0),
+		AnalyticsQueueSize:     envInt("ANALYTICS_QUEUE_SIZE", defaultAnalyticsQueueSize),
+		AnalyticsDropPolicy:    os.Getenv("ANALYTICS_DROP_POLICY"),
+
+		GeoIPDBPath: os.Getenv("GEOIP_DB_PATH"),
+
+		ReadHeaderTimeout: envDuration("READ_HEADER_TIMEOUT", defaultReadHeaderTimeout),
+		IdleTimeout:       envDuration("IDLE_TIMEOUT", defaultIdleTimeout),
+		MaxHeaderBytes:    envInt("MAX_HEADER_BYTES", defaultMaxHeaderBytes),
+		H2C:               envBool("ENABLE_H2C"),
+
+		Maintenance: envBool("MAINTENANCE_MODE"),
+		SelfTest:    envBool("SELFTEST"),
+
+		DisabledFeatures: envFeatures("DISABLED_FEATURES"),
+	}, nil
+}
+
+// withDefaults fills the zero values that would otherwise disable a timeout
+// or limit, so a Config built in code behaves like one loaded from an empty
+// environment.
+func (c Config) withDefaults() Config {
+	if c.TimeFormat == "" {
+		c.TimeFormat = timeFormatRFC3339
+	}
+	if c.CollisionWarnThreshold == 0 {
+		c.CollisionWarnThreshold = defaultCollisionWarnThreshold
+	}
+	if c.VisitBurstWindow == 0 {
+		c.VisitBurstWindow = defaultVisitBurstWindow
+	}
+	if c.RateLimitWindow == 0 {
+		c.RateLimitWindow = defaultRateLimitWindow
+	}
+	if c.QueryForwardPrecedence == "" {
+		c.QueryForwardPrecedence = queryPrecedenceLink
+	}
+	if c.ExpiringSoonThreshold == 0 {
+		c.ExpiringSoonThreshold = defaultExpiringSoonThreshold
+	}
+	if c.AnalyticsQueueSize == 0 {
+		c.AnalyticsQueueSize = defaultAnalyticsQueueSize
+	}
+	if c.AnalyticsDropPolicy == "" {
+		c.AnalyticsDropPolicy = dropNew
+	}
+	if c.ReadHeaderTimeout == 0 {
+		c.ReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = defaultIdleTimeout
+	}
+	if c.MaxHeaderBytes == 0 {
+		c.MaxHeaderBytes = defaultMaxHeaderBytes
+	}
+	return c
+}
+
+// validate reports the first setting in c that the server cannot run with.
+func (c Config) validate() error {
+	switch {
+	case c.Port < 1 || c.Port > 65535:
+		return fmt.Errorf("port must be between 1 and 65535, got %d", c.Port)
+	case c.GRPCPort < 0 || c.GRPCPort > 65535 || c.GRPCPort == c.Port:
+		return fmt.Errorf("grpc port must be between 1 and 65535 and differ from the HTTP port, got %d", c.GRPCPort)
+	case c.TimeFormat != timeFormatRFC3339 && c.TimeFormat != timeFormatEpochMillis:
+		return fmt.Errorf("time format must be %q or %q, got %q", timeFormatRFC3339, timeFormatEpochMillis, c.TimeFormat)
+	case c.MaxLinksPerOwner < 0 || c.MaxInFlight < 0 || c.VisitBurstLimit < 0 || c.CollisionWarnThreshold < 0 ||
+		c.GlobalRateLimit < 0 || c.GlobalRateBurst < 0 || c.RateLimit < 0 || c.CreateBufferSize < 0 || c.AnalyticsQueueSize < 0 || c.VisitSampleRate < 0:
+		return errors.New("limits must not be negative")
+	case c.RedirectCacheMaxAge < 0 || c.VisitBurstWindow < 0 || c.RateLimitWindow < 0 || c.ExpiringSoonThreshold < 0 || c.ReadHeaderTimeout < 0 || c.IdleTimeout < 0:
+		return errors.New("durations must not be negative")
+	case c.GlobalRateLimit > int(time.Second):
+		return fmt.Errorf("global rate limit must be at most %d per second", int(time.Second))
+	case c.QueryForwardPrecedence != queryPrecedenceLink && c.QueryForwardPrecedence != queryPrecedenceRequest:
+		return fmt.Errorf("query forward precedence must be %q or %q, got %q", queryPrecedenceLink, queryPrecedenceRequest, c.QueryForwardPrecedence)
+	case c.AnalyticsDropPolicy != dropNew && c.AnalyticsDropPolicy != dropOldest:
+		return fmt.Errorf("analytics drop policy must be %q or %q, got %q", dropNew, dropOldest, c.AnalyticsDropPolicy)
+	case c.MaxHeaderBytes < 0:
+		return errors.New("max header bytes must not be negative")
+	case c.CodePrefix != "" && !codePrefixPattern.MatchString(c.CodePrefix):
+		return fmt.Errorf("code prefix must match %s, got %q", codePrefixPattern, c.CodePrefix)
+	}
+	for _, u := range []*url.URL{c.BaseURL, c.RootRedirectURL} {
+		if u != nil && ((u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+			return fmt.Errorf("%q is not an absolute http(s) URL", u)
+		}
+	}
+	for _, feature := range c.DisabledFeatures {
+		if !slices.Contains(knownFeatures, feature) {
+			return fmt.Errorf("unknown feature %q", feature)
+		}
+	}
+	return nil
+}
+
+// envFeatures parses the comma-separated named environment variable as
+// feature names. Unknown names are logged and skipped.
+func envFeatures(key string) []Feature {
+	var features []Feature
+	for _, v := range envList(key) {
+		feature := Feature(v)
+		if !slices.Contains(knownFeatures, feature) {
+			log.Printf("ignoring unknown %s entry %q", key, v)
+			continue
+		}
+		features = append(features, feature)
+	}
+	return features
+}
+
+// enabled reports whether the routes of feature are registered.
+func (s *Server) enabled(feature Feature) bool {
+	return !slices.Contains(s.disabledFeatures, feature)
+}
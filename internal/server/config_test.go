@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("PORT", "9091")
+	t.Setenv("VISIT_BURST_LIMIT", "5")
+	t.Setenv("TIME_FORMAT", "epoch_ms")
+	t.Setenv("DISABLED_FEATURES", "Analytics, bogus,admin")
+	t.Setenv("IDLE_TIMEOUT", "")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Port != 9091 || cfg.VisitBurstLimit != 5 || cfg.TimeFormat != timeFormatEpochMillis {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	if cfg.IdleTimeout != defaultIdleTimeout || cfg.VisitBurstWindow != defaultVisitBurstWindow {
+		t.Fatalf("expected defaults for unset values, got idle=%s window=%s", cfg.IdleTimeout, cfg.VisitBurstWindow)
+	}
+	if !slices.Equal(cfg.DisabledFeatures, []Feature{FeatureAnalytics, FeatureAdmin}) {
+		t.Fatalf("expected known features only, got %v", cfg.DisabledFeatures)
+	}
+}
+
+func TestLoadConfigRedirectCacheMaxAge(t *testing.T) {
+	for raw, want := range map[string]time.Duration{
+		"":    defaultRedirectCacheMaxAge,
+		"0":   0,
+		"0s":  0,
+		"90s": 90 * time.Second,
+		"-1m": defaultRedirectCacheMaxAge,
+	} {
+		t.Setenv("REDIRECT_CACHE_MAX_AGE", raw)
+		cfg, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		if cfg.RedirectCacheMaxAge != want {
+			t.Fatalf("REDIRECT_CACHE_MAX_AGE=%q: expected %s, got %s", raw, want, cfg.RedirectCacheMaxAge)
+		}
+	}
+}
+
+func TestNewServerWithConfig(t *testing.T) {
+	db := newMockDB()
+	srv, err := NewServerWithConfig(Config{
+		Port:             9092,
+		Service:          db,
+		BaseURL:          &url.URL{Scheme: "https", Host: "sho.rt"},
+		DisabledFeatures: []Feature{FeatureDebug},
+	})
+	if err != nil {
+		t.Fatalf("NewServerWithConfig failed: %v", err)
+	}
+	if srv.Addr != ":9092" || srv.ReadHeaderTimeout != defaultReadHeaderTimeout || srv.MaxHeaderBytes != defaultMaxHeaderBytes {
+		t.Fatalf("unexpected http.Server settings: addr=%s read_header=%s max_header=%d", srv.Addr, srv.ReadHeaderTimeout, srv.MaxHeaderBytes)
+	}
+
+	res := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"https://docs.example.org/guide","custom_alias":"guide"}`)))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+	if !strings.Contains(res.Body.String(), `"short_url":"https://sho.rt/guide"`) {
+		t.Fatalf("expected short_url from the configured base URL, got %s", res.Body.String())
+	}
+	if _, ok := db.store["guide"]; !ok {
+		t.Fatal("expected the link to be stored in the injected service")
+	}
+
+	res = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected disabled debug route to return 404, got %d", res.Code)
+	}
+}
+
+func TestNewServerWithConfigRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "missing port", cfg: Config{}},
+		{name: "port out of range", cfg: Config{Port: 70000}},
+		{name: "unknown time format", cfg: Config{Port: 8080, TimeFormat: "unix"}},
+		{name: "negative limit", cfg: Config{Port: 8080, MaxInFlight: -1}},
+		{name: "relative base url", cfg: Config{Port: 8080, BaseURL: &url.URL{Path: "/s"}}},
+		{name: "unknown feature", cfg: Config{Port: 8080, DisabledFeatures: []Feature{"bogus"}}},
+		{name: "grpc port shared with http", cfg: Config{Port: 8080, GRPCPort: 8080}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Service = newMockDB()
+			if _, err := NewServerWithConfig(tt.cfg); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestDisabledFeaturesAreNotRegistered(t *testing.T) {
+	cfg := Config{
+		VisitBurstWindow: time.Second,
+		DisabledFeatures: []Feature{FeatureAnalytics, FeatureAdmin, FeatureDebug},
+	}
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "docs01", "https://example.com/docs", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	h := newServer(cfg, db).RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/json")
+	h.ServeHTTP(res, req)
+	var root struct {
+		Routes []string `json:"routes"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &root); err != nil {
+		t.Fatalf("failed to decode route list: %v", err)
+	}
+	for _, want := range []string{"POST /api/v1/shorten", "GET /{code}", "GET /api/v1/urls/{code}/preview", "GET /health"} {
+		if !slices.Contains(root.Routes, want) {
+			t.Fatalf("expected %q to be listed, got %v", want, root.Routes)
+		}
+	}
+	for _, unwanted := range []string{"GET /api/v1/urls/{code}/analytics?top={n}", "GET /api/v1/urls/{code}/live", "GET /api/v1/admin/urls/{code}/raw", "GET /debug/vars"} {
+		if slices.Contains(root.Routes, unwanted) {
+			t.Fatalf("expected %q not to be listed, got %v", unwanted, root.Routes)
+		}
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{method: http.MethodGet, path: "/api/v1/urls/docs01", status: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v1/urls/docs01/preview", status: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v1/urls/docs01/analytics", status: http.StatusNotFound},
+		{method: http.MethodGet, path: "/api/v1/urls/docs01/metrics", status: http.StatusNotFound},
+		{method: http.MethodGet, path: "/api/v1/admin/urls/docs01/raw", status: http.StatusNotFound},
+		{method: http.MethodGet, path: "/debug/vars", status: http.StatusNotFound},
+		{method: http.MethodOptions, path: "/api/v1/urls/docs01/analytics", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(tt.method, tt.path, nil))
+		if res.Code != tt.status {
+			t.Fatalf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.status, res.Code)
+		}
+	}
+
+	res = httptest.NewRecorder()
+	newServer(Config{}, db).RegisterRoutes().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/docs01/analytics", nil))
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected every feature to be enabled by default, got %d", res.Code)
+	}
+}
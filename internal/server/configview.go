@@ -0,0 +1,215 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// configView is the effective configuration as GET /api/v1/admin/config
+// reports it. Fields are copied one by one rather than serializing Config,
+// so a setting added later stays private until it is listed here; secrets
+// only ever appear as *_set flags.
+type configView struct {
+	Port         int    `json:"port"`
+	GRPCPort     int    `json:"grpc_port"`
+	ListenSocket string `json:"listen_socket,omitempty"`
+
+	Redis redisConfigView `json:"redis"`
+
+	ResponseEnvelope   bool   `json:"response_envelope"`
+	BaseURL            string `json:"short_base_url,omitempty"`
+	TimeFormat         string `json:"time_format"`
+	JSONP              bool   `json:"jsonp"`
+	BucketPublicVisits bool   `json:"bucket_public_visits"`
+
+	AdminTokenSet         bool     `json:"admin_token_set"`
+	ResponseSigningKeySet bool     `json:"response_signing_key_set"`
+	TrustedProxies        []string `json:"trusted_proxies"`
+	ForceHTTPS            bool     `json:"force_https"`
+	ManagementTokens      bool     `json:"management_tokens"`
+	RedactLoggedURLs      bool     `json:"redact_logged_urls"`
+
+	AllowedDomains []string `json:"allowed_target_domains"`
+	BlockedDomains []string `json:"blocked_target_domains"`
+	DenylistFile   string   `json:"denylist_file,omitempty"`
+	DenylistRedis  bool     `json:"denylist_redis"`
+
+	RootRedirectURL         string `json:"root_redirect_url,omitempty"`
+	RootHTML                bool   `json:"root_html"`
+	RejectSchemelessTargets bool   `json:"reject_schemeless_targets"`
+	TrailingSlashRedirect   bool   `json:"trailing_slash_redirect"`
+	ErrorPageTemplate       string `json:"error_page_template,omitempty"`
+	ErrorPageMessage        string `json:"error_page_message,omitempty"`
+	RobotsTxtPath           string `json:"robots_txt_path,omitempty"`
+	FaviconPath             string `json:"favicon_path,omitempty"`
+
+	MaxLinksPerOwner     int    `json:"max_links_per_owner"`
+	CaseInsensitiveCodes bool   `json:"case_insensitive_codes"`
+	ReserveCaseVariants  bool   `json:"reserve_case_variants"`
+	CodePrefix           string `json:"short_code_prefix,omitempty"`
+
+	CollisionWarnThreshold int    `json:"collision_warn_threshold"`
+	MaxInFlight            int    `json:"max_in_flight"`
+	GlobalRateLimit        int    `json:"global_rate_limit"`
+	GlobalRateBurst        int    `json:"global_rate_burst"`
+	RedirectCacheMaxAge    string `json:"redirect_cache_max_age"`
+	VisitBurstLimit        int    `json:"visit_burst_limit"`
+	VisitBurstWindow       string `json:"visit_burst_window"`
+	VisitSampleRate        int    `json:"visit_sample_rate"`
+	QueryForwardPrecedence string `json:"query_forward_precedence"`
+	RateLimit              int    `json:"rate_limit"`
+	RateLimitWindow        string `json:"rate_limit_window"`
+	ExpiringSoonThreshold  string `json:"expiring_soon_threshold"`
+	CreateBufferSize       int    `json:"create_buffer_size"`
+	AnalyticsQueueSize     int    `json:"analytics_queue_size"`
+	AnalyticsDropPolicy    string `json:"analytics_drop_policy"`
+	GeoIPDBPath            string `json:"geoip_db_path,omitempty"`
+
+	ReadHeaderTimeout string `json:"read_header_timeout"`
+	IdleTimeout       string `json:"idle_timeout"`
+	MaxHeaderBytes    int    `json:"max_header_bytes"`
+	H2C               bool   `json:"h2c"`
+
+	// Maintenance is the current mode, which the admin API may have
+	// switched since startup.
+	Maintenance bool `json:"maintenance"`
+	SelfTest    bool `json:"selftest"`
+
+	EnabledFeatures  []Feature `json:"enabled_features"`
+	DisabledFeatures []Feature `json:"disabled_features"`
+}
+
+type redisConfigView struct {
+	Addr         string `json:"addr"`
+	PasswordSet  bool   `json:"password_set"`
+	DB           int    `json:"db"`
+	PoolSize     int    `json:"pool_size"`
+	MinIdleConns int    `json:"min_idle_conns"`
+	PoolTimeout  string `json:"pool_timeout"`
+	ReadTimeout  string `json:"read_timeout"`
+	WriteTimeout string `json:"write_timeout"`
+
+	HashKeys     bool `json:"hash_keys"`
+	KeySecretSet bool `json:"hash_keys_secret_set"`
+	// URLEncryption reports whether destinations are encrypted, and
+	// OldEncryptionKeys how many retired keys are kept, never the keys.
+	URLEncryption     bool `json:"url_encryption"`
+	OldEncryptionKeys int  `json:"old_encryption_keys"`
+	TrackExpiry       bool `json:"track_expiry"`
+}
+
+// configHandler reports the configuration the server was built from, with
+// secrets replaced by whether they are set.
+func (s *Server) configHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := s.config
+	view := configView{
+		Port:         cfg.Port,
+		GRPCPort:     cfg.GRPCPort,
+		ListenSocket: cfg.ListenSocket,
+
+		Redis: redisConfigView{
+			Addr:         cfg.Redis.Addr,
+			PasswordSet:  cfg.Redis.Password != "",
+			DB:           cfg.Redis.DB,
+			PoolSize:     cfg.Redis.PoolSize,
+			MinIdleConns: cfg.Redis.MinIdleConns,
+			PoolTimeout:  cfg.Redis.PoolTimeout.String(),
+			ReadTimeout:  cfg.Redis.ReadTimeout.String(),
+			WriteTimeout: cfg.Redis.WriteTimeout.String(),
+
+			HashKeys:          cfg.Redis.HashKeys,
+			KeySecretSet:      cfg.Redis.KeySecret != "",
+			URLEncryption:     cfg.Redis.EncryptionKey != "",
+			OldEncryptionKeys: len(cfg.Redis.OldEncryptionKeys),
+			TrackExpiry:       cfg.Redis.TrackExpiry,
+		},
+
+		ResponseEnvelope:   cfg.ResponseEnvelope,
+		BaseURL:            configURL(cfg.BaseURL),
+		TimeFormat:         cfg.TimeFormat,
+		JSONP:              cfg.JSONP,
+		BucketPublicVisits: cfg.BucketPublicVisits,
+
+		AdminTokenSet:         cfg.AdminToken != "",
+		ResponseSigningKeySet: cfg.ResponseSigningKey != "",
+		TrustedProxies:        []string{},
+		ForceHTTPS:            cfg.ForceHTTPS,
+		ManagementTokens:      cfg.ManagementTokens,
+		RedactLoggedURLs:      cfg.RedactLoggedURLs,
+
+		AllowedDomains: nonNil(cfg.AllowedDomains),
+		BlockedDomains: nonNil(cfg.BlockedDomains),
+		DenylistFile:   cfg.DenylistFile,
+		DenylistRedis:  cfg.DenylistRedis,
+
+		RootRedirectURL:         configURL(cfg.RootRedirectURL),
+		RootHTML:                cfg.RootHTML,
+		RejectSchemelessTargets: cfg.RejectSchemelessTargets,
+		TrailingSlashRedirect:   cfg.TrailingSlashRedirect,
+		ErrorPageTemplate:       cfg.ErrorPageTemplate,
+		ErrorPageMessage:        cfg.ErrorPageMessage,
+		RobotsTxtPath:           cfg.RobotsTxtPath,
+		FaviconPath:             cfg.FaviconPath,
+
+		MaxLinksPerOwner:     cfg.MaxLinksPerOwner,
+		CaseInsensitiveCodes: cfg.CaseInsensitiveCodes,
+		ReserveCaseVariants:  cfg.ReserveCaseVariants,
+		CodePrefix:           cfg.CodePrefix,
+
+		CollisionWarnThreshold: cfg.CollisionWarnThreshold,
+		MaxInFlight:            cfg.MaxInFlight,
+		GlobalRateLimit:        cfg.GlobalRateLimit,
+		GlobalRateBurst:        cfg.GlobalRateBurst,
+		RedirectCacheMaxAge:    cfg.RedirectCacheMaxAge.String(),
+		VisitBurstLimit:        cfg.VisitBurstLimit,
+		VisitBurstWindow:       cfg.VisitBurstWindow.String(),
+		VisitSampleRate:        cfg.VisitSampleRate,
+		QueryForwardPrecedence: cfg.QueryForwardPrecedence,
+		RateLimit:              cfg.RateLimit,
+		RateLimitWindow:        cfg.RateLimitWindow.String(),
+		ExpiringSoonThreshold:  cfg.ExpiringSoonThreshold.String(),
+		CreateBufferSize:       cfg.CreateBufferSize,
+		AnalyticsQueueSize:     cfg.AnalyticsQueueSize,
+		AnalyticsDropPolicy:    cfg.AnalyticsDropPolicy,
+		GeoIPDBPath:            cfg.GeoIPDBPath,
+
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout.String(),
+		IdleTimeout:       cfg.IdleTimeout.String(),
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		H2C:               cfg.H2C,
+
+		Maintenance: s.maintenance.Load(),
+		SelfTest:    cfg.SelfTest,
+
+		EnabledFeatures:  []Feature{},
+		DisabledFeatures: []Feature{},
+	}
+	for _, prefix := range cfg.TrustedProxies {
+		view.TrustedProxies = append(view.TrustedProxies, prefix.String())
+	}
+	for _, feature := range knownFeatures {
+		if s.enabled(feature) {
+			view.EnabledFeatures = append(view.EnabledFeatures, feature)
+		} else {
+			view.DisabledFeatures = append(view.DisabledFeatures, feature)
+		}
+	}
+	s.writeJSON(w, http.StatusOK, view)
+}
+
+// configURL renders u with any password replaced, or "" when unset.
+func configURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return u.Redacted()
+}
+
+// nonNil returns list, or an empty list in place of nil, so unset lists
+// render as [] rather than null.
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var urlHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+var errDenylisted = errors.New("url is on the denylist of known malicious sites")
+
+// denylist holds known-malicious targets loaded from DENYLIST_FILE: domains,
+// which also cover their subdomains, and SHA-256 hashes of whole URLs.
+type denylist struct {
+	entries map[string]bool
+}
+
+// loadDenylist reads one entry per line from path. A line of 64 hex digits is
+// the SHA-256 of a normalized URL; anything else is a domain. Blank lines and
+// lines starting with # are skipped.
+func loadDenylist(path string) (*denylist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := &denylist{entries: make(map[string]bool)}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		if !urlHashPattern.MatchString(entry) {
+			entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		}
+		list.entries[entry] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return list, nil
+}
+
+// denylistEntries are the entries that would deny target: its host, every
+// parent domain of it, and the hash of the whole URL.
+func denylistEntries(target *url.URL) []string {
+	host := strings.ToLower(target.Hostname())
+	var entries []string
+	for domain := host; domain != ""; {
+		entries = append(entries, domain)
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok {
+			break
+		}
+		domain = parent
+	}
+	sum := sha256.Sum256([]byte(target.String()))
+	return append(entries, hex.EncodeToString(sum[:]))
+}
+
+// checkDenylist refuses target when DENYLIST_FILE or, with DENYLIST_REDIS,
+// the short:denylist set lists it. Without either it does nothing. A Redis
+// error lets the target through, as the rate limiter does, rather than
+// blocking every create.
+func (s *Server) checkDenylist(ctx context.Context, target *url.URL) error {
+	if s.denylist == nil && !s.denylistRedis {
+		return nil
+	}
+	entries := denylistEntries(target)
+	if s.denylist != nil {
+		for _, entry := range entries {
+			if s.denylist.entries[entry] {
+				return errDenylisted
+			}
+		}
+	}
+	if s.denylistRedis {
+		denied, err := s.db.Denylisted(ctx, entries)
+		if err != nil {
+			log.Printf("denylist unavailable, allowing target: %v", err)
+			return nil
+		}
+		if denied {
+			return errDenylisted
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDenylistFile(t *testing.T) {
+	sum := sha256.Sum256([]byte("https://files.example.org/payload.exe"))
+	path := filepath.Join(t.TempDir(), "denylist.txt")
+	contents := "# phishing\nEvil.Example.com\n\n*.malware.test\n" + hex.EncodeToString(sum[:]) + "\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	list, err := loadDenylist(path)
+	if err != nil {
+		t.Fatalf("loadDenylist failed: %v", err)
+	}
+	h := (&Server{db: newMockDB(), denylist: list}).RegisterRoutes()
+
+	for _, target := range []string{
+		"https://evil.example.com/login",
+		"https://www.evil.example.com/",
+		"https://cdn.malware.test/x.js",
+		"https://files.example.org/payload.exe",
+	} {
+		if code := shorten(h, `{"url":"`+target+`"}`, "").Code; code != http.StatusForbidden {
+			t.Fatalf("expected %s to be denied, got %d", target, code)
+		}
+	}
+	for _, target := range []string{"https://docs.example.org/", "https://files.example.org/readme.txt", "https://notevil.example.com/"} {
+		if code := shorten(h, `{"url":"`+target+`"}`, "").Code; code != http.StatusCreated {
+			t.Fatalf("expected %s to be allowed, got %d", target, code)
+		}
+	}
+}
+
+func TestDenylistRedisSet(t *testing.T) {
+	db := newMockDB()
+	db.denylist["phish.example.net"] = true
+
+	h := (&Server{db: db, denylistRedis: true}).RegisterRoutes()
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"https://login.phish.example.net/"}`)))
+	if res.Code != http.StatusForbidden || !strings.Contains(res.Body.String(), "denylist") {
+		t.Fatalf("expected the target to be denied with a reason, got %d: %s", res.Code, res.Body.String())
+	}
+	if code := shorten(h, `{"url":"https://example.net/"}`, "").Code; code != http.StatusCreated {
+		t.Fatalf("expected an unlisted target to be allowed, got %d", code)
+	}
+
+	unchecked := (&Server{db: db}).RegisterRoutes()
+	if code := shorten(unchecked, `{"url":"https://login.phish.example.net/"}`, "").Code; code != http.StatusCreated {
+		t.Fatalf("expected the set to be ignored without DENYLIST_REDIS, got %d", code)
+	}
+}
+
+func TestDenylistEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "denylist.txt")
+	if err := os.WriteFile(path, []byte("# nothing yet\n"), 0o600); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	list, err := loadDenylist(path)
+	if err != nil {
+		t.Fatalf("loadDenylist failed: %v", err)
+	}
+	h := (&Server{db: newMockDB(), denylist: list, denylistRedis: true}).RegisterRoutes()
+	if code := shorten(h, `{"url":"https://docs.example.org/"}`, "").Code; code != http.StatusCreated {
+		t.Fatalf("expected an empty denylist to allow everything, got %d", code)
+	}
+
+	if _, err := loadDenylist(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Fatal("expected a missing file to fail to load")
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+const destinationCheckTimeout = 5 * time.Second
+
+// CheckDestination probes the stored destination of code and records whether
+// it answered with a non-error status. Unreachable destinations, including
+// ones refused by the outbound address guard, are recorded as unhealthy
+// rather than returned as errors; only lookup and storage failures are.
+func (s *Server) CheckDestination(ctx context.Context, code string) (redisdb.DestinationHealth, error) {
+	stats, err := s.db.GetStats(ctx, code)
+	if err != nil {
+		return redisdb.DestinationHealth{}, err
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, destinationCheckTimeout)
+	defer cancel()
+	health := probeDestination(probeCtx, s.outboundClient(), stats.LongURL)
+
+	if err := s.db.SetDestinationHealth(ctx, code, health); err != nil {
+		return redisdb.DestinationHealth{}, err
+	}
+	return health, nil
+}
+
+// probeDestination sends a HEAD request to target, falling back to GET for
+// servers that do not support HEAD, and reports the final status after
+// redirects.
+func probeDestination(ctx context.Context, client *http.Client, target string) redisdb.DestinationHealth {
+	health := redisdb.DestinationHealth{CheckedAt: time.Now().UTC()}
+
+	status, err := probeStatus(ctx, client, http.MethodHead, target)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = probeStatus(ctx, client, http.MethodGet, target)
+	}
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+
+	health.Status = status
+	health.Healthy = status >= 200 && status < 400
+	return health
+}
+
+func probeStatus(ctx context.Context, client *http.Client, method, target string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "url-shortner/"+version+" (destination check)")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, maxMetadataBodyBytes))
+
+	return res.StatusCode, nil
+}
+
+func (s *Server) checkDestinationHandler(w http.ResponseWriter, r *http.Request) {
+	code := s.pathCode(r)
+	if code == "" {
+		s.writeError(w, http.StatusNotFound, "short code not found")
+		return
+	}
+
+	health, err := s.CheckDestination(r.Context(), code)
+	if err != nil {
+		if errors.Is(err, redisdb.ErrNotFound) {
+			s.writeError(w, http.StatusNotFound, "short code not found")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to check destination")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, s.destinationView(health))
+}
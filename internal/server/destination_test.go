@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestCheckDestinationRecordsStatus(t *testing.T) {
+	dest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/alive":
+			w.WriteHeader(http.StatusOK)
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer dest.Close()
+
+	db := newMockDB()
+	for code, path := range map[string]string{"live001": "/alive", "dead001": "/gone", "nohd001": "/no-head"} {
+		if err := db.CreateShortURL(context.Background(), code, dest.URL+path, redisdb.CreateOptions{}); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	s := &Server{db: db, outbound: dest.Client()}
+	h := s.RegisterRoutes()
+
+	tests := []struct {
+		code    string
+		status  int
+		healthy bool
+	}{
+		{code: "live001", status: http.StatusOK, healthy: true},
+		{code: "dead001", status: http.StatusNotFound, healthy: false},
+		{code: "nohd001", status: http.StatusOK, healthy: true},
+	}
+
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/urls/"+tt.code+"/check", nil))
+		if res.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d: %s", tt.code, http.StatusOK, res.Code, res.Body.String())
+		}
+
+		var health redisdb.DestinationHealth
+		if err := json.Unmarshal(res.Body.Bytes(), &health); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tt.code, err)
+		}
+		if health.Status != tt.status || health.Healthy != tt.healthy || time.Since(health.CheckedAt) > time.Minute {
+			t.Fatalf("%s: unexpected check result %+v", tt.code, health)
+		}
+
+		res = httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/"+tt.code, nil))
+		var stats redisdb.URLStats
+		if err := json.Unmarshal(res.Body.Bytes(), &stats); err != nil {
+			t.Fatalf("%s: failed to decode stats: %v", tt.code, err)
+		}
+		if stats.Destination == nil || stats.Destination.Status != tt.status || stats.Destination.Healthy != tt.healthy {
+			t.Fatalf("%s: expected the check to be surfaced in stats, got %+v", tt.code, stats.Destination)
+		}
+	}
+
+	stats, _ := db.GetStats(context.Background(), "live001")
+	if stats.Visits != 0 {
+		t.Fatalf("expected checks not to count as visits, got %d", stats.Visits)
+	}
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/urls/missing/check", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, res.Code)
+	}
+}
+
+func TestCheckDestinationUnreachable(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "priv001", "http://127.0.0.1:9/admin", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	s := &Server{db: db}
+	health, err := s.CheckDestination(context.Background(), "priv001")
+	if err != nil {
+		t.Fatalf("CheckDestination failed: %v", err)
+	}
+	if health.Healthy || health.Status != 0 || health.Error == "" {
+		t.Fatalf("expected a blocked destination to be recorded as unhealthy, got %+v", health)
+	}
+	if stats, _ := db.GetStats(context.Background(), "priv001"); stats.Destination == nil || stats.Destination.Error != health.Error {
+		t.Fatalf("expected the failure to be recorded, got %+v", stats.Destination)
+	}
+}
@@ -0,0 +1,85 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+	"url-shortner/internal/server"
+)
+
+// memoryService is the smallest backend an embedder could write: it keeps
+// links in a map and implements only what shortening and redirecting use.
+// Calls to any other method panic on the nil embedded interface.
+type memoryService struct {
+	redisdb.Service
+
+	mu    sync.Mutex
+	links map[string]string
+}
+
+func (m *memoryService) ShortCodeExists(_ context.Context, code string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.links[code]
+	return ok, nil
+}
+
+func (m *memoryService) CreateShortURL(_ context.Context, code, longURL string, _ redisdb.CreateOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.links[code]; ok {
+		return redisdb.ErrConflict
+	}
+	m.links[code] = longURL
+	return nil
+}
+
+func (m *memoryService) VisitURL(_ context.Context, code string, _ redisdb.Visit) (redisdb.ResolvedURL, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	longURL, ok := m.links[code]
+	if !ok {
+		return redisdb.ResolvedURL{}, redisdb.ErrNotFound
+	}
+	return redisdb.ResolvedURL{URL: longURL}, nil
+}
+
+func TestNewServerWithCustomService(t *testing.T) {
+	svc := &memoryService{links: map[string]string{}}
+	app, err := server.NewServerWithService(svc, server.Config{Port: 8080})
+	if err != nil {
+		t.Fatalf("NewServerWithService failed: %v", err)
+	}
+	h := app.RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"https://docs.example.org/embed","custom_alias":"embed"}`)))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+	if svc.links["embed"] != "https://docs.example.org/embed" {
+		t.Fatalf("expected the link in the custom service, got %v", svc.links)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/embed", nil))
+	if res.Code != http.StatusFound || res.Header().Get("Location") != "https://docs.example.org/embed" {
+		t.Fatalf("expected redirect to the stored URL, got %d %q", res.Code, res.Header().Get("Location"))
+	}
+
+	if srv := app.HTTPServer(); srv.Addr != ":8080" || srv.Handler == nil {
+		t.Fatalf("unexpected http.Server: addr=%q", srv.Addr)
+	}
+
+	if _, err := server.NewServerWithService(nil, server.Config{Port: 8080}); err == nil {
+		t.Fatal("expected an error for a nil service")
+	}
+	if _, err := server.NewServerWithService(svc, server.Config{}); err == nil {
+		t.Fatal("expected an error for an invalid config")
+	}
+}
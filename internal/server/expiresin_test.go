@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExpiresIn(t *testing.T) {
+	for raw, want := range map[string]time.Duration{
+		"30m":   30 * time.Minute,
+		"12h":   12 * time.Hour,
+		"7d":    7 * 24 * time.Hour,
+		"1d12h": 36 * time.Hour,
+		"1.5d":  36 * time.Hour,
+		"90s":   90 * time.Second,
+	} {
+		got, err := parseExpiresIn(raw)
+		if err != nil || got != want {
+			t.Errorf("parseExpiresIn(%q) = %v, %v; want %v", raw, got, err, want)
+		}
+	}
+
+	for _, raw := range []string{"", "7", "soon", "-1h", "0m", "-2d", "1w"} {
+		if _, err := parseExpiresIn(raw); err == nil {
+			t.Errorf("parseExpiresIn(%q) should fail", raw)
+		}
+	}
+}
+
+func TestCreateWithExpiresIn(t *testing.T) {
+	for _, tc := range []struct {
+		expiresIn string
+		ttl       time.Duration
+	}{
+		{"45m", 45 * time.Minute},
+		{"6h", 6 * time.Hour},
+		{"3d", 72 * time.Hour},
+	} {
+		db := newMockDB()
+		h := (&Server{db: db}).RegisterRoutes()
+
+		body := `{"url":"https://docs.example.org/soon","custom_alias":"soon01","expires_in":"` + tc.expiresIn + `"}`
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(body)))
+		if res.Code != http.StatusCreated {
+			t.Fatalf("%s: expected 201, got %d: %s", tc.expiresIn, res.Code, res.Body.String())
+		}
+		var created createShortURLResponse
+		json.Unmarshal(res.Body.Bytes(), &created)
+		if created.ExpiresAt == nil || time.Until(*created.ExpiresAt) > tc.ttl || time.Until(*created.ExpiresAt) < tc.ttl-time.Minute {
+			t.Fatalf("%s: expected expires_at about %s away, got %v", tc.expiresIn, tc.ttl, created.ExpiresAt)
+		}
+		if db.ttls["soon01"] != tc.ttl {
+			t.Fatalf("%s: expected a TTL of %s, got %s", tc.expiresIn, tc.ttl, db.ttls["soon01"])
+		}
+	}
+}
+
+func TestCreateWithExpiresInRejected(t *testing.T) {
+	h := (&Server{db: newMockDB()}).RegisterRoutes()
+
+	for _, body := range []string{
+		`{"url":"https://docs.example.org","expires_in":"later"}`,
+		`{"url":"https://docs.example.org","expires_in":"-5m"}`,
+		`{"url":"https://docs.example.org","expires_in":"0h"}`,
+		`{"url":"https://docs.example.org","expires_in":"2h","expiration_days":1}`,
+	} {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(body)))
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", body, res.Code)
+		}
+	}
+}
+
+func TestCreateSlidingWithExpiresIn(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db}).RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"https://docs.example.org","custom_alias":"slide01","expires_in":"30m","sliding_expiration":true}`)))
+	if res.Code != http.StatusCreated || !db.store["slide01"].Sliding {
+		t.Fatalf("expected a sliding link, got %d: %s", res.Code, res.Body.String())
+	}
+}
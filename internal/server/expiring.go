@@ -0,0 +1,76 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+const (
+	defaultExpiringSoonThreshold = 24 * time.Hour
+	// maxExpiringWithinHours caps within_hours at a year.
+	maxExpiringWithinHours = 366 * 24
+)
+
+func (s *Server) expiringSoonWithin() time.Duration {
+	if s.expiringSoonThreshold == 0 {
+		return defaultExpiringSoonThreshold
+	}
+	return s.expiringSoonThreshold
+}
+
+// expiresWithin reports whether stats expires in less than d. Permanent links
+// never do.
+func expiresWithin(stats redisdb.URLStats, d time.Duration) bool {
+	return stats.TTLSeconds != nil && time.Duration(*stats.TTLSeconds)*time.Second < d
+}
+
+// expiringURLsHandler lists links expiring in less than within_hours, or the
+// EXPIRING_SOON_THRESHOLD without it, so they can be renewed in time. It
+// scans every link, so it is paginated over the matches rather than the
+// keyspace.
+func (s *Server) expiringURLsHandler(w http.ResponseWriter, r *http.Request) {
+	within := s.expiringSoonWithin()
+	if raw := r.URL.Query().Get("within_hours"); raw != "" {
+		hours, err := strconv.Atoi(raw)
+		if err != nil || hours < 1 || hours > maxExpiringWithinHours {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("within_hours must be between 1 and %d", maxExpiringWithinHours))
+			return
+		}
+		within = time.Duration(hours) * time.Hour
+	}
+	page, err := parsePageRequest(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	expiring := make(map[string]redisdb.URLStats)
+	err = s.db.ScanURLs(r.Context(), func(stats redisdb.URLStats) error {
+		if expiresWithin(stats, within) && !stats.Consumed {
+			expiring[stats.Code] = stats
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, redisdb.ErrCodesHashed) {
+			s.writeError(w, http.StatusNotImplemented, "listing expiring links is unavailable while BLUEPRINT_DB_HASH_KEYS is enabled")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to list URLs")
+		return
+	}
+
+	codes, next := paginate(slices.Collect(maps.Keys(expiring)), page)
+	urls := make([]urlStatsView, 0, len(codes))
+	for _, code := range codes {
+		urls = append(urls, s.statsView(r, expiring[code]))
+	}
+	s.writeJSON(w, http.StatusOK, pagedResponse[urlStatsView]{Items: urls, NextCursor: next, HasMore: next != ""})
+}
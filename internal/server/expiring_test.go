@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestExpiresWithin(t *testing.T) {
+	ttl := func(seconds int64) *int64 { return &seconds }
+	tests := []struct {
+		name  string
+		stats redisdb.URLStats
+		want  bool
+	}{
+		{"permanent", redisdb.URLStats{}, false},
+		{"under threshold", redisdb.URLStats{TTLSeconds: ttl(3600)}, true},
+		{"at threshold", redisdb.URLStats{TTLSeconds: ttl(86400)}, false},
+		{"over threshold", redisdb.URLStats{TTLSeconds: ttl(7 * 86400)}, false},
+	}
+	for _, tt := range tests {
+		if got := expiresWithin(tt.stats, 24*time.Hour); got != tt.want {
+			t.Errorf("%s: expected %t, got %t", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestStatsReportExpiringSoon(t *testing.T) {
+	db := newMockDB()
+	soon := time.Now().Add(2 * time.Hour)
+	later := time.Now().Add(72 * time.Hour)
+	db.store["soon01"] = redisdb.URLStats{Code: "soon01", LongURL: "https://docs.example.org/a", ExpiresAt: &soon}
+	db.store["later01"] = redisdb.URLStats{Code: "later01", LongURL: "https://docs.example.org/b", ExpiresAt: &later}
+
+	stats := func(s *Server, code string) map[string]any {
+		res := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/"+code, nil))
+		var body map[string]any
+		json.Unmarshal(res.Body.Bytes(), &body)
+		return body
+	}
+
+	s := &Server{db: db}
+	if body := stats(s, "soon01"); body["expiring_soon"] != true || body["ttl_seconds"] == nil {
+		t.Fatalf("expected soon01 to be expiring soon with a ttl, got %v", body)
+	}
+	if body := stats(s, "later01"); body["expiring_soon"] != nil {
+		t.Fatalf("expected later01 not to be flagged, got %v", body)
+	}
+
+	s = &Server{db: db, expiringSoonThreshold: 96 * time.Hour}
+	if body := stats(s, "later01"); body["expiring_soon"] != true {
+		t.Fatalf("expected the configured threshold to flag later01, got %v", body)
+	}
+}
+
+func TestExpiringURLsHandler(t *testing.T) {
+	db := newMockDB()
+	for code, left := range map[string]time.Duration{"exp01": time.Hour, "exp02": 20 * time.Hour, "exp03": 48 * time.Hour} {
+		at := time.Now().Add(left)
+		db.store[code] = redisdb.URLStats{Code: code, LongURL: "https://docs.example.org/" + code, ExpiresAt: &at}
+	}
+	db.store["forever"] = redisdb.URLStats{Code: "forever", LongURL: "https://docs.example.org/forever"}
+	h := (&Server{db: db}).RegisterRoutes()
+
+	list := func(query string) (int, pagedResponse[redisdb.URLStats]) {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/expiring"+query, nil))
+		var page pagedResponse[redisdb.URLStats]
+		json.Unmarshal(res.Body.Bytes(), &page)
+		return res.Code, page
+	}
+	codes := func(page pagedResponse[redisdb.URLStats]) []string {
+		var out []string
+		for _, item := range page.Items {
+			if !item.ExpiringSoon && item.TTLSeconds != nil && *item.TTLSeconds < 86400 {
+				t.Fatalf("expected %s to be flagged expiring_soon", item.Code)
+			}
+			out = append(out, item.Code)
+		}
+		return out
+	}
+
+	code, page := list("")
+	if code != http.StatusOK || len(page.Items) != 2 || codes(page)[0] != "exp01" || codes(page)[1] != "exp02" {
+		t.Fatalf("expected exp01 and exp02 under the default threshold, got %d %v", code, codes(page))
+	}
+	if _, page = list("?within_hours=2"); len(page.Items) != 1 || page.Items[0].Code != "exp01" {
+		t.Fatalf("expected only exp01 within 2 hours, got %v", codes(page))
+	}
+	if _, page = list("?within_hours=72&limit=2"); len(page.Items) != 2 || !page.HasMore {
+		t.Fatalf("expected a first page of two with more to come, got %+v", page)
+	}
+	if _, page = list("?within_hours=72&limit=2&cursor=" + page.NextCursor); len(page.Items) != 1 || page.Items[0].Code != "exp03" {
+		t.Fatalf("expected exp03 on the second page, got %v", codes(page))
+	}
+	for _, bad := range []string{"?within_hours=0", "?within_hours=abc", "?within_hours=100000"} {
+		if code, _ := list(bad); code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", bad, code)
+		}
+	}
+}
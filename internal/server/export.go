@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+// exportFlushEvery is how many rows are written between flushes, so a large
+// export reaches the client as the keyspace is scanned rather than at the end.
+const exportFlushEvery = 100
+
+var exportCSVHeader = []string{"code", "long_url", "created_at", "visits", "expires_at", "tags", "group", "title"}
+
+// exportEncoder writes one export format row by row. begin sets the headers
+// and sends the status, so it is deferred until the first row is ready.
+type exportEncoder interface {
+	begin() error
+	row(stats redisdb.URLStats) error
+	end() error
+}
+
+// exportHandler streams every link as CSV or a JSON array. Nothing is
+// buffered beyond one Redis SCAN batch: rows are encoded as they are read and
+// flushed every exportFlushEvery rows, and a client that disconnects cancels
+// the request context, which stops the scan.
+func (s *Server) exportHandler(w http.ResponseWriter, r *http.Request) {
+	var enc exportEncoder
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		enc = &jsonExport{w: w, view: func(stats redisdb.URLStats) urlStatsView { return s.statsView(r, stats) }}
+	case "csv":
+		enc = &csvExport{w: w, csv: csv.NewWriter(w)}
+	default:
+		s.writeError(w, http.StatusBadRequest, "format must be json or csv")
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	started := false
+	rows := 0
+	err := s.db.ScanURLs(r.Context(), func(stats redisdb.URLStats) error {
+		if !started {
+			started = true
+			if err := enc.begin(); err != nil {
+				return err
+			}
+		}
+		if err := enc.row(stats); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushEvery == 0 && flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+
+	if err != nil && !started {
+		if errors.Is(err, redisdb.ErrCodesHashed) {
+			s.writeError(w, http.StatusNotImplemented, "export is unavailable while BLUEPRINT_DB_HASH_KEYS is enabled")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to export urls")
+		return
+	}
+	if err != nil {
+		// The status is already sent; leaving the output unterminated is
+		// the only way left to tell the client the export is incomplete.
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("export stopped after %d rows: %v", rows, err)
+		}
+		return
+	}
+
+	if !started {
+		if err := enc.begin(); err != nil {
+			return
+		}
+	}
+	_ = enc.end()
+}
+
+type jsonExport struct {
+	w    http.ResponseWriter
+	view func(redisdb.URLStats) urlStatsView
+	rows int
+}
+
+func (e *jsonExport) begin() error {
+	e.w.Header().Set("Content-Type", "application/json")
+	e.w.WriteHeader(http.StatusOK)
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonExport) row(stats redisdb.URLStats) error {
+	data, err := json.Marshal(e.view(stats))
+	if err != nil {
+		return err
+	}
+	if e.rows > 0 {
+		if _, err := io.WriteString(e.w, ",\n"); err != nil {
+			return err
+		}
+	}
+	e.rows++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonExport) end() error {
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
+
+// csvExport writes through a csv.Writer, which buffers; each row is flushed
+// to the response so the periodic http.Flusher flush sends it.
+type csvExport struct {
+	w   http.ResponseWriter
+	csv *csv.Writer
+}
+
+func (e *csvExport) begin() error {
+	e.w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	e.w.Header().Set("Content-Disposition", `attachment; filename="urls.csv"`)
+	e.w.WriteHeader(http.StatusOK)
+	return e.write(exportCSVHeader)
+}
+
+func (e *csvExport) row(stats redisdb.URLStats) error {
+	expiresAt := ""
+	if stats.ExpiresAt != nil {
+		expiresAt = stats.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return e.write([]string{
+		stats.Code,
+		stats.LongURL,
+		stats.CreatedAt.UTC().Format(time.RFC3339),
+		strconv.FormatInt(stats.Visits, 10),
+		expiresAt,
+		strings.Join(stats.Tags, ","),
+		stats.Group,
+		stats.Title,
+	})
+}
+
+func (e *csvExport) end() error {
+	return nil
+}
+
+func (e *csvExport) write(record []string) error {
+	if err := e.csv.Write(record); err != nil {
+		return err
+	}
+	e.csv.Flush()
+	return e.csv.Error()
+}
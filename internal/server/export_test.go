@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+// flushRecorder counts the flushes a streaming handler makes.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushes++
+	r.ResponseRecorder.Flush()
+}
+
+func newExportServer(t *testing.T, links int) *Server {
+	t.Helper()
+	db := newMockDB()
+	for i := range links {
+		code := fmt.Sprintf("exp%04d", i)
+		if err := db.CreateShortURL(context.Background(), code, "https://example.com/"+code, redisdb.CreateOptions{Tags: []string{"docs"}}); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	return &Server{db: db, adminToken: "s3cret"}
+}
+
+func exportRequest(ctx context.Context, query string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/export"+query, nil).WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	return req
+}
+
+func TestExportStreamsJSON(t *testing.T) {
+	s := newExportServer(t, 250)
+	res := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	s.RegisterRoutes().ServeHTTP(res, exportRequest(context.Background(), ""))
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+	if res.flushes < 2 {
+		t.Fatalf("expected the export to be flushed while streaming, got %d flushes", res.flushes)
+	}
+
+	var out []redisdb.URLStats
+	if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+		t.Fatalf("failed to decode export: %v", err)
+	}
+	if len(out) != 250 {
+		t.Fatalf("expected 250 links, got %d", len(out))
+	}
+	if out[0].Code != "exp0000" || out[0].LongURL != "https://example.com/exp0000" {
+		t.Fatalf("unexpected first link: %+v", out[0])
+	}
+}
+
+func TestExportStreamsCSV(t *testing.T) {
+	s := newExportServer(t, 3)
+	res := httptest.NewRecorder()
+	s.RegisterRoutes().ServeHTTP(res, exportRequest(context.Background(), "?format=csv"))
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+	if ct := res.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("expected a CSV content type, got %q", ct)
+	}
+
+	records, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read CSV: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("expected a header and 3 rows, got %d records", len(records))
+	}
+	if strings.Join(records[0], ",") != strings.Join(exportCSVHeader, ",") {
+		t.Fatalf("unexpected header: %v", records[0])
+	}
+	if records[1][0] != "exp0000" || records[1][1] != "https://example.com/exp0000" || records[1][5] != "docs" {
+		t.Fatalf("unexpected row: %v", records[1])
+	}
+}
+
+func TestExportEmptyAndInvalid(t *testing.T) {
+	s := newExportServer(t, 0)
+	h := s.RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, exportRequest(context.Background(), ""))
+	if res.Code != http.StatusOK || strings.TrimSpace(res.Body.String()) != "[]" {
+		t.Fatalf("expected an empty array, got %d %q", res.Code, res.Body.String())
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, exportRequest(context.Background(), "?format=xml"))
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, res.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/export", nil)
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d without a token, got %d", http.StatusUnauthorized, res.Code)
+	}
+}
+
+// cancelAfterFlush cancels the request context on the first flush, like a
+// client that hangs up part way through a download.
+type cancelAfterFlush struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (r *cancelAfterFlush) Flush() {
+	r.cancel()
+	r.ResponseRecorder.Flush()
+}
+
+func TestExportStopsWhenClientDisconnects(t *testing.T) {
+	s := newExportServer(t, 250)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	res := &cancelAfterFlush{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+	s.RegisterRoutes().ServeHTTP(res, exportRequest(ctx, "?format=csv"))
+
+	records, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read CSV: %v", err)
+	}
+	if got := len(records) - 1; got != exportFlushEvery {
+		t.Fatalf("expected the export to stop after %d rows, got %d", exportFlushEvery, got)
+	}
+}
@@ -0,0 +1,350 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+const (
+	// createBufferFlushInterval is how often buffered links are retried.
+	createBufferFlushInterval = 5 * time.Second
+	createBufferFlushTimeout  = 5 * time.Second
+)
+
+// redisUnreachable reports whether err means Redis could not be reached at
+// all, as opposed to refusing or failing the command.
+func redisUnreachable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// pendingLink is a create waiting in a createBuffer for Redis to come back.
+type pendingLink struct {
+	longURL   string
+	opts      redisdb.CreateOptions
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+// remainingTTL is what is left of the link's TTL at now, and false once the
+// link has expired while it waited.
+func (p pendingLink) remainingTTL(now time.Time) (time.Duration, bool) {
+	if p.expiresAt.IsZero() {
+		return 0, true
+	}
+	ttl := p.expiresAt.Sub(now)
+	return ttl, ttl > 0
+}
+
+// createBuffer wraps the storage backend so creates keep working through a
+// short Redis outage. A create that finds Redis unreachable is kept in
+// memory, up to limit links, and written to Redis by a background flush once
+// it answers again. Until then the buffered links resolve from memory, without
+// counting visits. Buffered links are lost if the process stops before they
+// are flushed, and a buffered custom alias that turns out to be taken in
+// Redis is dropped.
+type createBuffer struct {
+	redisdb.Service
+	limit int
+
+	mu      sync.Mutex
+	pending map[string]pendingLink
+	order   []string
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func newCreateBuffer(db redisdb.Service, limit int) *createBuffer {
+	b := &createBuffer{
+		Service: db,
+		limit:   limit,
+		pending: make(map[string]pendingLink),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *createBuffer) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(createBufferFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), createBufferFlushTimeout)
+			b.flush(ctx)
+			cancel()
+		}
+	}
+}
+
+// Len returns how many links are waiting to be flushed.
+func (b *createBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+func (b *createBuffer) lookup(code string) (pendingLink, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	link, ok := b.pending[code]
+	if !ok {
+		return pendingLink{}, false
+	}
+	if _, live := link.remainingTTL(time.Now()); !live {
+		return pendingLink{}, false
+	}
+	return link, true
+}
+
+func (b *createBuffer) remove(code string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.pending[code]; !ok {
+		return false
+	}
+	delete(b.pending, code)
+	b.order = slices.DeleteFunc(b.order, func(c string) bool { return c == code })
+	return true
+}
+
+// flush writes the buffered links to Redis, oldest first. It stops at the
+// first one Redis cannot be reached for and leaves the rest for the next try.
+func (b *createBuffer) flush(ctx context.Context) {
+	b.mu.Lock()
+	codes := slices.Clone(b.order)
+	b.mu.Unlock()
+
+	for _, code := range codes {
+		b.mu.Lock()
+		link, ok := b.pending[code]
+		b.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		opts := link.opts
+		ttl, live := link.remainingTTL(time.Now())
+		if !live {
+			b.remove(code)
+			continue
+		}
+		opts.TTL = ttl
+
+		err := b.Service.CreateShortURL(ctx, code, link.longURL, opts)
+		switch {
+		case err == nil:
+		case redisUnreachable(err) || errors.Is(err, redisdb.ErrReadOnly):
+			return
+		case errors.Is(err, redisdb.ErrConflict):
+			log.Printf("dropping buffered link %s: the code was taken while Redis was unreachable", code)
+		default:
+			log.Printf("dropping buffered link %s: %v", code, err)
+		}
+		b.remove(code)
+	}
+}
+
+// close stops the background flush and makes a last attempt to write what is
+// still buffered. It reports the links that could not be saved.
+func (b *createBuffer) close(ctx context.Context) error {
+	b.once.Do(func() { close(b.stop) })
+	<-b.done
+	b.flush(ctx)
+	if n := b.Len(); n > 0 {
+		return fmt.Errorf("%d buffered links were not saved", n)
+	}
+	return nil
+}
+
+func (b *createBuffer) CreateShortURL(ctx context.Context, code, longURL string, opts redisdb.CreateOptions) error {
+	if _, ok := b.lookup(code); ok {
+		return redisdb.ErrConflict
+	}
+	err := b.Service.CreateShortURL(ctx, code, longURL, opts)
+	if !redisUnreachable(err) {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pending) >= b.limit {
+		return err
+	}
+	now := time.Now()
+	link := pendingLink{longURL: longURL, opts: opts, createdAt: now.UTC()}
+	if opts.TTL > 0 {
+		link.expiresAt = now.Add(opts.TTL)
+	}
+	b.pending[code] = link
+	b.order = append(b.order, code)
+	return nil
+}
+
+func (b *createBuffer) ShortCodeExists(ctx context.Context, code string) (bool, error) {
+	if _, ok := b.lookup(code); ok {
+		return true, nil
+	}
+	exists, err := b.Service.ShortCodeExists(ctx, code)
+	if redisUnreachable(err) {
+		return false, nil
+	}
+	return exists, err
+}
+
+func (b *createBuffer) IsReserved(ctx context.Context, code string) (bool, error) {
+	reserved, err := b.Service.IsReserved(ctx, code)
+	if redisUnreachable(err) {
+		return false, nil
+	}
+	return reserved, err
+}
+
+// ClaimCaseFold lets the alias through while Redis is unreachable; a case
+// variant created then is not caught.
+func (b *createBuffer) ClaimCaseFold(ctx context.Context, code string) (bool, error) {
+	claimed, err := b.Service.ClaimCaseFold(ctx, code)
+	if redisUnreachable(err) {
+		return true, nil
+	}
+	return claimed, err
+}
+
+// GetOwnerQuota reports no override while Redis is unreachable, so keyed
+// creates are only held to MAX_LINKS_PER_OWNER, which still needs Redis to
+// count the owner's links.
+func (b *createBuffer) GetOwnerQuota(ctx context.Context, owner string) (int64, bool, error) {
+	limit, ok, err := b.Service.GetOwnerQuota(ctx, owner)
+	if redisUnreachable(err) {
+		return 0, false, nil
+	}
+	return limit, ok, err
+}
+
+func (b *createBuffer) resolved(link pendingLink) (redisdb.ResolvedURL, error) {
+	now := time.Now()
+	if !link.opts.StartsAt.IsZero() && link.opts.StartsAt.After(now) {
+		return redisdb.ResolvedURL{}, redisdb.ErrNotActive
+	}
+	// One-time links cannot be consumed from memory.
+	if link.opts.OneTime {
+		return redisdb.ResolvedURL{}, redisdb.ErrReadOnly
+	}
+	ttl, _ := link.remainingTTL(now)
+	return redisdb.ResolvedURL{
+		URL:                 link.longURL,
+		TTL:                 ttl,
+		ForwardQuery:        link.opts.ForwardQuery,
+		InterstitialSeconds: link.opts.InterstitialSeconds,
+		Variant:             -1,
+	}, nil
+}
+
+func (b *createBuffer) GetLongURL(ctx context.Context, code string) (string, error) {
+	if link, ok := b.lookup(code); ok {
+		resolved, err := b.resolved(link)
+		return resolved.URL, err
+	}
+	return b.Service.GetLongURL(ctx, code)
+}
+
+func (b *createBuffer) ResolveURL(ctx context.Context, code string) (redisdb.ResolvedURL, error) {
+	if link, ok := b.lookup(code); ok {
+		return b.resolved(link)
+	}
+	return b.Service.ResolveURL(ctx, code)
+}
+
+func (b *createBuffer) VisitURL(ctx context.Context, code string, visit redisdb.Visit) (redisdb.ResolvedURL, error) {
+	if link, ok := b.lookup(code); ok {
+		if link.opts.RequireHTTPS && visit.PlainHTTP {
+			return redisdb.ResolvedURL{}, redisdb.ErrInsecure
+		}
+		resolved, err := b.resolved(link)
+		if err == nil && len(link.opts.Variants) > 0 {
+			resolved.URL, resolved.Variant = pickVariant(redisdb.URLStats{Variants: link.opts.Variants, StickyVariants: link.opts.StickyVariants}, visit)
+		}
+		return resolved, err
+	}
+	return b.Service.VisitURL(ctx, code, visit)
+}
+
+func (b *createBuffer) GetStats(ctx context.Context, code string) (redisdb.URLStats, error) {
+	link, ok := b.lookup(code)
+	if !ok {
+		return b.Service.GetStats(ctx, code)
+	}
+	stats := redisdb.URLStats{
+		Code:         code,
+		LongURL:      link.longURL,
+		CreatedAt:    link.createdAt,
+		Tags:         link.opts.Tags,
+		Sliding:      link.opts.Sliding,
+		OneTime:      link.opts.OneTime,
+		ForwardQuery: link.opts.ForwardQuery,
+		RequireHTTPS: link.opts.RequireHTTPS,
+		Title:        link.opts.Title,
+		Description:  link.opts.Description,
+		Group:        link.opts.Group,
+		Owner:        link.opts.Owner,
+		Campaign:     link.opts.Campaign,
+
+		InterstitialSeconds: link.opts.InterstitialSeconds,
+		Variants:            link.opts.Variants,
+		StickyVariants:      link.opts.StickyVariants,
+	}
+	if ttl, _ := link.remainingTTL(time.Now()); ttl > 0 {
+		expiresAt := time.Now().UTC().Add(ttl)
+		seconds := int64(ttl / time.Second)
+		stats.ExpiresAt, stats.TTLSeconds = &expiresAt, &seconds
+	}
+	if !link.opts.StartsAt.IsZero() {
+		startsAt := link.opts.StartsAt.UTC()
+		stats.StartsAt = &startsAt
+	}
+	return stats, nil
+}
+
+// GetRaw reports the fields a buffered link will be stored with that the
+// server reads back, such as its management token digest.
+func (b *createBuffer) GetRaw(ctx context.Context, code string) (map[string]string, time.Duration, error) {
+	link, ok := b.lookup(code)
+	if !ok {
+		return b.Service.GetRaw(ctx, code)
+	}
+	fields := map[string]string{
+		"url":        link.longURL,
+		"created_at": link.createdAt.Format(time.RFC3339Nano),
+		"visits":     "0",
+	}
+	if link.opts.ManagementTokenHash != "" {
+		fields[managementTokenField] = link.opts.ManagementTokenHash
+	}
+	ttl, _ := link.remainingTTL(time.Now())
+	if ttl == 0 {
+		ttl = -1
+	}
+	return fields, ttl, nil
+}
+
+func (b *createBuffer) DeleteShortURL(ctx context.Context, code string) error {
+	if b.remove(code) {
+		return nil
+	}
+	return b.Service.DeleteShortURL(ctx, code)
+}
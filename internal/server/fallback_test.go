@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+var errDialRefused = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+// outageDB fails every call the create and redirect paths make with a dial
+// error while down is set, like a Redis that cannot be reached.
+type outageDB struct {
+	*mockDB
+	down atomic.Bool
+}
+
+func (o *outageDB) CreateShortURL(ctx context.Context, code, longURL string, opts redisdb.CreateOptions) error {
+	if o.down.Load() {
+		return errDialRefused
+	}
+	return o.mockDB.CreateShortURL(ctx, code, longURL, opts)
+}
+
+func (o *outageDB) ShortCodeExists(ctx context.Context, code string) (bool, error) {
+	if o.down.Load() {
+		return false, errDialRefused
+	}
+	return o.mockDB.ShortCodeExists(ctx, code)
+}
+
+func (o *outageDB) IsReserved(ctx context.Context, code string) (bool, error) {
+	if o.down.Load() {
+		return false, errDialRefused
+	}
+	return o.mockDB.IsReserved(ctx, code)
+}
+
+func (o *outageDB) VisitURL(ctx context.Context, code string, visit redisdb.Visit) (redisdb.ResolvedURL, error) {
+	if o.down.Load() {
+		return redisdb.ResolvedURL{}, errDialRefused
+	}
+	return o.mockDB.VisitURL(ctx, code, visit)
+}
+
+func TestCreateBufferHoldsLinksUntilRedisRecovers(t *testing.T) {
+	db := &outageDB{mockDB: newMockDB()}
+	app, err := NewServerWithService(db, Config{Port: 8080, CreateBufferSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := app.RegisterRoutes()
+
+	db.down.Store(true)
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"https://docs.example.org/outage","custom_alias":"outage1","expiration_days":1}`)))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected the create to be buffered, got %d: %s", res.Code, res.Body.String())
+	}
+	if _, ok := db.store["outage1"]; ok {
+		t.Fatal("expected nothing written while Redis is down")
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/outage1", nil))
+	if res.Code != http.StatusFound || res.Header().Get("Location") != "https://docs.example.org/outage" {
+		t.Fatalf("expected the buffered link to redirect from memory, got %d", res.Code)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"https://docs.example.org/other","custom_alias":"outage1"}`)))
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected a buffered alias to be taken, got %d", res.Code)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var health map[string]string
+	json.Unmarshal(res.Body.Bytes(), &health)
+	if health["buffered_links"] != "1" {
+		t.Fatalf("expected /health to report one buffered link, got %v", health)
+	}
+
+	// Still down: the flush keeps the link for later.
+	app.createBuffer.flush(context.Background())
+	if app.createBuffer.Len() != 1 {
+		t.Fatal("expected the link to stay buffered while Redis is down")
+	}
+
+	db.down.Store(false)
+	app.createBuffer.flush(context.Background())
+	if app.createBuffer.Len() != 0 {
+		t.Fatal("expected the buffer to be empty after the flush")
+	}
+	stored, ok := db.store["outage1"]
+	if !ok || stored.LongURL != "https://docs.example.org/outage" {
+		t.Fatalf("expected the link in Redis after recovery, got %+v", stored)
+	}
+	if ttl := db.ttls["outage1"]; ttl <= 23*time.Hour || ttl > 24*time.Hour {
+		t.Fatalf("expected the remaining TTL to be kept, got %s", ttl)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/outage1", nil))
+	if res.Code != http.StatusFound || db.store["outage1"].Visits != 1 {
+		t.Fatalf("expected redirects to be served and counted by Redis again, got %d", res.Code)
+	}
+
+	if err := app.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+}
+
+func TestCreateBufferLimit(t *testing.T) {
+	db := &outageDB{mockDB: newMockDB()}
+	db.down.Store(true)
+	app, err := NewServerWithService(db, Config{Port: 8080, CreateBufferSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := app.RegisterRoutes()
+
+	for i, want := range []int{http.StatusCreated, http.StatusInternalServerError} {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"https://docs.example.org"}`)))
+		if res.Code != want {
+			t.Fatalf("create %d: expected %d, got %d", i+1, want, res.Code)
+		}
+	}
+
+	if err := app.Shutdown(context.Background()); err == nil || !strings.Contains(err.Error(), "1 buffered links") {
+		t.Fatalf("expected Shutdown to report the unsaved link, got %v", err)
+	}
+}
+
+func TestCreateBufferDisabledByDefault(t *testing.T) {
+	db := &outageDB{mockDB: newMockDB()}
+	db.down.Store(true)
+	app, err := NewServerWithService(db, Config{Port: 8080})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	app.RegisterRoutes().ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"https://docs.example.org","custom_alias":"nobuf01"}`)))
+	if res.Code != http.StatusInternalServerError {
+		t.Fatalf("expected creates to fail without the buffer, got %d", res.Code)
+	}
+}
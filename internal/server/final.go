@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+const (
+	defaultFinalHops  = 10
+	maxFinalHops      = 20
+	finalResolveLimit = 15 * time.Second
+)
+
+var (
+	// ErrRedirectLoop is returned by ResolveFinal when a redirect chain
+	// revisits a URL it has already passed through.
+	ErrRedirectLoop = errors.New("redirect loop detected")
+	// ErrTooManyRedirects is returned by ResolveFinal when the destination is
+	// still redirecting after the allowed number of hops.
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// finalDestination is the outcome of following a link's redirect chain.
+type finalDestination struct {
+	URL    string   `json:"url"`
+	Final  string   `json:"final_url"`
+	Status int      `json:"status"`
+	Hops   []string `json:"hops"`
+}
+
+// ResolveFinal follows the redirect chain of code's destination for at most
+// maxHops redirects and returns the URL it lands on. Every hop goes through
+// the outbound client, so private and loopback addresses are refused.
+func (s *Server) ResolveFinal(ctx context.Context, code string, maxHops int) (string, error) {
+	final, err := s.followDestination(ctx, code, maxHops)
+	if err != nil {
+		return "", err
+	}
+	return final.Final, nil
+}
+
+func (s *Server) followDestination(ctx context.Context, code string, maxHops int) (finalDestination, error) {
+	if maxHops <= 0 {
+		maxHops = defaultFinalHops
+	}
+
+	stats, err := s.db.GetStats(ctx, code)
+	if err != nil {
+		return finalDestination{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, finalResolveLimit)
+	defer cancel()
+
+	// Redirects are followed here one at a time rather than by the client so
+	// that loops and the hop limit can be told apart.
+	client := *s.outboundClient()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	result := finalDestination{URL: stats.LongURL, Hops: []string{}}
+	seen := map[string]bool{}
+	current := stats.LongURL
+	for {
+		if seen[current] {
+			return finalDestination{}, fmt.Errorf("%w at %s", ErrRedirectLoop, current)
+		}
+		seen[current] = true
+
+		status, next, err := fetchHop(ctx, &client, current)
+		if err != nil {
+			return finalDestination{}, err
+		}
+		if next == nil {
+			result.Final = current
+			result.Status = status
+			return result, nil
+		}
+		if len(result.Hops) == maxHops {
+			return finalDestination{}, fmt.Errorf("%w: still redirecting after %d hops", ErrTooManyRedirects, maxHops)
+		}
+
+		current = next.String()
+		result.Hops = append(result.Hops, current)
+		if next.Scheme != "http" && next.Scheme != "https" {
+			// Nothing more to fetch; a redirect to mailto: or an app scheme
+			// is where a browser would end up.
+			result.Final = current
+			result.Status = status
+			return result, nil
+		}
+	}
+}
+
+// fetchHop requests target without following redirects and returns the
+// status plus the resolved Location when the response is a redirect.
+func fetchHop(ctx context.Context, client *http.Client, target string) (int, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("User-Agent", "url-shortner/"+version+" (redirect resolver)")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, maxMetadataBodyBytes))
+
+	location := res.Header.Get("Location")
+	if res.StatusCode < 300 || res.StatusCode >= 400 || location == "" {
+		return res.StatusCode, nil, nil
+	}
+
+	next, err := res.Request.URL.Parse(location)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid redirect location %q: %w", location, err)
+	}
+	return res.StatusCode, next, nil
+}
+
+func (s *Server) finalDestinationHandler(w http.ResponseWriter, r *http.Request) {
+	code := s.pathCode(r)
+	if code == "" {
+		s.writeError(w, http.StatusNotFound, "short code not found")
+		return
+	}
+
+	hops := defaultFinalHops
+	if raw := r.URL.Query().Get("max_hops"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxFinalHops {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("max_hops must be between 1 and %d", maxFinalHops))
+			return
+		}
+		hops = parsed
+	}
+
+	final, err := s.followDestination(r.Context(), code, hops)
+	switch {
+	case err == nil:
+		s.writeJSON(w, http.StatusOK, final)
+	case errors.Is(err, redisdb.ErrNotFound):
+		s.writeError(w, http.StatusNotFound, "short code not found")
+	case errors.Is(err, ErrRedirectLoop):
+		s.writeError(w, http.StatusLoopDetected, err.Error())
+	case errors.Is(err, ErrTooManyRedirects):
+		s.writeError(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		var fetchErr *url.Error
+		if errors.As(err, &fetchErr) {
+			s.writeError(w, http.StatusBadGateway, "failed to reach destination")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to resolve destination")
+	}
+}
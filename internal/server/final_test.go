@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func newRedirectChain(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/landing", http.StatusFound)
+	})
+	mux.HandleFunc("/landing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/loop1", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop2", http.StatusFound)
+	})
+	mux.HandleFunc("/loop2", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop1", http.StatusFound)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResolveFinal(t *testing.T) {
+	chain := newRedirectChain(t)
+
+	db := newMockDB()
+	ctx := context.Background()
+	for code, path := range map[string]string{"chain01": "/a", "loop001": "/loop1"} {
+		if err := db.CreateShortURL(ctx, code, chain.URL+path, redisdb.CreateOptions{}); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	s := &Server{db: db, outbound: chain.Client()}
+
+	final, err := s.ResolveFinal(ctx, "chain01", 5)
+	if err != nil {
+		t.Fatalf("ResolveFinal failed: %v", err)
+	}
+	if final != chain.URL+"/landing" {
+		t.Fatalf("expected final URL %q, got %q", chain.URL+"/landing", final)
+	}
+
+	if _, err := s.ResolveFinal(ctx, "chain01", 1); !errors.Is(err, ErrTooManyRedirects) {
+		t.Fatalf("expected ErrTooManyRedirects, got %v", err)
+	}
+	if _, err := s.ResolveFinal(ctx, "loop001", 10); !errors.Is(err, ErrRedirectLoop) {
+		t.Fatalf("expected ErrRedirectLoop, got %v", err)
+	}
+	if _, err := s.ResolveFinal(ctx, "missing", 10); !errors.Is(err, redisdb.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if stats, _ := db.GetStats(ctx, "chain01"); stats.Visits != 0 {
+		t.Fatalf("expected resolving not to count as a visit, got %d", stats.Visits)
+	}
+}
+
+func TestFinalDestinationHandler(t *testing.T) {
+	chain := newRedirectChain(t)
+
+	db := newMockDB()
+	for code, path := range map[string]string{"chain01": "/a", "loop001": "/loop1"} {
+		if err := db.CreateShortURL(context.Background(), code, chain.URL+path, redisdb.CreateOptions{}); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	if err := db.CreateShortURL(context.Background(), "priv001", "http://127.0.0.1:9/admin", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	h := (&Server{db: db, outbound: chain.Client()}).RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/chain01/final", nil))
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+	var body finalDestination
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if body.URL != chain.URL+"/a" || body.Final != chain.URL+"/landing" || body.Status != http.StatusOK || len(body.Hops) != 2 {
+		t.Fatalf("unexpected response: %+v", body)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{name: "too many hops", path: "/api/v1/urls/chain01/final?max_hops=1", status: http.StatusUnprocessableEntity},
+		{name: "loop", path: "/api/v1/urls/loop001/final", status: http.StatusLoopDetected},
+		{name: "invalid max_hops", path: "/api/v1/urls/chain01/final?max_hops=0", status: http.StatusBadRequest},
+		{name: "missing code", path: "/api/v1/urls/missing/final", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if res.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, res.Code, res.Body.String())
+			}
+		})
+	}
+
+	guarded := (&Server{db: db}).RegisterRoutes()
+	res = httptest.NewRecorder()
+	guarded.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/priv001/final", nil))
+	if res.Code != http.StatusBadGateway {
+		t.Fatalf("expected private destinations to be refused with %d, got %d", http.StatusBadGateway, res.Code)
+	}
+}
@@ -0,0 +1,34 @@
+package server
+
+import "net/url"
+
+const (
+	// queryPrecedenceLink keeps a destination's own value for a parameter
+	// the redirect request also sets.
+	queryPrecedenceLink = "link"
+	// queryPrecedenceRequest lets the redirect request's value replace it.
+	queryPrecedenceRequest = "request"
+)
+
+// forwardQuery merges the redirect request's query into target for links
+// created with forward_query, so /abc123?utm_source=x reaches the
+// destination with utm_source=x. A parameter set on both sides keeps the
+// destination's values unless QUERY_FORWARD_PRECEDENCE is "request".
+func (s *Server) forwardQuery(target string, incoming url.Values) string {
+	if len(incoming) == 0 {
+		return target
+	}
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	merged := parsed.Query()
+	for key, values := range incoming {
+		if _, ok := merged[key]; ok && s.queryPrecedence != queryPrecedenceRequest {
+			continue
+		}
+		merged[key] = values
+	}
+	parsed.RawQuery = merged.Encode()
+	return parsed.String()
+}
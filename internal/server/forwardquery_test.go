@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestRedirectForwardsQuery(t *testing.T) {
+	db := newMockDB()
+	ctx := context.Background()
+	if err := db.CreateShortURL(ctx, "fwd0001", "https://docs.example.org/landing?utm_source=newsletter&ref=home", redisdb.CreateOptions{ForwardQuery: true}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if err := db.CreateShortURL(ctx, "plain01", "https://docs.example.org/landing?ref=home", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		precedence string
+		path       string
+		location   string
+	}{
+		{"merges new params", "", "/fwd0001?utm_campaign=spring&aff=42", "https://docs.example.org/landing?aff=42&ref=home&utm_campaign=spring&utm_source=newsletter"},
+		{"link wins by default", "", "/fwd0001?utm_source=x", "https://docs.example.org/landing?ref=home&utm_source=newsletter"},
+		{"request wins when configured", queryPrecedenceRequest, "/fwd0001?utm_source=x", "https://docs.example.org/landing?ref=home&utm_source=x"},
+		{"no query leaves target alone", "", "/fwd0001", "https://docs.example.org/landing?utm_source=newsletter&ref=home"},
+		{"opt-in only", "", "/plain01?utm_source=x", "https://docs.example.org/landing?ref=home"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := (&Server{db: db, queryPrecedence: tt.precedence}).RegisterRoutes()
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if res.Code != http.StatusFound {
+				t.Fatalf("expected 302, got %d", res.Code)
+			}
+			if got := res.Header().Get("Location"); got != tt.location {
+				t.Fatalf("expected Location %q, got %q", tt.location, got)
+			}
+		})
+	}
+}
+
+func TestCreateForwardQueryLink(t *testing.T) {
+	db := newMockDB()
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"https://docs.example.org","custom_alias":"fwd0002","forward_query":true}`))
+	(&Server{db: db}).RegisterRoutes().ServeHTTP(res, req)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+	if !db.store["fwd0002"].ForwardQuery {
+		t.Fatal("expected forward_query to be stored on the link")
+	}
+}
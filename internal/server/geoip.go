@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// countryLookup maps a client IP to an ISO 3166-1 alpha-2 country code,
+// returning "" when the address is unknown.
+type countryLookup interface {
+	Country(ip netip.Addr) string
+}
+
+// mmdbCountryLookup reads country codes from a MaxMind GeoIP2/GeoLite2
+// database. The reader is memory-mapped, so lookups are cheap enough for the
+// redirect path.
+type mmdbCountryLookup struct {
+	reader *maxminddb.Reader
+}
+
+func openCountryLookup(path string) (*mmdbCountryLookup, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &mmdbCountryLookup{reader: reader}, nil
+}
+
+func (l *mmdbCountryLookup) Country(ip netip.Addr) string {
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	if err := l.reader.Lookup(ip).Decode(&record); err != nil {
+		return ""
+	}
+	return strings.ToUpper(record.Country.ISOCode)
+}
+
+// visitorCountry is the ISO country code of the client, as found by
+// clientIP, or "" when no GeoIP database is configured or the address is not
+// in it.
+func (s *Server) visitorCountry(r *http.Request) string {
+	if s.geo == nil {
+		return ""
+	}
+	ip, ok := s.clientIP(r)
+	if !ok {
+		return ""
+	}
+	return s.geo.Country(ip)
+}
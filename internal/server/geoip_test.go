@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+type staticCountryLookup map[netip.Addr]string
+
+func (l staticCountryLookup) Country(ip netip.Addr) string {
+	return l[ip]
+}
+
+func TestRedirectRecordsCountry(t *testing.T) {
+	db := newMockDB()
+	db.store["geo0001"] = redisdb.URLStats{Code: "geo0001", LongURL: "https://example.com", CreatedAt: time.Now().UTC()}
+	s := &Server{db: db, geo: staticCountryLookup{
+		netip.MustParseAddr("203.0.113.7"): "DE",
+		netip.MustParseAddr("2001:db8::1"): "JP",
+	}}
+	h := s.RegisterRoutes()
+
+	for _, remote := range []string{"203.0.113.7:4321", "203.0.113.7:4322", "[2001:db8::1]:80", "198.51.100.9:80"} {
+		req := httptest.NewRequest(http.MethodGet, "/geo0001", nil)
+		req.RemoteAddr = remote
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if res.Code != http.StatusFound {
+			t.Fatalf("expected status %d, got %d", http.StatusFound, res.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/urls/geo0001/analytics", nil)
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	var out analyticsResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+		t.Fatalf("failed to decode analytics: %v", err)
+	}
+	if len(out.Countries) != 2 || out.Countries["DE"] != 2 || out.Countries["JP"] != 1 {
+		t.Fatalf("unexpected countries: %v", out.Countries)
+	}
+}
+
+func TestRedirectRecordsForwardedClientCountry(t *testing.T) {
+	db := newMockDB()
+	db.store["geo0003"] = redisdb.URLStats{Code: "geo0003", LongURL: "https://example.com", CreatedAt: time.Now().UTC()}
+	s := &Server{
+		db:             db,
+		geo:            staticCountryLookup{netip.MustParseAddr("203.0.113.7"): "DE"},
+		trustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	}
+	h := s.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/geo0003", nil)
+	req.RemoteAddr = "10.0.0.1:5555"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusFound {
+		t.Fatalf("expected status %d, got %d", http.StatusFound, res.Code)
+	}
+	if got := db.countries["geo0003"]["DE"]; got != 1 {
+		t.Fatalf("expected the forwarded client to be geolocated, got %v", db.countries["geo0003"])
+	}
+}
+
+func TestRedirectWithoutGeoIPSkipsCountry(t *testing.T) {
+	db := newMockDB()
+	db.store["geo0002"] = redisdb.URLStats{Code: "geo0002", LongURL: "https://example.com", CreatedAt: time.Now().UTC()}
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/geo0002", nil)
+	req.RemoteAddr = "203.0.113.7:4321"
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusFound {
+		t.Fatalf("expected status %d, got %d", http.StatusFound, res.Code)
+	}
+	if len(db.countries["geo0002"]) != 0 {
+		t.Fatalf("expected no countries without a GeoIP database, got %v", db.countries["geo0002"])
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// normalizeGroup lowercases and validates a group name; groups follow the
+// same naming rules as tags. An empty name means no group.
+func normalizeGroup(raw string) (string, error) {
+	group := strings.ToLower(strings.TrimSpace(raw))
+	if group == "" {
+		return "", nil
+	}
+	if !tagPattern.MatchString(group) {
+		return "", fmt.Errorf("group must match %s", tagPattern.String())
+	}
+	return group, nil
+}
+
+func (s *Server) listGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePageRequest(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	groups, err := s.db.ListGroups(r.Context())
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to list groups")
+		return
+	}
+
+	groups, next := paginate(groups, page)
+	s.writeJSON(w, http.StatusOK, pagedResponse[string]{Items: groups, NextCursor: next, HasMore: next != ""})
+}
+
+func (s *Server) groupURLsHandler(w http.ResponseWriter, r *http.Request) {
+	group, err := normalizeGroup(r.PathValue("group"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if group == "" {
+		s.writeError(w, http.StatusNotFound, "group not found")
+		return
+	}
+
+	codes, err := s.db.CodesByGroup(r.Context(), group)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to list URLs")
+		return
+	}
+
+	s.writeURLList(w, r, codes)
+}
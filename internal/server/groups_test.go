@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestGroups(t *testing.T) {
+	s := &Server{db: newMockDB()}
+	h := s.RegisterRoutes()
+
+	create := func(body string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBufferString(body))
+		req.Host = "short.local"
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res.Code
+	}
+	get := func(path string, out any) int {
+		t.Helper()
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+		if res.Code == http.StatusOK {
+			if err := json.Unmarshal(res.Body.Bytes(), out); err != nil {
+				t.Fatalf("failed to decode %s: %v", path, err)
+			}
+		}
+		return res.Code
+	}
+
+	for _, body := range []string{
+		`{"url":"https://example.com/a","custom_alias":"spring-a","group":"Spring-Sale"}`,
+		`{"url":"https://example.com/b","custom_alias":"spring-b","group":"spring-sale"}`,
+		`{"url":"https://example.com/c","custom_alias":"winter-a","group":"winter"}`,
+		`{"url":"https://example.com/d","custom_alias":"loose-a"}`,
+	} {
+		if code := create(body); code != http.StatusCreated {
+			t.Fatalf("create %s: expected status %d, got %d", body, http.StatusCreated, code)
+		}
+	}
+	if code := create(`{"url":"https://example.com","group":"no spaces"}`); code != http.StatusBadRequest {
+		t.Fatalf("expected invalid group to be rejected, got %d", code)
+	}
+
+	var groups pagedResponse[string]
+	if code := get("/api/v1/groups", &groups); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if !slices.Equal(groups.Items, []string{"spring-sale", "winter"}) {
+		t.Fatalf("unexpected groups: %v", groups.Items)
+	}
+
+	var list struct {
+		Items []struct {
+			Code  string `json:"code"`
+			Group string `json:"group"`
+		} `json:"items"`
+	}
+	if code := get("/api/v1/groups/spring-sale/urls", &list); code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	if len(list.Items) != 2 || list.Items[0].Code != "spring-a" || list.Items[1].Code != "spring-b" || list.Items[0].Group != "spring-sale" {
+		t.Fatalf("unexpected group members: %+v", list.Items)
+	}
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodDelete, "/api/v1/urls/winter-a", nil))
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("expected delete to succeed, got %d", res.Code)
+	}
+	if code := get("/api/v1/groups/winter/urls", &list); code != http.StatusOK || len(list.Items) != 0 {
+		t.Fatalf("expected deleted link to leave its group, got %d %+v", code, list.Items)
+	}
+	if get("/api/v1/groups", &groups); !slices.Equal(groups.Items, []string{"spring-sale"}) {
+		t.Fatalf("expected empty group to disappear, got %v", groups.Items)
+	}
+}
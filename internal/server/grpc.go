@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	redisdb "url-shortner/internal/redis"
+	"url-shortner/internal/shortenerpb"
+)
+
+// grpcAPIKeyMetadata carries the caller's API key, like X-API-Key over REST.
+const grpcAPIKeyMetadata = "x-api-key"
+
+// grpcManagementTokenMetadata carries a link's management token, like
+// X-Management-Token over REST. CreateShortURL returns it in a response
+// header, as CreateShortURLResponse has no field for it.
+const grpcManagementTokenMetadata = "x-management-token"
+
+// grpcService serves the Shortener gRPC service from the same Server, and so
+// the same storage, validation and code rules, as the REST API.
+type grpcService struct {
+	shortenerpb.UnimplementedShortenerServer
+	s *Server
+}
+
+// GRPCServer returns a gRPC server with the Shortener service registered. The
+// caller serves it on its own listener, next to HTTPServer.
+func (s *Server) GRPCServer() *grpc.Server {
+	srv := grpc.NewServer(grpc.UnaryInterceptor(s.globalRateLimitInterceptor))
+	shortenerpb.RegisterShortenerServer(srv, &grpcService{s: s})
+	return srv
+}
+
+func (g *grpcService) CreateShortURL(ctx context.Context, in *shortenerpb.CreateShortURLRequest) (*shortenerpb.CreateShortURLResponse, error) {
+	if g.s.maintenance.Load() {
+		return nil, status.Error(codes.Unavailable, maintenanceMessage)
+	}
+	req := createShortURLRequest{
+		URL:            in.GetUrl(),
+		CustomAlias:    in.GetCustomAlias(),
+		ExpirationDays: int(in.GetExpirationDays()),
+		PreferAlias:    in.GetPreferAlias(),
+		Tags:           in.GetTags(),
+		Sliding:        in.GetSlidingExpiration(),
+		Title:          in.GetTitle(),
+		Description:    in.GetDescription(),
+		OneTime:        in.GetOneTime(),
+		Group:          in.GetGroup(),
+		CodeLength:     int(in.GetCodeLength()),
+	}
+	// There is no request host to compare the target against, so only
+	// SHORT_BASE_URL guards against self-referential links here.
+	created, err := g.s.createLink(ctx, req, ownerFromKey(metadataValue(ctx, grpcAPIKeyMetadata)), "")
+	if err != nil {
+		var createErr *createError
+		switch {
+		case errors.Is(err, redisdb.ErrReadOnly):
+			return nil, status.Error(codes.Unavailable, "service is temporarily read-only: new links cannot be saved")
+		case errors.As(err, &createErr):
+			return nil, status.Error(grpcCode(createErr.status), createErr.message)
+		default:
+			return nil, status.Error(codes.Internal, "failed to store short URL")
+		}
+	}
+
+	out := &shortenerpb.CreateShortURLResponse{
+		ShortCode: created.ShortCode,
+		LongUrl:   created.LongURL,
+		Strategy:  created.Strategy,
+	}
+	if g.s.baseURL != nil {
+		out.ShortUrl = strings.TrimSuffix(g.s.baseURL.String(), "/") + "/" + created.ShortCode
+	}
+	if created.ExpiresAt != nil {
+		out.ExpiresAt = timestamppb.New(*created.ExpiresAt)
+	}
+	if created.ManagementToken != "" {
+		if err := grpc.SetHeader(ctx, metadata.Pairs(grpcManagementTokenMetadata, created.ManagementToken)); err != nil {
+			return nil, status.Error(codes.Internal, "failed to return management token")
+		}
+	}
+	return out, nil
+}
+
+func (g *grpcService) Resolve(ctx context.Context, in *shortenerpb.ResolveRequest) (*shortenerpb.ResolveResponse, error) {
+	code := g.s.lookupCode(in.GetCode())
+	if code == "" {
+		return nil, status.Error(codes.NotFound, "short code not found")
+	}
+
+	visit := redisdb.Visit{Referrer: referrerHost(in.GetReferrer()), SampleRate: g.s.visitSampleRate}
+	rollVariant(&visit, code)
+	resolved, err := g.s.db.VisitURL(ctx, code, visit)
+	g.s.noteWrite(err)
+	if errors.Is(err, redisdb.ErrReadOnly) {
+		resolved, err = g.s.resolveWithoutVisit(ctx, code, visit)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, redisdb.ErrNotFound), errors.Is(err, redisdb.ErrNotActive):
+			return nil, status.Error(codes.NotFound, "short code not found")
+		case errors.Is(err, redisdb.ErrGone):
+			return nil, status.Error(codes.NotFound, "short URL has already been used")
+		case errors.Is(err, redisdb.ErrReadOnly):
+			return nil, status.Error(codes.Unavailable, "one-time links are unavailable while the service is read-only")
+		default:
+			return nil, status.Error(codes.Internal, "failed to resolve short URL")
+		}
+	}
+
+	if resolved.Counted {
+		g.s.publishClick(ctx, redisdb.ClickEvent{Code: code, Visits: resolved.Visits, Referrer: visit.Referrer, At: time.Now().UTC()})
+	}
+	return &shortenerpb.ResolveResponse{LongUrl: resolved.URL}, nil
+}
+
+func (g *grpcService) GetStats(ctx context.Context, in *shortenerpb.GetStatsRequest) (*shortenerpb.URLStats, error) {
+	code := g.s.lookupCode(in.GetCode())
+	if code == "" {
+		return nil, status.Error(codes.NotFound, "short code not found")
+	}
+
+	stats, err := g.s.sharedStats(ctx, code)
+	if err != nil {
+		if errors.Is(err, redisdb.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "short code not found")
+		}
+		return nil, status.Error(codes.Internal, "failed to fetch URL stats")
+	}
+
+	out := &shortenerpb.URLStats{
+		Code:        stats.Code,
+		LongUrl:     stats.LongURL,
+		CreatedAt:   timestamppb.New(stats.CreatedAt),
+		Visits:      stats.Visits,
+		Tags:        stats.Tags,
+		Group:       stats.Group,
+		Title:       stats.Title,
+		Description: stats.Description,
+	}
+	// As over HTTP, only the owner sees a one-time link's destination. The
+	// bucket label has no field here, so other callers only get the rounded
+	// count.
+	if owner := ownerFromKey(metadataValue(ctx, grpcAPIKeyMetadata)); owner == "" || owner != stats.Owner {
+		if stats.OneTime {
+			out.LongUrl = ""
+		}
+		if g.s.bucketPublicVisits {
+			out.Visits, _ = visitBucket(stats.Visits)
+		}
+	}
+	if stats.ExpiresAt != nil {
+		out.ExpiresAt = timestamppb.New(*stats.ExpiresAt)
+	}
+	return out, nil
+}
+
+func (g *grpcService) Delete(ctx context.Context, in *shortenerpb.DeleteRequest) (*shortenerpb.DeleteResponse, error) {
+	if g.s.maintenance.Load() {
+		return nil, status.Error(codes.Unavailable, maintenanceMessage)
+	}
+	code := g.s.lookupCode(in.GetCode())
+	if code == "" {
+		return nil, status.Error(codes.NotFound, "short code not found")
+	}
+	if err := g.s.checkManagementToken(ctx, code, metadataValue(ctx, grpcManagementTokenMetadata)); err != nil {
+		if errors.Is(err, errManagementToken) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to check management token")
+	}
+
+	err := g.s.db.DeleteShortURL(ctx, code)
+	g.s.noteWrite(err)
+	if err != nil {
+		switch {
+		case errors.Is(err, redisdb.ErrNotFound):
+			return nil, status.Error(codes.NotFound, "short code not found")
+		case errors.Is(err, redisdb.ErrReadOnly):
+			return nil, status.Error(codes.Unavailable, "service is temporarily read-only: links cannot be deleted")
+		default:
+			return nil, status.Error(codes.Internal, "failed to delete short URL")
+		}
+	}
+	return &shortenerpb.DeleteResponse{}, nil
+}
+
+// metadataValue returns the first value of key in the incoming metadata.
+func metadataValue(ctx context.Context, key string) string {
+	if values := metadata.ValueFromIncomingContext(ctx, key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// grpcCode maps the HTTP status a shared validation step answers with to the
+// matching gRPC code.
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound, http.StatusGone:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"url-shortner/internal/shortenerpb"
+)
+
+func newGRPCClient(t *testing.T, s *Server) shortenerpb.ShortenerClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := s.GRPCServer()
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return shortenerpb.NewShortenerClient(conn)
+}
+
+func TestGRPCShortener(t *testing.T) {
+	db := newMockDB()
+	client := newGRPCClient(t, &Server{db: db})
+	ctx := metadata.AppendToOutgoingContext(context.Background(), grpcAPIKeyMetadata, "team-key")
+
+	created, err := client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{
+		Url:            "https://docs.example.org/grpc",
+		CustomAlias:    "grpc01",
+		ExpirationDays: 7,
+		Tags:           []string{"Docs"},
+	})
+	if err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if created.GetShortCode() != "grpc01" || created.GetStrategy() != strategyAlias || created.GetExpiresAt() == nil {
+		t.Fatalf("unexpected create response: %v", created)
+	}
+	if db.owners["grpc01"] != ownerFromKey("team-key") {
+		t.Fatalf("expected the x-api-key metadata to set the owner, got %q", db.owners["grpc01"])
+	}
+
+	resolved, err := client.Resolve(ctx, &shortenerpb.ResolveRequest{Code: "grpc01", Referrer: "https://News.example.net/post"})
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if resolved.GetLongUrl() != "https://docs.example.org/grpc" {
+		t.Fatalf("unexpected destination %q", resolved.GetLongUrl())
+	}
+
+	stats, err := client.GetStats(ctx, &shortenerpb.GetStatsRequest{Code: "grpc01"})
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if stats.GetVisits() != 1 || len(stats.GetTags()) != 1 || stats.GetTags()[0] != "docs" || stats.GetExpiresAt() == nil {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+	if db.referrers["grpc01"]["news.example.net"] != 1 {
+		t.Fatalf("expected the referrer to be recorded, got %v", db.referrers["grpc01"])
+	}
+
+	if _, err := client.Delete(ctx, &shortenerpb.DeleteRequest{Code: "grpc01"}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := client.GetStats(ctx, &shortenerpb.GetStatsRequest{Code: "grpc01"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound after delete, got %v", err)
+	}
+}
+
+func TestGRPCSharesRESTValidation(t *testing.T) {
+	db := newMockDB()
+	client := newGRPCClient(t, &Server{db: db, blockedDomains: []string{"blocked.example"}})
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		req  *shortenerpb.CreateShortURLRequest
+		want codes.Code
+	}{
+		{"bad scheme", &shortenerpb.CreateShortURLRequest{Url: "ftp://docs.example.org"}, codes.InvalidArgument},
+		{"bad alias", &shortenerpb.CreateShortURLRequest{Url: "https://docs.example.org", CustomAlias: "a b"}, codes.InvalidArgument},
+		{"reserved alias", &shortenerpb.CreateShortURLRequest{Url: "https://docs.example.org", CustomAlias: "health"}, codes.InvalidArgument},
+		{"sliding without expiry", &shortenerpb.CreateShortURLRequest{Url: "https://docs.example.org", SlidingExpiration: true}, codes.InvalidArgument},
+		{"blocked domain", &shortenerpb.CreateShortURLRequest{Url: "https://blocked.example/x"}, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		if _, err := client.CreateShortURL(ctx, tt.req); status.Code(err) != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	if _, err := client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: "https://docs.example.org", CustomAlias: "taken1"}); err != nil {
+		t.Fatalf("CreateShortURL failed: %v", err)
+	}
+	if _, err := client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: "https://docs.example.org", CustomAlias: "taken1"}); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("expected AlreadyExists for a taken alias, got %v", err)
+	}
+
+	if _, err := client.Resolve(ctx, &shortenerpb.ResolveRequest{Code: "missing"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for a missing code, got %v", err)
+	}
+}
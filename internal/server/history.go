@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+type historyResponse struct {
+	Code   string             `json:"code"`
+	Events []historyEventView `json:"events"`
+}
+
+// historyEventView renders a HistoryEvent with at in the configured time
+// format.
+type historyEventView struct {
+	redisdb.HistoryEvent
+	epochMillis bool
+}
+
+func (v historyEventView) MarshalJSON() ([]byte, error) {
+	if !v.epochMillis {
+		return json.Marshal(v.HistoryEvent)
+	}
+	return json.Marshal(struct {
+		redisdb.HistoryEvent
+		At int64 `json:"at"`
+	}{HistoryEvent: v.HistoryEvent, At: v.At.UnixMilli()})
+}
+
+// historyHandler returns a link's lifecycle timeline, oldest event first:
+// when it was created, updated, disabled, enabled and rotated. Only the most
+// recent events are kept.
+func (s *Server) historyHandler(w http.ResponseWriter, r *http.Request) {
+	code := s.pathCode(r)
+	if code == "" {
+		s.writeError(w, http.StatusNotFound, "short code not found")
+		return
+	}
+
+	if _, err := s.sharedStats(r.Context(), code); err != nil {
+		if errors.Is(err, redisdb.ErrNotFound) {
+			s.writeError(w, http.StatusNotFound, "short code not found")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch URL history")
+		return
+	}
+
+	events, err := s.db.GetHistory(r.Context(), code)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch URL history")
+		return
+	}
+	views := make([]historyEventView, 0, len(events))
+	for _, event := range events {
+		views = append(views, historyEventView{HistoryEvent: event, epochMillis: s.epochMillis})
+	}
+	s.writeJSON(w, http.StatusOK, historyResponse{Code: code, Events: views})
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestHistoryCreateThenDisable(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db}).RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"https://docs.example.org/guide","custom_alias":"guide01"}`)))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPatch, "/api/v1/urls/guide01", strings.NewReader(`{"disabled":true}`)))
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"disabled":true`) {
+		t.Fatalf("expected the link to be disabled, got %d: %s", res.Code, res.Body.String())
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/guide01", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected a disabled link not to redirect, got %d", res.Code)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/guide01/history", nil))
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body.String())
+	}
+	var history struct {
+		Code   string                 `json:"code"`
+		Events []redisdb.HistoryEvent `json:"events"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &history); err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	if history.Code != "guide01" || len(history.Events) != 2 {
+		t.Fatalf("expected two history entries, got %+v", history)
+	}
+	if history.Events[0].Type != redisdb.EventCreate || history.Events[1].Type != redisdb.EventDisable {
+		t.Fatalf("expected create then disable, got %+v", history.Events)
+	}
+	if history.Events[1].At.Before(history.Events[0].At) {
+		t.Fatalf("expected events in order, got %+v", history.Events)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPatch, "/api/v1/urls/guide01", strings.NewReader(`{"disabled":false}`)))
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected the link to be enabled, got %d", res.Code)
+	}
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/guide01", nil))
+	if res.Code != http.StatusFound {
+		t.Fatalf("expected an enabled link to redirect, got %d", res.Code)
+	}
+	if events := db.history["guide01"]; len(events) != 3 || events[2].Type != redisdb.EventEnable {
+		t.Fatalf("expected an enable event last, got %+v", events)
+	}
+}
+
+func TestHistoryNotFound(t *testing.T) {
+	h := (&Server{db: newMockDB()}).RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/missing1/history", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", res.Code)
+	}
+}
+
+func TestHistoryEpochMillis(t *testing.T) {
+	db := newMockDB()
+	db.CreateShortURL(t.Context(), "guide02", "https://docs.example.org", redisdb.CreateOptions{})
+	h := (&Server{db: db, epochMillis: true}).RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/guide02/history", nil))
+	var history struct {
+		Events []map[string]any `json:"events"`
+	}
+	json.Unmarshal(res.Body.Bytes(), &history)
+	if len(history.Events) != 1 {
+		t.Fatalf("expected one event, got %s", res.Body.String())
+	}
+	if _, ok := history.Events[0]["at"].(float64); !ok {
+		t.Fatalf("expected at in epoch milliseconds, got %v", history.Events[0]["at"])
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+)
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Service}}</title>
+</head>
+<body>
+<main>
+<h1>{{.Service}}</h1>
+<p>Short links are served from this host. See <a href="/version">/version</a> for build details.</p>
+</main>
+</body>
+</html>
+`))
+
+var errorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Status}} {{.StatusText}}</title>
+</head>
+<body>
+<main>
+<h1>{{.StatusText}}</h1>
+<p>{{.Detail}}</p>
+{{with .Message}}<p>{{.}}</p>
+{{end}}</main>
+</body>
+</html>
+`))
+
+// errorPageDetails are the explanations shown to browsers for each redirect
+// failure; other statuses fall back to the status text.
+var errorPageDetails = map[int]string{
+	http.StatusNotFound:            "This short link doesn't exist or has expired.",
+	http.StatusGone:                "This short link was single-use and has already been opened.",
+	http.StatusInternalServerError: "Something went wrong on our side. Please try again in a moment.",
+}
+
+// errorPage is the data passed to the error page template.
+type errorPage struct {
+	Status     int
+	StatusText string
+	Detail     string
+	Message    string
+}
+
+// wantsJSON reports whether the client explicitly asked for JSON.
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// wantsHTML reports whether the client is a browser asking for a page rather
+// than an API client.
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html") && !wantsJSON(r)
+}
+
+// writePageError answers browsers with the HTML error page and everyone else
+// with the usual JSON error.
+func (s *Server) writePageError(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	if !wantsHTML(r) {
+		s.writeError(w, statusCode, message)
+		return
+	}
+
+	tmpl := s.errorTemplate
+	if tmpl == nil {
+		tmpl = errorTemplate
+	}
+	detail, ok := errorPageDetails[statusCode]
+	if !ok {
+		detail = http.StatusText(statusCode)
+	}
+	writeHTML(w, statusCode, tmpl, errorPage{
+		Status:     statusCode,
+		StatusText: http.StatusText(statusCode),
+		Detail:     detail,
+		Message:    s.errorPageMessage,
+	})
+}
+
+// loadErrorTemplate parses a custom error page from path.
+func loadErrorTemplate(path string) (*template.Template, error) {
+	return template.ParseFiles(path)
+}
+
+func writeHTML(w http.ResponseWriter, statusCode int, tmpl *template.Template, data any) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		log.Printf("failed to render %s page: %v", tmpl.Name(), err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statusCode)
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Printf("failed to write %s page: %v", tmpl.Name(), err)
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestRootHandlerModes(t *testing.T) {
+	landing, err := url.Parse("https://www.example.com/welcome")
+	if err != nil {
+		t.Fatalf("failed to parse landing url: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		server      *Server
+		accept      string
+		status      int
+		contentType string
+		location    string
+	}{
+		{name: "default json", server: &Server{}, accept: "text/html", status: http.StatusOK, contentType: "application/json"},
+		{name: "html page", server: &Server{rootHTML: true}, accept: "text/html,application/xhtml+xml", status: http.StatusOK, contentType: "text/html"},
+		{name: "redirect", server: &Server{rootRedirectURL: landing, rootHTML: true}, accept: "text/html", status: http.StatusFound, location: landing.String()},
+		{name: "json client with redirect configured", server: &Server{rootRedirectURL: landing}, accept: "application/json", status: http.StatusOK, contentType: "application/json"},
+		{name: "json client with html configured", server: &Server{rootHTML: true}, accept: "application/json", status: http.StatusOK, contentType: "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.server.db = newMockDB()
+			h := tt.server.RegisterRoutes()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", tt.accept)
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+
+			if res.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, res.Code)
+			}
+			if tt.location != "" && res.Header().Get("Location") != tt.location {
+				t.Fatalf("expected location %s, got %s", tt.location, res.Header().Get("Location"))
+			}
+			if tt.contentType != "" && !strings.HasPrefix(res.Header().Get("Content-Type"), tt.contentType) {
+				t.Fatalf("expected content type %s, got %s", tt.contentType, res.Header().Get("Content-Type"))
+			}
+			if tt.contentType == "application/json" {
+				var out map[string]any
+				if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+					t.Fatalf("expected json body: %v", err)
+				}
+				if _, ok := out["routes"]; !ok {
+					t.Fatal("expected routes in json body")
+				}
+			}
+			if tt.contentType == "text/html" && !strings.Contains(res.Body.String(), "<h1>url-shortner</h1>") {
+				t.Fatalf("expected landing page, got %s", res.Body.String())
+			}
+		})
+	}
+}
+
+// brokenDB fails every VisitURL call to simulate a Redis outage.
+type brokenDB struct {
+	*mockDB
+}
+
+func (brokenDB) VisitURL(context.Context, string, redisdb.Visit) (redisdb.ResolvedURL, error) {
+	return redisdb.ResolvedURL{}, errors.New("connection refused")
+}
+
+func TestRedirectErrorPages(t *testing.T) {
+	db := newMockDB()
+	db.store["used001"] = redisdb.URLStats{Code: "used001", LongURL: "https://example.com", CreatedAt: time.Now().UTC(), OneTime: true, Consumed: true}
+
+	tests := []struct {
+		name   string
+		db     redisdb.Service
+		path   string
+		status int
+		detail string
+	}{
+		{name: "missing", db: db, path: "/nope001", status: http.StatusNotFound, detail: "exist or has expired"},
+		{name: "consumed", db: db, path: "/used001", status: http.StatusGone, detail: "already been opened"},
+		{name: "backend failure", db: brokenDB{newMockDB()}, path: "/any0001", status: http.StatusInternalServerError, detail: "went wrong"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := (&Server{db: tt.db, errorPageMessage: "Need help? Mail <links@example.com>"}).RegisterRoutes()
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+
+			if res.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, res.Code)
+			}
+			if !strings.HasPrefix(res.Header().Get("Content-Type"), "text/html") {
+				t.Fatalf("expected html error page, got %s", res.Header().Get("Content-Type"))
+			}
+			body := res.Body.String()
+			if !strings.Contains(body, tt.detail) {
+				t.Fatalf("expected %q in page, got %s", tt.detail, body)
+			}
+			if !strings.Contains(body, "Mail &lt;links@example.com&gt;") {
+				t.Fatalf("expected escaped configured message in page, got %s", body)
+			}
+
+			for _, accept := range []string{"", "application/json", "*/*"} {
+				req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+				if accept != "" {
+					req.Header.Set("Accept", accept)
+				}
+				res := httptest.NewRecorder()
+				h.ServeHTTP(res, req)
+
+				if res.Code != tt.status {
+					t.Fatalf("Accept %q: expected status %d, got %d", accept, tt.status, res.Code)
+				}
+				var out map[string]any
+				if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+					t.Fatalf("Accept %q: expected json body: %v", accept, err)
+				}
+				if _, ok := out["error"]; !ok {
+					t.Fatalf("Accept %q: expected error field, got %v", accept, out)
+				}
+			}
+		})
+	}
+}
+
+func TestCustomErrorTemplate(t *testing.T) {
+	tmpl := template.Must(template.New("custom").Parse(`<p class="oops">{{.Status}}: {{.Detail}}</p>`))
+	h := (&Server{db: newMockDB(), errorTemplate: tmpl}).RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/nope001", nil)
+	req.Header.Set("Accept", "text/html")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, res.Code)
+	}
+	if want := `<p class="oops">404: This short link doesn&#39;t exist or has expired.</p>`; res.Body.String() != want {
+		t.Fatalf("expected custom page %q, got %q", want, res.Body.String())
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import "net/http"
+
+// httpsExemptPaths are probe endpoints that load balancers and scrapers hit
+// over plain HTTP and that must keep answering there.
+var httpsExemptPaths = map[string]bool{
+	"/health":     true,
+	"/debug/vars": true,
+	"/metrics":    true,
+}
+
+// forceHTTPSMiddleware redirects requests that arrived over plain HTTP to the
+// same host and path over HTTPS when FORCE_HTTPS is set. GET and HEAD get a
+// 301; other methods get a 308 so clients resend the body to the new URL.
+func (s *Server) forceHTTPSMiddleware(next http.Handler) http.Handler {
+	if !s.forceHTTPS {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.requestScheme(r) == "https" || httpsExemptPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+s.requestHost(r)+r.URL.RequestURI(), status)
+	})
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestForceHTTPS(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "tls0001", "https://example.com", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	s := &Server{db: db, forceHTTPS: true, trustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	h := s.RegisterRoutes()
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		remote   string
+		proto    string
+		tls      bool
+		status   int
+		location string
+	}{
+		{name: "plain http", method: http.MethodGet, target: "/tls0001?utm=x", remote: "203.0.113.9:5555", status: http.StatusMovedPermanently, location: "https://short.local/tls0001?utm=x"},
+		{name: "plain http post", method: http.MethodPost, target: "/api/v1/shorten", remote: "203.0.113.9:5555", status: http.StatusPermanentRedirect, location: "https://short.local/api/v1/shorten"},
+		{name: "spoofed proto from client", method: http.MethodGet, target: "/tls0001", remote: "203.0.113.9:5555", proto: "https", status: http.StatusMovedPermanently, location: "https://short.local/tls0001"},
+		{name: "trusted proxy terminated tls", method: http.MethodGet, target: "/tls0001", remote: "10.1.2.3:5555", proto: "https", status: http.StatusFound, location: "https://example.com"},
+		{name: "trusted proxy over http", method: http.MethodGet, target: "/tls0001", remote: "10.1.2.3:5555", proto: "http", status: http.StatusMovedPermanently, location: "https://short.local/tls0001"},
+		{name: "direct tls", method: http.MethodGet, target: "/tls0001", remote: "203.0.113.9:5555", tls: true, status: http.StatusFound, location: "https://example.com"},
+		{name: "health probe", method: http.MethodGet, target: "/health", remote: "203.0.113.9:5555", status: http.StatusOK},
+		{name: "metrics probe", method: http.MethodGet, target: "/debug/vars", remote: "203.0.113.9:5555", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Host = "short.local"
+			req.RemoteAddr = tt.remote
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+
+			if res.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, res.Code)
+			}
+			if got := res.Header().Get("Location"); got != tt.location {
+				t.Fatalf("expected location %q, got %q", tt.location, got)
+			}
+		})
+	}
+}
+
+func TestForceHTTPSDisabledByDefault(t *testing.T) {
+	h := (&Server{db: newMockDB()}).RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected plain HTTP to be served, got %d", res.Code)
+	}
+}
+
+func TestRequireHTTPSLink(t *testing.T) {
+	db := newMockDB()
+	s := &Server{db: db, trustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	h := s.RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"https://bank.example.com","custom_alias":"secure1","require_https":true}`)))
+	if res.Code != http.StatusCreated || !db.store["secure1"].RequireHTTPS {
+		t.Fatalf("expected require_https to be stored, got %d: %s", res.Code, res.Body.String())
+	}
+
+	tests := []struct {
+		name   string
+		remote string
+		proto  string
+		status int
+	}{
+		{name: "plain http", remote: "203.0.113.9:5555", status: http.StatusBadRequest},
+		{name: "spoofed proto from client", remote: "203.0.113.9:5555", proto: "https", status: http.StatusBadRequest},
+		{name: "trusted proxy over http", remote: "10.1.2.3:5555", proto: "http", status: http.StatusBadRequest},
+		{name: "trusted proxy terminated tls", remote: "10.1.2.3:5555", proto: "https", status: http.StatusFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/secure1", nil)
+			req.RemoteAddr = tt.remote
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+			if res.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, res.Code)
+			}
+		})
+	}
+
+	if visits := db.store["secure1"].Visits; visits != 1 {
+		t.Fatalf("expected only the HTTPS visit to count, got %d", visits)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/secure1", nil))
+	if !strings.Contains(res.Body.String(), `"require_https":true`) {
+		t.Fatalf("expected require_https in stats, got %s", res.Body.String())
+	}
+}
@@ -0,0 +1,270 @@
+package server
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxImportRows bounds one import request; larger files are split by the
+// caller.
+const maxImportRows = 1000
+
+// importFormat maps the CSV columns of one export format onto a create
+// request. Each field lists the header names accepted for it, lowercased;
+// only url is required.
+type importFormat struct {
+	code      []string
+	url       []string
+	visits    []string
+	title     []string
+	tags      []string
+	group     []string
+	expiresAt []string
+}
+
+// importFormats are the CSV layouts POST /api/v1/admin/import understands:
+// this service's own CSV export and the link exports of Bitly and TinyURL.
+var importFormats = map[string]importFormat{
+	"export": {
+		code:      []string{"code"},
+		url:       []string{"long_url"},
+		visits:    []string{"visits"},
+		title:     []string{"title"},
+		tags:      []string{"tags"},
+		group:     []string{"group"},
+		expiresAt: []string{"expires_at"},
+	},
+	"bitly": {
+		code:   []string{"bitlink", "link"},
+		url:    []string{"long url", "long_url"},
+		visits: []string{"clicks", "total clicks"},
+		title:  []string{"title"},
+		tags:   []string{"tags"},
+	},
+	"tinyurl": {
+		code:   []string{"alias", "tinyurl", "tiny url"},
+		url:    []string{"long url", "long_url", "url"},
+		visits: []string{"clicks", "hits", "total clicks"},
+		tags:   []string{"tags"},
+	},
+}
+
+type importedLink struct {
+	Row       int    `json:"row"`
+	ShortCode string `json:"short_code"`
+	ShortURL  string `json:"short_url"`
+	LongURL   string `json:"long_url"`
+	Strategy  string `json:"strategy"`
+	Visits    int64  `json:"visits,omitempty"`
+	// ManagementToken unlocks changes to the link with MANAGEMENT_TOKENS.
+	// It is only ever returned here.
+	ManagementToken string `json:"management_token,omitempty"`
+}
+
+type importFailure struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type importResponse struct {
+	Format   string          `json:"format"`
+	Imported []importedLink  `json:"imported"`
+	Failed   []importFailure `json:"failed,omitempty"`
+	// IgnoredColumns are header names the format does not map.
+	IgnoredColumns []string `json:"ignored_columns,omitempty"`
+}
+
+// importColumns is the index of each mapped column in one file, -1 when
+// the file does not have it.
+type importColumns struct {
+	code, url, visits, title, tags, group, expiresAt int
+}
+
+// importHandler creates a link for every row of a CSV export from this
+// service or another shortener, picked by ?format=. The original code is kept
+// as a custom alias, falling back to a generated one when it is taken, and
+// the click count is restored onto the new link. Rows that cannot be imported
+// are reported by line number without failing the rest; when none succeed
+// the response is a 400 listing them.
+func (s *Server) importHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		name = "export"
+	}
+	format, ok := importFormats[name]
+	if !ok {
+		s.writeError(w, http.StatusBadRequest, "format must be export, bitly or tinyurl")
+		return
+	}
+
+	reader := csv.NewReader(r.Body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "body must be a csv file with a header row")
+		return
+	}
+	cols, ignored := format.columns(header)
+	if cols.url < 0 {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("csv has no %s column", strings.Join(format.url, " or ")))
+		return
+	}
+
+	// The whole file is read before anything is created, so a file that is
+	// too large or malformed is refused without importing part of it.
+	var records [][]string
+	var lines []int
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid csv: "+err.Error())
+			return
+		}
+		if len(records) == maxImportRows {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d rows per import", maxImportRows))
+			return
+		}
+		line, _ := reader.FieldPos(0)
+		records, lines = append(records, record), append(lines, line)
+	}
+
+	response := importResponse{Format: name, Imported: []importedLink{}, IgnoredColumns: ignored}
+	owner, host := ownerFromRequest(r), s.requestHost(r)
+	for i, record := range records {
+		line := lines[i]
+		req, visits, err := cols.request(record)
+		if err != nil {
+			response.Failed = append(response.Failed, importFailure{Row: line, Error: err.Error()})
+			continue
+		}
+		link, err := s.createLink(r.Context(), req, owner, host)
+		if err != nil {
+			response.Failed = append(response.Failed, importFailure{Row: line, Error: campaignFailureMessage(err)})
+			continue
+		}
+
+		imported := importedLink{
+			Row:             line,
+			ShortCode:       link.ShortCode,
+			ShortURL:        fmt.Sprintf("%s/%s", s.shortBaseURL(r), link.ShortCode),
+			LongURL:         link.LongURL,
+			Strategy:        link.Strategy,
+			ManagementToken: link.ManagementToken,
+		}
+		if visits > 0 {
+			if imported.Visits, err = s.db.IncrementVisitsBy(r.Context(), link.ShortCode, visits); err != nil {
+				response.Failed = append(response.Failed, importFailure{Row: line, Error: "link imported without its click count"})
+			}
+		}
+		response.Imported = append(response.Imported, imported)
+	}
+
+	status := http.StatusCreated
+	if len(response.Imported) == 0 {
+		status = http.StatusBadRequest
+	}
+	s.writeJSON(w, status, response)
+}
+
+// columns finds the format's columns in header, matching names without
+// regard to case or surrounding space, and returns the header names it does
+// not map.
+func (f importFormat) columns(header []string) (importColumns, []string) {
+	if len(header) > 0 {
+		// Spreadsheet exports often start with a byte order mark.
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	find := func(names []string) int {
+		for i, column := range header {
+			if slices.Contains(names, strings.ToLower(strings.TrimSpace(column))) {
+				return i
+			}
+		}
+		return -1
+	}
+	cols := importColumns{
+		code:      find(f.code),
+		url:       find(f.url),
+		visits:    find(f.visits),
+		title:     find(f.title),
+		tags:      find(f.tags),
+		group:     find(f.group),
+		expiresAt: find(f.expiresAt),
+	}
+	var ignored []string
+	mapped := []int{cols.code, cols.url, cols.visits, cols.title, cols.tags, cols.group, cols.expiresAt}
+	for i, column := range header {
+		if !slices.Contains(mapped, i) {
+			ignored = append(ignored, column)
+		}
+	}
+	return cols, ignored
+}
+
+// request builds the create request for one row, along with the click count
+// to restore onto the new link.
+func (c importColumns) request(record []string) (createShortURLRequest, int64, error) {
+	field := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	req := createShortURLRequest{
+		URL:         field(c.url),
+		CustomAlias: codeFromShortLink(field(c.code)),
+		PreferAlias: true,
+		Title:       field(c.title),
+		Group:       field(c.group),
+	}
+	if req.URL == "" {
+		return createShortURLRequest{}, 0, errors.New("row has no destination url")
+	}
+	if tags := field(c.tags); tags != "" {
+		req.Tags = strings.FieldsFunc(tags, func(r rune) bool { return r == ',' || r == ';' })
+	}
+	if raw := field(c.expiresAt); raw != "" {
+		expiresAt, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return createShortURLRequest{}, 0, errors.New("expires_at must be an RFC 3339 time")
+		}
+		remaining := time.Until(expiresAt).Round(time.Second)
+		if remaining <= 0 {
+			return createShortURLRequest{}, 0, errors.New("link has already expired")
+		}
+		req.ExpiresIn = remaining.String()
+	}
+
+	var visits int64
+	if raw := strings.ReplaceAll(field(c.visits), ",", ""); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			return createShortURLRequest{}, 0, errors.New("click count must be a whole number")
+		}
+		visits = parsed
+	}
+	return req, visits, nil
+}
+
+// codeFromShortLink returns the code of a short link as other shorteners
+// export it, such as bit.ly/3xYz01 or https://tinyurl.com/abc123: the last
+// path segment, or the value itself when it has no slash.
+func codeFromShortLink(raw string) string {
+	raw = strings.TrimRight(raw, "/")
+	if i := strings.LastIndex(raw, "/"); i >= 0 {
+		raw = raw[i+1:]
+	}
+	return raw
+}
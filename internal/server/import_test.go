@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func importCSV(t *testing.T, h http.Handler, format, body string) (int, importResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/import?format="+format, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	var response importResponse
+	if res.Code == http.StatusCreated || res.Code == http.StatusBadRequest {
+		_ = json.Unmarshal(res.Body.Bytes(), &response)
+	}
+	return res.Code, response
+}
+
+func TestImportBitlyCSV(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db, adminToken: "admin-secret"}).RegisterRoutes()
+
+	body := "\ufeffBitlink,Long URL,Title,Clicks,Created\n" +
+		"bit.ly/3xYzAb1,https://docs.example.org/guide,Guide,\"1,204\",2024-01-02\n" +
+		"https://bit.ly/pricing,https://docs.example.org/pricing,,7,2024-01-03\n" +
+		"bit.ly/broken1,not a url,,3,2024-01-04\n" +
+		"bit.ly/nocount,https://docs.example.org/faq,,many,2024-01-05\n"
+	status, response := importCSV(t, h, "bitly", body)
+	if status != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %+v", status, response)
+	}
+
+	if len(response.Imported) != 2 {
+		t.Fatalf("expected two imported links, got %+v", response.Imported)
+	}
+	guide := db.store["3xYzAb1"]
+	if guide.LongURL != "https://docs.example.org/guide" || guide.Title != "Guide" || guide.Visits != 1204 {
+		t.Fatalf("expected the guide link with its clicks, got %+v", guide)
+	}
+	if pricing := db.store["pricing"]; pricing.Visits != 7 {
+		t.Fatalf("expected the pricing link with its clicks, got %+v", pricing)
+	}
+
+	rows := []int{}
+	for _, failure := range response.Failed {
+		rows = append(rows, failure.Row)
+	}
+	if !slices.Equal(rows, []int{4, 5}) {
+		t.Fatalf("expected rows 4 and 5 to be reported, got %+v", response.Failed)
+	}
+	if !slices.Equal(response.IgnoredColumns, []string{"Created"}) {
+		t.Fatalf("expected the unmapped column to be reported, got %v", response.IgnoredColumns)
+	}
+}
+
+func TestImportKeepsTakenCodesApart(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db, adminToken: "admin-secret"}).RegisterRoutes()
+
+	body := "code,long_url,visits\ndocs01,https://docs.example.org/a,2\ndocs01,https://docs.example.org/b,0\n"
+	status, response := importCSV(t, h, "export", body)
+	if status != http.StatusCreated || len(response.Imported) != 2 {
+		t.Fatalf("expected both rows imported, got %d: %+v", status, response)
+	}
+	if second := response.Imported[1]; second.ShortCode == "docs01" || second.Strategy != strategyFallback {
+		t.Fatalf("expected the taken code to fall back to a generated one, got %+v", second)
+	}
+}
+
+func TestImportRejectsBadFiles(t *testing.T) {
+	h := (&Server{db: newMockDB(), adminToken: "admin-secret"}).RegisterRoutes()
+
+	for name, tc := range map[string]struct{ format, body string }{
+		"unknown format": {"rebrandly", "Bitlink,Long URL\n"},
+		"no url column":  {"bitly", "Bitlink,Clicks\nbit.ly/a,1\n"},
+		"empty body":     {"bitly", ""},
+		"no valid rows":  {"bitly", "Bitlink,Long URL\nbit.ly/a,ftp://example.org\n"},
+	} {
+		if status, _ := importCSV(t, h, tc.format, tc.body); status != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", name, status)
+		}
+	}
+}
+
+func TestImportRefusesOversizedFilesWhole(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db, adminToken: "admin-secret"}).RegisterRoutes()
+
+	var body strings.Builder
+	body.WriteString("code,long_url\n")
+	for i := range maxImportRows + 1 {
+		fmt.Fprintf(&body, "row%04d,https://docs.example.org/%d\n", i, i)
+	}
+	if status, _ := importCSV(t, h, "export", body.String()); status != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", status)
+	}
+	if len(db.store) != 0 {
+		t.Fatalf("expected nothing imported from an oversized file, got %d links", len(db.store))
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// maxInterstitialSeconds caps interstitial_seconds so a link cannot hold
+// visitors on the countdown page indefinitely.
+const maxInterstitialSeconds = 30
+
+var interstitialTemplate = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<meta http-equiv="refresh" content="{{.Seconds}};url={{.Target}}">
+<title>Redirecting…</title>
+</head>
+<body>
+<main>
+<h1>You are leaving for {{.Host}}</h1>
+<p>Redirecting in <span id="countdown">{{.Seconds}}</span> seconds.</p>
+<p><a href="{{.Target}}" rel="noreferrer">Skip and continue now</a></p>
+</main>
+<script>
+(function () {
+	var left = {{.Seconds}};
+	var el = document.getElementById("countdown");
+	var timer = setInterval(function () {
+		left--;
+		if (left <= 0) {
+			clearInterval(timer);
+			left = 0;
+		}
+		el.textContent = left;
+	}, 1000);
+})();
+</script>
+</body>
+</html>
+`))
+
+// interstitialPage is the data passed to the interstitial template.
+type interstitialPage struct {
+	Seconds int
+	Target  string
+	Host    string
+}
+
+// writeInterstitial answers a browser visit to a link with
+// interstitial_seconds with a countdown page that redirects to target by
+// meta refresh. The visit was already counted when the page was served, and
+// the skip link points straight at target, so skipping is not counted again.
+// The page is never cached, so every view counts.
+func writeInterstitial(w http.ResponseWriter, seconds int, target, host string) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	writeHTML(w, http.StatusOK, interstitialTemplate, interstitialPage{Seconds: seconds, Target: target, Host: host})
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInterstitialForBrowsers(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db}).RegisterRoutes()
+
+	body := `{"url":"https://docs.example.org/guide","custom_alias":"wait01","interstitial_seconds":5}`
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(body)))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/wait01", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusOK || res.Header().Get("Location") != "" {
+		t.Fatalf("expected the interstitial page instead of a redirect, got %d", res.Code)
+	}
+	page := res.Body.String()
+	if !strings.Contains(page, `content="5;url=https://docs.example.org/guide"`) || !strings.Contains(page, `href="https://docs.example.org/guide"`) {
+		t.Fatalf("expected a countdown and skip link to the destination, got %s", page)
+	}
+	if res.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected the page not to be cached, got %q", res.Header().Get("Cache-Control"))
+	}
+	if visits := db.store["wait01"].Visits; visits != 1 {
+		t.Fatalf("expected serving the page to count one visit, got %d", visits)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/wait01", nil))
+	if res.Code != http.StatusFound || res.Header().Get("Location") != "https://docs.example.org/guide" {
+		t.Fatalf("expected API clients to get the direct redirect, got %d", res.Code)
+	}
+}
+
+func TestInterstitialDisabledRedirectsBrowsers(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db}).RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"https://docs.example.org/","custom_alias":"now001"}`)))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/now001", nil)
+	req.Header.Set("Accept", "text/html")
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusFound {
+		t.Fatalf("expected an immediate redirect, got %d", res.Code)
+	}
+}
+
+func TestInterstitialSecondsValidated(t *testing.T) {
+	h := (&Server{db: newMockDB()}).RegisterRoutes()
+	for _, seconds := range []string{"-1", "31"} {
+		res := httptest.NewRecorder()
+		body := `{"url":"https://docs.example.org/","interstitial_seconds":` + seconds + `}`
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(body)))
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("expected %s to be refused, got %d", seconds, res.Code)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+)
+
+// jsonpCallbackPattern admits a JavaScript identifier, or a few joined by
+// dots as in Widget.onStats, and nothing that could end the call early or
+// start another statement.
+var jsonpCallbackPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]{0,63}(\.[A-Za-z_$][A-Za-z0-9_$]{0,63}){0,3}$`)
+
+// writeJSONP is writeJSON for endpoints that legacy widgets load with a
+// script tag. With ENABLE_JSONP and a ?callback= parameter the body becomes
+// callback(json); and is served as application/javascript. The leading
+// empty comment keeps a crafted callback from making the response look like
+// another file type. An invalid callback answers 400.
+func (s *Server) writeJSONP(w http.ResponseWriter, r *http.Request, statusCode int, payload any) {
+	callback := r.URL.Query().Get("callback")
+	if !s.jsonp || callback == "" {
+		s.writeJSON(w, statusCode, payload)
+		return
+	}
+	if !jsonpCallbackPattern.MatchString(callback) {
+		s.writeError(w, http.StatusBadRequest, "callback must be a JavaScript identifier")
+		return
+	}
+
+	body, ok := s.encodeResponse(w, payload)
+	if !ok {
+		return
+	}
+	script := make([]byte, 0, len(callback)+len(body)+8)
+	script = append(script, "/**/"+callback+"("...)
+	script = append(script, body...)
+	script = append(script, ");"...)
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Type", "application/javascript")
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(script); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
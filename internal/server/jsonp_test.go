@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestStatsJSONP(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "wid0001", "https://example.com", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	h := (&Server{db: db, jsonp: true}).RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/wid0001?callback=Widget.onStats", nil))
+	body := res.Body.String()
+	if res.Code != http.StatusOK || !strings.HasPrefix(body, "/**/Widget.onStats({") || !strings.HasSuffix(body, ");") {
+		t.Fatalf("expected the stats wrapped in the callback, got %d: %s", res.Code, body)
+	}
+	if got := res.Header().Get("Content-Type"); got != "application/javascript" {
+		t.Fatalf("expected application/javascript, got %q", got)
+	}
+	if !strings.Contains(body, `"long_url":"https://example.com"`) {
+		t.Fatalf("expected the stats in the callback, got %s", body)
+	}
+
+	for _, callback := range []string{"alert(1);foo", "x</script><script>alert(1)//", "1abc", "a..b", strings.Repeat("a", 65)} {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/wid0001?callback="+url.QueryEscape(callback), nil))
+		if res.Code != http.StatusBadRequest || strings.Contains(res.Body.String(), "alert") {
+			t.Fatalf("%q: expected the callback to be rejected, got %d: %s", callback, res.Code, res.Body.String())
+		}
+		if got := res.Header().Get("Content-Type"); got != "application/json" {
+			t.Fatalf("%q: expected a JSON error, got %q", callback, got)
+		}
+	}
+}
+
+func TestStatsJSONPOffByDefault(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "wid0002", "https://example.com", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	h := (&Server{db: db}).RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/wid0002?callback=cb", nil))
+	if res.Code != http.StatusOK || res.Header().Get("Content-Type") != "application/json" || strings.HasPrefix(res.Body.String(), "/**/") {
+		t.Fatalf("expected plain JSON without ENABLE_JSONP, got %d: %s", res.Code, res.Body.String())
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"url-shortner/pkg/linkrules"
+)
+
+// TestHandlersAgreeWithLinkRules checks that the shorten handler accepts and
+// rejects aliases and URLs exactly as the exported linkrules functions do.
+func TestHandlersAgreeWithLinkRules(t *testing.T) {
+	h := (&Server{db: newMockDB()}).RegisterRoutes()
+	dryRun := func(body map[string]string) (int, string) {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten?dry_run=1", strings.NewReader(string(payload)))
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		var out errorResponse
+		json.Unmarshal(res.Body.Bytes(), &out)
+		return res.Code, out.Error
+	}
+
+	aliases := []string{"docs01", "abc", "has space", "health", "HEALTH", "version", "expiring", "x_y-z", "a23456789012345678901234567890123", "ünïcode"}
+	for _, alias := range aliases {
+		want := linkrules.ValidateAlias(alias)
+		code, msg := dryRun(map[string]string{"url": "https://docs.example.org", "custom_alias": alias})
+		if (code == http.StatusOK) != (want == nil) {
+			t.Errorf("alias %q: handler answered %d, ValidateAlias returned %v", alias, code, want)
+		}
+		if want != nil && msg != want.Error() {
+			t.Errorf("alias %q: handler said %q, ValidateAlias said %q", alias, msg, want)
+		}
+	}
+
+	urls := []string{"https://docs.example.org/a", " http://docs.example.org ", "", "ftp://docs.example.org", "docs.example.org", "https://", "https://docs.example.org/%zz", "javascript:alert(1)"}
+	for _, raw := range urls {
+		_, want := linkrules.NormalizeURL(raw)
+		code, msg := dryRun(map[string]string{"url": raw})
+		if (code == http.StatusOK) != (want == nil) {
+			t.Errorf("url %q: handler answered %d, NormalizeURL returned %v", raw, code, want)
+		}
+		if want != nil && msg != want.Error() {
+			t.Errorf("url %q: handler said %q, NormalizeURL said %q", raw, msg, want)
+		}
+	}
+}
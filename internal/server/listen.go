@@ -0,0 +1,47 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+)
+
+// Listen opens the listener for HTTPServer: the LISTEN_SOCKET unix socket
+// when one is configured, for reverse proxies on the same host, and TCP on
+// the configured port otherwise. A socket left behind by an earlier run is
+// replaced, and closing the listener, as http.Server.Shutdown does, removes
+// the file again.
+func (s *Server) Listen() (net.Listener, error) {
+	if s.listenSocket == "" {
+		return net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	}
+
+	info, err := os.Lstat(s.listenSocket)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("listen socket: %w", err)
+	case info.Mode().Type() != fs.ModeSocket:
+		return nil, fmt.Errorf("listen socket: %s exists and is not a socket", s.listenSocket)
+	default:
+		if err := os.Remove(s.listenSocket); err != nil {
+			return nil, fmt.Errorf("listen socket: remove stale socket: %w", err)
+		}
+	}
+
+	lis, err := net.Listen("unix", s.listenSocket)
+	if err != nil {
+		return nil, fmt.Errorf("listen socket: %w", err)
+	}
+	return lis, nil
+}
+
+// ListenAddr describes where Listen serves, for logging.
+func (s *Server) ListenAddr() string {
+	if s.listenSocket != "" {
+		return "unix:" + s.listenSocket
+	}
+	return fmt.Sprintf(":%d", s.port)
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestRedirectOverUnixSocket(t *testing.T) {
+	// Unix socket paths are short-limited, so stay out of the long TempDir.
+	dir, err := os.MkdirTemp("", "sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "api.sock")
+
+	// A socket left behind by a crashed run must not block startup.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	db := newMockDB()
+	db.store["sock001"] = redisdb.URLStats{Code: "sock001", LongURL: "https://docs.example.org/socket", CreatedAt: time.Now().UTC()}
+	s := &Server{db: db, listenSocket: path}
+	lis, err := s.Listen()
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	srv := s.HTTPServer()
+	go srv.Serve(lis)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	res, err := client.Get("http://short.local/sock001")
+	if err != nil {
+		t.Fatalf("GET over the socket: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound || res.Header.Get("Location") != "https://docs.example.org/socket" {
+		t.Fatalf("expected a redirect, got %d to %q", res.StatusCode, res.Header.Get("Location"))
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the socket file to be removed on shutdown, got %v", err)
+	}
+}
+
+func TestListenSocketKeepsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not-a-socket")
+	if err := os.WriteFile(path, []byte("keep"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (&Server{listenSocket: path}).Listen(); err == nil {
+		t.Fatal("expected Listen to refuse a path holding a regular file")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "keep" {
+		t.Fatal("expected the file to be left alone")
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+const liveHeartbeatInterval = 15 * time.Second
+
+// liveClicksHandler streams a Server-Sent Event for every visit to a code
+// until the client disconnects.
+func (s *Server) liveClicksHandler(w http.ResponseWriter, r *http.Request) {
+	code := s.pathCode(r)
+	if code == "" {
+		s.writeError(w, http.StatusNotFound, "short code not found")
+		return
+	}
+
+	exists, err := s.db.ShortCodeExists(r.Context(), code)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to resolve short URL")
+		return
+	}
+	if !exists {
+		s.writeError(w, http.StatusNotFound, "short code not found")
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The server-wide WriteTimeout would otherwise cut every stream short.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("failed to clear write deadline for live stream: %v", err)
+	}
+
+	events, err := s.db.SubscribeClicks(r.Context(), code)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to subscribe to clicks")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		log.Printf("live stream for %s does not support flushing: %v", code, err)
+		return
+	}
+
+	heartbeat := time.NewTicker(liveHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := writeClickEvent(w, event); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeClickEvent(w http.ResponseWriter, event redisdb.ClickEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: click\ndata: %s\n\n", payload)
+	return err
+}
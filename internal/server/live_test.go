@@ -0,0 +1,99 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestLiveClicksStreamsRedirects(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "live123", "https://example.com", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	s := &Server{db: db}
+	srv := httptest.NewServer(s.RegisterRoutes())
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1/urls/live123/live", nil)
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %s", ct)
+	}
+
+	reader := bufio.NewReader(res.Body)
+	if line, err := reader.ReadString('\n'); err != nil || line != ": connected\n" {
+		t.Fatalf("expected connected comment, got %q (%v)", line, err)
+	}
+
+	client := srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	redirectReq, _ := http.NewRequest(http.MethodGet, srv.URL+"/live123", nil)
+	redirectReq.Header.Set("Referer", "https://news.example.org/post")
+	redirectRes, err := client.Do(redirectReq)
+	if err != nil {
+		t.Fatalf("redirect failed: %v", err)
+	}
+	redirectRes.Body.Close()
+
+	var eventLine, dataLine string
+	for dataLine == "" {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			eventLine = strings.TrimSpace(line)
+		case strings.HasPrefix(line, "data: "):
+			dataLine = strings.TrimPrefix(strings.TrimSpace(line), "data: ")
+		}
+	}
+
+	if eventLine != "event: click" {
+		t.Fatalf("expected click event, got %q", eventLine)
+	}
+
+	var event redisdb.ClickEvent
+	if err := json.Unmarshal([]byte(dataLine), &event); err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+	if event.Code != "live123" || event.Visits != 1 || event.Referrer != "news.example.org" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+}
+
+func TestLiveClicksUnknownCode(t *testing.T) {
+	s := &Server{db: newMockDB()}
+	h := s.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/urls/missing/live", nil)
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, res.Code)
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// redactedURL is logged in place of a URL that cannot be parsed.
+const redactedURL = "[redacted url]"
+
+// redactURL keeps only the scheme and host of raw, dropping the userinfo,
+// path, query and fragment that may carry tokens or personal data.
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return redactedURL
+	}
+	return (&url.URL{Scheme: parsed.Scheme, Host: parsed.Host}).String()
+}
+
+// logURL returns raw as it should appear in the log: in full, or reduced to
+// scheme and host when REDACT_LOGGED_URLS is set.
+func (s *Server) logURL(raw string) string {
+	if !s.redactLoggedURLs {
+		return raw
+	}
+	return redactURL(raw)
+}
+
+// logError returns err as it should appear in the log. net/http errors embed
+// the request URL, so with redaction on a *url.Error is rewritten around the
+// redacted URL.
+func (s *Server) logError(err error) error {
+	var urlErr *url.Error
+	if !s.redactLoggedURLs || !errors.As(err, &urlErr) {
+		return err
+	}
+	return fmt.Errorf("%s %q: %w", urlErr.Op, redactURL(urlErr.URL), urlErr.Err)
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := map[string]string{
+		"https://user:pw@docs.example.org/reset?token=abc#top": "https://docs.example.org",
+		"http://docs.example.org:8080/private/path":            "http://docs.example.org:8080",
+		"not a url":                    redactedURL,
+		"https://docs.example.org/%zz": redactedURL,
+	}
+	for raw, want := range tests {
+		if got := redactURL(raw); got != want {
+			t.Errorf("redactURL(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestMetadataFailureLogRedactsURL(t *testing.T) {
+	const target = "https://docs.example.org/reset?token=abc123"
+
+	for _, redact := range []bool{false, true} {
+		var logs bytes.Buffer
+		log.SetOutput(&logs)
+
+		s := &Server{db: newMockDB(), outbound: &http.Client{Transport: failingTransport{}}, redactLoggedURLs: redact}
+		s.populateMetadata("meta01", target, "", "")
+		s.background.Wait()
+		log.SetOutput(os.Stderr)
+
+		out := logs.String()
+		if !strings.Contains(out, "connection refused") {
+			t.Fatalf("expected the fetch error to be logged, got %q", out)
+		}
+		if leaked := strings.Contains(out, "token=abc123"); leaked == redact {
+			t.Fatalf("redact=%v: unexpected log line %q", redact, out)
+		}
+		if redact && strings.Count(out, `"https://docs.example.org"`) != 1 {
+			t.Fatalf("expected the redacted URL in the error, got %q", out)
+		}
+	}
+}
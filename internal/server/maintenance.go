@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// maintenanceRetryAfter is the Retry-After value, in seconds, sent with
+// writes refused during maintenance.
+const maintenanceRetryAfter = "120"
+
+const maintenanceMessage = "service is in maintenance: changes are paused, existing links still redirect"
+
+type maintenanceRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+type maintenanceResponse struct {
+	Maintenance bool `json:"maintenance"`
+}
+
+// isWriteMethod reports whether routes registered for method change data.
+func isWriteMethod(pattern string) bool {
+	method, _, _ := strings.Cut(pattern, " ")
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch || method == http.MethodDelete
+}
+
+// maintenanceGate wraps a write route so it answers 503 while maintenance
+// mode is on, leaving Redis alone for migrations. Redirects and other reads
+// are not wrapped and keep working.
+func (s *Server) maintenanceGate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.maintenance.Load() {
+			w.Header().Set("Retry-After", maintenanceRetryAfter)
+			s.writeError(w, http.StatusServiceUnavailable, maintenanceMessage)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// maintenanceHandler switches maintenance mode with {"enabled": true|false}
+// and reports the resulting mode.
+func (s *Server) maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	var req maintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		s.writeError(w, http.StatusBadRequest, `body must be {"enabled": true} or {"enabled": false}`)
+		return
+	}
+	if s.maintenance.Swap(*req.Enabled) != *req.Enabled {
+		log.Printf("maintenance mode set to %t", *req.Enabled)
+	}
+	s.writeJSON(w, http.StatusOK, maintenanceResponse{Maintenance: *req.Enabled})
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	redisdb "url-shortner/internal/redis"
+	"url-shortner/internal/shortenerpb"
+)
+
+func TestMaintenanceModeRefusesWritesOnly(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "abc1234", "https://docs.example.org/live", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	s := &Server{db: db, adminToken: "s3cret"}
+	h := s.RegisterRoutes()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	if res := serve(http.MethodPost, "/api/v1/admin/maintenance", `{"enabled":true}`); res.Code != http.StatusOK {
+		t.Fatalf("expected maintenance to be enabled, got %d: %s", res.Code, res.Body.String())
+	}
+
+	writes := []struct{ method, path, body string }{
+		{http.MethodPost, "/api/v1/shorten", `{"url":"https://docs.example.org/new"}`},
+		{http.MethodPatch, "/api/v1/urls/abc1234", `{"title":"Renamed"}`},
+		{http.MethodDelete, "/api/v1/urls/abc1234", ""},
+	}
+	for _, tt := range writes {
+		res := serve(tt.method, tt.path, tt.body)
+		if res.Code != http.StatusServiceUnavailable || res.Header().Get("Retry-After") != maintenanceRetryAfter {
+			t.Fatalf("%s %s: expected 503 with Retry-After, got %d %v", tt.method, tt.path, res.Code, res.Header())
+		}
+	}
+	if _, ok := db.store["abc1234"]; !ok || len(db.store) != 1 {
+		t.Fatal("expected no writes to reach the store")
+	}
+
+	if res := serve(http.MethodGet, "/abc1234", ""); res.Code != http.StatusFound {
+		t.Fatalf("expected redirects to keep working, got %d", res.Code)
+	}
+	if res := serve(http.MethodGet, "/api/v1/urls/abc1234", ""); res.Code != http.StatusOK {
+		t.Fatalf("expected stats to keep working, got %d", res.Code)
+	}
+
+	var health map[string]string
+	json.Unmarshal(serve(http.MethodGet, "/health", "").Body.Bytes(), &health)
+	if health["maintenance"] != "true" {
+		t.Fatalf("expected /health to report maintenance, got %v", health)
+	}
+	var root map[string]any
+	json.Unmarshal(serve(http.MethodGet, "/", "").Body.Bytes(), &root)
+	if root["maintenance"] != true {
+		t.Fatalf("expected GET / to report maintenance, got %v", root["maintenance"])
+	}
+
+	if res := serve(http.MethodPost, "/api/v1/admin/maintenance", `{"enabled":false}`); res.Code != http.StatusOK {
+		t.Fatalf("expected maintenance to be disabled, got %d", res.Code)
+	}
+	if res := serve(writes[0].method, writes[0].path, writes[0].body); res.Code != http.StatusCreated {
+		t.Fatalf("expected writes to resume, got %d: %s", res.Code, res.Body.String())
+	}
+}
+
+func TestMaintenanceToggleValidation(t *testing.T) {
+	h := (&Server{db: newMockDB(), adminToken: "s3cret"}).RegisterRoutes()
+	for body, want := range map[string]int{`{}`: http.StatusBadRequest, `{"enabled":"yes"}`: http.StatusBadRequest} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/maintenance", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if res.Code != want {
+			t.Fatalf("%s: expected %d, got %d", body, want, res.Code)
+		}
+	}
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/admin/maintenance", strings.NewReader(`{"enabled":true}`)))
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the toggle to need the admin token, got %d", res.Code)
+	}
+}
+
+func TestMaintenanceModeGRPC(t *testing.T) {
+	s := &Server{db: newMockDB()}
+	s.maintenance.Store(true)
+	client := newGRPCClient(t, s)
+
+	_, err := client.CreateShortURL(context.Background(), &shortenerpb.CreateShortURLRequest{Url: "https://docs.example.org"})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable, got %v", err)
+	}
+}
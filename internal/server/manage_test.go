@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func createManagedLink(t *testing.T, h http.Handler, alias string) createShortURLResponse {
+	t.Helper()
+	res := shorten(h, `{"url":"https://docs.example.org/managed","custom_alias":"`+alias+`"}`, "")
+	if res.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+	var created createShortURLResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if created.ManagementToken == "" {
+		t.Fatal("expected a management_token in the create response")
+	}
+	return created
+}
+
+func TestManagementTokenGuardsDelete(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db, managementTokens: true}).RegisterRoutes()
+	created := createManagedLink(t, h, "manage1")
+
+	if stored := db.extra["manage1"][managementTokenField]; stored == "" || stored == created.ManagementToken {
+		t.Fatalf("expected only a digest of the token to be stored, got %q", stored)
+	}
+
+	for name, token := range map[string]string{"absent": "", "wrong": "not-the-token"} {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/urls/manage1", nil)
+		if token != "" {
+			req.Header.Set(managementTokenHeader, token)
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if res.Code != http.StatusForbidden {
+			t.Fatalf("%s token: expected 403, got %d", name, res.Code)
+		}
+	}
+	if _, ok := db.store["manage1"]; !ok {
+		t.Fatal("expected the link to survive refused deletes")
+	}
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/manage1", nil))
+	if strings.Contains(res.Body.String(), created.ManagementToken) || strings.Contains(res.Body.String(), "management_token") {
+		t.Fatalf("expected stats not to expose the token, got %s", res.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/urls/manage1", nil)
+	req.Header.Set(managementTokenHeader, created.ManagementToken)
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("expected the right token to delete, got %d: %s", res.Code, res.Body.String())
+	}
+	if _, ok := db.store["manage1"]; ok {
+		t.Fatal("expected the link to be deleted")
+	}
+}
+
+func TestManagementTokenGuardsUpdateAndRotate(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db, managementTokens: true, adminToken: "admin-secret"}).RegisterRoutes()
+	created := createManagedLink(t, h, "manage2")
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPatch, "/api/v1/urls/manage2", strings.NewReader(`{"title":"Hijacked"}`)))
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("expected an update without the token to be refused, got %d", res.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/urls/manage2", strings.NewReader(`{"title":"Renamed"}`))
+	req.Header.Set(managementTokenHeader, created.ManagementToken)
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusOK || db.store["manage2"].Title != "Renamed" {
+		t.Fatalf("expected the token to allow the update, got %d: %s", res.Code, res.Body.String())
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/urls/manage2/rotate", nil))
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("expected a rotation without the token to be refused, got %d", res.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/urls/manage2/rotate", strings.NewReader(`{"custom_alias":"manage3"}`))
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected the admin token to allow the rotation, got %d: %s", res.Code, res.Body.String())
+	}
+
+	// The token moves with the link.
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/urls/manage3", nil)
+	req.Header.Set(managementTokenHeader, created.ManagementToken)
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("expected the token to delete the rotated link, got %d", res.Code)
+	}
+}
+
+func TestManagementTokensOffByDefault(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db}).RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"https://docs.example.org","custom_alias":"open001"}`)))
+	if res.Code != http.StatusCreated || strings.Contains(res.Body.String(), "management_token") {
+		t.Fatalf("expected no management token, got %d: %s", res.Code, res.Body.String())
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodDelete, "/api/v1/urls/open001", nil))
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("expected links without a token to stay open, got %d", res.Code)
+	}
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	metadataFetchTimeout = 5 * time.Second
+	maxMetadataBodyBytes = 512 << 10
+	maxImageURLLength    = 2048
+)
+
+type pageMetadata struct {
+	Title       string
+	Description string
+	Image       string
+}
+
+// populateMetadata fetches target in the background and fills in whichever of
+// title and description the creator left empty, along with the page's
+// og:image. It never blocks the caller.
+func (s *Server) populateMetadata(code, target, title, description string) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), metadataFetchTimeout)
+		defer cancel()
+
+		meta, err := fetchPageMetadata(ctx, s.outboundClient(), target)
+		if err != nil {
+			log.Printf("failed to fetch metadata for %s from %s: %v", code, s.logURL(target), s.logError(err))
+			return
+		}
+
+		var update pageMetadata
+		if title == "" {
+			update.Title = truncateRunes(meta.Title, maxTitleLength)
+		}
+		if description == "" {
+			update.Description = truncateRunes(meta.Description, maxDescriptionLength)
+		}
+		if len(meta.Image) <= maxImageURLLength {
+			update.Image = meta.Image
+		}
+		if update.Title == "" && update.Description == "" && update.Image == "" {
+			return
+		}
+
+		if err := s.db.SetMetadata(ctx, code, update.Title, update.Description, update.Image); err != nil {
+			log.Printf("failed to store metadata for %s: %v", code, err)
+		}
+	}()
+}
+
+func (s *Server) outboundClient() *http.Client {
+	if s.outbound != nil {
+		return s.outbound
+	}
+	return newOutboundClient(metadataFetchTimeout)
+}
+
+// fetchPageMetadata reads at most maxMetadataBodyBytes of the page at target
+// and extracts its title, description and image, preferring OpenGraph tags.
+// A relative og:image is resolved against the final URL of the page.
+func fetchPageMetadata(ctx context.Context, client *http.Client, target string) (pageMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return pageMetadata{}, err
+	}
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "url-shortner/"+version+" (metadata fetch)")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return pageMetadata{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return pageMetadata{}, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mediaType != "text/html" {
+		return pageMetadata{}, fmt.Errorf("unexpected content type %q", mediaType)
+	}
+
+	meta := parsePageMetadata(io.LimitReader(res.Body, maxMetadataBodyBytes))
+	meta.Image = resolveImageURL(res.Request.URL, meta.Image)
+	return meta, nil
+}
+
+// resolveImageURL makes image absolute relative to base, dropping anything
+// that is not an http(s) URL.
+func resolveImageURL(base *url.URL, image string) string {
+	if image == "" {
+		return ""
+	}
+	ref, err := url.Parse(image)
+	if err != nil {
+		return ""
+	}
+	abs := base.ResolveReference(ref)
+	if (abs.Scheme != "http" && abs.Scheme != "https") || abs.Host == "" {
+		return ""
+	}
+	return abs.String()
+}
+
+func parsePageMetadata(r io.Reader) pageMetadata {
+	var (
+		meta                 pageMetadata
+		ogTitle, ogDesc      string
+		inTitle, sawTitleTag bool
+	)
+
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return mergeMetadata(meta, ogTitle, ogDesc)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			switch tok.Data {
+			case "title":
+				inTitle = !sawTitleTag
+				sawTitleTag = true
+			case "meta":
+				key, content := metaAttrs(tok)
+				switch key {
+				case "og:title":
+					ogTitle = content
+				case "og:description":
+					ogDesc = content
+				case "og:image":
+					meta.Image = strings.TrimSpace(content)
+				case "description":
+					meta.Description = content
+				}
+			case "body":
+				return mergeMetadata(meta, ogTitle, ogDesc)
+			}
+		case html.TextToken:
+			if inTitle {
+				meta.Title += string(z.Text())
+			}
+		case html.EndTagToken:
+			if tok := z.Token(); tok.Data == "title" {
+				inTitle = false
+			} else if tok.Data == "head" {
+				return mergeMetadata(meta, ogTitle, ogDesc)
+			}
+		}
+	}
+}
+
+func metaAttrs(tok html.Token) (key, content string) {
+	for _, attr := range tok.Attr {
+		switch strings.ToLower(attr.Key) {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(attr.Val))
+			}
+		case "content":
+			content = attr.Val
+		}
+	}
+	return key, content
+}
+
+func mergeMetadata(meta pageMetadata, ogTitle, ogDesc string) pageMetadata {
+	if ogTitle != "" {
+		meta.Title = ogTitle
+	}
+	if ogDesc != "" {
+		meta.Description = ogDesc
+	}
+	meta.Title = strings.Join(strings.Fields(meta.Title), " ")
+	meta.Description = strings.Join(strings.Fields(meta.Description), " ")
+	return meta
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
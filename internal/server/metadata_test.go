@@ -0,0 +1,116 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const ogPage = `<!DOCTYPE html>
+<html>
+<head>
+<title>Fallback   title</title>
+<meta name="description" content="Plain description">
+<meta property="og:title" content="Launch Day">
+<meta property="og:description" content="Everything we shipped">
+<meta property="og:image" content="/static/launch.png">
+</head>
+<body><p>ignored</p></body>
+</html>`
+
+func TestCreateShortURLFetchesMetadata(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(ogPage))
+	}))
+	defer page.Close()
+
+	db := newMockDB()
+	s := &Server{db: db, outbound: page.Client()}
+	h := s.RegisterRoutes()
+
+	body := []byte(`{"url":"` + page.URL + `/post","custom_alias":"ogmeta1","fetch_metadata":true}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+	req.Host = "short.local"
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, res.Code, res.Body.String())
+	}
+
+	s.background.Wait()
+
+	stats, err := db.GetStats(context.Background(), "ogmeta1")
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if stats.Title != "Launch Day" {
+		t.Fatalf("expected og:title to be stored, got %q", stats.Title)
+	}
+	if stats.Description != "Everything we shipped" {
+		t.Fatalf("expected og:description to be stored, got %q", stats.Description)
+	}
+	if stats.Image != page.URL+"/static/launch.png" {
+		t.Fatalf("expected og:image resolved against the page, got %q", stats.Image)
+	}
+}
+
+func TestFetchMetadataKeepsProvidedTitle(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(ogPage))
+	}))
+	defer page.Close()
+
+	db := newMockDB()
+	s := &Server{db: db, outbound: page.Client()}
+	h := s.RegisterRoutes()
+
+	body := []byte(`{"url":"` + page.URL + `","custom_alias":"ogmeta2","title":"Mine","fetch_metadata":true}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+	req.Host = "short.local"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	s.background.Wait()
+
+	stats, err := db.GetStats(context.Background(), "ogmeta2")
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if stats.Title != "Mine" || stats.Description != "Everything we shipped" {
+		t.Fatalf("unexpected metadata: title=%q description=%q", stats.Title, stats.Description)
+	}
+}
+
+func TestParsePageMetadataFallsBackToTitle(t *testing.T) {
+	meta := parsePageMetadata(strings.NewReader(`<html><head><title> Just a
+	title </title><meta name="Description" content="desc"></head></html>`))
+
+	if meta.Title != "Just a title" {
+		t.Fatalf("expected collapsed title, got %q", meta.Title)
+	}
+	if meta.Description != "desc" {
+		t.Fatalf("expected description, got %q", meta.Description)
+	}
+}
+
+func TestOutboundClientBlocksPrivateAddresses(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(ogPage))
+	}))
+	defer page.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := fetchPageMetadata(ctx, newOutboundClient(time.Second), page.URL)
+	if !errors.Is(err, errBlockedAddress) {
+		t.Fatalf("expected loopback fetch to be blocked, got %v", err)
+	}
+}
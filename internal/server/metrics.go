@@ -0,0 +1,70 @@
+package server
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// Counters published on /debug/vars. They are process-wide, so tests should
+// compare deltas rather than absolute values.
+var (
+	// codeCollisionRetries counts generated candidates that were already taken.
+	codeCollisionRetries = expvar.NewInt("code_collision_retries")
+	// codeAllocationFailures counts requests that gave up after maxCodeAttempts.
+	codeAllocationFailures = expvar.NewInt("code_allocation_failures")
+	// generatedCodeLengths counts allocated random codes, keyed by length.
+	generatedCodeLengths = expvar.NewMap("generated_code_lengths")
+)
+
+// saturationWarnPercent is the keyspace saturation past which a warning is
+// logged: random codes then collide often enough that requests start
+// spending their maxCodeAttempts.
+const saturationWarnPercent = 1.0
+
+// codeEntropyBits is how many bits of randomness a generated code of length
+// characters from an alphabet of alphabetSize carries.
+func codeEntropyBits(alphabetSize, length int) float64 {
+	return float64(length) * math.Log2(float64(alphabetSize))
+}
+
+// keyspaceSaturation estimates the share of generated codes already taken,
+// in percent. Every link counts, custom aliases included, so the estimate
+// errs on the high side.
+func keyspaceSaturation(links int64, alphabetSize, length int) float64 {
+	return float64(links) / math.Pow(float64(alphabetSize), float64(length)) * 100
+}
+
+// metricsHandler exposes service-wide gauges in the Prometheus text format:
+// the link count from the summary counters, and how much of the generated
+// code space it uses. Crossing saturationWarnPercent is logged once.
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	summary, err := s.db.GetSummary(r.Context())
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch metrics")
+		return
+	}
+
+	alphabet := len(s.codeAlphabet())
+	saturation := keyspaceSaturation(summary.Links, alphabet, shortCodeLength)
+	if above := saturation >= saturationWarnPercent; s.keyspaceSaturated.Swap(above) != above && above {
+		log.Printf("warning: %d links fill %.2f%% of the %d-character code space; collisions will climb, consider longer codes",
+			summary.Links, saturation, shortCodeLength)
+	}
+
+	var b strings.Builder
+	writeGauge := func(name, help string, value any) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+	writeGauge("urlshortner_links", "Links currently stored.", summary.Links)
+	writeGauge("urlshortner_code_entropy_bits", "Bits of randomness in a generated short code.", codeEntropyBits(alphabet, shortCodeLength))
+	writeGauge("urlshortner_code_space_size", "Possible generated short codes.", math.Pow(float64(alphabet), shortCodeLength))
+	writeGauge("urlshortner_code_space_saturation_percent", "Estimated share of the generated code space in use.", saturation)
+
+	w.Header().Set("Content-Type", prometheusContentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(b.String()))
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// ownerFromRequest derives a stable owner id from the request's API key. Only
+// a hash of the key is ever stored. Requests without a key have no owner.
+func ownerFromRequest(r *http.Request) string {
+	return ownerFromKey(r.Header.Get(apiKeyHeader))
+}
+
+// ownerFromKey hashes an API key into an owner id; "" for no key.
+func ownerFromKey(key string) string {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// ownerQuotaExceeded reports whether owner already has as many links as it is
+// allowed. It also returns owner's limit, 0 when unlimited, for
+// CreateOptions.OwnerLimit: creates racing past this check are still refused
+// when they are stored.
+func (s *Server) ownerQuotaExceeded(ctx context.Context, owner string) (int64, bool, error) {
+	limit, limited, err := s.ownerLimit(ctx, owner)
+	if err != nil || !limited {
+		return 0, false, err
+	}
+	count, err := s.db.CountOwnerLinks(ctx, owner)
+	if err != nil {
+		return 0, false, err
+	}
+	return limit, count >= limit, nil
+}
+
+// ownerQuotaRemaining returns how many more links, reservations included,
+// owner may have, and false when owner is not limited.
+func (s *Server) ownerQuotaRemaining(ctx context.Context, owner string) (int64, bool, error) {
+	limit, limited, err := s.ownerLimit(ctx, owner)
+	if err != nil || !limited {
+		return 0, false, err
+	}
+	count, err := s.db.CountOwnerLinks(ctx, owner)
+	if err != nil {
+		return 0, false, err
+	}
+	return limit - count, true, nil
+}
+
+// ownerLimit returns how many links owner may have, and false when owner is
+// not limited. A per-owner override stored in Redis wins over the global
+// MAX_LINKS_PER_OWNER; a global limit of zero means unlimited. Requests
+// without an API key have no owner and are never limited.
+func (s *Server) ownerLimit(ctx context.Context, owner string) (int64, bool, error) {
+	if owner == "" {
+		return 0, false, nil
+	}
+
+	override, ok, err := s.db.GetOwnerQuota(ctx, owner)
+	if err != nil {
+		return 0, false, err
+	}
+	if ok {
+		return override, true, nil
+	}
+	if s.maxLinksPerOwner <= 0 {
+		return 0, false, nil
+	}
+	return int64(s.maxLinksPerOwner), true, nil
+}
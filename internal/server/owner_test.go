@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOwnerQuotaEnforcedAndRecoversAfterDelete(t *testing.T) {
+	db := newMockDB()
+	s := &Server{db: db, maxLinksPerOwner: 2}
+	h := s.RegisterRoutes()
+
+	var codes []string
+	for i := 0; i < 2; i++ {
+		res := shorten(h, `{"url":"https://docs.example.org/"}`, "key-a")
+		if res.Code != http.StatusCreated {
+			t.Fatalf("create %d: expected status %d, got %d", i, http.StatusCreated, res.Code)
+		}
+		var out createShortURLResponse
+		if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		codes = append(codes, out.ShortCode)
+	}
+
+	if res := shorten(h, `{"url":"https://docs.example.org/"}`, "key-a"); res.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d over quota, got %d", http.StatusTooManyRequests, res.Code)
+	}
+	if res := shorten(h, `{"url":"https://docs.example.org/"}`, "key-b"); res.Code != http.StatusCreated {
+		t.Fatalf("expected another owner to be unaffected, got %d", res.Code)
+	}
+	if res := shorten(h, `{"url":"https://docs.example.org/"}`, ""); res.Code != http.StatusCreated {
+		t.Fatalf("expected anonymous create to be unaffected, got %d", res.Code)
+	}
+
+	delReq := httptest.NewRequest(http.MethodDelete, "/api/v1/urls/"+codes[0], nil)
+	delRes := httptest.NewRecorder()
+	h.ServeHTTP(delRes, delReq)
+	if delRes.Code != http.StatusNoContent {
+		t.Fatalf("expected delete status %d, got %d", http.StatusNoContent, delRes.Code)
+	}
+
+	if res := shorten(h, `{"url":"https://docs.example.org/"}`, "key-a"); res.Code != http.StatusCreated {
+		t.Fatalf("expected create to succeed after delete, got %d", res.Code)
+	}
+}
+
+// staleCountDB reports no links for every owner, like a count taken just
+// before another create from the same key landed.
+type staleCountDB struct {
+	*mockDB
+}
+
+func (staleCountDB) CountOwnerLinks(context.Context, string) (int64, error) {
+	return 0, nil
+}
+
+func TestOwnerQuotaEnforcedWhenStored(t *testing.T) {
+	s := &Server{db: staleCountDB{newMockDB()}, maxLinksPerOwner: 1}
+	h := s.RegisterRoutes()
+
+	if res := shorten(h, `{"url":"https://docs.example.org/"}`, "key-a"); res.Code != http.StatusCreated {
+		t.Fatalf("expected first create to succeed, got %d", res.Code)
+	}
+	if res := shorten(h, `{"url":"https://docs.example.org/"}`, "key-a"); res.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected a create racing past the quota check to be refused, got %d", res.Code)
+	}
+	if res := shorten(h, `{"url":"https://docs.example.org/"}`, ""); res.Code != http.StatusCreated {
+		t.Fatalf("expected anonymous create to stay unlimited, got %d", res.Code)
+	}
+}
+
+func TestOwnerQuotaOverride(t *testing.T) {
+	db := newMockDB()
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set(apiKeyHeader, "key-limited")
+	owner := ownerFromRequest(req)
+	if err := db.SetOwnerQuota(context.Background(), owner, 1); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	if res := shorten(h, `{"url":"https://docs.example.org/"}`, "key-limited"); res.Code != http.StatusCreated {
+		t.Fatalf("expected first create to succeed, got %d", res.Code)
+	}
+	if res := shorten(h, `{"url":"https://docs.example.org/"}`, "key-limited"); res.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected per-key quota to apply without a global limit, got %d", res.Code)
+	}
+}
+
+func TestOwnerFromRequestHashesKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if owner := ownerFromRequest(req); owner != "" {
+		t.Fatalf("expected no owner without a key, got %q", owner)
+	}
+
+	req.Header.Set(apiKeyHeader, "secret-key")
+	owner := ownerFromRequest(req)
+	if owner == "" || owner == "secret-key" || len(owner) != 32 {
+		t.Fatalf("expected a 32-char hashed owner id, got %q", owner)
+	}
+}
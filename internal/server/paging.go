@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// pagedResponse is the shape of every list endpoint. NextCursor is opaque:
+// clients pass it back verbatim as ?cursor= to get the following page, and it
+// is empty once HasMore is false.
+type pagedResponse[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// pageRequest is a parsed ?cursor=&limit= pair.
+type pageRequest struct {
+	after string
+	limit int
+}
+
+func parsePageRequest(r *http.Request) (pageRequest, error) {
+	page := pageRequest{limit: defaultPageSize}
+
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return pageRequest{}, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		page.limit = limit
+	}
+
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		after, err := base64.RawURLEncoding.DecodeString(raw)
+		if err != nil || len(after) == 0 {
+			return pageRequest{}, errors.New("invalid cursor")
+		}
+		page.after = string(after)
+	}
+
+	return page, nil
+}
+
+// paginate sorts keys and returns the page after the cursor, along with the
+// cursor for the next page. Cursors name the last key served rather than an
+// offset, so keys added or removed between requests do not shift pages.
+func paginate(keys []string, page pageRequest) ([]string, string) {
+	keys = append(make([]string, 0, len(keys)), keys...)
+	slices.Sort(keys)
+
+	start, _ := slices.BinarySearch(keys, page.after)
+	if start < len(keys) && page.after != "" && keys[start] == page.after {
+		start++
+	}
+	keys = keys[start:]
+
+	if len(keys) <= page.limit {
+		return keys, ""
+	}
+	keys = keys[:page.limit]
+	return keys, base64.RawURLEncoding.EncodeToString([]byte(keys[len(keys)-1]))
+}
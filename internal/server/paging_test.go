@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestListURLsPagination(t *testing.T) {
+	db := newMockDB()
+	for _, code := range []string{"page003", "page001", "page002"} {
+		if err := db.CreateShortURL(context.Background(), code, "https://example.com/"+code, redisdb.CreateOptions{Tags: []string{"paged"}}); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	h := (&Server{db: db}).RegisterRoutes()
+
+	fetch := func(query url.Values) (int, pagedResponse[urlStatsView]) {
+		query.Set("tag", "paged")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls?"+query.Encode(), nil))
+		var page pagedResponse[urlStatsView]
+		if res.Code == http.StatusOK {
+			if err := json.Unmarshal(res.Body.Bytes(), &page); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+		}
+		return res.Code, page
+	}
+	codes := func(page pagedResponse[urlStatsView]) []string {
+		var out []string
+		for _, item := range page.Items {
+			out = append(out, item.Code)
+		}
+		return out
+	}
+
+	status, first := fetch(url.Values{"limit": {"2"}})
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	if !slices.Equal(codes(first), []string{"page001", "page002"}) || !first.HasMore || first.NextCursor == "" {
+		t.Fatalf("unexpected first page: %v has_more=%v cursor=%q", codes(first), first.HasMore, first.NextCursor)
+	}
+
+	// A link created between pages sorts before the cursor and must not
+	// shift the second page.
+	if err := db.CreateShortURL(context.Background(), "page000", "https://example.com/new", redisdb.CreateOptions{Tags: []string{"paged"}}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	status, second := fetch(url.Values{"limit": {"2"}, "cursor": {first.NextCursor}})
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	if !slices.Equal(codes(second), []string{"page003"}) || second.HasMore || second.NextCursor != "" {
+		t.Fatalf("unexpected second page: %v has_more=%v cursor=%q", codes(second), second.HasMore, second.NextCursor)
+	}
+
+	for _, query := range []url.Values{
+		{"limit": {"0"}},
+		{"limit": {"500"}},
+		{"cursor": {"%%%"}},
+	} {
+		if status, _ := fetch(query); status != http.StatusBadRequest {
+			t.Fatalf("%v: expected status %d, got %d", query, http.StatusBadRequest, status)
+		}
+	}
+}
+
+func TestListGroupsPagination(t *testing.T) {
+	db := newMockDB()
+	for _, group := range []string{"beta", "alpha", "gamma"} {
+		if err := db.CreateShortURL(context.Background(), "grp-"+group, "https://example.com", redisdb.CreateOptions{Group: group}); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	h := (&Server{db: db}).RegisterRoutes()
+
+	var seen []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatal("expected listing to finish within three pages")
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/groups?limit=2&cursor="+cursor, nil))
+		var page pagedResponse[string]
+		if err := json.Unmarshal(res.Body.Bytes(), &page); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		seen = append(seen, page.Items...)
+		if !page.HasMore {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	if !slices.Equal(seen, []string{"alpha", "beta", "gamma"}) {
+		t.Fatalf("expected every group exactly once, got %v", seen)
+	}
+}
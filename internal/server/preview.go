@@ -0,0 +1,63 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+type previewResponse struct {
+	Code        string `json:"code"`
+	URL         string `json:"url,omitempty"`
+	Host        string `json:"host,omitempty"`
+	FaviconURL  string `json:"favicon_url,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+}
+
+// previewHandler describes where a code leads without redirecting, so chat
+// clients can unfurl it. It only reads stored metadata and never counts as a
+// visit.
+func (s *Server) previewHandler(w http.ResponseWriter, r *http.Request) {
+	code := s.pathCode(r)
+	if code == "" {
+		s.writeError(w, http.StatusNotFound, "short code not found")
+		return
+	}
+
+	stats, err := s.sharedStats(r.Context(), code)
+	if err != nil {
+		if errors.Is(err, redisdb.ErrNotFound) {
+			s.writeError(w, http.StatusNotFound, "short code not found")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch URL preview")
+		return
+	}
+	if stats.Consumed {
+		s.writeError(w, http.StatusGone, "short url already used")
+		return
+	}
+
+	response := previewResponse{
+		Code:        code,
+		Title:       stats.Title,
+		Description: stats.Description,
+		Image:       stats.Image,
+	}
+	if stats = s.readerStats(r, stats); stats.LongURL == "" {
+		// A one-time link's destination is only shown to its owner.
+		s.writeJSON(w, http.StatusOK, response)
+		return
+	}
+	response.URL = stats.LongURL
+	if target, err := url.Parse(stats.LongURL); err == nil && target.Host != "" {
+		response.Host = target.Hostname()
+		response.FaviconURL = (&url.URL{Scheme: target.Scheme, Host: target.Host, Path: "/favicon.ico"}).String()
+	}
+
+	s.writeJSON(w, http.StatusOK, response)
+}
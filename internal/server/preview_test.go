@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestPreviewReturnsStoredMetadata(t *testing.T) {
+	db := newMockDB()
+	opts := redisdb.CreateOptions{Title: "Launch Day", Description: "Everything we shipped"}
+	if err := db.CreateShortURL(context.Background(), "prev001", "https://blog.example.com:8443/launch?ref=x", opts); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if err := db.SetMetadata(context.Background(), "prev001", "", "", "https://cdn.example.com/launch.png"); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	s := &Server{db: db}
+	res := httptest.NewRecorder()
+	s.RegisterRoutes().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/prev001/preview", nil))
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+
+	var body previewResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	want := previewResponse{
+		Code:        "prev001",
+		URL:         "https://blog.example.com:8443/launch?ref=x",
+		Host:        "blog.example.com",
+		FaviconURL:  "https://blog.example.com:8443/favicon.ico",
+		Title:       "Launch Day",
+		Description: "Everything we shipped",
+		Image:       "https://cdn.example.com/launch.png",
+	}
+	if body != want {
+		t.Fatalf("unexpected preview:\n got %+v\nwant %+v", body, want)
+	}
+
+	stats, _ := db.GetStats(context.Background(), "prev001")
+	if stats.Visits != 0 {
+		t.Fatalf("expected preview not to count as a visit, got %d", stats.Visits)
+	}
+}
+
+func TestPreviewWithoutMetadata(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "prev002", "https://example.com/", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/prev002/preview", nil))
+	var body map[string]any
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if body["url"] != "https://example.com/" || body["host"] != "example.com" {
+		t.Fatalf("expected destination in preview, got %v", body)
+	}
+	for _, field := range []string{"title", "description", "image"} {
+		if _, ok := body[field]; ok {
+			t.Fatalf("expected %s to be omitted, got %v", field, body[field])
+		}
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/missing/preview", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, res.Code)
+	}
+}
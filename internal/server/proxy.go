@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// remoteIP returns the address of the peer that sent r.
+func remoteIP(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+// fromTrustedProxy reports whether r arrived directly from one of the
+// TRUSTED_PROXIES networks, whose forwarding headers may be believed.
+func (s *Server) fromTrustedProxy(r *http.Request) bool {
+	if len(s.trustedProxies) == 0 {
+		return false
+	}
+	ip, ok := remoteIP(r)
+	return ok && s.trustedProxy(ip)
+}
+
+// trustedProxy reports whether ip is in one of the TRUSTED_PROXIES networks.
+func (s *Server) trustedProxy(ip netip.Addr) bool {
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client behind r. Behind a trusted
+// proxy that is the last X-Forwarded-For hop the proxies did not add
+// themselves; otherwise, or when the header is missing or malformed, it is
+// the peer address.
+func (s *Server) clientIP(r *http.Request) (netip.Addr, bool) {
+	peer, ok := remoteIP(r)
+	if !ok || !s.fromTrustedProxy(r) {
+		return peer, ok
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return peer, true
+		}
+		ip = ip.Unmap()
+		if !s.trustedProxy(ip) {
+			return ip, true
+		}
+	}
+	return peer, true
+}
+
+// requestHost returns the public host the client used. Behind a trusted proxy
+// that is the first X-Forwarded-Host entry; otherwise, or when the header is
+// missing or malformed, it is r.Host.
+func (s *Server) requestHost(r *http.Request) string {
+	if !s.fromTrustedProxy(r) {
+		return r.Host
+	}
+	forwarded, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Host"), ",")
+	forwarded = strings.TrimSpace(forwarded)
+	if !validHost(forwarded) {
+		return r.Host
+	}
+	return forwarded
+}
+
+// requestScheme returns the scheme the client used: https for TLS
+// connections, the first X-Forwarded-Proto entry behind a trusted proxy, and
+// http otherwise.
+func (s *Server) requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if s.fromTrustedProxy(r) {
+		forwarded, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+		if strings.EqualFold(strings.TrimSpace(forwarded), "https") {
+			return "https"
+		}
+	}
+	return "http"
+}
+
+// validHost reports whether host is a bare host[:port] with nothing that
+// could smuggle a path, query, or credentials into a generated URL.
+func validHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	parsed, err := url.Parse("//" + host)
+	return err == nil && parsed.Host == host && parsed.User == nil && parsed.Path == "" && parsed.Hostname() != ""
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestShortURLHonorsForwardedHostFromTrustedProxy(t *testing.T) {
+	s := &Server{db: newMockDB(), trustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	h := s.RegisterRoutes()
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{name: "trusted proxy", remote: "10.1.2.3:5555", forwarded: "sho.rt", want: "http://sho.rt/"},
+		{name: "trusted proxy with list", remote: "10.1.2.3:5555", forwarded: "sho.rt:8443, internal.svc", want: "http://sho.rt:8443/"},
+		{name: "untrusted client", remote: "203.0.113.9:5555", forwarded: "evil.example", want: "http://short.local/"},
+		{name: "malformed header", remote: "10.1.2.3:5555", forwarded: "sho.rt/phish?x=", want: "http://short.local/"},
+		{name: "no header", remote: "10.1.2.3:5555", want: "http://short.local/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBufferString(`{"url":"https://example.com"}`))
+			req.Host = "short.local"
+			req.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-Host", tt.forwarded)
+			}
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+
+			if res.Code != http.StatusCreated {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, res.Code, res.Body.String())
+			}
+			var out createShortURLResponse
+			if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if out.ShortURL != tt.want+out.ShortCode {
+				t.Fatalf("expected short_url %q, got %q", tt.want+out.ShortCode, out.ShortURL)
+			}
+		})
+	}
+}
+
+func TestShortURLHonorsForwardedProtoFromTrustedProxy(t *testing.T) {
+	s := &Server{db: newMockDB(), trustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	h := s.RegisterRoutes()
+
+	tests := []struct {
+		name   string
+		remote string
+		proto  string
+		want   string
+	}{
+		{name: "trusted proxy", remote: "10.1.2.3:5555", proto: "https", want: "https://short.local/"},
+		{name: "trusted proxy with list", remote: "10.1.2.3:5555", proto: "https, http", want: "https://short.local/"},
+		{name: "untrusted client", remote: "203.0.113.9:5555", proto: "https", want: "http://short.local/"},
+		{name: "unknown scheme", remote: "10.1.2.3:5555", proto: "javascript", want: "http://short.local/"},
+		{name: "unknown scheme from untrusted client", remote: "203.0.113.9:5555", proto: "javascript", want: "http://short.local/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBufferString(`{"url":"https://example.com"}`))
+			req.Host = "short.local"
+			req.RemoteAddr = tt.remote
+			req.Header.Set("X-Forwarded-Proto", tt.proto)
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+
+			if res.Code != http.StatusCreated {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, res.Code, res.Body.String())
+			}
+			var out createShortURLResponse
+			if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if out.ShortURL != tt.want+out.ShortCode {
+				t.Fatalf("expected short_url %q, got %q", tt.want+out.ShortCode, out.ShortURL)
+			}
+		})
+	}
+}
+
+func TestSelfReferentialCheckUsesForwardedHost(t *testing.T) {
+	s := &Server{db: newMockDB(), trustedProxies: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}}
+	h := s.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBufferString(`{"url":"https://sho.rt/abc"}`))
+	req.Host = "backend:8080"
+	req.RemoteAddr = "127.0.0.1:5555"
+	req.Header.Set("X-Forwarded-Host", "sho.rt")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for a target on the public host, got %d", http.StatusBadRequest, res.Code)
+	}
+}
+
+func TestClientIPFromTrustedProxy(t *testing.T) {
+	s := &Server{trustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{name: "direct client", remote: "203.0.113.9:5555", want: "203.0.113.9"},
+		{name: "untrusted client spoofing", remote: "203.0.113.9:5555", forwarded: "198.51.100.1", want: "203.0.113.9"},
+		{name: "trusted proxy", remote: "10.1.2.3:5555", forwarded: "198.51.100.1", want: "198.51.100.1"},
+		{name: "client-supplied hop ignored", remote: "10.1.2.3:5555", forwarded: "1.2.3.4, 198.51.100.1, 10.0.0.5", want: "198.51.100.1"},
+		{name: "malformed hop", remote: "10.1.2.3:5555", forwarded: "198.51.100.1, bogus", want: "10.1.2.3"},
+		{name: "no header", remote: "10.1.2.3:5555", want: "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			ip, ok := s.clientIP(req)
+			if !ok || ip.String() != tt.want {
+				t.Fatalf("expected %s, got %s (%v)", tt.want, ip, ok)
+			}
+		})
+	}
+}
+
+func TestVisitBurstLimitPerForwardedClient(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "burst02", "https://example.com", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	s := &Server{
+		db:               db,
+		visitBurstLimit:  2,
+		visitBurstWindow: time.Minute,
+		trustedProxies:   []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	}
+	h := s.RegisterRoutes()
+
+	visit := func(client string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/burst02", nil)
+		req.RemoteAddr = "10.0.0.1:5555"
+		req.Header.Set("X-Forwarded-For", client)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if res.Code != http.StatusFound {
+			t.Fatalf("expected every visit to redirect, got %d", res.Code)
+		}
+	}
+
+	for range 3 {
+		visit("203.0.113.7")
+	}
+	visit("198.51.100.2")
+	visit("198.51.100.3")
+
+	if got := db.store["burst02"].Visits; got != 4 {
+		t.Fatalf("expected the burst limit to apply per forwarded client, got %d visits", got)
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// globalRateLimited counts requests rejected by the global rate limit.
+	globalRateLimited = expvar.NewInt("global_rate_limited")
+	// clientRateLimited counts requests rejected by the per-client limit.
+	clientRateLimited = expvar.NewInt("client_rate_limited")
+)
+
+const (
+	defaultRateLimitWindow = time.Minute
+	// rateLimitWarnInterval spaces out the warnings logged while the
+	// per-client limit cannot reach Redis.
+	rateLimitWarnInterval = time.Minute
+)
+
+// tokenBucket is a lock-free token bucket holding up to burst tokens that
+// refill at rate per second. It is kept as a single theoretical arrival time
+// (GCRA): each allowed request pushes tat one interval further, and a request
+// is refused while tat is more than burst intervals ahead of now. Concurrent
+// callers race on one atomic compare-and-swap instead of a mutex.
+type tokenBucket struct {
+	interval  int64 // nanoseconds per token
+	tolerance int64 // how far tat may run ahead of now
+	tat       atomic.Int64
+}
+
+func newTokenBucket(rate, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = rate
+	}
+	interval := int64(time.Second) / int64(rate)
+	return &tokenBucket{interval: interval, tolerance: interval * int64(burst)}
+}
+
+// allow takes a token at now. When none is left it returns false and how long
+// until the next one.
+func (b *tokenBucket) allow(now time.Time) (bool, time.Duration) {
+	t := now.UnixNano()
+	for {
+		tat := b.tat.Load()
+		next := max(tat, t) + b.interval
+		if ahead := next - t; ahead > b.tolerance {
+			return false, time.Duration(ahead - b.tolerance)
+		}
+		if b.tat.CompareAndSwap(tat, next) {
+			return true, 0
+		}
+	}
+}
+
+// healthPattern is the health probe route, which the global rate limit never
+// applies to so an overloaded instance is not also marked dead.
+const healthPattern = "GET /health"
+
+// globalRateLimit wraps next so it answers 429 once the process-wide request
+// rate exceeds GLOBAL_RATE_LIMIT, whatever the clients. Every wrapped route
+// draws from the same bucket.
+func (s *Server) globalRateLimit(next http.HandlerFunc) http.HandlerFunc {
+	if s.globalLimiter == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := s.globalLimiter.allow(time.Now()); !ok {
+			globalRateLimited.Add(1)
+			w.Header().Set("Retry-After", retryAfterSeconds(wait))
+			s.writeError(w, http.StatusTooManyRequests, "server request rate exceeded, retry later")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// globalRateLimitInterceptor applies the same limit, and the same bucket, to
+// gRPC calls.
+func (s *Server) globalRateLimitInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if s.globalLimiter != nil {
+		if ok, _ := s.globalLimiter.allow(time.Now()); !ok {
+			globalRateLimited.Add(1)
+			return nil, status.Error(codes.ResourceExhausted, "server request rate exceeded, retry later")
+		}
+	}
+	return handler(ctx, req)
+}
+
+// clientRateLimit wraps the route registered as pattern so each client IP
+// gets RATE_LIMIT requests to it per RATE_LIMIT_WINDOW. The counts live in
+// Redis and are shared by every instance behind the load balancer. When
+// Redis cannot be asked, requests are let through with a warning rather than
+// refused.
+func (s *Server) clientRateLimit(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	if s.rateLimit <= 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip, ok := s.clientIP(r)
+		if !ok {
+			next(w, r)
+			return
+		}
+		allowed, wait, err := s.db.AllowRequest(r.Context(), pattern+"|"+ip.String(), int64(s.rateLimit), s.rateLimitWindow)
+		if err != nil {
+			s.warnRateLimitUnavailable(err)
+			next(w, r)
+			return
+		}
+		if !allowed {
+			clientRateLimited.Add(1)
+			w.Header().Set("Retry-After", retryAfterSeconds(wait))
+			s.writeError(w, http.StatusTooManyRequests, "rate limit exceeded, retry later")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// warnRateLimitUnavailable logs that the per-client limit is failing open,
+// at most once per rateLimitWarnInterval.
+func (s *Server) warnRateLimitUnavailable(err error) {
+	now := time.Now().UnixNano()
+	last := s.rateLimitWarned.Load()
+	if now-last < int64(rateLimitWarnInterval) || !s.rateLimitWarned.CompareAndSwap(last, now) {
+		return
+	}
+	log.Printf("rate limit unavailable, allowing requests: %v", err)
+}
+
+// retryAfterSeconds rounds wait up to whole seconds, at least 1.
+func retryAfterSeconds(wait time.Duration) string {
+	seconds := int64((wait + time.Second - 1) / time.Second)
+	return strconv.FormatInt(max(seconds, 1), 10)
+}
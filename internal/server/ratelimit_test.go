@@ -0,0 +1,148 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestTokenBucketRefills(t *testing.T) {
+	b := newTokenBucket(10, 3)
+	now := time.Unix(1700000000, 0)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.allow(now); !ok {
+			t.Fatalf("expected request %d of the burst to pass", i+1)
+		}
+	}
+	ok, wait := b.allow(now)
+	if ok || wait != 100*time.Millisecond {
+		t.Fatalf("expected an empty bucket with a 100ms wait, got ok=%v wait=%v", ok, wait)
+	}
+
+	if ok, _ := b.allow(now.Add(100 * time.Millisecond)); !ok {
+		t.Fatal("expected one token to refill after 100ms")
+	}
+	if ok, _ := b.allow(now.Add(100 * time.Millisecond)); ok {
+		t.Fatal("expected only one token to refill after 100ms")
+	}
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.allow(now.Add(time.Hour)); !ok {
+			t.Fatal("expected an idle bucket to refill to its burst")
+		}
+	}
+	if ok, _ := b.allow(now.Add(time.Hour)); ok {
+		t.Fatal("expected an idle bucket to hold no more than its burst")
+	}
+}
+
+func TestGlobalRateLimitRejectsOverRate(t *testing.T) {
+	const burst = 5
+
+	db := newMockDB()
+	db.store["hot0001"] = redisdb.URLStats{Code: "hot0001", LongURL: "https://docs.example.org", CreatedAt: time.Now().UTC()}
+	// One token a minute: nothing refills while the test runs.
+	s := &Server{db: db, globalLimiter: newTokenBucket(1, burst)}
+	s.globalLimiter.interval = int64(time.Minute)
+	s.globalLimiter.tolerance = int64(time.Minute) * burst
+	h := s.RegisterRoutes()
+
+	before := globalRateLimited.Value()
+	var mu sync.Mutex
+	counts := map[int]int{}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/version", nil))
+			mu.Lock()
+			counts[res.Code]++
+			mu.Unlock()
+			if res.Code == http.StatusTooManyRequests && res.Header().Get("Retry-After") == "" {
+				t.Error("expected Retry-After on a rate-limited response")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if counts[http.StatusOK] != burst || counts[http.StatusTooManyRequests] != 20-burst {
+		t.Fatalf("expected %d successes and %d rejections, got %v", burst, 20-burst, counts)
+	}
+	if got := globalRateLimited.Value() - before; got != 20-burst {
+		t.Fatalf("expected global_rate_limited to grow by %d, got %d", 20-burst, got)
+	}
+
+	// Every route shares the bucket, except the health probe.
+	for _, path := range []string{"/hot0001", "/api/v1/urls/hot0001", "/"} {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+		if res.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected %s to be limited too, got %d", path, res.Code)
+		}
+	}
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected /health to bypass the limit, got %d", res.Code)
+	}
+}
+
+func TestClientRateLimitSharedAcrossInstances(t *testing.T) {
+	// Both instances talk to the same store, as they would to one Redis.
+	db := newMockDB()
+	a := (&Server{db: db, rateLimit: 3, rateLimitWindow: time.Minute}).RegisterRoutes()
+	b := (&Server{db: db, rateLimit: 3, rateLimitWindow: time.Minute}).RegisterRoutes()
+
+	get := func(h http.Handler, path, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remote
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	for i, h := range []http.Handler{a, b, a} {
+		if res := get(h, "/version", "198.51.100.7:4000"); res.Code != http.StatusOK {
+			t.Fatalf("expected request %d to pass, got %d", i+1, res.Code)
+		}
+	}
+	before := clientRateLimited.Value()
+	res := get(b, "/version", "198.51.100.7:4001")
+	if res.Code != http.StatusTooManyRequests || res.Header().Get("Retry-After") != "60" {
+		t.Fatalf("expected the other instance to see the shared count, got %d (Retry-After %q)", res.Code, res.Header().Get("Retry-After"))
+	}
+	if clientRateLimited.Value()-before != 1 {
+		t.Fatal("expected client_rate_limited to count the rejection")
+	}
+
+	if res := get(a, "/version", "198.51.100.8:4000"); res.Code != http.StatusOK {
+		t.Fatalf("expected another client to have its own allowance, got %d", res.Code)
+	}
+	if res := get(a, "/robots.txt", "198.51.100.7:4000"); res.Code != http.StatusOK {
+		t.Fatalf("expected another route to have its own allowance, got %d", res.Code)
+	}
+	if res := get(a, "/health", "198.51.100.7:4000"); res.Code != http.StatusOK {
+		t.Fatalf("expected /health to bypass the limit, got %d", res.Code)
+	}
+}
+
+func TestClientRateLimitFailsOpen(t *testing.T) {
+	db := newMockDB()
+	db.rateErr = errors.New("dial tcp: connection refused")
+	h := (&Server{db: db, rateLimit: 1, rateLimitWindow: time.Minute}).RegisterRoutes()
+
+	for range 3 {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/version", nil))
+		if res.Code != http.StatusOK {
+			t.Fatalf("expected requests through while Redis is down, got %d", res.Code)
+		}
+	}
+}
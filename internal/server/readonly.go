@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+// readOnlyRetryAfter is the Retry-After value, in seconds, sent with writes
+// refused while Redis is read-only.
+const readOnlyRetryAfter = "30"
+
+// noteWrite tracks whether Redis is accepting writes. A refused write puts the
+// server in read-only mode, where creates fail fast with 503 and redirects are
+// served from plain reads; the next successful write leaves it again.
+func (s *Server) noteWrite(err error) {
+	switch {
+	case err == nil:
+		if s.readOnly.Swap(false) {
+			log.Print("redis is accepting writes again, leaving read-only mode")
+		}
+	case errors.Is(err, redisdb.ErrReadOnly):
+		if !s.readOnly.Swap(true) {
+			log.Printf("redis refused a write, entering read-only mode: %v", err)
+		}
+	}
+}
+
+// writeReadOnlyError answers a write that Redis refused.
+func (s *Server) writeReadOnlyError(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", readOnlyRetryAfter)
+	s.writeError(w, http.StatusServiceUnavailable, "service is temporarily read-only: links cannot be created or changed, existing links still redirect")
+}
+
+// resolveWithoutVisit resolves code for visit with reads only, for redirects
+// while Redis refuses writes. The visit goes uncounted, and one-time links are
+// refused because they cannot be consumed.
+func (s *Server) resolveWithoutVisit(ctx context.Context, code string, visit redisdb.Visit) (redisdb.ResolvedURL, error) {
+	stats, err := s.sharedStats(ctx, code)
+	if err != nil {
+		return redisdb.ResolvedURL{}, err
+	}
+	if stats.Consumed {
+		return redisdb.ResolvedURL{}, redisdb.ErrGone
+	}
+	if stats.Disabled || stats.StartsAt != nil && stats.StartsAt.After(time.Now()) {
+		return redisdb.ResolvedURL{}, redisdb.ErrNotActive
+	}
+	if stats.RequireHTTPS && visit.PlainHTTP {
+		return redisdb.ResolvedURL{}, redisdb.ErrInsecure
+	}
+	if stats.OneTime {
+		return redisdb.ResolvedURL{}, redisdb.ErrReadOnly
+	}
+
+	resolved := redisdb.ResolvedURL{ForwardQuery: stats.ForwardQuery, InterstitialSeconds: stats.InterstitialSeconds}
+	resolved.URL, resolved.Variant = pickVariant(stats, visit)
+	if stats.TTLSeconds != nil {
+		resolved.TTL = time.Duration(*stats.TTLSeconds) * time.Second
+	}
+	return resolved, nil
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+// readOnlyDB refuses writes the way the Redis client reports a read-only
+// replica while refuse is set.
+type readOnlyDB struct {
+	*mockDB
+	refuse bool
+}
+
+var errReplicaReadOnly = fmt.Errorf("%w: READONLY You can't write against a read only replica.", redisdb.ErrReadOnly)
+
+func (d *readOnlyDB) CreateShortURL(ctx context.Context, code, longURL string, opts redisdb.CreateOptions) error {
+	if d.refuse {
+		return errReplicaReadOnly
+	}
+	return d.mockDB.CreateShortURL(ctx, code, longURL, opts)
+}
+
+func (d *readOnlyDB) VisitURL(ctx context.Context, code string, visit redisdb.Visit) (redisdb.ResolvedURL, error) {
+	if d.refuse {
+		return redisdb.ResolvedURL{}, errReplicaReadOnly
+	}
+	return d.mockDB.VisitURL(ctx, code, visit)
+}
+
+func (d *readOnlyDB) DeleteShortURL(ctx context.Context, code string) error {
+	if d.refuse {
+		return errReplicaReadOnly
+	}
+	return d.mockDB.DeleteShortURL(ctx, code)
+}
+
+func (d *readOnlyDB) RotateCode(ctx context.Context, oldCode, newCode string) error {
+	if d.refuse {
+		return errReplicaReadOnly
+	}
+	return d.mockDB.RotateCode(ctx, oldCode, newCode)
+}
+
+func (d *readOnlyDB) AddTags(ctx context.Context, code string, tags []string) error {
+	if d.refuse {
+		return errReplicaReadOnly
+	}
+	return d.mockDB.AddTags(ctx, code, tags)
+}
+
+func (d *readOnlyDB) SetExpiration(ctx context.Context, code string, ttl time.Duration) error {
+	if d.refuse {
+		return errReplicaReadOnly
+	}
+	return d.mockDB.SetExpiration(ctx, code, ttl)
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	db := &readOnlyDB{mockDB: newMockDB()}
+	db.store["docs01"] = redisdb.URLStats{Code: "docs01", LongURL: "https://example.com/docs", CreatedAt: time.Now().UTC()}
+	db.store["once001"] = redisdb.URLStats{Code: "once001", LongURL: "https://example.com/once", CreatedAt: time.Now().UTC(), OneTime: true}
+
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	create := func() *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		body := bytes.NewBufferString(`{"url":"https://docs.example.org/new"}`)
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", body))
+		return res
+	}
+	readOnlyHealth := func() string {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/health", nil))
+		var payload map[string]string
+		if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("failed to decode health: %v", err)
+		}
+		return payload["read_only"]
+	}
+
+	if got := readOnlyHealth(); got != "false" {
+		t.Fatalf("expected read_only=false before any failure, got %q", got)
+	}
+
+	db.refuse = true
+	res := create()
+	if res.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected create status %d, got %d: %s", http.StatusServiceUnavailable, res.Code, res.Body.String())
+	}
+	if res.Header().Get("Retry-After") == "" {
+		t.Fatal("expected Retry-After on refused creates")
+	}
+	if got := readOnlyHealth(); got != "true" {
+		t.Fatalf("expected read_only=true after a refused write, got %q", got)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/docs01", nil))
+	if res.Code != http.StatusFound || res.Header().Get("Location") != "https://example.com/docs" {
+		t.Fatalf("expected redirects to keep working, got %d to %q", res.Code, res.Header().Get("Location"))
+	}
+	if db.store["docs01"].Visits != 0 {
+		t.Fatalf("expected read-only redirects not to count visits, got %d", db.store["docs01"].Visits)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/once001", nil))
+	if res.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected one-time links to be unavailable, got %d", res.Code)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown codes to stay 404, got %d", res.Code)
+	}
+
+	db.refuse = false
+	if res := create(); res.Code != http.StatusCreated {
+		t.Fatalf("expected create to recover, got %d: %s", res.Code, res.Body.String())
+	}
+	if got := readOnlyHealth(); got != "false" {
+		t.Fatalf("expected read_only=false after a successful write, got %q", got)
+	}
+}
+
+func TestReadOnlyModeLinkWrites(t *testing.T) {
+	db := &readOnlyDB{mockDB: newMockDB()}
+	db.store["docs01"] = redisdb.URLStats{Code: "docs01", LongURL: "https://example.com/docs", CreatedAt: time.Now().UTC()}
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	writes := []struct {
+		method, path, body string
+	}{
+		{http.MethodPatch, "/api/v1/urls/docs01/expiration", `{"expiration_days":7}`},
+		{http.MethodPost, "/api/v1/urls/docs01/tags", `{"tags":["docs"]}`},
+		{http.MethodPost, "/api/v1/urls/docs01/rotate", `{"custom_alias":"docs02"}`},
+		{http.MethodDelete, "/api/v1/urls/docs02", ``},
+	}
+	for _, write := range writes {
+		db.refuse = true
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(write.method, write.path, bytes.NewBufferString(write.body)))
+		if res.Code != http.StatusServiceUnavailable {
+			t.Fatalf("%s %s: expected status %d, got %d: %s", write.method, write.path, http.StatusServiceUnavailable, res.Code, res.Body.String())
+		}
+		if !s.readOnly.Load() {
+			t.Fatalf("%s %s: expected a refused write to turn on read-only mode", write.method, write.path)
+		}
+
+		db.refuse = false
+		res = httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(write.method, write.path, bytes.NewBufferString(write.body)))
+		if res.Code >= 300 {
+			t.Fatalf("%s %s: expected the write to recover, got %d: %s", write.method, write.path, res.Code, res.Body.String())
+		}
+		if s.readOnly.Load() {
+			t.Fatalf("%s %s: expected a successful write to turn off read-only mode", write.method, write.path)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+const maxReserveBatchSize = 100
+
+const (
+	reservationReserved = "reserved"
+	reservationConflict = "conflict"
+	reservationInvalid  = "invalid"
+)
+
+type reserveAliasesRequest struct {
+	Aliases []string `json:"aliases"`
+}
+
+type reservationResult struct {
+	Alias  string `json:"alias"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type reserveAliasesResponse struct {
+	Results  []reservationResult `json:"results"`
+	Reserved int                 `json:"reserved"`
+}
+
+// reserveAliasesHandler holds a batch of vanity aliases for the caller before
+// their destinations are known. Every valid, free alias is reserved in one
+// atomic step; the rest are reported per alias as invalid or conflict rather
+// than failing the batch. A reserved alias answers 404 until a shorten
+// request from the same API key claims it with custom_alias, and is released
+// after redisdb.ReservationTTL if it never is. Reservations count toward the
+// owner's link quota, so a batch that does not fit is refused whole.
+func (s *Server) reserveAliasesHandler(w http.ResponseWriter, r *http.Request) {
+	var req reserveAliasesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if len(req.Aliases) == 0 {
+		s.writeError(w, http.StatusBadRequest, "aliases must not be empty")
+		return
+	}
+	if len(req.Aliases) > maxReserveBatchSize {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d aliases per request", maxReserveBatchSize))
+		return
+	}
+
+	results := make([]reservationResult, 0, len(req.Aliases))
+	var valid []string
+	seen := make(map[string]bool, len(req.Aliases))
+	for _, raw := range req.Aliases {
+		alias, err := s.qualifyAlias(s.canonicalCode(raw))
+		if seen[alias] {
+			continue
+		}
+		seen[alias] = true
+
+		if err != nil {
+			results = append(results, reservationResult{Alias: alias, Status: reservationInvalid, Error: err.Error()})
+			continue
+		}
+		results = append(results, reservationResult{Alias: alias})
+		valid = append(valid, alias)
+	}
+
+	owner := ownerFromRequest(r)
+	remaining, limited, err := s.ownerQuotaRemaining(r.Context(), owner)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to check link quota")
+		return
+	}
+	if limited && int64(len(valid)) > remaining {
+		s.writeError(w, http.StatusTooManyRequests, "link quota exceeded")
+		return
+	}
+
+	reserved, err := s.db.ReserveAliases(r.Context(), valid, owner)
+	s.noteWrite(err)
+	if err != nil {
+		if errors.Is(err, redisdb.ErrReadOnly) {
+			s.writeReadOnlyError(w)
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to reserve aliases")
+		return
+	}
+
+	response := reserveAliasesResponse{Results: results}
+	for i, result := range response.Results {
+		if result.Status == reservationInvalid {
+			continue
+		}
+		if reserved[result.Alias] {
+			response.Results[i].Status = reservationReserved
+			response.Reserved++
+		} else {
+			response.Results[i].Status = reservationConflict
+		}
+	}
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+// fillsReservation reports whether alias names a reservation, which already
+// counts toward its owner's link quota.
+func (s *Server) fillsReservation(ctx context.Context, alias string) bool {
+	if alias == "" {
+		return false
+	}
+	alias, err := s.qualifyAlias(s.canonicalCode(alias))
+	if err != nil {
+		return false
+	}
+	reserved, err := s.db.IsReserved(ctx, alias)
+	return err == nil && reserved
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestReserveAndFillAliases(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "taken01", "https://example.com/taken", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	h := (&Server{db: db}).RegisterRoutes()
+
+	post := func(path, body, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Host = "short.local"
+		if apiKey != "" {
+			req.Header.Set(apiKeyHeader, apiKey)
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	res := post("/api/v1/aliases/reserve", `{"aliases":["spring-sale","summer-sale","taken01","no!","health","spring-sale"]}`, "campaign-key")
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+	var reserved reserveAliasesResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &reserved); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	want := map[string]string{
+		"spring-sale": reservationReserved,
+		"summer-sale": reservationReserved,
+		"taken01":     reservationConflict,
+		"no!":         reservationInvalid,
+		"health":      reservationInvalid,
+	}
+	if len(reserved.Results) != len(want) || reserved.Reserved != 2 {
+		t.Fatalf("expected %d results with 2 reserved, got %+v", len(want), reserved)
+	}
+	for _, result := range reserved.Results {
+		if want[result.Alias] != result.Status {
+			t.Fatalf("%s: expected %q, got %q", result.Alias, want[result.Alias], result.Status)
+		}
+	}
+
+	for _, path := range []string{"/spring-sale", "/api/v1/urls/spring-sale"} {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+		if res.Code != http.StatusNotFound {
+			t.Fatalf("%s: expected an unfilled reservation to answer 404, got %d", path, res.Code)
+		}
+	}
+
+	res = post("/api/v1/shorten", `{"url":"https://example.com/sale","custom_alias":"spring-sale"}`, "other-key")
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected another key's reservation to conflict, got %d: %s", res.Code, res.Body.String())
+	}
+	res = post("/api/v1/shorten", `{"url":"https://example.com/sale","custom_alias":"spring-sale","prefer_alias":true}`, "other-key")
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected prefer_alias to fall back past another key's reservation, got %d: %s", res.Code, res.Body.String())
+	}
+	var fallback createShortURLResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &fallback); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if fallback.ShortCode == "spring-sale" || fallback.Strategy != strategyFallback {
+		t.Fatalf("expected a generated fallback code, got %q (%s)", fallback.ShortCode, fallback.Strategy)
+	}
+	res = post("/api/v1/shorten", `{"url":"https://example.com/sale","custom_alias":"spring-sale"}`, "campaign-key")
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected the reserving key to fill the alias, got %d: %s", res.Code, res.Body.String())
+	}
+	var created createShortURLResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if created.ShortCode != "spring-sale" || created.Strategy != strategyReserved {
+		t.Fatalf("expected the reserved alias to be used, got %q (%s)", created.ShortCode, created.Strategy)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/spring-sale", nil))
+	if res.Code != http.StatusFound || res.Header().Get("Location") != "https://example.com/sale" {
+		t.Fatalf("expected the filled alias to redirect, got %d to %q", res.Code, res.Header().Get("Location"))
+	}
+
+	res = post("/api/v1/shorten", `{"url":"https://example.com/again","custom_alias":"spring-sale"}`, "campaign-key")
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected a filled alias to conflict, got %d", res.Code)
+	}
+
+	res = post("/api/v1/aliases/reserve", `{"aliases":[]}`, "")
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected an empty batch to be rejected, got %d", res.Code)
+	}
+}
+
+func TestReserveAliasesCountTowardQuota(t *testing.T) {
+	h := (&Server{db: newMockDB(), maxLinksPerOwner: 2}).RegisterRoutes()
+	post := func(path, body string) int {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set(apiKeyHeader, "squatter")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	if got := post("/api/v1/aliases/reserve", `{"aliases":["alias-a","alias-b","alias-c"]}`); got != http.StatusTooManyRequests {
+		t.Fatalf("expected a batch over the quota to be refused, got %d", got)
+	}
+	if got := post("/api/v1/aliases/reserve", `{"aliases":["alias-a","alias-b"]}`); got != http.StatusOK {
+		t.Fatalf("expected a batch within the quota to be reserved, got %d", got)
+	}
+	if got := post("/api/v1/shorten", `{"url":"https://docs.example.org/"}`); got != http.StatusTooManyRequests {
+		t.Fatalf("expected reservations to use up the quota, got %d", got)
+	}
+	if got := post("/api/v1/shorten", `{"url":"https://docs.example.org/","custom_alias":"alias-a"}`); got != http.StatusCreated {
+		t.Fatalf("expected filling a reservation not to need more quota, got %d", got)
+	}
+}
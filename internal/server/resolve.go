@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const maxResolveBatchSize = 100
+
+type resolveBatchRequest struct {
+	Codes []string `json:"codes"`
+}
+
+type resolvedCode struct {
+	LongURL  string `json:"long_url,omitempty"`
+	NotFound bool   `json:"not_found,omitempty"`
+}
+
+type resolveBatchResponse struct {
+	URLs map[string]resolvedCode `json:"urls"`
+}
+
+// resolveBatchHandler looks up the destinations of up to maxResolveBatchSize
+// codes in one Redis round trip, for clients such as browser extensions that
+// show where every short link on a page leads. It is a read: visits are not
+// counted and one-time links are not consumed. Results are keyed by the
+// codes as sent.
+func (s *Server) resolveBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var req resolveBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if len(req.Codes) == 0 {
+		s.writeError(w, http.StatusBadRequest, "codes must not be empty")
+		return
+	}
+	if len(req.Codes) > maxResolveBatchSize {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d codes per request", maxResolveBatchSize))
+		return
+	}
+
+	lookups := make(map[string]string, len(req.Codes))
+	var codes []string
+	for _, raw := range req.Codes {
+		if _, ok := lookups[raw]; ok {
+			continue
+		}
+		code := s.lookupCode(raw)
+		lookups[raw] = code
+		if code != "" {
+			codes = append(codes, code)
+		}
+	}
+
+	found, err := s.db.GetLongURLs(r.Context(), codes)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to resolve short codes")
+		return
+	}
+
+	urls := make(map[string]resolvedCode, len(lookups))
+	for raw, code := range lookups {
+		if longURL, ok := found[code]; ok && code != "" {
+			urls[raw] = resolvedCode{LongURL: longURL}
+		} else {
+			urls[raw] = resolvedCode{NotFound: true}
+		}
+	}
+	s.writeJSON(w, http.StatusOK, resolveBatchResponse{URLs: urls})
+}
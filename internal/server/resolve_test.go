@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestResolveBatch(t *testing.T) {
+	db := newMockDB()
+	ctx := context.Background()
+	if err := db.CreateShortURL(ctx, "docs01", "https://docs.example.org/a", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if err := db.CreateShortURL(ctx, "once01", "https://docs.example.org/secret", redisdb.CreateOptions{OneTime: true}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	db.store["used01"] = redisdb.URLStats{Code: "used01", LongURL: "https://docs.example.org/used", OneTime: true, Consumed: true}
+	h := (&Server{db: db}).RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/resolve", strings.NewReader(`{"codes":["docs01","nope01","once01","used01","docs01"]}`)))
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body.String())
+	}
+	var out resolveBatchResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	want := map[string]resolvedCode{
+		"docs01": {LongURL: "https://docs.example.org/a"},
+		"once01": {NotFound: true},
+		"nope01": {NotFound: true},
+		"used01": {NotFound: true},
+	}
+	if len(out.URLs) != len(want) {
+		t.Fatalf("expected %d results, got %+v", len(want), out.URLs)
+	}
+	for code, result := range want {
+		if out.URLs[code] != result {
+			t.Fatalf("%s: expected %+v, got %+v", code, result, out.URLs[code])
+		}
+	}
+	if db.store["docs01"].Visits != 0 || db.store["once01"].Consumed {
+		t.Fatal("expected batch resolution not to count visits or consume one-time links")
+	}
+}
+
+func TestResolveBatchLimits(t *testing.T) {
+	h := (&Server{db: newMockDB()}).RegisterRoutes()
+	codes := make([]string, maxResolveBatchSize+1)
+	for i := range codes {
+		codes[i] = fmt.Sprintf("code%03d", i)
+	}
+	tooMany, _ := json.Marshal(resolveBatchRequest{Codes: codes})
+
+	for _, body := range []string{`{"codes":[]}`, `not json`, string(tooMany)} {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/resolve", strings.NewReader(body)))
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %.40q, got %d", body, res.Code)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+type rotateCodeRequest struct {
+	CustomAlias string `json:"custom_alias,omitempty"`
+}
+
+type rotateCodeResponse struct {
+	OldCode   string `json:"old_code"`
+	ShortCode string `json:"short_code"`
+	ShortURL  string `json:"short_url"`
+}
+
+// rotateCodeHandler moves a link to a new code, for when the old one has
+// leaked. Visits, analytics, tags and expiry move with it, and the old code
+// stops resolving. The new code is generated unless a custom_alias is given.
+func (s *Server) rotateCodeHandler(w http.ResponseWriter, r *http.Request) {
+	code := s.pathCode(r)
+	if code == "" {
+		s.writeError(w, http.StatusNotFound, "short code not found")
+		return
+	}
+
+	var req rotateCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+
+	exists, err := s.db.ShortCodeExists(r.Context(), code)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to rotate short code")
+		return
+	}
+	if !exists {
+		s.writeError(w, http.StatusNotFound, "short code not found")
+		return
+	}
+
+	newCode, _, err := s.resolveShortCode(r.Context(), req.CustomAlias, false, false)
+	if err != nil {
+		s.writeCodeError(w, err)
+		return
+	}
+
+	err = s.db.RotateCode(r.Context(), code, newCode)
+	s.noteWrite(err)
+	if err != nil {
+		switch {
+		case errors.Is(err, redisdb.ErrNotFound):
+			s.writeError(w, http.StatusNotFound, "short code not found")
+		case errors.Is(err, redisdb.ErrConflict):
+			s.writeError(w, http.StatusConflict, "short code already exists")
+		case errors.Is(err, redisdb.ErrReadOnly):
+			s.writeReadOnlyError(w)
+		default:
+			s.writeError(w, http.StatusInternalServerError, "failed to rotate short code")
+		}
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, rotateCodeResponse{
+		OldCode:   code,
+		ShortCode: newCode,
+		ShortURL:  fmt.Sprintf("%s/%s", s.shortBaseURL(r), newCode),
+	})
+}
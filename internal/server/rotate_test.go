@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestRotateCodeHandler(t *testing.T) {
+	db := newMockDB()
+	ctx := context.Background()
+	if err := db.CreateShortURL(ctx, "leak001", "https://example.com/secret", redisdb.CreateOptions{Tags: []string{"internal"}}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if err := db.CreateShortURL(ctx, "taken1", "https://example.com/other", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	for range 4 {
+		if _, err := db.VisitURL(ctx, "leak001", redisdb.Visit{Referrer: "news.example"}); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	h := (&Server{db: db}).RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/urls/leak001/rotate", nil)
+	req.Host = "short.local"
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+
+	var rotated rotateCodeResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &rotated); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if rotated.OldCode != "leak001" || rotated.ShortCode == "" || rotated.ShortCode == "leak001" {
+		t.Fatalf("unexpected rotation: %+v", rotated)
+	}
+	if rotated.ShortURL != "http://short.local/"+rotated.ShortCode {
+		t.Fatalf("unexpected short_url %q", rotated.ShortURL)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/leak001", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected the old code to stop resolving, got %d", res.Code)
+	}
+
+	stats, err := db.GetStats(ctx, rotated.ShortCode)
+	if err != nil {
+		t.Fatalf("expected the new code to exist: %v", err)
+	}
+	if stats.Visits != 4 || stats.LongURL != "https://example.com/secret" || len(stats.Tags) != 1 {
+		t.Fatalf("expected stats to carry over, got %+v", stats)
+	}
+	if db.referrers[rotated.ShortCode]["news.example"] != 4 {
+		t.Fatalf("expected referrers to carry over, got %v", db.referrers[rotated.ShortCode])
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "custom alias", path: "/api/v1/urls/" + rotated.ShortCode + "/rotate", body: `{"custom_alias":"fresh01"}`, status: http.StatusOK},
+		{name: "taken alias", path: "/api/v1/urls/fresh01/rotate", body: `{"custom_alias":"taken1"}`, status: http.StatusConflict},
+		{name: "invalid alias", path: "/api/v1/urls/fresh01/rotate", body: `{"custom_alias":"no!"}`, status: http.StatusBadRequest},
+		{name: "missing code", path: "/api/v1/urls/missing/rotate", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(tt.body)))
+			if res.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, res.Code, res.Body.String())
+			}
+		})
+	}
+
+	if stats, err := db.GetStats(ctx, "fresh01"); err != nil || stats.Visits != 4 {
+		t.Fatalf("expected the custom alias to hold the link, got %+v, %v", stats, err)
+	}
+}
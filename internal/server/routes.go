@@ -1,287 +1,1320 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
 	"log"
 	"math/big"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	redisdb "url-shortner/internal/redis"
+	"url-shortner/pkg/linkrules"
 )
 
 const (
-	shortCodeLength = 7
-	maxCodeAttempts = 10
+	shortCodeLength      = 7
+	maxCodeLength        = 32
+	minCodeSpace         = 1 << 28
+	maxCodeAttempts      = 10
+	maxTagsPerURL        = redisdb.MaxTags
+	maxTitleLength       = 200
+	maxDescriptionLength = 1000
+	defaultTopReferrers  = 10
+	maxTopReferrers      = 100
+	directReferrer       = "direct"
+	maxVisitBatchSize    = 1000
 )
 
-var aliasPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{4,32}$`)
+const (
+	strategyGenerated = "generated"
+	strategyAlias     = "alias"
+	strategyFallback  = "fallback"
+	strategyReadable  = "readable"
+	strategyReserved  = "reserved"
+)
+
+// ErrCodeSpaceExhausted is returned when every generated candidate collided
+// with an existing code, a sign that the code length is too short for the
+// number of live links.
+var ErrCodeSpaceExhausted = errors.New("failed to allocate unique short code")
+
+// errCaseVariantTaken refuses a custom alias that differs only in case from
+// an existing code while RESERVE_CASE_VARIANTS is on.
+var errCaseVariantTaken = errors.New("custom alias differs only in case from an existing short code")
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
 
 type createShortURLResponse struct {
 	ShortCode string     `json:"short_code"`
 	ShortURL  string     `json:"short_url"`
 	LongURL   string     `json:"long_url"`
 	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	StartsAt  *time.Time `json:"starts_at,omitempty"`
+	Strategy  string     `json:"strategy"`
+	DryRun    bool       `json:"dry_run,omitempty"`
+	// ManagementToken unlocks changes to the link with MANAGEMENT_TOKENS.
+	// It is only ever returned here.
+	ManagementToken string `json:"management_token,omitempty"`
+
+	epochMillis bool
+}
+
+type analyticsResponse struct {
+	Code      string                  `json:"code"`
+	Visits    int64                   `json:"visits"`
+	Referrers []redisdb.ReferrerCount `json:"referrers"`
+	Others    int64                   `json:"others"`
+	Countries map[string]int64        `json:"countries,omitempty"`
+}
+
+type tagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+type expirationRequest struct {
+	ExpirationDays *int       `json:"expiration_days,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+}
+
+// ttl returns the TTL the request asks for, where <= 0 means permanent, and
+// whether it asks for one at all.
+func (req expirationRequest) ttl() (time.Duration, bool, error) {
+	switch {
+	case req.ExpirationDays != nil && req.ExpiresAt != nil:
+		return 0, false, errors.New("provide either expiration_days or expires_at, not both")
+	case req.ExpirationDays != nil:
+		if *req.ExpirationDays < 0 {
+			return 0, false, errors.New("expiration_days must be >= 0")
+		}
+		return time.Duration(*req.ExpirationDays) * 24 * time.Hour, true, nil
+	case req.ExpiresAt != nil:
+		ttl := time.Until(*req.ExpiresAt)
+		if ttl <= 0 {
+			return 0, false, errors.New("expires_at must be in the future")
+		}
+		return ttl, true, nil
+	default:
+		return 0, false, nil
+	}
+}
+
+// dayComponent matches the day counts parseExpiresIn adds to the units of
+// time.ParseDuration.
+var dayComponent = regexp.MustCompile(`(\d*\.?\d+)d`)
+
+// parseExpiresIn parses a relative expiry such as "30m", "12h", "7d" or
+// "1d12h": a time.ParseDuration string that may also count days of 24 hours.
+// Only positive durations are accepted.
+func parseExpiresIn(raw string) (time.Duration, error) {
+	hours := dayComponent.ReplaceAllStringFunc(raw, func(days string) string {
+		n, _ := strconv.ParseFloat(strings.TrimSuffix(days, "d"), 64)
+		return strconv.FormatFloat(n*24, 'f', -1, 64) + "h"
+	})
+	ttl, err := time.ParseDuration(hours)
+	if err != nil {
+		return 0, errors.New("expires_in must be a duration such as 30m, 12h or 7d")
+	}
+	if ttl <= 0 {
+		return 0, errors.New("expires_in must be positive")
+	}
+	return ttl, nil
+}
+
+type visitBatchResponse struct {
+	Visits  map[string]int64 `json:"visits"`
+	Missing []string         `json:"missing"`
 }
 
 type errorResponse struct {
 	Error string `json:"error"`
 }
 
+// route is an endpoint registered by RegisterRoutes. Routes tied to a feature
+// are left out while it is disabled. usage is how GET / advertises the route
+// when it differs from the pattern. POST, PUT, PATCH and DELETE routes are
+// refused during maintenance unless duringMaintenance is set.
+type route struct {
+	pattern           string
+	handler           http.HandlerFunc
+	feature           Feature
+	usage             string
+	duringMaintenance bool
+}
+
+func (s *Server) routes(shed func(http.HandlerFunc) http.HandlerFunc) []route {
+	return []route{
+		{pattern: "POST /api/v1/shorten", handler: shed(s.createShortURLHandler)},
+		{pattern: "GET /{code}", handler: shed(s.redirectHandler)},
+		{pattern: "GET /{code}/{$}", handler: shed(s.trailingSlashHandler), usage: "GET /{code}/"},
+		{pattern: "GET /api/v1/urls", handler: s.listURLsHandler, feature: FeatureTags, usage: "GET /api/v1/urls?tag={tag}"},
+		{pattern: "GET /api/v1/groups", handler: s.listGroupsHandler, feature: FeatureGroups},
+		{pattern: "GET /api/v1/tags/{tag}/stats", handler: s.tagStatsHandler, feature: FeatureTags},
+		{pattern: "GET /api/v1/groups/{group}/urls", handler: s.groupURLsHandler, feature: FeatureGroups},
+		{pattern: "GET /api/v1/groups/{group}/stats", handler: s.groupStatsHandler, feature: FeatureGroups},
+		{pattern: "POST /api/v1/campaigns", handler: shed(s.createCampaignHandler)},
+		{pattern: "GET /api/v1/campaigns/{campaign}/urls", handler: s.campaignURLsHandler},
+		{pattern: "PATCH /api/v1/campaigns/{campaign}", handler: s.updateCampaignHandler},
+		{pattern: "DELETE /api/v1/campaigns/{campaign}", handler: s.deleteCampaignHandler},
+		{pattern: "POST /api/v1/aliases/reserve", handler: s.reserveAliasesHandler},
+		{pattern: "POST /api/v1/resolve", handler: s.resolveBatchHandler, duringMaintenance: true},
+		{pattern: "GET /api/v1/urls/expiring", handler: s.expiringURLsHandler, usage: "GET /api/v1/urls/expiring?within_hours=24"},
+		{pattern: "POST /api/v1/urls/visits", handler: s.requireAdmin(s.visitBatchHandler), feature: FeatureAdmin, duringMaintenance: true},
+		{pattern: "GET /api/v1/search", handler: s.requireAdmin(s.searchHandler), feature: FeatureAdmin, usage: "GET /api/v1/search?q={text}"},
+		{pattern: "GET /api/v1/urls/{code}", handler: s.urlStatsHandler},
+		{pattern: "PATCH /api/v1/urls/{code}", handler: s.requireManagementToken(s.updateURLHandler)},
+		{pattern: "DELETE /api/v1/urls/{code}", handler: s.requireManagementToken(s.deleteURLHandler)},
+		{pattern: "PATCH /api/v1/urls/{code}/expiration", handler: s.requireManagementToken(s.setExpirationHandler)},
+		{pattern: "POST /api/v1/urls/{code}/clone", handler: s.cloneURLHandler, feature: FeatureClone},
+		{pattern: "POST /api/v1/urls/{code}/rotate", handler: s.requireManagementToken(s.rotateCodeHandler), feature: FeatureRotate},
+		{pattern: "POST /api/v1/urls/{code}/check", handler: s.checkDestinationHandler, feature: FeatureChecks},
+		{pattern: "GET /api/v1/urls/{code}/final", handler: s.finalDestinationHandler, feature: FeatureChecks, usage: "GET /api/v1/urls/{code}/final?max_hops={n}"},
+		{pattern: "GET /api/v1/urls/{code}/preview", handler: s.previewHandler, feature: FeaturePreview},
+		{pattern: "GET /api/v1/urls/{code}/image", handler: s.imageHandler, usage: "GET /api/v1/urls/{code}/image?type={qr|datamatrix}&format={png|svg|datauri}&size={px}"},
+		{pattern: "GET /api/v1/urls/{code}/analytics", handler: s.analyticsHandler, feature: FeatureAnalytics, usage: "GET /api/v1/urls/{code}/analytics?top={n}"},
+		{pattern: "GET /api/v1/urls/{code}/live", handler: s.liveClicksHandler, feature: FeatureAnalytics},
+		{pattern: "GET /api/v1/urls/{code}/metrics", handler: s.codeMetricsHandler, feature: FeatureAnalytics},
+		{pattern: "GET /api/v1/urls/{code}/history", handler: s.historyHandler},
+		{pattern: "POST /api/v1/urls/{code}/tags", handler: s.requireManagementToken(s.addTagsHandler), feature: FeatureTags},
+		{pattern: "DELETE /api/v1/urls/{code}/tags", handler: s.requireManagementToken(s.removeTagsHandler), feature: FeatureTags},
+		{pattern: "GET /api/v1/admin/urls/{code}/raw", handler: s.requireAdmin(s.adminRawURLHandler), feature: FeatureAdmin},
+		{pattern: "POST /api/v1/admin/maintenance", handler: s.requireAdmin(s.maintenanceHandler), feature: FeatureAdmin, duringMaintenance: true},
+		{pattern: "GET /api/v1/admin/config", handler: s.requireAdmin(s.configHandler), feature: FeatureAdmin},
+		{pattern: "GET /api/v1/admin/codes/stats", handler: s.requireAdmin(s.codeStatsHandler), feature: FeatureAdmin},
+		{pattern: "POST /api/v1/admin/import", handler: s.requireAdmin(s.importHandler), feature: FeatureAdmin, usage: "POST /api/v1/admin/import?format={export|bitly|tinyurl}"},
+		{pattern: "GET /api/v1/admin/export", handler: s.requireAdmin(s.exportHandler), feature: FeatureAdmin, usage: "GET /api/v1/admin/export?format={json|csv}"},
+		{pattern: healthPattern, handler: s.healthHandler},
+		{pattern: "GET /version", handler: s.versionHandler},
+		{pattern: "GET /robots.txt", handler: s.robotsHandler},
+		{pattern: "GET /favicon.ico", handler: s.faviconHandler},
+		{pattern: "GET /debug/vars", handler: expvar.Handler().ServeHTTP, feature: FeatureDebug},
+		{pattern: "GET /metrics", handler: s.metricsHandler, feature: FeatureDebug},
+	}
+}
+
+// RegisterRoutes builds the handler for every route whose feature is enabled.
 func (s *Server) RegisterRoutes() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("GET /", s.rootHandler)
-	mux.HandleFunc("GET /health", s.healthHandler)
-
-	mux.HandleFunc("POST /api/v1/shorten", s.createShortURLHandler)
-	mux.HandleFunc("GET /api/v1/urls/{code}", s.urlStatsHandler)
-	mux.HandleFunc("DELETE /api/v1/urls/{code}", s.deleteURLHandler)
+	var usages []string
+	for _, rt := range s.routes(s.loadShedder(s.maxInFlight)) {
+		if rt.feature != "" && !s.enabled(rt.feature) {
+			continue
+		}
+		handler := rt.handler
+		if isWriteMethod(rt.pattern) && !rt.duringMaintenance {
+			handler = s.maintenanceGate(handler)
+		}
+		if rt.pattern != healthPattern {
+			handler = s.globalRateLimit(s.clientRateLimit(rt.pattern, handler))
+		}
+		mux.HandleFunc(rt.pattern, handler)
 
-	mux.HandleFunc("GET /{code}", s.redirectHandler)
+		usage := rt.usage
+		if usage == "" {
+			usage = rt.pattern
+		}
+		usages = append(usages, usage)
+	}
+	mux.HandleFunc("GET /{$}", s.globalRateLimit(s.rootHandler(usages)))
 
-	return s.corsMiddleware(mux)
+	return s.forceHTTPSMiddleware(s.corsMiddleware(mux))
 }
 
-func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+// corsMiddleware adds CORS headers and answers OPTIONS itself: known paths get
+// 204 with the methods registered for them in Allow, unknown paths get 404.
+func (s *Server) corsMiddleware(mux *http.ServeMux) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token, X-Management-Token")
 		w.Header().Set("Access-Control-Allow-Credentials", "false")
 
 		if r.Method == http.MethodOptions {
+			allowed := allowedMethods(mux, r)
+			if len(allowed) == 0 {
+				s.writeError(w, http.StatusNotFound, "route not found")
+				return
+			}
+			allow := strings.Join(allowed, ", ")
+			w.Header().Set("Allow", allow)
+			w.Header().Set("Access-Control-Allow-Methods", allow)
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		mux.ServeHTTP(w, r)
 	})
 }
 
-func (s *Server) rootHandler(w http.ResponseWriter, _ *http.Request) {
-	writeJSON(w, http.StatusOK, map[string]any{
-		"service": "url-shortner",
-		"version": "v1",
-		"routes": []string{
-			"POST /api/v1/shorten",
-			"GET /{code}",
-			"GET /api/v1/urls/{code}",
-			"DELETE /api/v1/urls/{code}",
-			"GET /health",
-		},
-	})
+// probedMethods are the methods checked against the mux to build Allow.
+var probedMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+// allowedMethods returns the methods mux has a route for at r's path, plus
+// OPTIONS, or nil when no route matches the path at all.
+func allowedMethods(mux *http.ServeMux, r *http.Request) []string {
+	var allowed []string
+	for _, method := range probedMethods {
+		probe := &http.Request{Method: method, URL: r.URL, Host: r.Host, Header: r.Header}
+		if _, pattern := mux.Handler(probe); pattern != "" {
+			allowed = append(allowed, method)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	return append(allowed, http.MethodOptions)
+}
+
+// rootHandler serves the JSON list of registered routes to API clients.
+// Browsers are sent to ROOT_REDIRECT_URL or shown a landing page when either
+// is configured.
+func (s *Server) rootHandler(routes []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !wantsJSON(r) {
+			if s.rootRedirectURL != nil {
+				http.Redirect(w, r, s.rootRedirectURL.String(), http.StatusFound)
+				return
+			}
+			if s.rootHTML {
+				writeHTML(w, http.StatusOK, landingTemplate, map[string]string{"Service": "url-shortner"})
+				return
+			}
+		}
+
+		s.writeJSON(w, http.StatusOK, map[string]any{
+			"service":     "url-shortner",
+			"version":     version,
+			"api_version": "v1",
+			"maintenance": s.maintenance.Load(),
+			"routes":      routes,
+		})
+	}
 }
 
 func (s *Server) healthHandler(w http.ResponseWriter, _ *http.Request) {
-	writeJSON(w, http.StatusOK, s.db.Health())
+	stats := s.db.Health()
+	stats["read_only"] = strconv.FormatBool(s.readOnly.Load())
+	stats["maintenance"] = strconv.FormatBool(s.maintenance.Load())
+	if s.createBuffer != nil {
+		stats["buffered_links"] = strconv.Itoa(s.createBuffer.Len())
+	}
+	s.writeJSON(w, http.StatusOK, stats)
+}
+
+type createShortURLRequest struct {
+	URL            string   `json:"url"`
+	CustomAlias    string   `json:"custom_alias,omitempty"`
+	ExpirationDays int      `json:"expiration_days,omitempty"`
+	PreferAlias    bool     `json:"prefer_alias,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	Sliding        bool     `json:"sliding_expiration,omitempty"`
+	Title          string   `json:"title,omitempty"`
+	Description    string   `json:"description,omitempty"`
+	FetchMetadata  bool     `json:"fetch_metadata,omitempty"`
+	DryRun         bool     `json:"dry_run,omitempty"`
+	OneTime        bool     `json:"one_time,omitempty"`
+	Readable       bool     `json:"readable,omitempty"`
+	Group          string   `json:"group,omitempty"`
+	CodeLength     int      `json:"code_length,omitempty"`
+	ForwardQuery   bool     `json:"forward_query,omitempty"`
+	// RequireHTTPS refuses redirects requested over plain HTTP.
+	RequireHTTPS bool `json:"require_https,omitempty"`
+	// InterstitialSeconds shows browsers a countdown page before the
+	// redirect; 0 redirects at once.
+	InterstitialSeconds int `json:"interstitial_seconds,omitempty"`
+	// Variants split redirects across several destinations by weight, in
+	// place of URL; see checkVariants.
+	Variants       []variantRequest `json:"variants,omitempty"`
+	StickyVariants bool             `json:"sticky_variants,omitempty"`
+	// ExpiresIn is a relative expiry for links shorter-lived than whole
+	// days; see parseExpiresIn.
+	ExpiresIn string `json:"expires_in,omitempty"`
+	// StartsAt embargoes the link: it answers 404 until then.
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+
+	// campaign and managementTokenHash are shared by every link of a
+	// campaign; see createCampaignHandler.
+	campaign            string
+	managementTokenHash string
+}
+
+// createError is a rejected create request and the HTTP status it answers
+// with. The gRPC server maps the status to a status code.
+type createError struct {
+	status  int
+	message string
+}
+
+func (e *createError) Error() string {
+	return e.message
 }
 
 func (s *Server) createShortURLHandler(w http.ResponseWriter, r *http.Request) {
-	type createShortURLRequest struct {
-		URL            string `json:"url"`
-		CustomAlias    string `json:"custom_alias,omitempty"`
-		ExpirationDays int    `json:"expiration_days,omitempty"`
-	}
 	var req createShortURLRequest
-
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid json body")
+		s.writeError(w, http.StatusBadRequest, "invalid json body")
 		return
 	}
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		dryRun, err := strconv.ParseBool(v)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "dry_run must be a boolean")
+			return
+		}
+		req.DryRun = req.DryRun || dryRun
+	}
 
-	parsedURL, err := validateTargetURL(req.URL)
+	response, err := s.createLink(r.Context(), req, ownerFromRequest(r), s.requestHost(r))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		s.writeCreateError(w, err)
 		return
 	}
+	response.ShortURL = fmt.Sprintf("%s/%s", s.shortBaseURL(r), response.ShortCode)
 
-	if req.ExpirationDays < 0 {
-		writeError(w, http.StatusBadRequest, "expiration_days must be >= 0")
+	// A dry run stops after validation and code resolution: nothing is
+	// written, and the returned code is not reserved.
+	if response.DryRun {
+		s.writeSignedJSON(w, http.StatusOK, response)
 		return
 	}
+	s.writeSignedJSON(w, http.StatusCreated, response)
+}
+
+// createLink validates req, picks its code and stores the link for owner,
+// unless req is a dry run. host is the host the request came in on, which
+// the target must not point back at. Rejections are *createError; everything
+// but ShortURL is filled in on success. It is shared by the REST and gRPC
+// create calls.
+func (s *Server) createLink(ctx context.Context, req createShortURLRequest, owner, host string) (createShortURLResponse, error) {
+	var variants []redisdb.Variant
+	switch {
+	case len(req.Variants) > 0:
+		if req.URL != "" {
+			return createShortURLResponse{}, &createError{http.StatusBadRequest, "provide either url or variants, not both"}
+		}
+		var err error
+		if variants, err = s.checkVariants(ctx, req.Variants, host); err != nil {
+			return createShortURLResponse{}, err
+		}
+		req.URL = variants[0].URL
+	case req.StickyVariants:
+		return createShortURLResponse{}, &createError{http.StatusBadRequest, "sticky_variants requires variants"}
+	}
 
-	code, err := s.resolveShortCode(r.Context(), strings.TrimSpace(req.CustomAlias))
+	parsedURL, err := s.checkTarget(ctx, req.URL, host)
 	if err != nil {
-		if errors.Is(err, redisdb.ErrConflict) {
-			writeError(w, http.StatusConflict, "custom alias already exists")
-			return
+		return createShortURLResponse{}, err
+	}
+
+	if req.ExpirationDays < 0 {
+		return createShortURLResponse{}, &createError{http.StatusBadRequest, "expiration_days must be >= 0"}
+	}
+	ttl := time.Duration(req.ExpirationDays) * 24 * time.Hour
+	if req.ExpiresIn != "" {
+		if req.ExpirationDays != 0 {
+			return createShortURLResponse{}, &createError{http.StatusBadRequest, "provide either expiration_days or expires_in, not both"}
 		}
-		if strings.Contains(err.Error(), "custom_alias") {
-			writeError(w, http.StatusBadRequest, err.Error())
-			return
+		if ttl, err = parseExpiresIn(req.ExpiresIn); err != nil {
+			return createShortURLResponse{}, &createError{http.StatusBadRequest, err.Error()}
 		}
-		writeError(w, http.StatusInternalServerError, "failed to generate short code")
-		return
 	}
 
-	var ttl time.Duration
-	var expiresAt *time.Time
-	if req.ExpirationDays > 0 {
-		ttl = time.Duration(req.ExpirationDays) * 24 * time.Hour
-		exp := time.Now().UTC().Add(ttl)
-		expiresAt = &exp
+	if req.Sliding && ttl == 0 {
+		return createShortURLResponse{}, &createError{http.StatusBadRequest, "sliding_expiration requires expiration_days or expires_in"}
 	}
 
-	log.Printf("URL Expiration: %d", req.ExpirationDays)
+	var startsAt *time.Time
+	if req.StartsAt != nil {
+		start := req.StartsAt.UTC()
+		if ttl > 0 && !start.Before(time.Now().Add(ttl)) {
+			return createShortURLResponse{}, &createError{http.StatusBadRequest, "starts_at must be before the link expires"}
+		}
+		startsAt = &start
+	}
 
-	if err := s.db.CreateShortURL(r.Context(), code, parsedURL.String(), ttl); err != nil {
-		if errors.Is(err, redisdb.ErrConflict) {
-			writeError(w, http.StatusConflict, "short code already exists")
-			return
+	if req.InterstitialSeconds < 0 || req.InterstitialSeconds > maxInterstitialSeconds {
+		return createShortURLResponse{}, &createError{http.StatusBadRequest, fmt.Sprintf("interstitial_seconds must be between 0 and %d", maxInterstitialSeconds)}
+	}
+
+	if req.CodeLength != 0 {
+		if strings.TrimSpace(req.CustomAlias) != "" || req.Readable {
+			return createShortURLResponse{}, &createError{http.StatusBadRequest, "code_length only applies to generated codes"}
 		}
-		writeError(w, http.StatusInternalServerError, "failed to store short URL")
-		return
+		if minLength, maxLength := s.codeLengthRange(); req.CodeLength < minLength || req.CodeLength > maxLength {
+			return createShortURLResponse{}, &createError{http.StatusBadRequest, fmt.Sprintf("code_length must be between %d and %d", minLength, maxLength)}
+		}
+	}
+
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		return createShortURLResponse{}, &createError{http.StatusBadRequest, err.Error()}
+	}
+
+	group, err := normalizeGroup(req.Group)
+	if err != nil {
+		return createShortURLResponse{}, &createError{http.StatusBadRequest, err.Error()}
+	}
+
+	title, err := normalizeText("title", req.Title, maxTitleLength)
+	if err != nil {
+		return createShortURLResponse{}, &createError{http.StatusBadRequest, err.Error()}
+	}
+	description, err := normalizeText("description", req.Description, maxDescriptionLength)
+	if err != nil {
+		return createShortURLResponse{}, &createError{http.StatusBadRequest, err.Error()}
+	}
+
+	alias := strings.TrimSpace(req.CustomAlias)
+	ownerLimit, exceeded, err := s.ownerQuotaExceeded(ctx, owner)
+	if err != nil {
+		return createShortURLResponse{}, &createError{http.StatusInternalServerError, "failed to check link quota"}
+	}
+	if exceeded && !s.fillsReservation(ctx, alias) {
+		return createShortURLResponse{}, &createError{http.StatusTooManyRequests, "link quota exceeded"}
+	}
+
+	var code, strategy string
+	if req.Readable && alias == "" {
+		code, err = s.resolveReadableCode(ctx, title, parsedURL)
+		strategy = strategyReadable
+	} else if req.CodeLength != 0 {
+		code, err = s.generateUniqueCode(ctx, req.CodeLength)
+		strategy = strategyGenerated
+	} else {
+		code, strategy, err = s.resolveShortCode(ctx, alias, req.PreferAlias, req.DryRun)
+	}
+	if err != nil {
+		status, message := codeErrorStatus(err)
+		return createShortURLResponse{}, &createError{status, message}
+	}
+
+	var expiresAt *time.Time
+	if ttl > 0 {
+		exp := time.Now().UTC().Add(ttl)
+		expiresAt = &exp
 	}
 
 	response := createShortURLResponse{
 		ShortCode: code,
-		ShortURL:  fmt.Sprintf("%s/%s", requestBaseURL(r), code),
 		LongURL:   parsedURL.String(),
 		ExpiresAt: expiresAt,
+		StartsAt:  startsAt,
+		Strategy:  strategy,
+
+		epochMillis: s.epochMillis,
+	}
+
+	if req.DryRun {
+		response.DryRun = true
+		return response, nil
+	}
+
+	opts := redisdb.CreateOptions{
+		TTL:         ttl,
+		Tags:        tags,
+		Sliding:     req.Sliding,
+		Title:       title,
+		Description: description,
+		Owner:       owner,
+		OwnerLimit:  ownerLimit,
+		OneTime:     req.OneTime,
+		Group:       group,
+		Campaign:    req.campaign,
+
+		ForwardQuery:    req.ForwardQuery,
+		RequireHTTPS:    req.RequireHTTPS,
+		FillReservation: strategy == strategyReserved,
+
+		InterstitialSeconds: req.InterstitialSeconds,
+		Variants:            variants,
+		StickyVariants:      req.StickyVariants,
+	}
+	if startsAt != nil {
+		opts.StartsAt = *startsAt
+	}
+	switch {
+	case req.managementTokenHash != "":
+		opts.ManagementTokenHash = req.managementTokenHash
+	case s.managementTokens:
+		if response.ManagementToken, opts.ManagementTokenHash, err = newManagementToken(); err != nil {
+			return createShortURLResponse{}, &createError{http.StatusInternalServerError, "failed to store short URL"}
+		}
+	}
+	err = s.db.CreateShortURL(ctx, code, parsedURL.String(), opts)
+	if errors.Is(err, redisdb.ErrConflict) && req.PreferAlias && (strategy == strategyAlias || strategy == strategyReserved) {
+		// Another request took the alias after resolveShortCode found it
+		// free, or the reservation it names belongs to another API key.
+		if code, err = s.generateUniqueCode(ctx, shortCodeLength); err != nil {
+			status, message := codeErrorStatus(err)
+			return createShortURLResponse{}, &createError{status, message}
+		}
+		response.ShortCode, response.Strategy = code, strategyFallback
+		err = s.db.CreateShortURL(ctx, code, parsedURL.String(), opts)
+	}
+	s.noteWrite(err)
+	if err != nil {
+		if errors.Is(err, redisdb.ErrConflict) {
+			return createShortURLResponse{}, &createError{http.StatusConflict, "short code already exists"}
+		}
+		if errors.Is(err, redisdb.ErrQuotaExceeded) {
+			return createShortURLResponse{}, &createError{http.StatusTooManyRequests, "link quota exceeded"}
+		}
+		if errors.Is(err, redisdb.ErrReadOnly) {
+			return createShortURLResponse{}, err
+		}
+		return createShortURLResponse{}, &createError{http.StatusInternalServerError, "failed to store short URL"}
+	}
+
+	if req.FetchMetadata && (title == "" || description == "") {
+		s.populateMetadata(code, parsedURL.String(), title, description)
+	}
+
+	return response, nil
+}
+
+// checkTarget parses a destination and applies the URL rules and domain
+// policy, returning a *createError when they reject it. host is as for
+// createLink.
+func (s *Server) checkTarget(ctx context.Context, raw, host string) (*url.URL, error) {
+	normalized, err := linkrules.NormalizeURL(raw)
+	if err != nil {
+		return nil, &createError{http.StatusBadRequest, err.Error()}
+	}
+	parsedURL, err := url.Parse(normalized)
+	if err != nil {
+		return nil, &createError{http.StatusBadRequest, "invalid url"}
+	}
+
+	if s.isSelfReferential(parsedURL, host) {
+		return nil, &createError{http.StatusBadRequest, "url must not point at this shortener"}
+	}
+
+	if err := s.checkTargetDomain(parsedURL); err != nil {
+		return nil, &createError{http.StatusForbidden, err.Error()}
+	}
+	if err := s.checkDenylist(ctx, parsedURL); err != nil {
+		return nil, &createError{http.StatusForbidden, err.Error()}
+	}
+	return parsedURL, nil
+}
+
+// normalizeText trims a title or description, named field, and checks it
+// against maxLength characters.
+func normalizeText(field, raw string, maxLength int) (string, error) {
+	text := strings.TrimSpace(raw)
+	if utf8.RuneCountInString(text) > maxLength {
+		return "", fmt.Errorf("%s must be at most %d characters", field, maxLength)
+	}
+	return text, nil
+}
+
+// writeCreateError answers a failed createLink.
+func (s *Server) writeCreateError(w http.ResponseWriter, err error) {
+	var createErr *createError
+	switch {
+	case errors.Is(err, redisdb.ErrReadOnly):
+		s.writeReadOnlyError(w)
+	case errors.As(err, &createErr):
+		s.writeError(w, createErr.status, createErr.message)
+	default:
+		s.writeError(w, http.StatusInternalServerError, "failed to store short URL")
 	}
+}
 
-	writeJSON(w, http.StatusCreated, response)
+// writeCodeError maps a failure to pick a short code to its HTTP response.
+func (s *Server) writeCodeError(w http.ResponseWriter, err error) {
+	status, message := codeErrorStatus(err)
+	s.writeError(w, status, message)
+}
+
+// codeErrorStatus maps a failure to pick a short code to an HTTP status and
+// message.
+func codeErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, errNoReadableSlug):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, errSlugTaken):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, redisdb.ErrConflict):
+		return http.StatusConflict, "custom alias already exists"
+	case errors.Is(err, errCaseVariantTaken):
+		return http.StatusConflict, err.Error()
+	case strings.Contains(err.Error(), "custom_alias"):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, ErrCodeSpaceExhausted):
+		return http.StatusServiceUnavailable, "short code space exhausted, try again later"
+	default:
+		return http.StatusInternalServerError, "failed to generate short code"
+	}
 }
 
 func (s *Server) redirectHandler(w http.ResponseWriter, r *http.Request) {
-	code := strings.TrimSpace(r.PathValue("code"))
+	code := s.pathCode(r)
 	if code == "" {
-		writeError(w, http.StatusNotFound, "short code not found")
+		s.writePageError(w, r, http.StatusNotFound, "short code not found")
 		return
 	}
 
-	target, err := s.db.GetLongURL(r.Context(), code)
+	visit := redisdb.Visit{
+		Referrer:    referrerHost(r.Referer()),
+		Country:     s.visitorCountry(r),
+		MaxBurst:    s.visitBurstLimit,
+		BurstWindow: s.visitBurstWindow,
+		SampleRate:  s.visitSampleRate,
+		PlainHTTP:   s.requestScheme(r) != "https",
+	}
+	if ip, ok := s.clientIP(r); ok {
+		visit.Visitor = ip.String()
+	}
+	rollVariant(&visit, code)
+	resolved, err := s.db.VisitURL(r.Context(), code, visit)
+	s.noteWrite(err)
+	if errors.Is(err, redisdb.ErrReadOnly) {
+		resolved, err = s.resolveWithoutVisit(r.Context(), code, visit)
+	}
 	if err != nil {
-		if errors.Is(err, redisdb.ErrNotFound) {
-			writeError(w, http.StatusNotFound, "short code not found")
+		// An embargoed link looks missing until it starts, so its
+		// existence does not leak ahead of time.
+		if errors.Is(err, redisdb.ErrNotFound) || errors.Is(err, redisdb.ErrNotActive) {
+			s.writePageError(w, r, http.StatusNotFound, "short code not found")
+			return
+		}
+		if errors.Is(err, redisdb.ErrGone) {
+			s.writePageError(w, r, http.StatusGone, "short URL has already been used")
+			return
+		}
+		if errors.Is(err, redisdb.ErrInsecure) {
+			s.writePageError(w, r, http.StatusBadRequest, "short URL must be opened over HTTPS")
+			return
+		}
+		if errors.Is(err, redisdb.ErrReadOnly) {
+			w.Header().Set("Retry-After", readOnlyRetryAfter)
+			s.writePageError(w, r, http.StatusServiceUnavailable, "one-time links are unavailable while the service is read-only")
 			return
 		}
-		writeError(w, http.StatusInternalServerError, "failed to resolve short URL")
+		s.writePageError(w, r, http.StatusInternalServerError, "failed to resolve short URL")
 		return
 	}
 
-	if _, err := s.db.IncrementVisits(r.Context(), code); err != nil {
-		log.Printf("failed to increment visits for %s: %v", code, err)
+	if resolved.Counted {
+		s.publishClick(r.Context(), redisdb.ClickEvent{Code: code, Visits: resolved.Visits, Referrer: visit.Referrer, At: time.Now().UTC()})
+	}
+
+	target, ok := s.redirectTarget(code, resolved.URL)
+	if !ok {
+		s.writePageError(w, r, http.StatusInternalServerError, "short URL has an invalid destination")
+		return
+	}
+	if resolved.ForwardQuery {
+		target = s.forwardQuery(target, r.URL.Query())
+	}
+	if resolved.InterstitialSeconds > 0 && wantsHTML(r) {
+		parsed, _ := url.Parse(target)
+		writeInterstitial(w, resolved.InterstitialSeconds, target, parsed.Hostname())
+		return
 	}
 
+	w.Header().Set("Cache-Control", s.redirectCacheControl(resolved))
 	http.Redirect(w, r, target, http.StatusFound)
 }
 
+// trailingSlashHandler serves /{code}/ like /{code}, or with
+// TRAILING_SLASH_REDIRECT sends a 301 to the canonical /{code} first. Being
+// more specific than any /{code}/{path...} route, it keeps the bare trailing
+// slash out of path forwarding.
+func (s *Server) trailingSlashHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.trailingSlashRedirect {
+		s.redirectHandler(w, r)
+		return
+	}
+	canonical := &url.URL{Path: strings.TrimSuffix(r.URL.Path, "/"), RawQuery: r.URL.RawQuery}
+	http.Redirect(w, r, canonical.String(), http.StatusMovedPermanently)
+}
+
+// redirectTarget returns the absolute URL to redirect to for the stored
+// destination raw. Shortening always stores an http(s) URL, but a stored
+// value without a scheme would otherwise become a relative redirect onto the
+// shortener's own domain, so it gets https:// prepended, or is refused when
+// REJECT_SCHEMELESS_TARGETS is set. Any other scheme is refused.
+func (s *Server) redirectTarget(code, raw string) (string, bool) {
+	parsed, err := url.Parse(raw)
+	if err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "" {
+		return raw, true
+	}
+	if err == nil && parsed.Scheme == "" && !s.rejectSchemelessTargets {
+		fixed, err := url.Parse("https://" + strings.TrimPrefix(raw, "//"))
+		if err == nil && fixed.Host != "" {
+			return fixed.String(), true
+		}
+	}
+	log.Printf("refusing to redirect %s to malformed destination %q", code, s.logURL(raw))
+	return "", false
+}
+
 func (s *Server) urlStatsHandler(w http.ResponseWriter, r *http.Request) {
-	code := strings.TrimSpace(r.PathValue("code"))
+	code := s.pathCode(r)
 	if code == "" {
-		writeError(w, http.StatusNotFound, "short code not found")
+		s.writeError(w, http.StatusNotFound, "short code not found")
 		return
 	}
 
-	stats, err := s.db.GetStats(r.Context(), code)
+	stats, err := s.sharedStats(r.Context(), code)
 	if err != nil {
 		if errors.Is(err, redisdb.ErrNotFound) {
-			writeError(w, http.StatusNotFound, "short code not found")
+			s.writeError(w, http.StatusNotFound, "short code not found")
 			return
 		}
-		writeError(w, http.StatusInternalServerError, "failed to fetch URL stats")
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch URL stats")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, stats)
+	s.writeJSONP(w, r, http.StatusOK, s.statsView(r, stats))
 }
 
-func (s *Server) deleteURLHandler(w http.ResponseWriter, r *http.Request) {
-	code := strings.TrimSpace(r.PathValue("code"))
+func (s *Server) analyticsHandler(w http.ResponseWriter, r *http.Request) {
+	code := s.pathCode(r)
 	if code == "" {
-		writeError(w, http.StatusNotFound, "short code not found")
+		s.writeError(w, http.StatusNotFound, "short code not found")
 		return
 	}
 
-	if err := s.db.DeleteShortURL(r.Context(), code); err != nil {
+	top := defaultTopReferrers
+	if raw := r.URL.Query().Get("top"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxTopReferrers {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("top must be between 1 and %d", maxTopReferrers))
+			return
+		}
+		top = parsed
+	}
+
+	stats, err := s.sharedStats(r.Context(), code)
+	if err != nil {
+		if errors.Is(err, redisdb.ErrNotFound) {
+			s.writeError(w, http.StatusNotFound, "short code not found")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch URL analytics")
+		return
+	}
+
+	referrers, err := s.db.GetReferrers(r.Context(), code, top)
+	if err != nil {
 		if errors.Is(err, redisdb.ErrNotFound) {
-			writeError(w, http.StatusNotFound, "short code not found")
+			s.writeError(w, http.StatusNotFound, "short code not found")
 			return
 		}
-		writeError(w, http.StatusInternalServerError, "failed to delete short URL")
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch URL analytics")
+		return
+	}
+
+	countries, err := s.db.GetCountries(r.Context(), code)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch URL analytics")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, analyticsResponse{
+		Code:      code,
+		Visits:    stats.Visits,
+		Referrers: referrers.Top,
+		Others:    referrers.Others,
+		Countries: countries,
+	})
+}
+
+func (s *Server) deleteURLHandler(w http.ResponseWriter, r *http.Request) {
+	code := s.pathCode(r)
+	if code == "" {
+		s.writeError(w, http.StatusNotFound, "short code not found")
+		return
+	}
+
+	err := s.db.DeleteShortURL(r.Context(), code)
+	s.noteWrite(err)
+	if err != nil {
+		switch {
+		case errors.Is(err, redisdb.ErrNotFound):
+			s.writeError(w, http.StatusNotFound, "short code not found")
+		case errors.Is(err, redisdb.ErrReadOnly):
+			s.writeReadOnlyError(w)
+		default:
+			s.writeError(w, http.StatusInternalServerError, "failed to delete short URL")
+		}
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (s *Server) resolveShortCode(ctx context.Context, customAlias string) (string, error) {
+func (s *Server) listURLsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := normalizeTags(r.URL.Query()["tag"])
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(tags) == 0 {
+		s.writeError(w, http.StatusBadRequest, "tag query parameter is required")
+		return
+	}
+
+	codes, err := s.db.CodesByTags(r.Context(), tags)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to list URLs")
+		return
+	}
+
+	s.writeURLList(w, r, codes)
+}
+
+// writeURLList hydrates one page of codes into a pagedResponse, skipping
+// codes that expired or were deleted since they were looked up.
+func (s *Server) writeURLList(w http.ResponseWriter, r *http.Request, codes []string) {
+	page, err := parsePageRequest(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	codes, next := paginate(codes, page)
+
+	urls := make([]urlStatsView, 0, len(codes))
+	for _, code := range codes {
+		stats, err := s.sharedStats(r.Context(), code)
+		if err != nil {
+			if errors.Is(err, redisdb.ErrNotFound) {
+				continue
+			}
+			s.writeError(w, http.StatusInternalServerError, "failed to list URLs")
+			return
+		}
+		urls = append(urls, s.statsView(r, stats))
+	}
+
+	s.writeJSON(w, http.StatusOK, pagedResponse[urlStatsView]{Items: urls, NextCursor: next, HasMore: next != ""})
+}
+
+func (s *Server) addTagsHandler(w http.ResponseWriter, r *http.Request) {
+	s.updateTags(w, r, s.db.AddTags)
+}
+
+func (s *Server) removeTagsHandler(w http.ResponseWriter, r *http.Request) {
+	s.updateTags(w, r, s.db.RemoveTags)
+}
+
+func (s *Server) updateTags(w http.ResponseWriter, r *http.Request, apply func(context.Context, string, []string) error) {
+	code := s.pathCode(r)
+	if code == "" {
+		s.writeError(w, http.StatusNotFound, "short code not found")
+		return
+	}
+
+	var req tagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(tags) == 0 {
+		s.writeError(w, http.StatusBadRequest, "tags are required")
+		return
+	}
+
+	err = apply(r.Context(), code, tags)
+	s.noteWrite(err)
+	if err != nil {
+		switch {
+		case errors.Is(err, redisdb.ErrNotFound):
+			s.writeError(w, http.StatusNotFound, "short code not found")
+		case errors.Is(err, redisdb.ErrTooManyTags):
+			s.writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, redisdb.ErrReadOnly):
+			s.writeReadOnlyError(w)
+		default:
+			s.writeError(w, http.StatusInternalServerError, "failed to update tags")
+		}
+		return
+	}
+
+	stats, err := s.db.GetStats(r.Context(), code)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch URL stats")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, s.statsView(r, stats))
+}
+
+// visitBatchHandler adds buffered click counts, e.g. from edge nodes serving
+// cached redirects, given as {"code": delta, ...}. Unknown codes are reported
+// back instead of failing the whole batch.
+func (s *Server) visitBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var deltas map[string]int64
+	if err := json.NewDecoder(r.Body).Decode(&deltas); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if len(deltas) == 0 {
+		s.writeError(w, http.StatusBadRequest, "at least one code is required")
+		return
+	}
+	if len(deltas) > maxVisitBatchSize {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d codes per batch", maxVisitBatchSize))
+		return
+	}
+	for code, delta := range deltas {
+		if delta <= 0 {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("visit count for %q must be positive", code))
+			return
+		}
+	}
+	if s.caseInsensitiveCodes {
+		folded := make(map[string]int64, len(deltas))
+		for code, delta := range deltas {
+			folded[s.canonicalCode(code)] += delta
+		}
+		deltas = folded
+	}
+
+	totals, err := s.db.IncrementVisitsBatch(r.Context(), deltas)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to record visits")
+		return
+	}
+
+	missing := []string{}
+	for code := range deltas {
+		if _, ok := totals[code]; !ok {
+			missing = append(missing, code)
+		}
+	}
+	slices.Sort(missing)
+
+	s.writeJSON(w, http.StatusOK, visitBatchResponse{Visits: totals, Missing: missing})
+}
+
+// setExpirationHandler extends, shortens, or removes a link's expiry. The body
+// carries either expiration_days (0 makes the link permanent) or an absolute
+// expires_at in the future.
+func (s *Server) setExpirationHandler(w http.ResponseWriter, r *http.Request) {
+	code := s.pathCode(r)
+	if code == "" {
+		s.writeError(w, http.StatusNotFound, "short code not found")
+		return
+	}
+
+	var req expirationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+
+	ttl, ok, err := req.ttl()
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !ok {
+		s.writeError(w, http.StatusBadRequest, "expiration_days or expires_at is required")
+		return
+	}
+
+	err = s.db.SetExpiration(r.Context(), code, ttl)
+	s.noteWrite(err)
+	if err != nil {
+		switch {
+		case errors.Is(err, redisdb.ErrNotFound):
+			s.writeError(w, http.StatusNotFound, "short code not found")
+		case errors.Is(err, redisdb.ErrReadOnly):
+			s.writeReadOnlyError(w)
+		default:
+			s.writeError(w, http.StatusInternalServerError, "failed to update expiration")
+		}
+		return
+	}
+
+	stats, err := s.db.GetStats(r.Context(), code)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch URL stats")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, s.statsView(r, stats))
+}
+
+// resolveShortCode picks the short code for a new link and reports which
+// strategy produced it. A taken custom alias is a conflict unless preferAlias
+// is set, in which case a random code is generated instead. A dryRun only
+// checks that the alias is free, claiming nothing.
+func (s *Server) resolveShortCode(ctx context.Context, customAlias string, preferAlias, dryRun bool) (string, string, error) {
+	customAlias = s.canonicalCode(customAlias)
 	if customAlias != "" {
-		if !aliasPattern.MatchString(customAlias) {
-			return "", fmt.Errorf("custom_alias must match %s", aliasPattern.String())
+		var err error
+		if customAlias, err = s.qualifyAlias(customAlias); err != nil {
+			return "", "", err
 		}
 		exists, err := s.db.ShortCodeExists(ctx, customAlias)
 		if err != nil {
-			return "", err
+			return "", "", err
+		}
+		if !exists && dryRun {
+			return customAlias, strategyAlias, nil
+		}
+		if !exists {
+			claimed, err := s.claimCaseFold(ctx, customAlias)
+			if err != nil {
+				return "", "", err
+			}
+			if claimed {
+				return customAlias, strategyAlias, nil
+			}
+			if !preferAlias {
+				return "", "", errCaseVariantTaken
+			}
+		} else {
+			reserved, err := s.db.IsReserved(ctx, customAlias)
+			if err != nil {
+				return "", "", err
+			}
+			if reserved {
+				return customAlias, strategyReserved, nil
+			}
+			if !preferAlias {
+				return "", "", redisdb.ErrConflict
+			}
 		}
-		if exists {
-			return "", redisdb.ErrConflict
+
+		code, err := s.generateUniqueCode(ctx, shortCodeLength)
+		if err != nil {
+			return "", "", err
 		}
-		return customAlias, nil
+		return code, strategyFallback, nil
+	}
+
+	code, err := s.generateUniqueCode(ctx, shortCodeLength)
+	if err != nil {
+		return "", "", err
 	}
+	return code, strategyGenerated, nil
+}
+
+// claimCaseFold claims the lowercased form of a free custom alias with
+// RESERVE_CASE_VARIANTS, reporting false when a code in another case holds
+// it. Without the mode, or with CASE_INSENSITIVE_CODES making it moot, every
+// alias is claimed.
+func (s *Server) claimCaseFold(ctx context.Context, alias string) (bool, error) {
+	if !s.reserveCaseVariants || s.caseInsensitiveCodes {
+		return true, nil
+	}
+	return s.db.ClaimCaseFold(ctx, alias)
+}
+
+func (s *Server) generateUniqueCode(ctx context.Context, length int) (string, error) {
+	collisions := 0
+	defer func() {
+		s.codeGenerations.Add(1)
+		if collisions > 0 {
+			codeCollisionRetries.Add(int64(collisions))
+		}
+		if s.collisionWarnThreshold > 0 && collisions >= s.collisionWarnThreshold {
+			log.Printf("warning: short code generation hit %d collisions (length %d, max attempts %d); consider longer codes",
+				collisions, length, maxCodeAttempts)
+		}
+	}()
 
 	for i := 0; i < maxCodeAttempts; i++ {
-		candidate, err := generateShortCode(shortCodeLength)
+		s.codeAttempts.Add(1)
+		candidate, err := generateShortCode(length, s.codeAlphabet())
 		if err != nil {
 			return "", err
 		}
+		candidate = s.codePrefix + candidate
 
 		exists, err := s.db.ShortCodeExists(ctx, candidate)
 		if err != nil {
 			return "", err
 		}
 		if !exists {
+			generatedCodeLengths.Add(strconv.Itoa(length), 1)
 			return candidate, nil
 		}
+		collisions++
 	}
 
-	return "", errors.New("failed to allocate unique short code")
+	codeAllocationFailures.Add(1)
+	s.codeFailures.Add(1)
+	return "", ErrCodeSpaceExhausted
 }
 
-func validateTargetURL(raw string) (*url.URL, error) {
-	trimmed := strings.TrimSpace(raw)
-	if trimmed == "" {
-		return nil, errors.New("url is required")
+// normalizeTags lowercases, trims, and de-duplicates tags, rejecting any that
+// would not be safe to use as a Redis key suffix.
+func normalizeTags(raw []string) ([]string, error) {
+	seen := make(map[string]bool, len(raw))
+	tags := make([]string, 0, len(raw))
+	for _, tag := range raw {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("tags must match %s", tagPattern.String())
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
 	}
 
-	parsed, err := url.Parse(trimmed)
-	log.Printf("parsing url: %s", parsed.Host)
-	if err != nil {
-		return nil, errors.New("invalid url")
+	if len(tags) > maxTagsPerURL {
+		return nil, fmt.Errorf("at most %d tags are allowed", maxTagsPerURL)
+	}
+	return tags, nil
+}
+
+// isSelfReferential reports whether target points back at this service, either
+// at the configured short base URL or at the host the request came in on.
+// Shortening such a URL would let redirects loop through the service.
+func (s *Server) isSelfReferential(target *url.URL, requestHost string) bool {
+	host := target.Hostname()
+	if s.baseURL != nil && strings.EqualFold(host, s.baseURL.Hostname()) {
+		return true
 	}
 
-	if parsed.Scheme != "http" && parsed.Scheme != "https" {
-		return nil, errors.New("url must start with http:// or https://")
+	if h, _, err := net.SplitHostPort(requestHost); err == nil {
+		requestHost = h
 	}
+	return requestHost != "" && strings.EqualFold(host, requestHost)
+}
+
+// checkTargetDomain enforces the configured domain policy on target. When an
+// allowlist is configured it alone decides; otherwise the blocklist applies.
+func (s *Server) checkTargetDomain(target *url.URL) error {
+	host := strings.ToLower(target.Hostname())
 
-	if parsed.Host == "" {
-		return nil, errors.New("url host is required")
+	if len(s.allowedDomains) > 0 {
+		if !matchesDomain(host, s.allowedDomains) {
+			return errors.New("url host is not on the allowed domain list")
+		}
+		return nil
 	}
 
-	return parsed, nil
+	if matchesDomain(host, s.blockedDomains) {
+		return errors.New("url host is blocked")
+	}
+	return nil
 }
 
-func requestBaseURL(r *http.Request) string {
-	scheme := "http"
-	if forwardedProto := r.Header.Get("X-Forwarded-Proto"); forwardedProto != "" {
-		scheme = forwardedProto
-	} else if r.TLS != nil {
-		scheme = "https"
+// matchesDomain reports whether host equals one of domains or is a subdomain
+// of one.
+func matchesDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
 	}
+	return false
+}
+
+// shortBaseURL returns the configured SHORT_BASE_URL when set, falling back to
+// the scheme and host of the incoming request. Forwarded scheme and host
+// headers only count behind a trusted proxy.
+func (s *Server) shortBaseURL(r *http.Request) string {
+	if s.baseURL != nil {
+		return strings.TrimSuffix(s.baseURL.String(), "/")
+	}
+	return fmt.Sprintf("%s://%s", s.requestScheme(r), s.requestHost(r))
+}
+
+// redirectCacheControl lets clients cache redirects for links that never
+// expire, and forces expiring, sliding, one-time, and split links to be
+// re-resolved on every visit; a cached split redirect would pin everyone
+// behind the cache to one variant.
+func (s *Server) redirectCacheControl(resolved redisdb.ResolvedURL) string {
+	if resolved.TTL > 0 || resolved.OneTime || resolved.Variant >= 0 || s.redirectCacheMaxAge <= 0 {
+		return "no-store"
+	}
+	return fmt.Sprintf("public, max-age=%d", int64(s.redirectCacheMaxAge/time.Second))
+}
+
+// referrerHost returns the lowercased host of a Referer header value, or
+// directReferrer when the visit carried no usable referrer.
+func referrerHost(referer string) string {
+	parsed, err := url.Parse(referer)
+	if err != nil || parsed.Hostname() == "" {
+		return directReferrer
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// Alphabets for generated codes. With case-insensitive codes only the
+// lowercase one is used, so a generated code never folds onto another.
+const (
+	mixedCaseAlphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	lowerCaseAlphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+)
+
+// pathCode returns the {code} path value in its stored form; see lookupCode.
+func (s *Server) pathCode(r *http.Request) string {
+	return s.lookupCode(r.PathValue("code"))
+}
+
+// lookupCode returns code in its stored form, or "" when it lacks this
+// server's code prefix and so belongs to another namespace.
+func (s *Server) lookupCode(code string) string {
+	code = s.canonicalCode(code)
+	if !s.hasCodePrefix(code) {
+		return ""
+	}
+	return code
+}
 
-	return fmt.Sprintf("%s://%s", scheme, r.Host)
+// canonicalCode trims code and, with CASE_INSENSITIVE_CODES, lowercases it so
+// every casing of a code names the same link.
+func (s *Server) canonicalCode(code string) string {
+	code = strings.TrimSpace(code)
+	if s.caseInsensitiveCodes {
+		code = strings.ToLower(code)
+	}
+	return code
+}
+
+func (s *Server) codeAlphabet() string {
+	if s.caseInsensitiveCodes {
+		return lowerCaseAlphabet
+	}
+	return mixedCaseAlphabet
 }
 
-func generateShortCode(length int) (string, error) {
-	const alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+// codeLengthRange returns the shortest and longest code_length a create
+// request may ask for. The minimum still leaves at least minCodeSpace possible
+// codes in the active alphabet, so random codes stay unlikely to collide.
+func (s *Server) codeLengthRange() (int, int) {
+	size := len(s.codeAlphabet())
+	length, space := 1, size
+	for space < minCodeSpace {
+		length++
+		space *= size
+	}
+	return length, maxCodeLength
+}
+
+func generateShortCode(length int, alphabet string) (string, error) {
 	max := big.NewInt(int64(len(alphabet)))
 
 	buf := make([]byte, length)
@@ -296,14 +1329,69 @@ func generateShortCode(length int) (string, error) {
 	return string(buf), nil
 }
 
-func writeError(w http.ResponseWriter, statusCode int, message string) {
-	writeJSON(w, statusCode, errorResponse{Error: message})
+// responseEnvelope wraps every response when envelope mode is enabled so
+// clients can parse success and failure through the same shape.
+type responseEnvelope struct {
+	Data  any            `json:"data"`
+	Error *envelopeError `json:"error"`
+}
+
+type envelopeError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (s *Server) writeError(w http.ResponseWriter, statusCode int, message string) {
+	var payload any = errorResponse{Error: message}
+	if s.envelope {
+		payload = responseEnvelope{Error: &envelopeError{Status: statusCode, Message: message}}
+	}
+	body, err := encodeJSON(payload)
+	if err != nil {
+		log.Printf("failed to encode error response: %v", err)
+		http.Error(w, message, statusCode)
+		return
+	}
+	writeBody(w, statusCode, body)
 }
 
-func writeJSON(w http.ResponseWriter, statusCode int, payload any) {
+// writeJSON encodes payload before sending anything, so a payload that fails
+// to encode answers a clean 500 rather than statusCode with a truncated body.
+func (s *Server) writeJSON(w http.ResponseWriter, statusCode int, payload any) {
+	body, ok := s.encodeResponse(w, payload)
+	if !ok {
+		return
+	}
+	writeBody(w, statusCode, body)
+}
+
+// encodeResponse encodes payload, wrapped in the envelope when that is on.
+// When encoding fails it answers 500 itself and returns false.
+func (s *Server) encodeResponse(w http.ResponseWriter, payload any) ([]byte, bool) {
+	if s.envelope {
+		payload = responseEnvelope{Data: payload}
+	}
+	body, err := encodeJSON(payload)
+	if err != nil {
+		log.Printf("failed to encode response: %v", err)
+		s.writeError(w, http.StatusInternalServerError, "failed to encode response")
+		return nil, false
+	}
+	return body, true
+}
+
+func encodeJSON(payload any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(payload); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeBody(w http.ResponseWriter, statusCode int, body []byte) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	if err := json.NewEncoder(w).Encode(payload); err != nil {
-		log.Printf("failed to encode response: %v", err)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("failed to write response: %v", err)
 	}
 }
@@ -5,8 +5,18 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"expvar"
+	"io"
+	"log"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,34 +24,130 @@ import (
 )
 
 type mockDB struct {
-	store map[string]redisdb.URLStats
+	store     map[string]redisdb.URLStats
+	referrers map[string]map[string]int64
+	countries map[string]map[string]int64
+	ttls      map[string]time.Duration
+	owners    map[string]string
+	extra     map[string]map[string]string
+	quotas    map[string]int64
+	bursts    map[string]mockBurst
+	history   map[string][]redisdb.HistoryEvent
+	rateHits  map[string]int64
+
+	// rateErr, when set, is returned by AllowRequest as if Redis were down.
+	rateErr error
+
+	// reservations maps reserved codes to the owner holding them.
+	reservations map[string]string
+	// folds maps lowercased aliases to the code claiming them.
+	folds map[string]string
+	// denylist is the short:denylist set.
+	denylist map[string]bool
+
+	mu          sync.Mutex
+	subscribers map[string][]chan redisdb.ClickEvent
+}
+
+// mockBurst is a visitor's hit count for a code within one burst window.
+type mockBurst struct {
+	hits  int
+	until time.Time
 }
 
 func newMockDB() *mockDB {
-	return &mockDB{store: make(map[string]redisdb.URLStats)}
+	return &mockDB{
+		store:     make(map[string]redisdb.URLStats),
+		referrers: make(map[string]map[string]int64),
+		countries: make(map[string]map[string]int64),
+		ttls:      make(map[string]time.Duration),
+		owners:    make(map[string]string),
+		extra:     make(map[string]map[string]string),
+		quotas:    make(map[string]int64),
+		bursts:    make(map[string]mockBurst),
+		history:   make(map[string][]redisdb.HistoryEvent),
+		rateHits:  make(map[string]int64),
+
+		reservations: make(map[string]string),
+		folds:        make(map[string]string),
+		denylist:     make(map[string]bool),
+
+		subscribers: make(map[string][]chan redisdb.ClickEvent),
+	}
+}
+
+// shorten posts body to /api/v1/shorten, sending apiKey as X-API-Key when it
+// is set.
+func shorten(h http.Handler, body, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(body))
+	if apiKey != "" {
+		req.Header.Set(apiKeyHeader, apiKey)
+	}
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	return res
 }
 
 func (m *mockDB) Health() map[string]string {
 	return map[string]string{"redis_status": "up"}
 }
 
-func (m *mockDB) CreateShortURL(_ context.Context, code, longURL string, ttl time.Duration) error {
+func (m *mockDB) CreateShortURL(_ context.Context, code, longURL string, opts redisdb.CreateOptions) error {
 	if _, ok := m.store[code]; ok {
 		return redisdb.ErrConflict
 	}
+	owner, reserved := m.reservations[code]
+	if reserved && (!opts.FillReservation || (owner != "" && owner != opts.Owner)) {
+		return redisdb.ErrConflict
+	}
+	if opts.Owner != "" && opts.OwnerLimit > 0 && !(reserved && owner == opts.Owner) {
+		if count, _ := m.CountOwnerLinks(context.Background(), opts.Owner); count >= opts.OwnerLimit {
+			return redisdb.ErrQuotaExceeded
+		}
+	}
+	delete(m.reservations, code)
 
 	stats := redisdb.URLStats{
 		Code:      code,
 		LongURL:   longURL,
 		CreatedAt: time.Now().UTC(),
 		Visits:    0,
+		Tags:      opts.Tags,
+
+		Title:       opts.Title,
+		Description: opts.Description,
+		OneTime:     opts.OneTime,
+		Group:       opts.Group,
+		Owner:       opts.Owner,
+		Campaign:    opts.Campaign,
+
+		ForwardQuery: opts.ForwardQuery,
+		RequireHTTPS: opts.RequireHTTPS,
+
+		InterstitialSeconds: opts.InterstitialSeconds,
+		Variants:            slices.Clone(opts.Variants),
+		StickyVariants:      opts.StickyVariants,
 	}
-	if ttl > 0 {
-		exp := time.Now().UTC().Add(ttl)
+	if !opts.StartsAt.IsZero() {
+		startsAt := opts.StartsAt
+		stats.StartsAt = &startsAt
+	}
+	if opts.TTL > 0 {
+		exp := time.Now().UTC().Add(opts.TTL)
 		stats.ExpiresAt = &exp
+		stats.Sliding = opts.Sliding
+		m.ttls[code] = opts.TTL
 	}
 
 	m.store[code] = stats
+	if opts.Owner != "" {
+		m.owners[code] = opts.Owner
+	}
+	if opts.ManagementTokenHash != "" {
+		m.extra[code] = map[string]string{"management_token_hash": opts.ManagementTokenHash}
+	}
+	m.history[code] = nil
+	m.recordEvent(code, redisdb.EventCreate)
 	return nil
 }
 
@@ -50,9 +156,122 @@ func (m *mockDB) GetLongURL(_ context.Context, code string) (string, error) {
 	if !ok {
 		return "", redisdb.ErrNotFound
 	}
+	if stats.OneTime {
+		if stats.Consumed {
+			return "", redisdb.ErrGone
+		}
+		stats.Consumed = true
+		m.store[code] = stats
+	}
 	return stats.LongURL, nil
 }
 
+func (m *mockDB) GetLongURLs(_ context.Context, codes []string) (map[string]string, error) {
+	result := make(map[string]string, len(codes))
+	for _, code := range codes {
+		if stats, ok := m.store[code]; ok && !stats.OneTime && !stats.Disabled && (stats.StartsAt == nil || !stats.StartsAt.After(time.Now())) {
+			result[code] = stats.LongURL
+		}
+	}
+	return result, nil
+}
+
+func (m *mockDB) ResolveURL(ctx context.Context, code string) (redisdb.ResolvedURL, error) {
+	if exp := m.store[code].ExpiresAt; exp != nil && exp.Before(time.Now()) {
+		return redisdb.ResolvedURL{}, redisdb.ErrNotFound
+	}
+	if start := m.store[code].StartsAt; m.store[code].Disabled || start != nil && start.After(time.Now()) {
+		return redisdb.ResolvedURL{}, redisdb.ErrNotActive
+	}
+	url, err := m.GetLongURL(ctx, code)
+	if err != nil {
+		return redisdb.ResolvedURL{}, err
+	}
+	resolved := redisdb.ResolvedURL{URL: url, OneTime: m.store[code].OneTime, ForwardQuery: m.store[code].ForwardQuery, Variant: -1}
+	if exp := m.store[code].ExpiresAt; exp != nil {
+		resolved.TTL = time.Until(*exp)
+	}
+	return resolved, nil
+}
+
+func (m *mockDB) VisitURL(ctx context.Context, code string, visit redisdb.Visit) (redisdb.ResolvedURL, error) {
+	if stats, ok := m.store[code]; ok && stats.RequireHTTPS && visit.PlainHTTP {
+		return redisdb.ResolvedURL{}, redisdb.ErrInsecure
+	}
+	resolved, err := m.ResolveURL(ctx, code)
+	if err != nil {
+		return redisdb.ResolvedURL{}, err
+	}
+	resolved.InterstitialSeconds = m.store[code].InterstitialSeconds
+	resolved.Variant = -1
+	if stats := m.store[code]; len(stats.Variants) > 0 {
+		roll := visit.VariantRoll
+		if stats.StickyVariants {
+			roll = visit.StickyRoll
+		}
+		resolved.Variant = redisdb.PickVariant(stats.Variants, roll)
+		resolved.URL = stats.Variants[resolved.Variant].URL
+	}
+	if refreshed, _ := m.RefreshTTL(ctx, code); refreshed {
+		resolved.TTL = m.ttls[code]
+	}
+
+	if visit.Visitor != "" && visit.MaxBurst > 0 && visit.BurstWindow > 0 {
+		key := code + ":" + visit.Visitor
+		burst := m.bursts[key]
+		if time.Now().After(burst.until) {
+			burst = mockBurst{until: time.Now().Add(visit.BurstWindow)}
+		}
+		burst.hits++
+		m.bursts[key] = burst
+		if burst.hits > visit.MaxBurst {
+			resolved.Visits = m.store[code].Visits
+			return resolved, nil
+		}
+	}
+
+	resolved.Counted = true
+	if resolved.Visits, err = m.IncrementVisits(ctx, code); err != nil {
+		return redisdb.ResolvedURL{}, err
+	}
+	if resolved.Variant >= 0 {
+		m.store[code].Variants[resolved.Variant].Visits++
+	}
+	if visit.Referrer != "" {
+		_ = m.RecordReferrer(ctx, code, visit.Referrer)
+	}
+	if visit.Country != "" {
+		_ = m.RecordCountry(ctx, code, visit.Country)
+	}
+	return resolved, nil
+}
+
+func (m *mockDB) GetRaw(_ context.Context, code string) (map[string]string, time.Duration, error) {
+	stats, ok := m.store[code]
+	if !ok {
+		return nil, 0, redisdb.ErrNotFound
+	}
+	fields := map[string]string{
+		"url":        stats.LongURL,
+		"created_at": stats.CreatedAt.Format(time.RFC3339Nano),
+		"visits":     strconv.FormatInt(stats.Visits, 10),
+	}
+	if owner := m.owners[code]; owner != "" {
+		fields["owner"] = owner
+	}
+	if stats.Sliding {
+		fields["sliding"] = "1"
+		fields["ttl_seconds"] = strconv.FormatInt(int64(m.ttls[code]/time.Second), 10)
+	}
+	maps.Copy(fields, m.extra[code])
+
+	ttl := time.Duration(-1)
+	if stats.ExpiresAt != nil {
+		ttl = time.Until(*stats.ExpiresAt)
+	}
+	return fields, ttl, nil
+}
+
 func (m *mockDB) IncrementVisits(_ context.Context, code string) (int64, error) {
 	stats, ok := m.store[code]
 	if !ok {
@@ -63,27 +282,510 @@ func (m *mockDB) IncrementVisits(_ context.Context, code string) (int64, error)
 	return stats.Visits, nil
 }
 
+func (m *mockDB) IncrementVisitsBy(_ context.Context, code string, delta int64) (int64, error) {
+	stats, ok := m.store[code]
+	if !ok {
+		return 0, redisdb.ErrNotFound
+	}
+	stats.Visits += delta
+	m.store[code] = stats
+	return stats.Visits, nil
+}
+
+func (m *mockDB) IncrementVisitsBatch(ctx context.Context, deltas map[string]int64) (map[string]int64, error) {
+	totals := make(map[string]int64, len(deltas))
+	for code, delta := range deltas {
+		if visits, err := m.IncrementVisitsBy(ctx, code, delta); err == nil {
+			totals[code] = visits
+		}
+	}
+	return totals, nil
+}
+
 func (m *mockDB) GetStats(_ context.Context, code string) (redisdb.URLStats, error) {
 	stats, ok := m.store[code]
 	if !ok {
 		return redisdb.URLStats{}, redisdb.ErrNotFound
 	}
+	if stats.ExpiresAt != nil {
+		seconds := int64(time.Until(*stats.ExpiresAt) / time.Second)
+		stats.TTLSeconds = &seconds
+	}
 	return stats, nil
 }
 
+func (m *mockDB) ScanURLs(ctx context.Context, fn func(redisdb.URLStats) error) error {
+	for _, code := range slices.Sorted(maps.Keys(m.store)) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		stats, err := m.GetStats(ctx, code)
+		if err != nil {
+			continue
+		}
+		if err := fn(stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *mockDB) DeleteShortURL(_ context.Context, code string) error {
+	if _, ok := m.reservations[code]; ok {
+		delete(m.reservations, code)
+		delete(m.owners, code)
+		return nil
+	}
 	if _, ok := m.store[code]; !ok {
 		return redisdb.ErrNotFound
 	}
 	delete(m.store, code)
+	delete(m.referrers, code)
+	delete(m.countries, code)
+	delete(m.owners, code)
+	if folded := strings.ToLower(code); m.folds[folded] == code {
+		delete(m.folds, folded)
+	}
+	delete(m.extra, code)
+	delete(m.history, code)
+	return nil
+}
+
+func (m *mockDB) RotateCode(_ context.Context, oldCode, newCode string) error {
+	stats, ok := m.store[oldCode]
+	if !ok {
+		return redisdb.ErrNotFound
+	}
+	if _, taken := m.store[newCode]; taken {
+		return redisdb.ErrConflict
+	}
+	stats.Code = newCode
+	m.store[newCode] = stats
+	delete(m.store, oldCode)
+	moveEntry(m.referrers, oldCode, newCode)
+	moveEntry(m.countries, oldCode, newCode)
+	moveEntry(m.ttls, oldCode, newCode)
+	moveEntry(m.owners, oldCode, newCode)
+	moveEntry(m.extra, oldCode, newCode)
+	moveEntry(m.history, oldCode, newCode)
+	m.recordEvent(newCode, redisdb.EventRotate)
 	return nil
 }
 
+func moveEntry[V any](m map[string]V, from, to string) {
+	if v, ok := m[from]; ok {
+		m[to] = v
+		delete(m, from)
+	}
+}
+
 func (m *mockDB) ShortCodeExists(_ context.Context, code string) (bool, error) {
 	_, ok := m.store[code]
+	_, reserved := m.reservations[code]
+	return ok || reserved, nil
+}
+
+func (m *mockDB) ReserveAliases(ctx context.Context, codes []string, owner string) (map[string]bool, error) {
+	reserved := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		if exists, _ := m.ShortCodeExists(ctx, code); !exists {
+			m.reservations[code] = owner
+			if owner != "" {
+				m.owners[code] = owner
+			}
+			reserved[code] = true
+		} else if !reserved[code] {
+			reserved[code] = false
+		}
+	}
+	return reserved, nil
+}
+
+func (m *mockDB) IsReserved(_ context.Context, code string) (bool, error) {
+	_, ok := m.reservations[code]
 	return ok, nil
 }
 
+func (m *mockDB) ShortCodeExistsBatch(ctx context.Context, codes []string) (map[string]bool, error) {
+	result := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		result[code], _ = m.ShortCodeExists(ctx, code)
+	}
+	return result, nil
+}
+
+func (m *mockDB) AddTags(_ context.Context, code string, tags []string) error {
+	stats, ok := m.store[code]
+	if !ok {
+		return redisdb.ErrNotFound
+	}
+	merged := slices.Clone(stats.Tags)
+	for _, tag := range tags {
+		if !slices.Contains(merged, tag) {
+			merged = append(merged, tag)
+		}
+	}
+	if len(merged) > redisdb.MaxTags {
+		return redisdb.ErrTooManyTags
+	}
+	stats.Tags = merged
+	m.store[code] = stats
+	return nil
+}
+
+func (m *mockDB) RemoveTags(_ context.Context, code string, tags []string) error {
+	stats, ok := m.store[code]
+	if !ok {
+		return redisdb.ErrNotFound
+	}
+	stats.Tags = slices.DeleteFunc(stats.Tags, func(tag string) bool {
+		return slices.Contains(tags, tag)
+	})
+	m.store[code] = stats
+	return nil
+}
+
+func (m *mockDB) CodesByTags(_ context.Context, tags []string) ([]string, error) {
+	var codes []string
+	for code, stats := range m.store {
+		matches := true
+		for _, tag := range tags {
+			if !slices.Contains(stats.Tags, tag) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			codes = append(codes, code)
+		}
+	}
+	slices.Sort(codes)
+	return codes, nil
+}
+
+func (m *mockDB) CodesByGroup(_ context.Context, group string) ([]string, error) {
+	var codes []string
+	for code, stats := range m.store {
+		if stats.Group == group {
+			codes = append(codes, code)
+		}
+	}
+	slices.Sort(codes)
+	return codes, nil
+}
+
+func (m *mockDB) CodesByCampaign(_ context.Context, campaign string) ([]string, error) {
+	var codes []string
+	for code, stats := range m.store {
+		if stats.Campaign == campaign {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return nil, redisdb.ErrNotFound
+	}
+	slices.Sort(codes)
+	return codes, nil
+}
+
+// SearchDestinations matches like the Redis implementation: a query without
+// a slash against hosts, one with a slash against the whole URL.
+func (m *mockDB) SearchDestinations(_ context.Context, query string, limit int) ([]string, error) {
+	query = strings.ToLower(query)
+	codes := []string{}
+	for code, stats := range m.store {
+		target := strings.ToLower(stats.LongURL)
+		if !strings.Contains(query, "/") {
+			parsed, err := url.Parse(target)
+			if err != nil {
+				continue
+			}
+			target = parsed.Hostname()
+		}
+		if strings.Contains(target, query) {
+			codes = append(codes, code)
+		}
+	}
+	slices.Sort(codes)
+	return codes[:min(len(codes), limit)], nil
+}
+
+func (m *mockDB) ClaimCaseFold(_ context.Context, code string) (bool, error) {
+	folded := strings.ToLower(code)
+	if holder, ok := m.folds[folded]; ok && holder != code {
+		if _, exists := m.store[holder]; exists {
+			return false, nil
+		}
+	}
+	m.folds[folded] = code
+	return true, nil
+}
+
+func (m *mockDB) Denylisted(_ context.Context, entries []string) (bool, error) {
+	return slices.ContainsFunc(entries, func(entry string) bool { return m.denylist[entry] }), nil
+}
+
+func (m *mockDB) VisitCounts(_ context.Context, codes []string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(codes))
+	for _, code := range codes {
+		if stats, ok := m.store[code]; ok {
+			counts[code] = stats.Visits
+		}
+	}
+	return counts, nil
+}
+
+func (m *mockDB) ListGroups(context.Context) ([]string, error) {
+	groups := []string{}
+	for _, stats := range m.store {
+		if stats.Group != "" && !slices.Contains(groups, stats.Group) {
+			groups = append(groups, stats.Group)
+		}
+	}
+	slices.Sort(groups)
+	return groups, nil
+}
+
+func (m *mockDB) SetMetadata(_ context.Context, code, title, description, image string) error {
+	stats, ok := m.store[code]
+	if !ok {
+		return redisdb.ErrNotFound
+	}
+	if title != "" {
+		stats.Title = title
+	}
+	if description != "" {
+		stats.Description = description
+	}
+	if image != "" {
+		stats.Image = image
+	}
+	m.store[code] = stats
+	return nil
+}
+
+func (m *mockDB) SetDestinationHealth(_ context.Context, code string, health redisdb.DestinationHealth) error {
+	stats, ok := m.store[code]
+	if !ok {
+		return redisdb.ErrNotFound
+	}
+	stats.Destination = &health
+	m.store[code] = stats
+	return nil
+}
+
+func (m *mockDB) RefreshTTL(_ context.Context, code string) (bool, error) {
+	stats, ok := m.store[code]
+	if !ok || !stats.Sliding || m.ttls[code] <= 0 {
+		return false, nil
+	}
+	exp := time.Now().UTC().Add(m.ttls[code])
+	stats.ExpiresAt = &exp
+	m.store[code] = stats
+	return true, nil
+}
+
+func (m *mockDB) SetExpiration(_ context.Context, code string, ttl time.Duration) error {
+	stats, ok := m.store[code]
+	if !ok {
+		return redisdb.ErrNotFound
+	}
+	if ttl <= 0 {
+		stats.ExpiresAt = nil
+		stats.Sliding = false
+		delete(m.ttls, code)
+	} else {
+		exp := time.Now().UTC().Add(ttl)
+		stats.ExpiresAt = &exp
+		m.ttls[code] = ttl
+	}
+	m.store[code] = stats
+	return nil
+}
+
+func (m *mockDB) UpdateLink(ctx context.Context, code string, update redisdb.LinkUpdate) error {
+	stats, ok := m.store[code]
+	if !ok {
+		return redisdb.ErrNotFound
+	}
+	if update.URL != nil {
+		stats.LongURL = *update.URL
+		stats.Destination = nil
+		stats.Variants, stats.StickyVariants = nil, false
+	}
+	if update.Title != nil {
+		stats.Title = *update.Title
+	}
+	if update.Description != nil {
+		stats.Description = *update.Description
+	}
+	if update.Tags != nil {
+		stats.Tags = *update.Tags
+		if len(stats.Tags) == 0 {
+			stats.Tags = nil
+		}
+	}
+	if update.Group != nil {
+		stats.Group = *update.Group
+	}
+	if update.Sliding != nil {
+		stats.Sliding = *update.Sliding
+	}
+	if update.Disabled != nil {
+		stats.Disabled = *update.Disabled
+	}
+	m.store[code] = stats
+
+	settings := update
+	settings.Disabled = nil
+	if settings != (redisdb.LinkUpdate{}) {
+		m.recordEvent(code, redisdb.EventUpdate)
+	}
+	switch {
+	case update.Disabled == nil:
+	case *update.Disabled:
+		m.recordEvent(code, redisdb.EventDisable)
+	default:
+		m.recordEvent(code, redisdb.EventEnable)
+	}
+
+	if update.TTL != nil {
+		return m.SetExpiration(ctx, code, *update.TTL)
+	}
+	return nil
+}
+
+func (m *mockDB) recordEvent(code, event string) {
+	m.history[code] = append(m.history[code], redisdb.HistoryEvent{Type: event, At: time.Now().UTC()})
+}
+
+// AllowRequest counts without ever resetting: mock windows never end.
+func (m *mockDB) AllowRequest(_ context.Context, key string, limit int64, window time.Duration) (bool, time.Duration, error) {
+	if m.rateErr != nil {
+		return false, 0, m.rateErr
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rateHits[key]++
+	if m.rateHits[key] > limit {
+		return false, window, nil
+	}
+	return true, 0, nil
+}
+
+func (m *mockDB) GetHistory(_ context.Context, code string) ([]redisdb.HistoryEvent, error) {
+	return m.history[code], nil
+}
+
+func (m *mockDB) RecordReferrer(_ context.Context, code, referrer string) error {
+	if m.referrers[code] == nil {
+		m.referrers[code] = make(map[string]int64)
+	}
+	m.referrers[code][referrer]++
+	return nil
+}
+
+func (m *mockDB) CountOwnerLinks(_ context.Context, owner string) (int64, error) {
+	var count int64
+	for _, o := range m.owners {
+		if o == owner {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockDB) GetOwnerQuota(_ context.Context, owner string) (int64, bool, error) {
+	limit, ok := m.quotas[owner]
+	return limit, ok, nil
+}
+
+func (m *mockDB) SetOwnerQuota(_ context.Context, owner string, limit int64) error {
+	if limit < 0 {
+		delete(m.quotas, owner)
+		return nil
+	}
+	m.quotas[owner] = limit
+	return nil
+}
+
+func (m *mockDB) PublishClick(_ context.Context, event redisdb.ClickEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ch := range m.subscribers[event.Code] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	return nil
+}
+
+func (m *mockDB) SubscribeClicks(ctx context.Context, code string) (<-chan redisdb.ClickEvent, error) {
+	ch := make(chan redisdb.ClickEvent, 16)
+	m.mu.Lock()
+	m.subscribers[code] = append(m.subscribers[code], ch)
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		m.subscribers[code] = slices.DeleteFunc(m.subscribers[code], func(c chan redisdb.ClickEvent) bool {
+			return c == ch
+		})
+		m.mu.Unlock()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (m *mockDB) RecordCountry(_ context.Context, code, country string) error {
+	if m.countries[code] == nil {
+		m.countries[code] = make(map[string]int64)
+	}
+	m.countries[code][country]++
+	return nil
+}
+
+func (m *mockDB) GetCountries(_ context.Context, code string) (map[string]int64, error) {
+	return maps.Clone(m.countries[code]), nil
+}
+
+func (m *mockDB) GetSummary(context.Context) (redisdb.Summary, error) {
+	summary := redisdb.Summary{Links: int64(len(m.store))}
+	for _, stats := range m.store {
+		summary.Visits += stats.Visits
+	}
+	return summary, nil
+}
+
+func (m *mockDB) Close() error {
+	return nil
+}
+
+func (m *mockDB) GetReferrers(_ context.Context, code string, top int) (redisdb.ReferrerStats, error) {
+	if _, ok := m.store[code]; !ok {
+		return redisdb.ReferrerStats{}, redisdb.ErrNotFound
+	}
+
+	counts := make([]redisdb.ReferrerCount, 0, len(m.referrers[code]))
+	for referrer, count := range m.referrers[code] {
+		counts = append(counts, redisdb.ReferrerCount{Referrer: referrer, Count: count})
+	}
+	slices.SortFunc(counts, func(a, b redisdb.ReferrerCount) int {
+		if a.Count != b.Count {
+			return int(b.Count - a.Count)
+		}
+		return strings.Compare(b.Referrer, a.Referrer)
+	})
+
+	stats := redisdb.ReferrerStats{Top: counts[:min(top, len(counts))]}
+	for _, c := range counts[min(top, len(counts)):] {
+		stats.Others += c.Count
+	}
+	return stats, nil
+}
+
 func TestCreateShortURLHandler(t *testing.T) {
 	s := &Server{db: newMockDB()}
 	h := s.RegisterRoutes()
@@ -113,7 +815,7 @@ func TestCreateShortURLHandler(t *testing.T) {
 
 func TestRedirectHandler(t *testing.T) {
 	db := newMockDB()
-	if err := db.CreateShortURL(context.Background(), "abc1234", "https://example.com", 0); err != nil {
+	if err := db.CreateShortURL(context.Background(), "abc1234", "https://example.com", redisdb.CreateOptions{}); err != nil {
 		t.Fatalf("setup failed: %v", err)
 	}
 
@@ -141,24 +843,162 @@ func TestRedirectHandler(t *testing.T) {
 	}
 }
 
-func TestURLStatsAndDelete(t *testing.T) {
+func TestRedirectSchemelessTarget(t *testing.T) {
 	db := newMockDB()
-	if err := db.CreateShortURL(context.Background(), "stat123", "https://example.com/stats", 0); err != nil {
-		t.Fatalf("setup failed: %v", err)
+	// Stored directly, as an import that skipped validation would.
+	for code, target := range map[string]string{"bare0001": "docs.example.org/path?q=1", "bare0002": "//docs.example.org/x", "bare0003": "javascript:alert(1)"} {
+		if err := db.CreateShortURL(context.Background(), code, target, redisdb.CreateOptions{}); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
 	}
-	if _, err := db.IncrementVisits(context.Background(), "stat123"); err != nil {
-		t.Fatalf("setup increment failed: %v", err)
+
+	redirect := func(s *Server, code string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/"+code, nil))
+		return res
 	}
 
 	s := &Server{db: db}
-	h := s.RegisterRoutes()
-
-	statsReq := httptest.NewRequest(http.MethodGet, "/api/v1/urls/stat123", nil)
-	statsRes := httptest.NewRecorder()
-	h.ServeHTTP(statsRes, statsReq)
+	for code, want := range map[string]string{"bare0001": "https://docs.example.org/path?q=1", "bare0002": "https://docs.example.org/x"} {
+		res := redirect(s, code)
+		if res.Code != http.StatusFound || res.Header().Get("Location") != want {
+			t.Fatalf("%s: expected a redirect to %s, got %d %q", code, want, res.Code, res.Header().Get("Location"))
+		}
+	}
+	if res := redirect(s, "bare0003"); res.Code != http.StatusInternalServerError {
+		t.Fatalf("expected a non-http scheme to be refused, got %d %q", res.Code, res.Header().Get("Location"))
+	}
 
-	if statsRes.Code != http.StatusOK {
-		t.Fatalf("expected status %d, got %d", http.StatusOK, statsRes.Code)
+	strict := &Server{db: db, rejectSchemelessTargets: true}
+	if res := redirect(strict, "bare0001"); res.Code != http.StatusInternalServerError || res.Header().Get("Location") != "" {
+		t.Fatalf("expected REJECT_SCHEMELESS_TARGETS to refuse the redirect, got %d %q", res.Code, res.Header().Get("Location"))
+	}
+}
+
+func TestRedirectTrailingSlash(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "abc1234", "https://docs.example.org/slash", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	res := httptest.NewRecorder()
+	(&Server{db: db}).RegisterRoutes().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/abc1234/", nil))
+	if res.Code != http.StatusFound || res.Header().Get("Location") != "https://docs.example.org/slash" {
+		t.Fatalf("expected the trailing-slash form to resolve, got %d %q", res.Code, res.Header().Get("Location"))
+	}
+
+	h := (&Server{db: db, trailingSlashRedirect: true}).RegisterRoutes()
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/abc1234/?utm_source=mail", nil))
+	if res.Code != http.StatusMovedPermanently || res.Header().Get("Location") != "/abc1234?utm_source=mail" {
+		t.Fatalf("expected a canonical redirect, got %d %q", res.Code, res.Header().Get("Location"))
+	}
+
+	canonical := res.Header().Get("Location")
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, canonical, nil))
+	if res.Code != http.StatusFound || res.Header().Get("Location") != "https://docs.example.org/slash" {
+		t.Fatalf("expected the canonical form to resolve, got %d %q", res.Code, res.Header().Get("Location"))
+	}
+	if stats, _ := db.GetStats(context.Background(), "abc1234"); stats.Visits != 2 {
+		t.Fatalf("expected the canonical redirect itself not to count a visit, got %d visits", stats.Visits)
+	}
+}
+
+func TestRedirectVisitBurstLimit(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "burst01", "https://example.com", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	s := &Server{db: db, visitBurstLimit: 2, visitBurstWindow: time.Minute}
+	h := s.RegisterRoutes()
+
+	visit := func(remoteAddr string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/burst01", nil)
+		req.RemoteAddr = remoteAddr
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if res.Code != http.StatusFound {
+			t.Fatalf("expected every visit to redirect, got %d", res.Code)
+		}
+	}
+
+	for range 5 {
+		visit("203.0.113.7:40000")
+	}
+	visit("198.51.100.2:40000")
+
+	stats, err := db.GetStats(context.Background(), "burst01")
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if stats.Visits != 3 {
+		t.Fatalf("expected 2 visits from the bursting IP plus 1 from another, got %d", stats.Visits)
+	}
+	if got := db.referrers["burst01"][directReferrer]; got != 3 {
+		t.Fatalf("expected uncounted visits to be left out of referrers, got %d", got)
+	}
+}
+
+func BenchmarkRedirectHandler(b *testing.B) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "abc1234", "https://example.com", redisdb.CreateOptions{TTL: time.Hour, Sliding: true}); err != nil {
+		b.Fatalf("setup failed: %v", err)
+	}
+	h := (&Server{db: db}).RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/abc1234", nil)
+	req.Header.Set("Referer", "https://news.example.com/item")
+
+	b.ReportAllocs()
+	for b.Loop() {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if res.Code != http.StatusFound {
+			b.Fatalf("expected status %d, got %d", http.StatusFound, res.Code)
+		}
+	}
+}
+
+func BenchmarkCreateShortURLHandler(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	h := (&Server{db: newMockDB()}).RegisterRoutes()
+	body := []byte(`{"url":"https://example.com/some/long/path"}`)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewReader(body))
+		req.Host = "short.local"
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if res.Code != http.StatusCreated {
+			b.Fatalf("expected status %d, got %d", http.StatusCreated, res.Code)
+		}
+	}
+}
+
+func TestURLStatsAndDelete(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "stat123", "https://example.com/stats", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if _, err := db.IncrementVisits(context.Background(), "stat123"); err != nil {
+		t.Fatalf("setup increment failed: %v", err)
+	}
+
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	statsReq := httptest.NewRequest(http.MethodGet, "/api/v1/urls/stat123", nil)
+	statsRes := httptest.NewRecorder()
+	h.ServeHTTP(statsRes, statsReq)
+
+	if statsRes.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, statsRes.Code)
 	}
 
 	var stats redisdb.URLStats
@@ -182,3 +1022,1176 @@ func TestURLStatsAndDelete(t *testing.T) {
 		t.Fatalf("expected ErrNotFound after delete, got %v", err)
 	}
 }
+
+func TestCreateShortURLPreferAliasFallback(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "taken1", "https://example.com/original", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	body := []byte(`{"url":"https://example.com/new","custom_alias":"taken1","prefer_alias":true}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+	req.Host = "short.local"
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, res.Code)
+	}
+
+	var out createShortURLResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if out.ShortCode == "taken1" {
+		t.Fatal("expected a generated code instead of the taken alias")
+	}
+	if out.Strategy != strategyFallback {
+		t.Fatalf("expected strategy %q, got %q", strategyFallback, out.Strategy)
+	}
+
+	original, err := db.GetLongURL(context.Background(), "taken1")
+	if err != nil {
+		t.Fatalf("failed to read original: %v", err)
+	}
+	if original != "https://example.com/original" {
+		t.Fatalf("expected original alias to be untouched, got %s", original)
+	}
+}
+
+// staleExistsDB reports every code as free, like a check made just before
+// another request took it.
+type staleExistsDB struct {
+	*mockDB
+}
+
+func (staleExistsDB) ShortCodeExists(context.Context, string) (bool, error) {
+	return false, nil
+}
+
+func TestCreateShortURLPreferAliasFallbackAfterRace(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "taken1", "https://example.com/original", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	h := (&Server{db: staleExistsDB{db}}).RegisterRoutes()
+
+	res := shorten(h, `{"url":"https://docs.example.org/new","custom_alias":"taken1","prefer_alias":true}`, "")
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, res.Code, res.Body.String())
+	}
+	var out createShortURLResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if out.ShortCode == "taken1" || out.Strategy != strategyFallback {
+		t.Fatalf("expected a generated fallback code, got %q (%s)", out.ShortCode, out.Strategy)
+	}
+	if got := db.store[out.ShortCode].LongURL; got != "https://docs.example.org/new" {
+		t.Fatalf("expected the fallback code to be stored, got %q", got)
+	}
+	if got := db.store["taken1"].LongURL; got != "https://example.com/original" {
+		t.Fatalf("expected original alias to be untouched, got %s", got)
+	}
+
+	res = shorten(h, `{"url":"https://docs.example.org/new","custom_alias":"taken1"}`, "")
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected status %d without prefer_alias, got %d", http.StatusConflict, res.Code)
+	}
+}
+
+func TestCreateShortURLAliasConflictWithoutPreference(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "taken1", "https://example.com/original", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	body := []byte(`{"url":"https://example.com/new","custom_alias":"taken1"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+	req.Host = "short.local"
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d", http.StatusConflict, res.Code)
+	}
+}
+
+func TestResolveShortCodeStrategies(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "taken1", "https://example.com", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	s := &Server{db: db}
+
+	tests := []struct {
+		name        string
+		alias       string
+		preferAlias bool
+		strategy    string
+	}{
+		{name: "generated", strategy: strategyGenerated},
+		{name: "free alias", alias: "free01", strategy: strategyAlias},
+		{name: "free alias preferred", alias: "free01", preferAlias: true, strategy: strategyAlias},
+		{name: "taken alias preferred", alias: "taken1", preferAlias: true, strategy: strategyFallback},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, strategy, err := s.resolveShortCode(context.Background(), tt.alias, tt.preferAlias, false)
+			if err != nil {
+				t.Fatalf("resolveShortCode failed: %v", err)
+			}
+			if strategy != tt.strategy {
+				t.Fatalf("expected strategy %q, got %q", tt.strategy, strategy)
+			}
+			if code == "" {
+				t.Fatal("expected non-empty code")
+			}
+		})
+	}
+
+	if _, _, err := s.resolveShortCode(context.Background(), "bad alias!", true, false); err == nil {
+		t.Fatal("expected invalid alias to fail even when preferred")
+	}
+}
+
+func TestCaseInsensitiveCodes(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "Mixed1", "https://example.com/mixed", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	sensitive := (&Server{db: db}).RegisterRoutes()
+	res := httptest.NewRecorder()
+	sensitive.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/mixed1", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected codes to be case-sensitive by default, got %d", res.Code)
+	}
+
+	s := &Server{db: db, caseInsensitiveCodes: true}
+	h := s.RegisterRoutes()
+
+	body := []byte(`{"url":"https://example.com/docs","custom_alias":"Docs-Home"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+	req.Host = "short.local"
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, res.Code, res.Body.String())
+	}
+	var created map[string]any
+	if err := json.Unmarshal(res.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if created["short_code"] != "docs-home" {
+		t.Fatalf("expected the alias to be stored lowercased, got %v", created["short_code"])
+	}
+
+	for _, path := range []string{"/docs-home", "/DOCS-HOME", "/Docs-Home"} {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+		if res.Code != http.StatusFound || res.Header().Get("Location") != "https://example.com/docs" {
+			t.Fatalf("%s: expected redirect to the same link, got %d to %q", path, res.Code, res.Header().Get("Location"))
+		}
+	}
+	if visits := db.store["docs-home"].Visits; visits != 3 {
+		t.Fatalf("expected every casing to count against one link, got %d visits", visits)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBufferString(`{"url":"https://example.com/other","custom_alias":"DOCS-home"}`))
+	req.Host = "short.local"
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected a differently-cased alias to conflict, got %d", res.Code)
+	}
+
+	for range 20 {
+		code, _, err := s.resolveShortCode(context.Background(), "", false, false)
+		if err != nil {
+			t.Fatalf("resolveShortCode failed: %v", err)
+		}
+		if code != strings.ToLower(code) {
+			t.Fatalf("expected generated codes to be lowercase, got %q", code)
+		}
+	}
+}
+
+func TestCreateShortURLWithTags(t *testing.T) {
+	db := newMockDB()
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	body := []byte(`{"url":"https://example.com","custom_alias":"tagged1","tags":["Marketing"," spring ","marketing"]}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+	req.Host = "short.local"
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, res.Code)
+	}
+
+	stats, err := db.GetStats(context.Background(), "tagged1")
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if !slices.Equal(stats.Tags, []string{"marketing", "spring"}) {
+		t.Fatalf("expected normalized tags, got %v", stats.Tags)
+	}
+
+	body = []byte(`{"url":"https://example.com","tags":["bad tag"]}`)
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+	req.Host = "short.local"
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for invalid tag, got %d", http.StatusBadRequest, res.Code)
+	}
+}
+
+func TestListURLsByTag(t *testing.T) {
+	db := newMockDB()
+	ctx := context.Background()
+	seed := map[string][]string{
+		"camp001": {"marketing", "spring"},
+		"camp002": {"marketing"},
+		"camp003": {"sales"},
+	}
+	for code, tags := range seed {
+		if err := db.CreateShortURL(ctx, code, "https://example.com/"+code, redisdb.CreateOptions{Tags: tags}); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	tests := []struct {
+		query string
+		codes []string
+	}{
+		{query: "?tag=marketing", codes: []string{"camp001", "camp002"}},
+		{query: "?tag=marketing&tag=spring", codes: []string{"camp001"}},
+		{query: "?tag=unknown", codes: []string{}},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/urls"+tt.query, nil)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+
+		if res.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d", tt.query, http.StatusOK, res.Code)
+		}
+
+		var out pagedResponse[urlStatsView]
+		if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tt.query, err)
+		}
+		codes := []string{}
+		for _, u := range out.Items {
+			codes = append(codes, u.Code)
+		}
+		if !slices.Equal(codes, tt.codes) {
+			t.Fatalf("%s: expected codes %v, got %v", tt.query, tt.codes, codes)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/urls", nil)
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d without tag, got %d", http.StatusBadRequest, res.Code)
+	}
+}
+
+func TestAddAndRemoveTagsHandlers(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "tagme01", "https://example.com", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/urls/tagme01/tags", bytes.NewBufferString(`{"tags":["a","b"]}`))
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/urls/tagme01/tags", bytes.NewBufferString(`{"tags":["a"]}`))
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+
+	var stats redisdb.URLStats
+	if err := json.Unmarshal(res.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !slices.Equal(stats.Tags, []string{"b"}) {
+		t.Fatalf("expected tags [b], got %v", stats.Tags)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/urls/missing/tags", bytes.NewBufferString(`{"tags":["a"]}`))
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, res.Code)
+	}
+}
+
+func TestAddTagsCapsMergedTags(t *testing.T) {
+	db := newMockDB()
+	full := []string{"t1", "t2", "t3", "t4", "t5", "t6", "t7", "t8", "t9", "t10"}
+	if err := db.CreateShortURL(context.Background(), "tagcap1", "https://example.com", redisdb.CreateOptions{Tags: full}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	h := (&Server{db: db}).RegisterRoutes()
+
+	for body, want := range map[string]int{
+		`{"tags":["t1","t2"]}`:        http.StatusOK,
+		`{"tags":["x1","x2","x3"]}`:   http.StatusBadRequest,
+		`{"tags":["t1","extra-tag"]}`: http.StatusBadRequest,
+	} {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/urls/tagcap1/tags", bytes.NewBufferString(body)))
+		if res.Code != want {
+			t.Fatalf("%s: expected status %d, got %d: %s", body, want, res.Code, res.Body.String())
+		}
+	}
+	if got := db.store["tagcap1"].Tags; len(got) != maxTagsPerURL {
+		t.Fatalf("expected the link to keep %d tags, got %v", maxTagsPerURL, got)
+	}
+}
+
+func TestOptionsIsRouteAware(t *testing.T) {
+	h := (&Server{db: newMockDB()}).RegisterRoutes()
+
+	tests := []struct {
+		path   string
+		status int
+		allow  string
+	}{
+		{path: "/api/v1/shorten", status: http.StatusNoContent, allow: "POST, OPTIONS"},
+		{path: "/api/v1/urls/docs01", status: http.StatusNoContent, allow: "GET, HEAD, PATCH, DELETE, OPTIONS"},
+		{path: "/api/v1/urls/docs01/expiration", status: http.StatusNoContent, allow: "PATCH, OPTIONS"},
+		{path: "/", status: http.StatusNoContent, allow: "GET, HEAD, OPTIONS"},
+		{path: "/api/v1/nope/at/all", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, tt.path, nil)
+			req.Header.Set("Origin", "https://app.example.com")
+			req.Header.Set("Access-Control-Request-Method", "GET")
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+
+			if res.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, res.Code)
+			}
+			if got := res.Header().Get("Allow"); got != tt.allow {
+				t.Fatalf("expected Allow %q, got %q", tt.allow, got)
+			}
+			if res.Header().Get("Access-Control-Allow-Origin") != "*" {
+				t.Fatal("expected CORS headers on every OPTIONS response")
+			}
+		})
+	}
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/nope/at/all", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown GET paths to 404 instead of serving the route list, got %d", res.Code)
+	}
+}
+
+func TestResponseEnvelope(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "env1234", "https://example.com", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		envelope bool
+		path     string
+		status   int
+		check    func(t *testing.T, body map[string]json.RawMessage)
+	}{
+		{
+			name:   "bare success",
+			path:   "/api/v1/urls/env1234",
+			status: http.StatusOK,
+			check: func(t *testing.T, body map[string]json.RawMessage) {
+				if _, ok := body["code"]; !ok {
+					t.Fatalf("expected bare stats object, got %v", body)
+				}
+				if _, ok := body["data"]; ok {
+					t.Fatal("did not expect data envelope")
+				}
+			},
+		},
+		{
+			name:   "bare error",
+			path:   "/api/v1/urls/missing",
+			status: http.StatusNotFound,
+			check: func(t *testing.T, body map[string]json.RawMessage) {
+				var message string
+				if err := json.Unmarshal(body["error"], &message); err != nil {
+					t.Fatalf("expected string error, got %s", body["error"])
+				}
+			},
+		},
+		{
+			name:     "enveloped success",
+			envelope: true,
+			path:     "/api/v1/urls/env1234",
+			status:   http.StatusOK,
+			check: func(t *testing.T, body map[string]json.RawMessage) {
+				var stats redisdb.URLStats
+				if err := json.Unmarshal(body["data"], &stats); err != nil {
+					t.Fatalf("failed to decode data: %v", err)
+				}
+				if stats.Code != "env1234" {
+					t.Fatalf("expected code env1234, got %s", stats.Code)
+				}
+				if string(body["error"]) != "null" {
+					t.Fatalf("expected null error, got %s", body["error"])
+				}
+			},
+		},
+		{
+			name:     "enveloped error",
+			envelope: true,
+			path:     "/api/v1/urls/missing",
+			status:   http.StatusNotFound,
+			check: func(t *testing.T, body map[string]json.RawMessage) {
+				var apiErr envelopeError
+				if err := json.Unmarshal(body["error"], &apiErr); err != nil {
+					t.Fatalf("failed to decode error: %v", err)
+				}
+				if apiErr.Status != http.StatusNotFound || apiErr.Message == "" {
+					t.Fatalf("unexpected error object: %+v", apiErr)
+				}
+				if string(body["data"]) != "null" {
+					t.Fatalf("expected null data, got %s", body["data"])
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{db: db, envelope: tt.envelope}
+			h := s.RegisterRoutes()
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+
+			if res.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, res.Code)
+			}
+
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			tt.check(t, body)
+		})
+	}
+}
+
+func TestWriteJSONUnencodablePayload(t *testing.T) {
+	for _, signed := range []bool{false, true} {
+		s := &Server{}
+		write := s.writeJSON
+		if signed {
+			s.responseSigningKey = []byte("signing-key")
+			write = s.writeSignedJSON
+		}
+
+		res := httptest.NewRecorder()
+		write(res, http.StatusCreated, map[string]any{"short_code": "abc1234", "broken": func() {}})
+
+		if res.Code != http.StatusInternalServerError {
+			t.Fatalf("signed=%v: expected 500, got %d", signed, res.Code)
+		}
+		var body errorResponse
+		if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil || body.Error == "" {
+			t.Fatalf("signed=%v: expected a clean JSON error, got %q", signed, res.Body.String())
+		}
+		if strings.Contains(res.Body.String(), "abc1234") || res.Header().Get(signatureHeader) != "" {
+			t.Fatalf("signed=%v: expected nothing of the failed payload to be sent", signed)
+		}
+	}
+}
+
+func TestCreateShortURLRejectsSelfReferentialTarget(t *testing.T) {
+	baseURL, err := url.Parse("https://sho.rt")
+	if err != nil {
+		t.Fatalf("failed to parse base url: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{name: "request host", target: "http://short.local/abc1234", status: http.StatusBadRequest},
+		{name: "request host with port", target: "http://SHORT.local:8080/abc1234", status: http.StatusBadRequest},
+		{name: "configured base url", target: "https://sho.rt/abc1234", status: http.StatusBadRequest},
+		{name: "other host", target: "https://example.com/abc1234", status: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{db: newMockDB(), baseURL: baseURL}
+			h := s.RegisterRoutes()
+
+			body, _ := json.Marshal(map[string]string{"url": tt.target})
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+			req.Host = "short.local:8080"
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+
+			if res.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, res.Code, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateShortURLUsesConfiguredBaseURL(t *testing.T) {
+	baseURL, err := url.Parse("https://sho.rt/")
+	if err != nil {
+		t.Fatalf("failed to parse base url: %v", err)
+	}
+
+	s := &Server{db: newMockDB(), baseURL: baseURL}
+	h := s.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBufferString(`{"url":"https://example.com","custom_alias":"base01"}`))
+	req.Host = "internal:8080"
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	var out createShortURLResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if out.ShortURL != "https://sho.rt/base01" {
+		t.Fatalf("expected short url on configured base, got %s", out.ShortURL)
+	}
+}
+
+func TestCreateShortURLDomainPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		blocked []string
+		target  string
+		status  int
+	}{
+		{name: "allowed host", allowed: []string{"example.com"}, target: "https://example.com/a", status: http.StatusCreated},
+		{name: "allowed subdomain", allowed: []string{"example.com"}, target: "https://docs.example.com/a", status: http.StatusCreated},
+		{name: "not on allowlist", allowed: []string{"example.com"}, target: "https://other.org/a", status: http.StatusForbidden},
+		{name: "suffix is not a subdomain", allowed: []string{"example.com"}, target: "https://badexample.com/a", status: http.StatusForbidden},
+		{name: "allowlist takes precedence", allowed: []string{"example.com"}, blocked: []string{"example.com"}, target: "https://example.com/a", status: http.StatusCreated},
+		{name: "blocked host", blocked: []string{"evil.test"}, target: "https://login.evil.test/a", status: http.StatusForbidden},
+		{name: "not blocked", blocked: []string{"evil.test"}, target: "https://example.com/a", status: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{db: newMockDB(), allowedDomains: tt.allowed, blockedDomains: tt.blocked}
+			h := s.RegisterRoutes()
+
+			body, _ := json.Marshal(map[string]string{"url": tt.target})
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+			req.Host = "short.local"
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+
+			if res.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, res.Code, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestAnalyticsTopReferrers(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "ana1234", "https://example.com", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	visits := map[string]int{
+		"https://news.ycombinator.com/item": 5,
+		"https://www.reddit.com/r/golang":   3,
+		"https://t.co/xyz":                  2,
+		"":                                  1,
+	}
+	for referer, n := range visits {
+		for i := 0; i < n; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/ana1234", nil)
+			if referer != "" {
+				req.Header.Set("Referer", referer)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/urls/ana1234/analytics?top=2", nil)
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+
+	var out analyticsResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	want := []redisdb.ReferrerCount{
+		{Referrer: "news.ycombinator.com", Count: 5},
+		{Referrer: "www.reddit.com", Count: 3},
+	}
+	if !slices.Equal(out.Referrers, want) {
+		t.Fatalf("expected top referrers %v, got %v", want, out.Referrers)
+	}
+	if out.Others != 3 {
+		t.Fatalf("expected others=3 (t.co + direct), got %d", out.Others)
+	}
+	if out.Visits != 11 {
+		t.Fatalf("expected visits=11, got %d", out.Visits)
+	}
+
+	for _, query := range []string{"?top=0", "?top=abc", "?top=101"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/urls/ana1234/analytics"+query, nil)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status %d, got %d", query, http.StatusBadRequest, res.Code)
+		}
+	}
+}
+
+func TestRedirectSlidingExpiration(t *testing.T) {
+	db := newMockDB()
+	ctx := context.Background()
+	if err := db.CreateShortURL(ctx, "slide01", "https://example.com", redisdb.CreateOptions{TTL: time.Hour, Sliding: true}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if err := db.CreateShortURL(ctx, "fixed01", "https://example.com", redisdb.CreateOptions{TTL: time.Hour}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	// Pretend both links are about to expire.
+	soon := time.Now().UTC().Add(time.Minute)
+	for _, code := range []string{"slide01", "fixed01"} {
+		stats := db.store[code]
+		stats.ExpiresAt = &soon
+		db.store[code] = stats
+	}
+
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+	for _, code := range []string{"slide01", "fixed01"} {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/"+code, nil))
+		if res.Code != http.StatusFound {
+			t.Fatalf("expected status %d for %s, got %d", http.StatusFound, code, res.Code)
+		}
+	}
+
+	if exp := db.store["slide01"].ExpiresAt; !exp.After(soon.Add(30 * time.Minute)) {
+		t.Fatalf("expected sliding link ttl to be extended, got %v", exp)
+	}
+	if exp := db.store["fixed01"].ExpiresAt; !exp.Equal(soon) {
+		t.Fatalf("expected fixed link ttl to be unchanged, got %v", exp)
+	}
+}
+
+func TestCreateSlidingRequiresExpiration(t *testing.T) {
+	s := &Server{db: newMockDB()}
+	h := s.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBufferString(`{"url":"https://example.com","sliding_expiration":true}`))
+	req.Host = "short.local"
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, res.Code)
+	}
+}
+
+func TestCreateShortURLMetadata(t *testing.T) {
+	db := newMockDB()
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	body := []byte(`{"url":"https://example.com/post","custom_alias":"meta01","title":"  Launch post ","description":"All about the launch"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+	req.Host = "short.local"
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, res.Code, res.Body.String())
+	}
+
+	statsReq := httptest.NewRequest(http.MethodGet, "/api/v1/urls/meta01", nil)
+	statsRes := httptest.NewRecorder()
+	h.ServeHTTP(statsRes, statsReq)
+
+	var stats redisdb.URLStats
+	if err := json.Unmarshal(statsRes.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	if stats.Title != "Launch post" || stats.Description != "All about the launch" {
+		t.Fatalf("unexpected metadata: title=%q description=%q", stats.Title, stats.Description)
+	}
+
+	long := strings.Repeat("x", maxTitleLength+1)
+	body, _ = json.Marshal(map[string]string{"url": "https://example.com", "title": long})
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBuffer(body))
+	req.Host = "short.local"
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for oversized title, got %d", http.StatusBadRequest, res.Code)
+	}
+}
+
+func TestCreateShortURLDryRun(t *testing.T) {
+	db := newMockDB()
+	db.store["taken1"] = redisdb.URLStats{Code: "taken1", LongURL: "https://example.com"}
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		status int
+	}{
+		{name: "body flag", target: "/api/v1/shorten", body: `{"url":"https://example.com","custom_alias":"dry001","dry_run":true}`, status: http.StatusOK},
+		{name: "query flag", target: "/api/v1/shorten?dry_run=1", body: `{"url":"https://example.com"}`, status: http.StatusOK},
+		{name: "invalid url", target: "/api/v1/shorten?dry_run=1", body: `{"url":"ftp://example.com"}`, status: http.StatusBadRequest},
+		{name: "alias conflict", target: "/api/v1/shorten", body: `{"url":"https://example.com","custom_alias":"taken1","dry_run":true}`, status: http.StatusConflict},
+		{name: "invalid flag", target: "/api/v1/shorten?dry_run=maybe", body: `{"url":"https://example.com"}`, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, bytes.NewBufferString(tt.body))
+			req.Host = "short.local"
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+
+			if res.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, res.Code, res.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var out createShortURLResponse
+			if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if !out.DryRun || out.ShortCode == "" {
+				t.Fatalf("expected a dry-run response with a code, got %+v", out)
+			}
+			if _, ok := db.store[out.ShortCode]; ok {
+				t.Fatalf("dry run must not create %q", out.ShortCode)
+			}
+		})
+	}
+
+	if len(db.store) != 1 {
+		t.Fatalf("expected no writes during dry runs, store has %d entries", len(db.store))
+	}
+}
+
+func TestSetExpirationHandler(t *testing.T) {
+	db := newMockDB()
+	created := time.Now().UTC()
+	exp := created.Add(24 * time.Hour)
+	db.store["exp001"] = redisdb.URLStats{Code: "exp001", LongURL: "https://example.com", CreatedAt: created, ExpiresAt: &exp}
+	db.ttls["exp001"] = 24 * time.Hour
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	patch := func(code, body string) (*httptest.ResponseRecorder, redisdb.URLStats) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/urls/"+code+"/expiration", bytes.NewBufferString(body))
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		var stats redisdb.URLStats
+		if res.Code == http.StatusOK {
+			if err := json.Unmarshal(res.Body.Bytes(), &stats); err != nil {
+				t.Fatalf("failed to decode stats: %v", err)
+			}
+		}
+		return res, stats
+	}
+
+	res, stats := patch("exp001", `{"expiration_days":30}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("extend: expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	if stats.ExpiresAt == nil || stats.ExpiresAt.Before(created.Add(29*24*time.Hour)) {
+		t.Fatalf("expected expiry to be extended to ~30 days, got %v", stats.ExpiresAt)
+	}
+
+	target := time.Now().UTC().Add(2 * time.Hour).Truncate(time.Second)
+	res, stats = patch("exp001", `{"expires_at":"`+target.Format(time.RFC3339)+`"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("shorten: expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	if stats.ExpiresAt == nil || stats.ExpiresAt.Sub(target).Abs() > time.Minute {
+		t.Fatalf("expected expiry near %v, got %v", target, stats.ExpiresAt)
+	}
+
+	res, stats = patch("exp001", `{"expiration_days":0}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("remove: expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	if stats.ExpiresAt != nil {
+		t.Fatalf("expected expiry to be removed, got %v", stats.ExpiresAt)
+	}
+
+	for _, tt := range []struct {
+		code, body string
+		status     int
+	}{
+		{"missing", `{"expiration_days":1}`, http.StatusNotFound},
+		{"exp001", `{}`, http.StatusBadRequest},
+		{"exp001", `{"expiration_days":-1}`, http.StatusBadRequest},
+		{"exp001", `{"expires_at":"2000-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"exp001", `{"expiration_days":1,"expires_at":"2999-01-01T00:00:00Z"}`, http.StatusBadRequest},
+	} {
+		if res, _ := patch(tt.code, tt.body); res.Code != tt.status {
+			t.Fatalf("%s %s: expected status %d, got %d", tt.code, tt.body, tt.status, res.Code)
+		}
+	}
+}
+
+// collidingDB reports every short code as taken to simulate a saturated
+// keyspace.
+func TestCreateWithCodeLength(t *testing.T) {
+	s := &Server{db: newMockDB()}
+	h := s.RegisterRoutes()
+
+	shorten := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBufferString(body))
+		req.Host = "short.local"
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	generated12 := func() int64 {
+		if v, ok := generatedCodeLengths.Get("12").(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	before := generated12()
+	res := shorten(`{"url":"https://example.com/secure","code_length":12}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, res.Code, res.Body.String())
+	}
+	var created createShortURLResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(created.ShortCode) != 12 || created.Strategy != strategyGenerated {
+		t.Fatalf("expected a generated 12-character code, got %q (%s)", created.ShortCode, created.Strategy)
+	}
+	if got := generated12() - before; got != 1 {
+		t.Fatalf("expected generated_code_lengths to count one 12-character code, got %d", got)
+	}
+
+	res = shorten(`{"url":"https://example.com/print","code_length":5}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected the shortest safe length to be accepted, got %d: %s", res.Code, res.Body.String())
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "too short", body: `{"url":"https://example.com","code_length":3}`, want: "code_length must be between 5 and 32"},
+		{name: "too long", body: `{"url":"https://example.com","code_length":33}`, want: "code_length must be between 5 and 32"},
+		{name: "with alias", body: `{"url":"https://example.com","code_length":8,"custom_alias":"mine01"}`, want: "code_length only applies to generated codes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := shorten(tt.body)
+			if res.Code != http.StatusBadRequest || !strings.Contains(res.Body.String(), tt.want) {
+				t.Fatalf("expected 400 %q, got %d: %s", tt.want, res.Code, res.Body.String())
+			}
+		})
+	}
+
+	// Lowercase-only codes have fewer combinations, so the minimum rises.
+	lower := (&Server{db: newMockDB(), caseInsensitiveCodes: true}).RegisterRoutes()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBufferString(`{"url":"https://example.com","code_length":5}`))
+	req.Host = "short.local"
+	res = httptest.NewRecorder()
+	lower.ServeHTTP(res, req)
+	if res.Code != http.StatusBadRequest || !strings.Contains(res.Body.String(), "between 6 and 32") {
+		t.Fatalf("expected 400 with a minimum of 6, got %d: %s", res.Code, res.Body.String())
+	}
+}
+
+type collidingDB struct {
+	*mockDB
+}
+
+func (c collidingDB) ShortCodeExists(context.Context, string) (bool, error) {
+	return true, nil
+}
+
+func TestCodeSpaceExhausted(t *testing.T) {
+	s := &Server{db: collidingDB{newMockDB()}, collisionWarnThreshold: 5}
+	h := s.RegisterRoutes()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	retriesBefore := codeCollisionRetries.Value()
+	failuresBefore := codeAllocationFailures.Value()
+
+	if _, _, err := s.resolveShortCode(context.Background(), "", false, false); !errors.Is(err, ErrCodeSpaceExhausted) {
+		t.Fatalf("expected ErrCodeSpaceExhausted, got %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBufferString(`{"url":"https://example.com"}`))
+	req.Host = "short.local"
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, res.Code)
+	}
+	if got := codeCollisionRetries.Value() - retriesBefore; got != 2*maxCodeAttempts {
+		t.Fatalf("expected %d collision retries, got %d", 2*maxCodeAttempts, got)
+	}
+	if got := codeAllocationFailures.Value() - failuresBefore; got != 2 {
+		t.Fatalf("expected 2 allocation failures, got %d", got)
+	}
+	if !strings.Contains(logs.String(), "collisions") {
+		t.Fatalf("expected a collision warning to be logged, got %q", logs.String())
+	}
+}
+
+func TestOneTimeLink(t *testing.T) {
+	db := newMockDB()
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	for _, body := range []string{
+		`{"url":"https://example.com/secret","custom_alias":"once01","one_time":true}`,
+		`{"url":"https://example.com/normal","custom_alias":"many01"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBufferString(body))
+		req.Host = "short.local"
+		req.Header.Set(apiKeyHeader, "owner-key")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if res.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, res.Code, res.Body.String())
+		}
+	}
+
+	// Reading the destination must not work around the single visit.
+	for _, path := range []string{"/api/v1/urls/once01", "/api/v1/urls/once01/preview"} {
+		for key, wantURL := range map[string]bool{"": false, "other-key": false, "owner-key": true} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if key != "" {
+				req.Header.Set(apiKeyHeader, key)
+			}
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+			if res.Code != http.StatusOK {
+				t.Fatalf("%s: expected status %d, got %d", path, http.StatusOK, res.Code)
+			}
+			if got := strings.Contains(res.Body.String(), "/secret"); got != wantURL {
+				t.Fatalf("%s with key %q: expected destination shown %v, got %s", path, key, wantURL, res.Body.String())
+			}
+		}
+	}
+
+	visit := func(code string) int {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/"+code, nil))
+		return res.Code
+	}
+
+	if got := visit("once01"); got != http.StatusFound {
+		t.Fatalf("first visit: expected status %d, got %d", http.StatusFound, got)
+	}
+	if got := visit("once01"); got != http.StatusGone {
+		t.Fatalf("second visit: expected status %d, got %d", http.StatusGone, got)
+	}
+	for i := 0; i < 3; i++ {
+		if got := visit("many01"); got != http.StatusFound {
+			t.Fatalf("normal link visit %d: expected status %d, got %d", i, http.StatusFound, got)
+		}
+	}
+}
+
+func TestURLStatsTTLSeconds(t *testing.T) {
+	db := newMockDB()
+	ctx := context.Background()
+	if err := db.CreateShortURL(ctx, "ttl0001", "https://example.com", redisdb.CreateOptions{TTL: 2 * time.Hour}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if err := db.CreateShortURL(ctx, "ttl0002", "https://example.com", redisdb.CreateOptions{}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	fetch := func(code string) map[string]any {
+		t.Helper()
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/"+code, nil))
+		var body map[string]any
+		if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to decode stats: %v", err)
+		}
+		return body
+	}
+
+	ttl, ok := fetch("ttl0001")["ttl_seconds"].(float64)
+	if !ok || ttl <= 7190 || ttl > 7200 {
+		t.Fatalf("expected ttl_seconds close to 7200, got %v", fetch("ttl0001")["ttl_seconds"])
+	}
+	if _, ok := fetch("ttl0002")["ttl_seconds"]; ok {
+		t.Fatal("expected no ttl_seconds for a permanent link")
+	}
+}
+
+func TestRedirectCacheControl(t *testing.T) {
+	db := newMockDB()
+	ctx := context.Background()
+	setup := map[string]redisdb.CreateOptions{
+		"perm001": {},
+		"temp001": {TTL: time.Hour},
+		"slid001": {TTL: time.Hour, Sliding: true},
+		"once001": {OneTime: true},
+	}
+	for code, opts := range setup {
+		if err := db.CreateShortURL(ctx, code, "https://example.com", opts); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	s := &Server{db: db, redirectCacheMaxAge: 10 * time.Minute}
+	h := s.RegisterRoutes()
+
+	tests := map[string]string{
+		"perm001": "public, max-age=600",
+		"temp001": "no-store",
+		"slid001": "no-store",
+		"once001": "no-store",
+	}
+	for code, want := range tests {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/"+code, nil))
+		if res.Code != http.StatusFound {
+			t.Fatalf("%s: expected status %d, got %d", code, http.StatusFound, res.Code)
+		}
+		if got := res.Header().Get("Cache-Control"); got != want {
+			t.Fatalf("%s: expected Cache-Control %q, got %q", code, want, got)
+		}
+	}
+
+	s = &Server{db: db}
+	h = s.RegisterRoutes()
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/perm001", nil))
+	if got := res.Header().Get("Cache-Control"); got != "no-store" {
+		t.Fatalf("expected no-store when caching is disabled, got %q", got)
+	}
+}
+
+func TestVisitBatchHandler(t *testing.T) {
+	db := newMockDB()
+	ctx := context.Background()
+	for _, code := range []string{"edge001", "edge002"} {
+		if err := db.CreateShortURL(ctx, code, "https://example.com", redisdb.CreateOptions{}); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	s := &Server{db: db, adminToken: "edge-token"}
+	h := s.RegisterRoutes()
+
+	post := func(body string) (*httptest.ResponseRecorder, visitBatchResponse) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/urls/visits", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer edge-token")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		var out visitBatchResponse
+		_ = json.Unmarshal(res.Body.Bytes(), &out)
+		return res, out
+	}
+
+	res, out := post(`{"edge001":5,"edge002":2,"gone001":7}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+	if out.Visits["edge001"] != 5 || out.Visits["edge002"] != 2 {
+		t.Fatalf("unexpected totals: %v", out.Visits)
+	}
+	if !slices.Equal(out.Missing, []string{"gone001"}) {
+		t.Fatalf("expected gone001 to be reported missing, got %v", out.Missing)
+	}
+
+	if _, out = post(`{"edge001":3}`); out.Visits["edge001"] != 8 {
+		t.Fatalf("expected deltas to accumulate to 8, got %v", out.Visits)
+	}
+
+	for _, body := range []string{`{}`, `{"edge001":0}`, `{"edge001":-4}`, `[1,2]`} {
+		if res, _ := post(body); res.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status %d, got %d", body, http.StatusBadRequest, res.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/urls/visits", bytes.NewBufferString(`{"edge001":1}`))
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d without a token, got %d", http.StatusUnauthorized, res.Code)
+	}
+}
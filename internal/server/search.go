@@ -0,0 +1,41 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+const (
+	// maxSearchResults bounds the matches one search collects; pages are
+	// served from them.
+	maxSearchResults     = 500
+	minSearchQueryLength = 3
+	maxSearchQueryLength = 200
+)
+
+// searchHandler lists links whose destination contains ?q=, for support
+// staff looking for every link to a host or path.
+func (s *Server) searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if n := utf8.RuneCountInString(query); n < minSearchQueryLength || n > maxSearchQueryLength {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("q must be %d to %d characters", minSearchQueryLength, maxSearchQueryLength))
+		return
+	}
+
+	codes, err := s.db.SearchDestinations(r.Context(), query, maxSearchResults)
+	if err != nil {
+		if errors.Is(err, redisdb.ErrURLsEncrypted) {
+			s.writeError(w, http.StatusNotImplemented, "search is unavailable while URL_ENCRYPTION is enabled")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to search URLs")
+		return
+	}
+
+	s.writeURLList(w, r, codes)
+}
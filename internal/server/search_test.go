@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestSearchDestinations(t *testing.T) {
+	db := newMockDB()
+	ctx := context.Background()
+	for code, target := range map[string]string{
+		"docs001": "https://docs.example.com/guide/setup",
+		"docs002": "https://docs.example.com/pricing",
+		"blog001": "https://blog.example.org/guide/setup",
+		"shop001": "https://shop.test/cart",
+	} {
+		if err := db.CreateShortURL(ctx, code, target, redisdb.CreateOptions{}); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	h := (&Server{db: db, adminToken: "admin-secret"}).RegisterRoutes()
+
+	search := func(query string) (int, []string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/search?q="+query, nil)
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if res.Code != http.StatusOK {
+			return res.Code, nil
+		}
+		var page pagedResponse[redisdb.URLStats]
+		if err := json.Unmarshal(res.Body.Bytes(), &page); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		var codes []string
+		for _, item := range page.Items {
+			codes = append(codes, item.Code)
+		}
+		return res.Code, codes
+	}
+
+	for query, want := range map[string][]string{
+		"example.com":            {"docs001", "docs002"},
+		"EXAMPLE":                {"blog001", "docs001", "docs002"},
+		"/guide/":                {"blog001", "docs001"},
+		"docs.example.com/guide": {"docs001"},
+		"pricing":                nil,
+	} {
+		status, codes := search(query)
+		if status != http.StatusOK || !slices.Equal(codes, want) {
+			t.Fatalf("%q: expected %v, got %d %v", query, want, status, codes)
+		}
+	}
+
+	if status, _ := search("ab"); status != http.StatusBadRequest {
+		t.Fatalf("expected a too-short query to be rejected, got %d", status)
+	}
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/search?q=example.com", nil))
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected search to require the admin token, got %d", res.Code)
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+const (
+	selfTestTimeout = 10 * time.Second
+	// selfTestCodePrefix marks the throwaway links selfTest creates, so one
+	// left behind by a crash is easy to find.
+	selfTestCodePrefix = "selftest-"
+	selfTestURL        = "https://selftest.invalid/"
+)
+
+// runSelfTest runs selfTest with a timeout, logging the outcome.
+func runSelfTest(db redisdb.Service) error {
+	ctx, cancel := context.WithTimeout(context.Background(), selfTestTimeout)
+	defer cancel()
+	if err := selfTest(ctx, db); err != nil {
+		log.Printf("SELFTEST FAILED: %v", err)
+		return err
+	}
+	log.Print("self-test passed: Redis accepted a create, read, visit and delete")
+	return nil
+}
+
+// selfTest takes a throwaway link through the writes and reads the server
+// depends on: it creates one under selfTestCodePrefix, resolves it, counts a
+// visit, and deletes it again. A ping succeeds for a Redis user that may not
+// write, or not run scripts; this does not. The link is deleted even when a
+// later step fails.
+func selfTest(ctx context.Context, db redisdb.Service) (err error) {
+	code, err := generateShortCode(shortCodeLength, lowerCaseAlphabet)
+	if err != nil {
+		return fmt.Errorf("self-test: %w", err)
+	}
+	code = selfTestCodePrefix + code
+
+	if err := db.CreateShortURL(ctx, code, selfTestURL, redisdb.CreateOptions{}); err != nil {
+		return fmt.Errorf("self-test: create: %w", err)
+	}
+	defer func() {
+		if deleteErr := db.DeleteShortURL(ctx, code); deleteErr != nil {
+			err = errors.Join(err, fmt.Errorf("self-test: delete %s: %w", code, deleteErr))
+		}
+	}()
+
+	longURL, err := db.GetLongURL(ctx, code)
+	if err != nil {
+		return fmt.Errorf("self-test: read: %w", err)
+	}
+	if longURL != selfTestURL {
+		return fmt.Errorf("self-test: read back %q, want %q", longURL, selfTestURL)
+	}
+	visits, err := db.IncrementVisits(ctx, code)
+	if err != nil {
+		return fmt.Errorf("self-test: increment: %w", err)
+	}
+	if visits != 1 {
+		return fmt.Errorf("self-test: counted %d visits, want 1", visits)
+	}
+	return nil
+}
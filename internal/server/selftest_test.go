@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+// writeDeniedDB refuses creates like a Redis user without write permission.
+type writeDeniedDB struct {
+	*mockDB
+}
+
+func (writeDeniedDB) CreateShortURL(context.Context, string, string, redisdb.CreateOptions) error {
+	return errors.New("NOPERM this user has no permissions to run the 'evalsha' command")
+}
+
+func TestSelfTestPasses(t *testing.T) {
+	db := newMockDB()
+	if err := selfTest(context.Background(), db); err != nil {
+		t.Fatalf("expected the self-test to pass, got %v", err)
+	}
+	if len(db.store) != 0 {
+		t.Fatalf("expected the throwaway link to be deleted, got %v", db.store)
+	}
+}
+
+func TestSelfTestFailsWhenWritesAreDenied(t *testing.T) {
+	err := selfTest(context.Background(), writeDeniedDB{newMockDB()})
+	if err == nil || !strings.Contains(err.Error(), "create") || !strings.Contains(err.Error(), "NOPERM") {
+		t.Fatalf("expected the denied create to fail the self-test, got %v", err)
+	}
+
+	if _, err := NewServerWithService(writeDeniedDB{newMockDB()}, Config{Port: 8080, SelfTest: true}); err == nil || !strings.Contains(err.Error(), "self-test") {
+		t.Fatalf("expected a failed self-test to fail building the server, got %v", err)
+	}
+	if _, err := NewServerWithService(newMockDB(), Config{Port: 8080, SelfTest: true}); err != nil {
+		t.Fatalf("expected a passing self-test to build the server, got %v", err)
+	}
+}
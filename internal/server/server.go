@@ -1,40 +1,495 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"html/template"
+	"log"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
+	"golang.org/x/sync/singleflight"
 
 	redisdb "url-shortner/internal/redis"
 )
 
+const (
+	defaultReadHeaderTimeout      = 5 * time.Second
+	defaultIdleTimeout            = time.Minute
+	defaultMaxHeaderBytes         = 1 << 20
+	defaultCollisionWarnThreshold = 3
+	defaultRedirectCacheMaxAge    = 5 * time.Minute
+	defaultVisitBurstWindow       = time.Second
+)
+
 type Server struct {
-	port int
-	db   redisdb.Service
+	port     int
+	db       redisdb.Service
+	envelope bool
+	baseURL  *url.URL
+
+	// listenSocket is the unix socket Listen serves on instead of port.
+	listenSocket string
+
+	// epochMillis renders URL timestamps as Unix milliseconds instead of
+	// RFC 3339 strings.
+	epochMillis bool
+	// jsonp answers requests with a callback parameter as JavaScript.
+	jsonp bool
+	// bucketPublicVisits hides exact visit counts from public readers; see
+	// readerStats.
+	bucketPublicVisits bool
+
+	// config is what the server was built from, reported by configHandler.
+	config Config
+
+	// adminToken guards /api/v1/admin; empty disables those routes.
+	adminToken string
+
+	// managementTokens issues each new link a token that changes to it must
+	// present; see requireManagementToken.
+	managementTokens bool
+
+	// responseSigningKey signs shorten responses; see writeSignedJSON.
+	responseSigningKey []byte
+
+	// trustedProxies are the networks whose X-Forwarded-* headers are honored.
+	trustedProxies []netip.Prefix
+
+	// forceHTTPS redirects plain-HTTP requests to their https:// URL.
+	forceHTTPS bool
+
+	// redactLoggedURLs reduces destinations in log lines to scheme and host;
+	// see logURL.
+	redactLoggedURLs bool
+
+	allowedDomains []string
+	blockedDomains []string
+	// denylist and denylistRedis refuse known-malicious targets; see
+	// checkDenylist.
+	denylist      *denylist
+	denylistRedis bool
+
+	rootRedirectURL *url.URL
+	rootHTML        bool
+
+	// rejectSchemelessTargets refuses to redirect to stored destinations
+	// without a scheme; see redirectTarget.
+	rejectSchemelessTargets bool
+
+	// trailingSlashRedirect sends /{code}/ to /{code} with a 301 rather
+	// than resolving it directly.
+	trailingSlashRedirect bool
+
+	// errorTemplate overrides the HTML error page shown to browsers;
+	// errorPageMessage is extra text rendered on it.
+	errorTemplate    *template.Template
+	errorPageMessage string
+
+	// robotsTxt and favicon are served from /robots.txt and /favicon.ico;
+	// nil uses the built-in defaults.
+	robotsTxt []byte
+	favicon   []byte
+
+	maxLinksPerOwner int
+
+	collisionWarnThreshold int
+
+	// codeGenerations and codeAttempts count the random codes this server
+	// allocated, or gave up on, and the candidates it tried for them;
+	// codeFailures counts the ones it gave up on.
+	codeGenerations atomic.Int64
+	codeAttempts    atomic.Int64
+	codeFailures    atomic.Int64
+
+	// caseInsensitiveCodes lowercases codes on create and lookup, and limits
+	// generated codes to lowercase letters and digits.
+	caseInsensitiveCodes bool
+	// reserveCaseVariants refuses custom aliases that another code holds in
+	// a different case; see claimCaseFold.
+	reserveCaseVariants bool
+
+	// codePrefix starts every code in this server's namespace; see
+	// hasCodePrefix and qualifyAlias.
+	codePrefix string
+
+	// maxInFlight bounds concurrent redirect and shorten requests; 0 means
+	// unlimited.
+	maxInFlight int
+
+	// keyspaceSaturated remembers whether the code space was past
+	// saturationWarnPercent at the last /metrics scrape, so the warning is
+	// logged once per crossing.
+	keyspaceSaturated atomic.Bool
+
+	// globalLimiter caps the request rate of the whole process; nil means
+	// unlimited.
+	globalLimiter *tokenBucket
+
+	// rateLimit caps the requests one client IP makes to a route per
+	// rateLimitWindow, shared through Redis; 0 disables it. rateLimitWarned
+	// is when the limiter last logged that Redis was unavailable.
+	rateLimit       int
+	rateLimitWindow time.Duration
+	rateLimitWarned atomic.Int64
+
+	// visitBurstLimit caps how many visits one client IP can add to a code
+	// per visitBurstWindow; extra visits redirect without being counted. 0
+	// disables the limit.
+	visitBurstLimit  int
+	visitBurstWindow time.Duration
+
+	// visitSampleRate counts a random one in visitSampleRate redirects as
+	// that many visits, trading exact counts for fewer Redis writes; 0 and
+	// 1 count every visit.
+	visitSampleRate int
+
+	// redirectCacheMaxAge is the max-age sent on redirects for links that
+	// never expire; 0 sends no-store for every redirect.
+	redirectCacheMaxAge time.Duration
+
+	// queryPrecedence decides conflicts when forwarding a redirect
+	// request's query; see forwardQuery.
+	queryPrecedence string
+
+	// expiringSoonThreshold flags links with less time left than this as
+	// expiring_soon; 0 means defaultExpiringSoonThreshold.
+	expiringSoonThreshold time.Duration
+
+	// statsFlight merges concurrent stats reads of one code; see
+	// sharedStats.
+	statsFlight singleflight.Group
+
+	// clicks publishes click events off the redirect path; nil publishes
+	// them inline.
+	clicks *analyticsQueue
+
+	// createBuffer, when CREATE_BUFFER_SIZE is set, wraps db to hold creates
+	// while Redis is unreachable; nil otherwise.
+	createBuffer *createBuffer
+
+	// geo resolves visitor countries for analytics; nil disables it.
+	geo countryLookup
+
+	// outbound is used for requests to user-supplied URLs; nil means a
+	// client guarded against non-public addresses.
+	outbound   *http.Client
+	background sync.WaitGroup
+
+	// readOnly is set while Redis is refusing writes; see noteWrite.
+	readOnly atomic.Bool
+
+	// maintenance refuses writes while an operator migrates data; see
+	// maintenanceGate.
+	maintenance atomic.Bool
+
+	// disabledFeatures are left out by RegisterRoutes.
+	disabledFeatures []Feature
+
+	readHeaderTimeout time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+	h2c               bool
 }
 
+// NewServer builds the server from the environment, exiting the process when
+// the configuration is invalid.
 func NewServer() *http.Server {
-	port := 8080
-	if v := os.Getenv("PORT"); v != "" {
-		if parsed, err := strconv.Atoi(v); err == nil {
-			port = parsed
+	cfg, err := LoadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv, err := NewServerWithConfig(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return srv
+}
+
+// NewServerWithConfig builds the server from cfg, which need not come from
+// the environment. Zero timeouts and limits take their defaults; cfg.Service,
+// when set, replaces the Redis connection described by cfg.Redis.
+func NewServerWithConfig(cfg Config) (*http.Server, error) {
+	cfg = cfg.withDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	db := cfg.Service
+	if db == nil {
+		var err error
+		if db, err = redisdb.NewWithOptions(cfg.Redis); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.SelfTest {
+		if err := runSelfTest(db); err != nil {
+			return nil, err
+		}
+	}
+	return newServer(cfg, db).HTTPServer(), nil
+}
+
+// NewServerWithService returns a Server that stores links in svc, for
+// embedders and binaries that bring their own backend. cfg is applied as in
+// NewServerWithConfig, except that cfg.Redis and cfg.Service are ignored.
+func NewServerWithService(svc redisdb.Service, cfg Config) (*Server, error) {
+	if svc == nil {
+		return nil, errors.New("service must not be nil")
+	}
+	cfg = cfg.withDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if cfg.SelfTest {
+		if err := runSelfTest(svc); err != nil {
+			return nil, err
 		}
 	}
+	return newServer(cfg, svc), nil
+}
 
+// newServer builds a Server around db from cfg. Optional dependencies that
+// fail to load, such as the GeoIP database, are logged and left disabled.
+func newServer(cfg Config, db redisdb.Service) *Server {
 	app := &Server{
-		port: port,
-		db:   redisdb.New(),
+		config:   cfg,
+		port:     cfg.Port,
+		db:       db,
+		envelope: cfg.ResponseEnvelope,
+		baseURL:  cfg.BaseURL,
+
+		listenSocket: cfg.ListenSocket,
+
+		epochMillis:        cfg.TimeFormat == timeFormatEpochMillis,
+		jsonp:              cfg.JSONP,
+		bucketPublicVisits: cfg.BucketPublicVisits,
+
+		adminToken:         cfg.AdminToken,
+		managementTokens:   cfg.ManagementTokens,
+		responseSigningKey: []byte(cfg.ResponseSigningKey),
+		trustedProxies:     cfg.TrustedProxies,
+		forceHTTPS:         cfg.ForceHTTPS,
+		redactLoggedURLs:   cfg.RedactLoggedURLs,
+
+		allowedDomains: cfg.AllowedDomains,
+		blockedDomains: cfg.BlockedDomains,
+		denylistRedis:  cfg.DenylistRedis,
+
+		rootRedirectURL:         cfg.RootRedirectURL,
+		rootHTML:                cfg.RootHTML,
+		rejectSchemelessTargets: cfg.RejectSchemelessTargets,
+		trailingSlashRedirect:   cfg.TrailingSlashRedirect,
+
+		errorPageMessage: cfg.ErrorPageMessage,
+
+		maxLinksPerOwner: cfg.MaxLinksPerOwner,
+
+		caseInsensitiveCodes: cfg.CaseInsensitiveCodes,
+		reserveCaseVariants:  cfg.ReserveCaseVariants,
+
+		collisionWarnThreshold: cfg.CollisionWarnThreshold,
+		maxInFlight:            cfg.MaxInFlight,
+		redirectCacheMaxAge:    cfg.RedirectCacheMaxAge,
+
+		expiringSoonThreshold: cfg.ExpiringSoonThreshold,
+		queryPrecedence:       cfg.QueryForwardPrecedence,
+
+		rateLimit:       cfg.RateLimit,
+		rateLimitWindow: cfg.RateLimitWindow,
+
+		visitBurstLimit:  cfg.VisitBurstLimit,
+		visitBurstWindow: cfg.VisitBurstWindow,
+		visitSampleRate:  cfg.VisitSampleRate,
+
+		disabledFeatures: cfg.DisabledFeatures,
+
+		outbound: newOutboundClient(metadataFetchTimeout),
+
+		readHeaderTimeout: cfg.ReadHeaderTimeout,
+		idleTimeout:       cfg.IdleTimeout,
+		maxHeaderBytes:    cfg.MaxHeaderBytes,
+		h2c:               cfg.H2C,
+	}
+	if cfg.GlobalRateLimit > 0 {
+		app.globalLimiter = newTokenBucket(cfg.GlobalRateLimit, cfg.GlobalRateBurst)
+	}
+	if cfg.CreateBufferSize > 0 {
+		app.createBuffer = newCreateBuffer(app.db, cfg.CreateBufferSize)
+		app.db = app.createBuffer
+	}
+	app.clicks = newAnalyticsQueue(cfg.AnalyticsQueueSize, cfg.AnalyticsDropPolicy, app.db.PublishClick)
+	app.maintenance.Store(cfg.Maintenance)
+	// Lowercased with CASE_INSENSITIVE_CODES, like every code it starts.
+	app.codePrefix = app.canonicalCode(cfg.CodePrefix)
+
+	if cfg.GeoIPDBPath != "" {
+		lookup, err := openCountryLookup(cfg.GeoIPDBPath)
+		if err != nil {
+			log.Printf("geoip disabled: %v", err)
+		} else {
+			app.geo = lookup
+		}
+	}
+
+	if cfg.DenylistFile != "" {
+		list, err := loadDenylist(cfg.DenylistFile)
+		if err != nil {
+			log.Printf("denylist file disabled: %v", err)
+		} else {
+			app.denylist = list
+		}
+	}
+
+	if cfg.ErrorPageTemplate != "" {
+		tmpl, err := loadErrorTemplate(cfg.ErrorPageTemplate)
+		if err != nil {
+			log.Printf("custom error page disabled: %v", err)
+		} else {
+			app.errorTemplate = tmpl
+		}
+	}
+
+	for path, dst := range map[string]*[]byte{cfg.RobotsTxtPath: &app.robotsTxt, cfg.FaviconPath: &app.favicon} {
+		if path == "" {
+			continue
+		}
+		body, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("ignoring %s: %v", path, err)
+			continue
+		}
+		*dst = body
+	}
+
+	return app
+}
+
+// HTTPServer builds the http.Server for the app. ReadHeaderTimeout is always
+// set so slow clients cannot hold connections open by trickling headers.
+func (s *Server) HTTPServer() *http.Server {
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", s.port),
+		Handler:           s.RegisterRoutes(),
+		IdleTimeout:       s.idleTimeout,
+		ReadTimeout:       10 * time.Second,
+		ReadHeaderTimeout: s.readHeaderTimeout,
+		WriteTimeout:      30 * time.Second,
+		MaxHeaderBytes:    s.maxHeaderBytes,
 	}
 
-	return &http.Server{
-		Addr:         fmt.Sprintf(":%d", app.port),
-		Handler:      app.RegisterRoutes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+	if s.h2c {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetUnencryptedHTTP2(true)
+		srv.Protocols = protocols
+	}
+
+	return srv
+}
+
+// envBool reports whether the named environment variable is set to a true
+// value as understood by strconv.ParseBool.
+func envBool(key string) bool {
+	enabled, err := strconv.ParseBool(os.Getenv(key))
+	return err == nil && enabled
+}
+
+// envInt returns the positive integer in the named environment variable, or
+// fallback when it is unset or invalid.
+func envInt(key string, fallback int) int {
+	parsed, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || parsed <= 0 {
+		return fallback
+	}
+	return parsed
+}
+
+// envList splits the comma-separated named environment variable into
+// lowercased, trimmed, non-empty entries.
+func envList(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// envPrefixes parses the comma-separated named environment variable as CIDR
+// networks; bare IPs are treated as single-address networks. Invalid entries
+// are logged and skipped.
+func envPrefixes(key string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, v := range envList(key) {
+		if prefix, err := netip.ParsePrefix(v); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(v); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		log.Printf("ignoring invalid %s entry %q", key, v)
+	}
+	return prefixes
+}
+
+// envTimeFormat returns the named timestamp format, falling back to RFC 3339
+// when it is unset or unknown.
+func envTimeFormat(key string) string {
+	switch v := strings.ToLower(strings.TrimSpace(os.Getenv(key))); v {
+	case "", timeFormatRFC3339:
+		return timeFormatRFC3339
+	case timeFormatEpochMillis:
+		return timeFormatEpochMillis
+	default:
+		log.Printf("ignoring invalid %s %q", key, v)
+		return timeFormatRFC3339
+	}
+}
+
+// envURL parses the absolute URL in the named environment variable, returning
+// nil when it is unset or not an absolute http(s) URL.
+func envURL(key string) *url.URL {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		log.Printf("ignoring invalid %s %q", key, raw)
+		return nil
+	}
+	return parsed
+}
+
+// envDuration returns the positive time.Duration in the named environment
+// variable, or fallback when it is unset or invalid.
+func envDuration(key string, fallback time.Duration) time.Duration {
+	parsed, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || parsed <= 0 {
+		return fallback
+	}
+	return parsed
+}
+
+// envDurationOrZero is envDuration for settings that 0 turns off: an explicit
+// 0 is kept, and only an unset, invalid, or negative value gets fallback.
+func envDurationOrZero(key string, fallback time.Duration) time.Duration {
+	parsed, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || parsed < 0 {
+		return fallback
 	}
+	return parsed
 }
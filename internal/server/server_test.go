@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestHTTPServerSettings(t *testing.T) {
+	s := &Server{
+		port:              9090,
+		db:                newMockDB(),
+		readHeaderTimeout: 2 * time.Second,
+		idleTimeout:       90 * time.Second,
+		maxHeaderBytes:    4096,
+	}
+
+	srv := s.HTTPServer()
+
+	if srv.Addr != ":9090" {
+		t.Fatalf("expected addr :9090, got %s", srv.Addr)
+	}
+	if srv.ReadHeaderTimeout != 2*time.Second {
+		t.Fatalf("expected read header timeout 2s, got %s", srv.ReadHeaderTimeout)
+	}
+	if srv.IdleTimeout != 90*time.Second {
+		t.Fatalf("expected idle timeout 90s, got %s", srv.IdleTimeout)
+	}
+	if srv.MaxHeaderBytes != 4096 {
+		t.Fatalf("expected max header bytes 4096, got %d", srv.MaxHeaderBytes)
+	}
+	if srv.Protocols != nil {
+		t.Fatal("expected default protocols when h2c is disabled")
+	}
+
+	s.h2c = true
+	srv = s.HTTPServer()
+	if srv.Protocols == nil || !srv.Protocols.UnencryptedHTTP2() || !srv.Protocols.HTTP1() {
+		t.Fatalf("expected HTTP/1 and h2c to be enabled, got %v", srv.Protocols)
+	}
+}
+
+func TestEnvDefaults(t *testing.T) {
+	t.Setenv("READ_HEADER_TIMEOUT", "")
+	t.Setenv("MAX_HEADER_BYTES", "not-a-number")
+
+	if got := envDuration("READ_HEADER_TIMEOUT", defaultReadHeaderTimeout); got != defaultReadHeaderTimeout {
+		t.Fatalf("expected default read header timeout, got %s", got)
+	}
+	if got := envInt("MAX_HEADER_BYTES", defaultMaxHeaderBytes); got != defaultMaxHeaderBytes {
+		t.Fatalf("expected default max header bytes, got %d", got)
+	}
+
+	t.Setenv("READ_HEADER_TIMEOUT", "3s")
+	if got := envDuration("READ_HEADER_TIMEOUT", defaultReadHeaderTimeout); got != 3*time.Second {
+		t.Fatalf("expected 3s, got %s", got)
+	}
+}
+
+func TestEnvPrefixes(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.7 ,fd00::/8,not-an-ip")
+
+	got := envPrefixes("TRUSTED_PROXIES")
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.1.7/32"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+// sharedStatsTimeout bounds a shared stats read, which runs detached from the
+// request that started it so other waiters are not failed by its cancellation.
+const sharedStatsTimeout = 5 * time.Second
+
+// sharedStats is GetStats for read-only endpoints: concurrent requests for
+// the same code share one Redis round trip. Nothing is cached once the read
+// finishes, so a failed read is retried by the next request rather than
+// handed out. Handlers that write to a link must read it back with
+// s.db.GetStats instead, since a read already in flight can predate the
+// write.
+func (s *Server) sharedStats(ctx context.Context, code string) (redisdb.URLStats, error) {
+	results := s.statsFlight.DoChan(code, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sharedStatsTimeout)
+		defer cancel()
+		return s.db.GetStats(ctx, code)
+	})
+
+	select {
+	case res := <-results:
+		if res.Err != nil {
+			return redisdb.URLStats{}, res.Err
+		}
+		stats := res.Val.(redisdb.URLStats)
+		// Each caller gets its own slice to work with.
+		stats.Tags = slices.Clone(stats.Tags)
+		return stats, nil
+	case <-ctx.Done():
+		return redisdb.URLStats{}, ctx.Err()
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+// gatedStatsDB counts GetStats calls and holds each until release is closed,
+// so concurrent requests pile up behind the first one.
+type gatedStatsDB struct {
+	*mockDB
+	calls   atomic.Int64
+	started chan struct{}
+	release chan struct{}
+	err     error
+}
+
+func newGatedStatsDB(err error) *gatedStatsDB {
+	return &gatedStatsDB{mockDB: newMockDB(), started: make(chan struct{}, 100), release: make(chan struct{}), err: err}
+}
+
+func (db *gatedStatsDB) GetStats(_ context.Context, code string) (redisdb.URLStats, error) {
+	db.calls.Add(1)
+	db.started <- struct{}{}
+	<-db.release
+	if db.err != nil {
+		return redisdb.URLStats{}, db.err
+	}
+	return redisdb.URLStats{Code: code, LongURL: "https://docs.example.org/hot", Visits: 7, Tags: []string{"docs"}}, nil
+}
+
+// concurrentStats issues n stats requests for code at once and returns their
+// statuses once the first read has been released.
+func concurrentStats(s *Server, db *gatedStatsDB, code string, n int) []int {
+	h := s.RegisterRoutes()
+	statuses := make([]int, n)
+	var entered, done sync.WaitGroup
+	entered.Add(n)
+	for i := range n {
+		done.Go(func() {
+			res := httptest.NewRecorder()
+			entered.Done()
+			h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/"+code, nil))
+			statuses[i] = res.Code
+		})
+	}
+	<-db.started
+	entered.Wait()
+	// Let the stragglers reach the read in flight before it completes.
+	time.Sleep(50 * time.Millisecond)
+	close(db.release)
+	done.Wait()
+	return statuses
+}
+
+func TestConcurrentStatsShareOneRead(t *testing.T) {
+	db := newGatedStatsDB(nil)
+	s := &Server{db: db}
+
+	for _, status := range concurrentStats(s, db, "hot0001", 20) {
+		if status != http.StatusOK {
+			t.Fatalf("expected every request to succeed, got %d", status)
+		}
+	}
+	if got := db.calls.Load(); got != 1 {
+		t.Fatalf("expected 20 concurrent requests to share 1 read, got %d", got)
+	}
+}
+
+func TestSharedStatsDoesNotCacheErrors(t *testing.T) {
+	db := newGatedStatsDB(errors.New("redis unavailable"))
+	s := &Server{db: db}
+
+	for _, status := range concurrentStats(s, db, "hot0001", 5) {
+		if status != http.StatusInternalServerError {
+			t.Fatalf("expected the shared failure for every request, got %d", status)
+		}
+	}
+
+	db.err = nil
+	stats, err := s.sharedStats(context.Background(), "hot0001")
+	if err != nil || stats.Visits != 7 {
+		t.Fatalf("expected a fresh read after the failure, got %+v (%v)", stats, err)
+	}
+	if got := db.calls.Load(); got != 2 {
+		t.Fatalf("expected the failed read not to be reused, got %d reads", got)
+	}
+}
+
+func TestSharedStatsHonorsCallerCancellation(t *testing.T) {
+	db := newGatedStatsDB(nil)
+	s := &Server{db: db}
+	defer close(db.release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		_, err := s.sharedStats(ctx, "hot0001")
+		result <- err
+	}()
+	<-db.started
+	cancel()
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"expvar"
+	"net/http"
+)
+
+// shedRetryAfter is the Retry-After value, in seconds, sent with shed requests.
+const shedRetryAfter = "1"
+
+// shedRequests counts requests rejected by the load shedder.
+var shedRequests = expvar.NewInt("shed_requests")
+
+// loadShedder returns a wrapper that lets at most limit wrapped requests run
+// at once. Requests over the limit are rejected immediately with 503 instead
+// of queueing for Redis connections. All handlers wrapped by the same
+// loadShedder share the limit; a limit <= 0 disables shedding.
+func (s *Server) loadShedder(limit int) func(http.HandlerFunc) http.HandlerFunc {
+	if limit <= 0 {
+		return func(next http.HandlerFunc) http.HandlerFunc { return next }
+	}
+
+	inFlight := make(chan struct{}, limit)
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case inFlight <- struct{}{}:
+				defer func() { <-inFlight }()
+				next(w, r)
+			default:
+				shedRequests.Add(1)
+				w.Header().Set("Retry-After", shedRetryAfter)
+				s.writeError(w, http.StatusServiceUnavailable, "server is busy, retry later")
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+// blockingDB parks every VisitURL call until it is released, so tests can
+// hold requests in flight.
+type blockingDB struct {
+	*mockDB
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b blockingDB) VisitURL(ctx context.Context, code string, visit redisdb.Visit) (redisdb.ResolvedURL, error) {
+	b.entered <- struct{}{}
+	<-b.release
+	return b.mockDB.VisitURL(ctx, code, visit)
+}
+
+func TestLoadShedderRejectsOverLimit(t *testing.T) {
+	const limit = 3
+
+	db := blockingDB{mockDB: newMockDB(), entered: make(chan struct{}), release: make(chan struct{})}
+	db.store["hot0001"] = redisdb.URLStats{Code: "hot0001", LongURL: "https://example.com", CreatedAt: time.Now().UTC()}
+	s := &Server{db: db, maxInFlight: limit}
+	h := s.RegisterRoutes()
+
+	results := make(chan int, limit)
+	for i := 0; i < limit; i++ {
+		go func() {
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/hot0001", nil))
+			results <- res.Code
+		}()
+		<-db.entered
+	}
+
+	shedBefore := shedRequests.Value()
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/hot0001", nil))
+	if res.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected request %d to be shed with %d, got %d", limit+1, http.StatusServiceUnavailable, res.Code)
+	}
+	if res.Header().Get("Retry-After") == "" {
+		t.Fatal("expected a Retry-After header on shed requests")
+	}
+	if shedRequests.Value()-shedBefore != 1 {
+		t.Fatalf("expected shed_requests to grow by 1, got %d", shedRequests.Value()-shedBefore)
+	}
+
+	// Release the held requests one at a time so the mock is never used
+	// concurrently.
+	for i := 0; i < limit; i++ {
+		db.release <- struct{}{}
+		if code := <-results; code != http.StatusFound {
+			t.Fatalf("expected in-flight request to complete with %d, got %d", http.StatusFound, code)
+		}
+	}
+
+	// Capacity is back once the in-flight requests finish.
+	go func() { <-db.entered; db.release <- struct{}{} }()
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/hot0001", nil))
+	if res.Code != http.StatusFound {
+		t.Fatalf("expected request after drain to succeed, got %d", res.Code)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"crypto/hmac"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSignBodyKnownVector(t *testing.T) {
+	// RFC 4231 test case 2.
+	got := signBody([]byte("Jefe"), []byte("what do ya want for nothing?"))
+	want := "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestShortenResponseIsSigned(t *testing.T) {
+	shorten := func(s *Server) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"https://docs.example.org/signed"}`)))
+		if res.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, res.Code, res.Body.String())
+		}
+		return res
+	}
+
+	if res := shorten(&Server{db: newMockDB()}); res.Header().Get(signatureHeader) != "" {
+		t.Fatal("expected no signature without a signing key")
+	}
+
+	key := []byte("integration-secret")
+	res := shorten(&Server{db: newMockDB(), responseSigningKey: key, envelope: true})
+	signature := res.Header().Get(signatureHeader)
+	if !strings.HasPrefix(signature, "sha256=") {
+		t.Fatalf("expected a sha256 signature, got %q", signature)
+	}
+	// What an integrator does: recompute over the raw body and compare in
+	// constant time.
+	if !hmac.Equal([]byte(signature), []byte(signBody(key, res.Body.Bytes()))) {
+		t.Fatal("expected the signature to verify against the body")
+	}
+	if !strings.HasPrefix(res.Body.String(), `{"data":`) {
+		t.Fatalf("expected the envelope to be kept, got %s", res.Body.String())
+	}
+
+	tampered := strings.Replace(res.Body.String(), "signed", "forged", 1)
+	if signBody(key, []byte(tampered)) == signature {
+		t.Fatal("expected a modified body not to verify")
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"url-shortner/pkg/linkrules"
+)
+
+const (
+	// maxReadableSuffix bounds the -2, -3, ... suffixes tried for a taken slug.
+	maxReadableSuffix = 20
+	// maxSlugBaseLength leaves room for the longest suffix within
+	// linkrules.AliasPattern.
+	maxSlugBaseLength = 32 - len("-20")
+)
+
+var (
+	errNoReadableSlug = errors.New("could not derive a readable slug; provide a title or custom_alias")
+	errSlugTaken      = errors.New("every readable slug variant is taken")
+)
+
+// slugify lowercases s and collapses every run of characters outside
+// [a-z0-9] into a single hyphen, trimmed to maxSlugBaseLength.
+func slugify(s string) string {
+	var b strings.Builder
+	pendingHyphen := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if pendingHyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			pendingHyphen = false
+			b.WriteRune(r)
+			continue
+		}
+		pendingHyphen = true
+	}
+
+	slug := b.String()
+	if len(slug) > maxSlugBaseLength {
+		slug = strings.TrimRight(slug[:maxSlugBaseLength], "-")
+	}
+	return slug
+}
+
+// readableSlugSource picks the text a readable slug is built from: the title
+// when given, otherwise the last path segment of the target without its file
+// extension, otherwise the host.
+func readableSlugSource(title string, target *url.URL) string {
+	if title != "" {
+		return title
+	}
+	if segment := path.Base(strings.TrimRight(target.Path, "/")); segment != "." && segment != "/" && segment != "" {
+		return strings.TrimSuffix(segment, path.Ext(segment))
+	}
+	return strings.TrimPrefix(target.Hostname(), "www.")
+}
+
+// resolveReadableCode turns title or target into a slug and returns the first
+// of slug, slug-2, ... slug-N that is not taken, checking all candidates in a
+// single round trip.
+func (s *Server) resolveReadableCode(ctx context.Context, title string, target *url.URL) (string, error) {
+	base := slugify(readableSlugSource(title, target))
+	if !linkrules.AliasPattern.MatchString(base) {
+		return "", errNoReadableSlug
+	}
+
+	candidates := make([]string, 0, maxReadableSuffix)
+	candidates = append(candidates, s.codePrefix+base)
+	for i := 2; i <= maxReadableSuffix; i++ {
+		candidates = append(candidates, s.codePrefix+base+"-"+strconv.Itoa(i))
+	}
+
+	taken, err := s.db.ShortCodeExistsBatch(ctx, candidates)
+	if err != nil {
+		return "", err
+	}
+	for _, candidate := range candidates {
+		if !taken[candidate] {
+			return candidate, nil
+		}
+	}
+	return "", errSlugTaken
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"My Blog Post", "my-blog-post"},
+		{"  Hello,   World!! ", "hello-world"},
+		{"Café & Crème — 2024", "caf-cr-me-2024"},
+		{"already-a-slug_ok", "already-a-slug-ok"},
+		{"!!!", ""},
+		{"a very long title that keeps going well past the limit", "a-very-long-title-that-keeps"},
+	}
+
+	for _, tt := range tests {
+		if got := slugify(tt.in); got != tt.want {
+			t.Errorf("slugify(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if got := slugify(tt.in); len(got) > maxSlugBaseLength {
+			t.Errorf("slugify(%q) exceeded %d characters: %q", tt.in, maxSlugBaseLength, got)
+		}
+	}
+}
+
+func TestReadableSlugSource(t *testing.T) {
+	tests := []struct {
+		title  string
+		target string
+		want   string
+	}{
+		{"Launch Post", "https://example.com/a/b", "Launch Post"},
+		{"", "https://example.com/blog/my-first-post.html", "my-first-post"},
+		{"", "https://example.com/docs/getting-started/", "getting-started"},
+		{"", "https://www.example.com/", "example.com"},
+	}
+
+	for _, tt := range tests {
+		target, _ := url.Parse(tt.target)
+		if got := readableSlugSource(tt.title, target); got != tt.want {
+			t.Errorf("readableSlugSource(%q, %q) = %q, want %q", tt.title, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestCreateReadableSlug(t *testing.T) {
+	db := newMockDB()
+	s := &Server{db: db}
+	h := s.RegisterRoutes()
+
+	create := func(body string) (*httptest.ResponseRecorder, createShortURLResponse) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBufferString(body))
+		req.Host = "short.local"
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		var out createShortURLResponse
+		_ = json.Unmarshal(res.Body.Bytes(), &out)
+		return res, out
+	}
+
+	body := `{"url":"https://example.com/blog/my-blog-post","readable":true}`
+	for i, want := range []string{"my-blog-post", "my-blog-post-2", "my-blog-post-3"} {
+		res, out := create(body)
+		if res.Code != http.StatusCreated {
+			t.Fatalf("create %d: expected status %d, got %d: %s", i, http.StatusCreated, res.Code, res.Body.String())
+		}
+		if out.ShortCode != want || out.Strategy != strategyReadable {
+			t.Fatalf("create %d: expected %q via %q, got %q via %q", i, want, strategyReadable, out.ShortCode, out.Strategy)
+		}
+	}
+
+	if _, out := create(`{"url":"https://example.com/x","title":"Quarterly Report","readable":true}`); out.ShortCode != "quarterly-report" {
+		t.Fatalf("expected slug from title, got %q", out.ShortCode)
+	}
+
+	if res, _ := create(`{"url":"https://example.com/","title":"!!","readable":true}`); res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for an unusable slug, got %d", http.StatusBadRequest, res.Code)
+	}
+
+	db.store["full"] = redisdb.URLStats{Code: "full"}
+	for i := 2; i <= maxReadableSuffix; i++ {
+		code := "full-" + strconv.Itoa(i)
+		db.store[code] = redisdb.URLStats{Code: code}
+	}
+	if res, _ := create(`{"url":"https://example.com/full","readable":true}`); res.Code != http.StatusConflict {
+		t.Fatalf("expected status %d when every variant is taken, got %d", http.StatusConflict, res.Code)
+	}
+}
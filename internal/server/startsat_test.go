@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduledActivation(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db}).RegisterRoutes()
+	start := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	body := fmt.Sprintf(`{"url":"https://docs.example.org/launch","custom_alias":"launch01","expiration_days":2,"starts_at":%q}`, start.Format(time.RFC3339))
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(body)))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+	var created createShortURLResponse
+	json.Unmarshal(res.Body.Bytes(), &created)
+	if created.StartsAt == nil || !created.StartsAt.Equal(start) {
+		t.Fatalf("expected starts_at %s in the response, got %v", start, created.StartsAt)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/launch01", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 before activation, got %d", res.Code)
+	}
+	if db.store["launch01"].Visits != 0 {
+		t.Fatal("expected no visit to be counted before activation")
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/urls/launch01", nil))
+	var stats map[string]any
+	json.Unmarshal(res.Body.Bytes(), &stats)
+	if stats["starts_at"] != start.Format(time.RFC3339) || stats["expires_at"] == nil {
+		t.Fatalf("expected stats to show the active window, got %v", stats)
+	}
+
+	link := db.store["launch01"]
+	started := time.Now().Add(-time.Minute)
+	link.StartsAt = &started
+	db.store["launch01"] = link
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/launch01", nil))
+	if res.Code != http.StatusFound || res.Header().Get("Location") != "https://docs.example.org/launch" {
+		t.Fatalf("expected a redirect once active, got %d", res.Code)
+	}
+
+	ended := time.Now().Add(-time.Second)
+	link = db.store["launch01"]
+	link.ExpiresAt = &ended
+	db.store["launch01"] = link
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/launch01", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected the link to be gone after its window, got %d", res.Code)
+	}
+}
+
+func TestScheduledActivationValidation(t *testing.T) {
+	h := (&Server{db: newMockDB()}).RegisterRoutes()
+	tooLate := time.Now().Add(72 * time.Hour).UTC().Format(time.RFC3339)
+
+	for _, body := range []string{
+		fmt.Sprintf(`{"url":"https://docs.example.org","expiration_days":1,"starts_at":%q}`, tooLate),
+		`{"url":"https://docs.example.org","starts_at":"tomorrow"}`,
+	} {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(body)))
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d: %s", body, res.Code, res.Body.String())
+		}
+	}
+}
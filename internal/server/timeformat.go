@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+const (
+	timeFormatRFC3339     = "rfc3339"
+	timeFormatEpochMillis = "epoch_ms"
+)
+
+// urlStatsView renders URLStats with its timestamps either as RFC 3339
+// strings (the default) or as Unix epoch milliseconds.
+type urlStatsView struct {
+	redisdb.URLStats
+	epochMillis bool
+}
+
+func (s *Server) statsView(r *http.Request, stats redisdb.URLStats) urlStatsView {
+	stats.ExpiringSoon = expiresWithin(stats, s.expiringSoonWithin())
+	stats = s.readerStats(r, stats)
+	return urlStatsView{URLStats: stats, epochMillis: s.epochMillis}
+}
+
+func (v urlStatsView) MarshalJSON() ([]byte, error) {
+	if !v.epochMillis {
+		return json.Marshal(v.URLStats)
+	}
+	view := struct {
+		redisdb.URLStats
+		CreatedAt   int64            `json:"created_at"`
+		ExpiresAt   *int64           `json:"expires_at,omitempty"`
+		StartsAt    *int64           `json:"starts_at,omitempty"`
+		Destination *destinationView `json:"destination,omitempty"`
+	}{
+		URLStats:  v.URLStats,
+		CreatedAt: v.CreatedAt.UnixMilli(),
+		ExpiresAt: unixMillis(v.ExpiresAt),
+		StartsAt:  unixMillis(v.StartsAt),
+	}
+	if v.Destination != nil {
+		dest := destinationView{DestinationHealth: *v.Destination, epochMillis: true}
+		view.Destination = &dest
+	}
+	return json.Marshal(view)
+}
+
+// destinationView renders DestinationHealth with checked_at in the
+// configured time format.
+type destinationView struct {
+	redisdb.DestinationHealth
+	epochMillis bool
+}
+
+func (s *Server) destinationView(health redisdb.DestinationHealth) destinationView {
+	return destinationView{DestinationHealth: health, epochMillis: s.epochMillis}
+}
+
+func (v destinationView) MarshalJSON() ([]byte, error) {
+	if !v.epochMillis {
+		return json.Marshal(v.DestinationHealth)
+	}
+	return json.Marshal(struct {
+		redisdb.DestinationHealth
+		CheckedAt int64 `json:"checked_at"`
+	}{
+		DestinationHealth: v.DestinationHealth,
+		CheckedAt:         v.CheckedAt.UnixMilli(),
+	})
+}
+
+func (r createShortURLResponse) MarshalJSON() ([]byte, error) {
+	type plain createShortURLResponse
+	if !r.epochMillis {
+		return json.Marshal(plain(r))
+	}
+	return json.Marshal(struct {
+		plain
+		ExpiresAt *int64 `json:"expires_at,omitempty"`
+		StartsAt  *int64 `json:"starts_at,omitempty"`
+	}{
+		plain:     plain(r),
+		ExpiresAt: unixMillis(r.ExpiresAt),
+		StartsAt:  unixMillis(r.StartsAt),
+	})
+}
+
+func unixMillis(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	ms := t.UnixMilli()
+	return &ms
+}
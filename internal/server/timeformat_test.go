@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestStatsTimeFormats(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	expires := created.Add(48 * time.Hour)
+
+	db := newMockDB()
+	db.store["time001"] = redisdb.URLStats{Code: "time001", LongURL: "https://example.com", CreatedAt: created, ExpiresAt: &expires, Tags: []string{"t"}}
+	db.store["time002"] = redisdb.URLStats{Code: "time002", LongURL: "https://example.com", CreatedAt: created}
+
+	fetch := func(s *Server, path string) map[string]any {
+		t.Helper()
+		res := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+		var body map[string]any
+		if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to decode %s: %v", path, err)
+		}
+		return body
+	}
+
+	body := fetch(&Server{db: db}, "/api/v1/urls/time001")
+	if body["created_at"] != created.Format(time.RFC3339) || body["expires_at"] != expires.Format(time.RFC3339) {
+		t.Fatalf("expected RFC 3339 timestamps by default, got %v / %v", body["created_at"], body["expires_at"])
+	}
+
+	epoch := &Server{db: db, epochMillis: true}
+	body = fetch(epoch, "/api/v1/urls/time001")
+	if body["created_at"] != float64(created.UnixMilli()) || body["expires_at"] != float64(expires.UnixMilli()) {
+		t.Fatalf("expected epoch millis, got %v / %v", body["created_at"], body["expires_at"])
+	}
+	if body["code"] != "time001" || body["long_url"] != "https://example.com" {
+		t.Fatalf("expected other fields to be kept, got %v", body)
+	}
+
+	body = fetch(epoch, "/api/v1/urls/time002")
+	if _, ok := body["expires_at"]; ok {
+		t.Fatalf("expected no expires_at for a permanent link, got %v", body["expires_at"])
+	}
+
+	list := fetch(epoch, "/api/v1/urls?tag=t")
+	urls, _ := list["items"].([]any)
+	if len(urls) != 1 || urls[0].(map[string]any)["created_at"] != float64(created.UnixMilli()) {
+		t.Fatalf("expected epoch millis in list responses, got %v", list)
+	}
+}
+
+func TestCreateResponseTimeFormat(t *testing.T) {
+	s := &Server{db: newMockDB(), epochMillis: true}
+	h := s.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewBufferString(`{"url":"https://example.com","expiration_days":1}`))
+	req.Host = "short.local"
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	var body map[string]any
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	ms, ok := body["expires_at"].(float64)
+	if !ok {
+		t.Fatalf("expected numeric expires_at, got %v", body["expires_at"])
+	}
+	if got := time.UnixMilli(int64(ms)); time.Until(got) < 23*time.Hour {
+		t.Fatalf("expected expiry about a day out, got %s", got)
+	}
+	if _, ok := body["short_code"].(string); !ok {
+		t.Fatalf("expected short_code to be kept, got %v", body)
+	}
+
+	if _, err := s.db.GetStats(context.Background(), body["short_code"].(string)); err != nil {
+		t.Fatalf("expected the link to be created: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+// updateURLRequest is a partial update: only the fields present in the body
+// are changed, and an empty string or list clears a setting. Expiry is given
+// as in PATCH /api/v1/urls/{code}/expiration.
+type updateURLRequest struct {
+	URL         *string   `json:"url,omitempty"`
+	Title       *string   `json:"title,omitempty"`
+	Description *string   `json:"description,omitempty"`
+	Tags        *[]string `json:"tags,omitempty"`
+	Group       *string   `json:"group,omitempty"`
+	Sliding     *bool     `json:"sliding_expiration,omitempty"`
+	Disabled    *bool     `json:"disabled,omitempty"`
+	expirationRequest
+}
+
+// updateURLHandler changes any of a link's settings in one request. Every
+// field present is validated with the create rules before anything is
+// written, and the changes are applied together or not at all.
+func (s *Server) updateURLHandler(w http.ResponseWriter, r *http.Request) {
+	code := s.pathCode(r)
+	if code == "" {
+		s.writeError(w, http.StatusNotFound, "short code not found")
+		return
+	}
+
+	var req updateURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+
+	update, err := s.linkUpdate(r.Context(), req, s.requestHost(r))
+	if err != nil {
+		s.writeCreateError(w, err)
+		return
+	}
+
+	err = s.db.UpdateLink(r.Context(), code, update)
+	s.noteWrite(err)
+	if err != nil {
+		switch {
+		case errors.Is(err, redisdb.ErrNotFound):
+			s.writeError(w, http.StatusNotFound, "short code not found")
+		case errors.Is(err, redisdb.ErrReadOnly):
+			s.writeReadOnlyError(w)
+		default:
+			s.writeError(w, http.StatusInternalServerError, "failed to update short URL")
+		}
+		return
+	}
+
+	stats, err := s.db.GetStats(r.Context(), code)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to fetch URL stats")
+		return
+	}
+	s.writeJSON(w, http.StatusOK, s.statsView(r, stats))
+}
+
+// linkUpdate validates req and turns it into a redisdb.LinkUpdate. Errors are
+// *createError, as from createLink.
+func (s *Server) linkUpdate(ctx context.Context, req updateURLRequest, host string) (redisdb.LinkUpdate, error) {
+	var update redisdb.LinkUpdate
+	invalid := func(message string) (redisdb.LinkUpdate, error) {
+		return redisdb.LinkUpdate{}, &createError{http.StatusBadRequest, message}
+	}
+
+	if req.URL != nil {
+		target, err := s.checkTarget(ctx, *req.URL, host)
+		if err != nil {
+			return redisdb.LinkUpdate{}, err
+		}
+		longURL := target.String()
+		update.URL = &longURL
+	}
+	if req.Title != nil {
+		title, err := normalizeText("title", *req.Title, maxTitleLength)
+		if err != nil {
+			return invalid(err.Error())
+		}
+		update.Title = &title
+	}
+	if req.Description != nil {
+		description, err := normalizeText("description", *req.Description, maxDescriptionLength)
+		if err != nil {
+			return invalid(err.Error())
+		}
+		update.Description = &description
+	}
+	if req.Tags != nil {
+		tags, err := normalizeTags(*req.Tags)
+		if err != nil {
+			return invalid(err.Error())
+		}
+		update.Tags = &tags
+	}
+	if req.Group != nil {
+		group, err := normalizeGroup(*req.Group)
+		if err != nil {
+			return invalid(err.Error())
+		}
+		update.Group = &group
+	}
+
+	ttl, hasTTL, err := req.ttl()
+	if err != nil {
+		return invalid(err.Error())
+	}
+	if hasTTL {
+		update.TTL = &ttl
+	}
+	if req.Sliding != nil {
+		if *req.Sliding && (!hasTTL || ttl <= 0) {
+			return invalid("sliding_expiration requires expiration_days")
+		}
+		update.Sliding = req.Sliding
+	}
+	update.Disabled = req.Disabled
+
+	if update == (redisdb.LinkUpdate{}) {
+		return invalid("no fields to update")
+	}
+	return update, nil
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestUpdateURLAppliesPartialChanges(t *testing.T) {
+	db := newMockDB()
+	opts := redisdb.CreateOptions{TTL: 48 * time.Hour, Tags: []string{"docs"}, Title: "Docs", Description: "All the docs", Group: "launch"}
+	if err := db.CreateShortURL(context.Background(), "patch01", "https://docs.example.org/v1", opts); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	h := (&Server{db: db}).RegisterRoutes()
+
+	patch := func(body string) (int, redisdb.URLStats) {
+		t.Helper()
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPatch, "/api/v1/urls/patch01", strings.NewReader(body)))
+		var out redisdb.URLStats
+		if res.Code == http.StatusOK {
+			if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+		}
+		return res.Code, out
+	}
+
+	status, out := patch(`{"title":"  New docs  ","tags":["Guides","docs"]}`)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	if out.Title != "New docs" || !slices.Equal(out.Tags, []string{"guides", "docs"}) {
+		t.Fatalf("expected the title and tags to change, got %+v", out)
+	}
+	if out.LongURL != "https://docs.example.org/v1" || out.Description != "All the docs" || out.Group != "launch" || out.ExpiresAt == nil {
+		t.Fatalf("expected unspecified fields to be unchanged, got %+v", out)
+	}
+
+	status, out = patch(`{"url":"https://docs.example.org/v2","expiration_days":0,"description":""}`)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	if out.LongURL != "https://docs.example.org/v2" || out.ExpiresAt != nil || out.Description != "" {
+		t.Fatalf("expected a new destination, no expiry and no description, got %+v", out)
+	}
+	if out.Title != "New docs" || out.Group != "launch" {
+		t.Fatalf("expected unspecified fields to be unchanged, got %+v", out)
+	}
+}
+
+func TestUpdateURLValidatesLikeCreate(t *testing.T) {
+	db := newMockDB()
+	if err := db.CreateShortURL(context.Background(), "patch02", "https://docs.example.org", redisdb.CreateOptions{Title: "Keep"}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	h := (&Server{db: db, blockedDomains: []string{"blocked.example"}}).RegisterRoutes()
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{"empty patch", "/api/v1/urls/patch02", `{}`, http.StatusBadRequest},
+		{"bad scheme", "/api/v1/urls/patch02", `{"url":"ftp://docs.example.org","title":"Lost"}`, http.StatusBadRequest},
+		{"blocked domain", "/api/v1/urls/patch02", `{"url":"https://blocked.example/x"}`, http.StatusForbidden},
+		{"self reference", "/api/v1/urls/patch02", `{"url":"https://example.com/loop"}`, http.StatusBadRequest},
+		{"bad tag", "/api/v1/urls/patch02", `{"tags":["no spaces"]}`, http.StatusBadRequest},
+		{"long title", "/api/v1/urls/patch02", `{"title":"` + strings.Repeat("x", maxTitleLength+1) + `"}`, http.StatusBadRequest},
+		{"negative expiry", "/api/v1/urls/patch02", `{"expiration_days":-1}`, http.StatusBadRequest},
+		{"sliding without expiry", "/api/v1/urls/patch02", `{"sliding_expiration":true}`, http.StatusBadRequest},
+		{"missing code", "/api/v1/urls/nope0001", `{"title":"x"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPatch, tt.path, strings.NewReader(tt.body)))
+		if res.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.status, res.Code, res.Body.String())
+		}
+	}
+
+	if stats := db.store["patch02"]; stats.Title != "Keep" || stats.LongURL != "https://docs.example.org" {
+		t.Fatalf("expected rejected patches to change nothing, got %+v", stats)
+	}
+}
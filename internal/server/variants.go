@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+const (
+	minVariants = 2
+	maxVariants = 10
+	// variantWeightTotal is what the weights of a link's variants must add
+	// up to, so they read as percentages.
+	variantWeightTotal = 100
+)
+
+// variantRequest is one destination of a split link in a create request.
+type variantRequest struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// checkVariants validates the variants of a split link: every URL as
+// checkTarget does, and positive weights adding up to variantWeightTotal. It
+// returns them with their URLs normalized. Errors are *createError.
+func (s *Server) checkVariants(ctx context.Context, raw []variantRequest, host string) ([]redisdb.Variant, error) {
+	if len(raw) < minVariants || len(raw) > maxVariants {
+		return nil, &createError{http.StatusBadRequest, fmt.Sprintf("variants must list between %d and %d destinations", minVariants, maxVariants)}
+	}
+	variants := make([]redisdb.Variant, len(raw))
+	total := 0
+	for i, v := range raw {
+		if v.Weight < 1 {
+			return nil, &createError{http.StatusBadRequest, "variant weights must be positive"}
+		}
+		total += v.Weight
+		target, err := s.checkTarget(ctx, v.URL, host)
+		if err != nil {
+			var createErr *createError
+			if errors.As(err, &createErr) {
+				return nil, &createError{createErr.status, fmt.Sprintf("variant %d: %s", i+1, createErr.message)}
+			}
+			return nil, err
+		}
+		variants[i] = redisdb.Variant{URL: target.String(), Weight: v.Weight}
+	}
+	if total != variantWeightTotal {
+		return nil, &createError{http.StatusBadRequest, fmt.Sprintf("variant weights must add up to %d, got %d", variantWeightTotal, total)}
+	}
+	return variants, nil
+}
+
+// rollVariant fills in the rolls that pick a split link's variant for visit
+// to code: a random one, and for sticky_variants links one derived from the
+// visitor and code, so each client keeps landing on the same variant. The
+// visitor is the client IP from clientIP, so clients behind TRUSTED_PROXIES
+// roll independently of the proxy. A visit without a known visitor rolls
+// randomly for both.
+func rollVariant(visit *redisdb.Visit, code string) {
+	visit.VariantRoll = rand.Float64()
+	visit.StickyRoll = visit.VariantRoll
+	if visit.Visitor != "" {
+		h := fnv.New64a()
+		h.Write([]byte(visit.Visitor + "\x00" + code))
+		visit.StickyRoll = float64(h.Sum64()>>11) / (1 << 53)
+	}
+}
+
+// pickVariant returns the URL a visit to the link described by stats goes
+// to and the index of its variant, -1 for a link without variants, for the
+// paths that resolve without the visit script.
+func pickVariant(stats redisdb.URLStats, visit redisdb.Visit) (string, int) {
+	roll := visit.VariantRoll
+	if stats.StickyVariants {
+		roll = visit.StickyRoll
+	}
+	if i := redisdb.PickVariant(stats.Variants, roll); i >= 0 {
+		return stats.Variants[i].URL, i
+	}
+	return stats.LongURL, -1
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func visitFrom(h http.Handler, code, remoteAddr string) string {
+	req := httptest.NewRequest(http.MethodGet, "/"+code, nil)
+	req.RemoteAddr = remoteAddr
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	return res.Header().Get("Location")
+}
+
+func TestSplitLinkNotCached(t *testing.T) {
+	h := (&Server{db: newMockDB(), redirectCacheMaxAge: 10 * time.Minute}).RegisterRoutes()
+	split := `{"custom_alias":"split1","variants":[
+		{"url":"https://a.example.org/","weight":50},
+		{"url":"https://b.example.org/","weight":50}
+	]}`
+	if res := shorten(h, split, ""); res.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+	if res := shorten(h, `{"custom_alias":"plain1","url":"https://a.example.org/"}`, ""); res.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+
+	for code, want := range map[string]string{"split1": "no-store", "plain1": "public, max-age=600"} {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/"+code, nil))
+		if res.Code != http.StatusFound {
+			t.Fatalf("%s: expected status %d, got %d", code, http.StatusFound, res.Code)
+		}
+		if got := res.Header().Get("Cache-Control"); got != want {
+			t.Fatalf("%s: expected Cache-Control %q, got %q", code, want, got)
+		}
+	}
+}
+
+func TestSplitLinkDistributesByWeight(t *testing.T) {
+	db := newMockDB()
+	h := (&Server{db: db}).RegisterRoutes()
+	split := `{"custom_alias":"split1","variants":[
+		{"url":"https://a.example.org/","weight":80},
+		{"url":"https://b.example.org/","weight":20}
+	]}`
+	if res := shorten(h, split, ""); res.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+
+	const visits = 4000
+	landed := map[string]int{}
+	for range visits {
+		landed[visitFrom(h, "split1", "192.0.2.1:1234")]++
+	}
+	share := float64(landed["https://a.example.org/"]) / visits
+	if share < 0.75 || share > 0.85 || landed["https://a.example.org/"]+landed["https://b.example.org/"] != visits {
+		t.Fatalf("expected about 80%% of visits on the first variant, got %v", landed)
+	}
+
+	stats := db.store["split1"]
+	if stats.LongURL != "https://a.example.org/" || stats.Visits != visits {
+		t.Fatalf("unexpected link stats: %+v", stats)
+	}
+	for _, v := range stats.Variants {
+		if v.Visits != int64(landed[v.URL]) {
+			t.Fatalf("expected %s to count %d visits, got %d", v.URL, landed[v.URL], v.Visits)
+		}
+	}
+}
+
+func TestSplitLinkSticky(t *testing.T) {
+	h := (&Server{db: newMockDB()}).RegisterRoutes()
+	split := `{"custom_alias":"split2","sticky_variants":true,"variants":[
+		{"url":"https://a.example.org/","weight":50},
+		{"url":"https://b.example.org/","weight":50}
+	]}`
+	if res := shorten(h, split, ""); res.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+
+	seen := map[string]bool{}
+	for i := range 50 {
+		addr := "198.51.100." + strconv.Itoa(i+1) + ":80"
+		first := visitFrom(h, "split2", addr)
+		if again := visitFrom(h, "split2", addr); again != first {
+			t.Fatalf("expected %s to stay on %s, got %s", addr, first, again)
+		}
+		seen[first] = true
+	}
+	if len(seen) != 2 {
+		t.Fatalf("expected different clients to be spread across both variants, got %v", seen)
+	}
+}
+
+func TestSplitLinkStickyBehindProxy(t *testing.T) {
+	s := &Server{db: newMockDB(), trustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	h := s.RegisterRoutes()
+	split := `{"custom_alias":"split3","sticky_variants":true,"variants":[
+		{"url":"https://a.example.org/","weight":50},
+		{"url":"https://b.example.org/","weight":50}
+	]}`
+	if res := shorten(h, split, ""); res.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", res.Code, res.Body.String())
+	}
+
+	visit := func(client string) string {
+		req := httptest.NewRequest(http.MethodGet, "/split3", nil)
+		req.RemoteAddr = "10.0.0.1:5555"
+		req.Header.Set("X-Forwarded-For", client)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res.Header().Get("Location")
+	}
+
+	seen := map[string]bool{}
+	for i := range 50 {
+		client := "198.51.100." + strconv.Itoa(i+1)
+		first := visit(client)
+		if again := visit(client); again != first {
+			t.Fatalf("expected %s to stay on %s, got %s", client, first, again)
+		}
+		seen[first] = true
+	}
+	if len(seen) != 2 {
+		t.Fatalf("expected forwarded clients to be spread across both variants, got %v", seen)
+	}
+}
+
+func TestSplitLinkValidation(t *testing.T) {
+	h := (&Server{db: newMockDB()}).RegisterRoutes()
+	for name, body := range map[string]string{
+		"weights short of 100": `{"variants":[{"url":"https://a.example.org/","weight":50},{"url":"https://b.example.org/","weight":40}]}`,
+		"zero weight":          `{"variants":[{"url":"https://a.example.org/","weight":100},{"url":"https://b.example.org/","weight":0}]}`,
+		"single variant":       `{"variants":[{"url":"https://a.example.org/","weight":100}]}`,
+		"invalid variant url":  `{"variants":[{"url":"https://a.example.org/","weight":50},{"url":"ftp://b.example.org/","weight":50}]}`,
+		"url and variants":     `{"url":"https://a.example.org/","variants":[{"url":"https://a.example.org/","weight":50},{"url":"https://b.example.org/","weight":50}]}`,
+		"sticky without split": `{"url":"https://a.example.org/","sticky_variants":true}`,
+	} {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(body)))
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d: %s", name, res.Code, res.Body.String())
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net/http"
+	"runtime"
+)
+
+// Build metadata, overridden at link time, e.g.
+//
+//	go build -ldflags "-X url-shortner/internal/server.version=v1.2.0"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+type versionResponse struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+func (s *Server) versionHandler(w http.ResponseWriter, _ *http.Request) {
+	s.writeJSON(w, http.StatusOK, versionResponse{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	})
+}
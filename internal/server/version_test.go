@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestVersionHandlerDefaults(t *testing.T) {
+	s := &Server{db: newMockDB()}
+	h := s.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/version", nil)
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+
+	var out versionResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if out.Version != "dev" {
+		t.Fatalf("expected version dev, got %q", out.Version)
+	}
+	if out.Commit != "unknown" || out.BuildTime != "unknown" {
+		t.Fatalf("expected unknown commit/build_time, got %q/%q", out.Commit, out.BuildTime)
+	}
+	if out.GoVersion != runtime.Version() {
+		t.Fatalf("expected go_version %s, got %s", runtime.Version(), out.GoVersion)
+	}
+}
+
+func TestRootHandlerReportsBuildVersion(t *testing.T) {
+	s := &Server{db: newMockDB()}
+	h := s.RegisterRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	var out map[string]any
+	if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if out["version"] != version {
+		t.Fatalf("expected version %q, got %v", version, out["version"])
+	}
+	if out["api_version"] != "v1" {
+		t.Fatalf("expected api_version v1, got %v", out["api_version"])
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+// readerStats is the copy of stats r may see. Unless r comes from the link's
+// owner or the admin, a one-time link's destination is left out, since
+// reading it would work around the single visit, and with
+// BUCKET_PUBLIC_VISITS the exact visit count is hidden. Only the rendered
+// copy changes; the stored link stays as it is.
+func (s *Server) readerStats(r *http.Request, stats redisdb.URLStats) redisdb.URLStats {
+	if s.isLinkOwner(r, stats) {
+		return stats
+	}
+	if stats.OneTime {
+		stats.LongURL, stats.Variants = "", nil
+	}
+	if !s.bucketPublicVisits {
+		return stats
+	}
+	stats.Visits, stats.VisitsBucket = visitBucket(stats.Visits)
+	if len(stats.Variants) > 0 {
+		// Per-variant counts would give the total away, so they are left
+		// out rather than bucketed.
+		variants := make([]redisdb.Variant, len(stats.Variants))
+		for i, v := range stats.Variants {
+			variants[i] = redisdb.Variant{URL: v.URL, Weight: v.Weight}
+		}
+		stats.Variants = variants
+	}
+	return stats
+}
+
+// isLinkOwner reports whether r comes from the admin or carries the
+// X-API-Key that created the link.
+func (s *Server) isLinkOwner(r *http.Request, stats redisdb.URLStats) bool {
+	if s.isAdmin(r) {
+		return true
+	}
+	owner := ownerFromRequest(r)
+	return owner != "" && owner == stats.Owner
+}
+
+// visitBucket rounds visits down to its order of magnitude (0, 1, 10, 100,
+// ...) and labels the bucket, as in "100+" for anything from 100 to 999.
+func visitBucket(visits int64) (int64, string) {
+	if visits <= 0 {
+		return 0, "0"
+	}
+	bucket := int64(1)
+	for bucket <= visits/10 {
+		bucket *= 10
+	}
+	return bucket, strconv.FormatInt(bucket, 10) + "+"
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+func TestVisitBucket(t *testing.T) {
+	for visits, want := range map[int64]string{0: "0", 1: "1+", 9: "1+", 10: "10+", 99: "10+", 100: "100+", 4321: "1000+"} {
+		if _, got := visitBucket(visits); got != want {
+			t.Fatalf("visitBucket(%d): expected %q, got %q", visits, want, got)
+		}
+	}
+}
+
+func TestPublicStatsBucketVisits(t *testing.T) {
+	db := newMockDB()
+	ctx := context.Background()
+	if err := db.CreateShortURL(ctx, "pop0001", "https://example.com", redisdb.CreateOptions{Owner: ownerFromKey("owner-key")}); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if _, err := db.IncrementVisitsBy(ctx, "pop0001", 1234); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	h := (&Server{db: db, bucketPublicVisits: true, adminToken: "admin-secret"}).RegisterRoutes()
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		visits int64
+		bucket string
+	}{
+		{name: "public", visits: 1000, bucket: "1000+"},
+		{name: "other key", header: apiKeyHeader, value: "someone-else", visits: 1000, bucket: "1000+"},
+		{name: "owner", header: apiKeyHeader, value: "owner-key", visits: 1234},
+		{name: "admin", header: "Authorization", value: "Bearer admin-secret", visits: 1234},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/urls/pop0001", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+
+			var stats redisdb.URLStats
+			if err := json.Unmarshal(res.Body.Bytes(), &stats); err != nil || res.Code != http.StatusOK {
+				t.Fatalf("unexpected response %d: %s", res.Code, res.Body.String())
+			}
+			if stats.Visits != tt.visits || stats.VisitsBucket != tt.bucket {
+				t.Fatalf("expected visits %d bucket %q, got %d %q", tt.visits, tt.bucket, stats.Visits, stats.VisitsBucket)
+			}
+		})
+	}
+
+	if visits := db.store["pop0001"].Visits; visits != 1234 {
+		t.Fatalf("expected the stored count to stay exact, got %d", visits)
+	}
+}
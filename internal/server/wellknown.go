@@ -0,0 +1,49 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultRobotsTxt asks crawlers to stay away from every path, since each
+// short code is only a redirect to somebody else's page.
+const defaultRobotsTxt = "User-agent: *\nDisallow: /\n"
+
+// wellKnownMaxAge is how long browsers and crawlers may cache /favicon.ico
+// and /robots.txt.
+const wellKnownMaxAge = 24 * time.Hour
+
+// robotsHandler serves ROBOTS_TXT_PATH, or defaultRobotsTxt without one.
+// Without this route crawlers would reach the redirect handler and cost a
+// Redis lookup for a code that can never exist.
+func (s *Server) robotsHandler(w http.ResponseWriter, r *http.Request) {
+	body := s.robotsTxt
+	if body == nil {
+		body = []byte(defaultRobotsTxt)
+	}
+	serveStatic(w, r, "robots.txt", "text/plain; charset=utf-8", body)
+}
+
+// faviconHandler serves FAVICON_PATH, or 204 without one so browsers stop
+// asking without the request being looked up as a code.
+func (s *Server) faviconHandler(w http.ResponseWriter, r *http.Request) {
+	if s.favicon == nil {
+		setMaxAge(w)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	serveStatic(w, r, "favicon.ico", http.DetectContentType(s.favicon), s.favicon)
+}
+
+// serveStatic writes body with a day-long cache lifetime.
+func serveStatic(w http.ResponseWriter, r *http.Request, name, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	setMaxAge(w)
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(body))
+}
+
+func setMaxAge(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int64(wellKnownMaxAge/time.Second)))
+}
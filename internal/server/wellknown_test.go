@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	redisdb "url-shortner/internal/redis"
+)
+
+// lookupCountingDB counts redirect lookups.
+type lookupCountingDB struct {
+	*mockDB
+	lookups int
+}
+
+func (db *lookupCountingDB) VisitURL(ctx context.Context, code string, visit redisdb.Visit) (redisdb.ResolvedURL, error) {
+	db.lookups++
+	return db.mockDB.VisitURL(ctx, code, visit)
+}
+
+func TestWellKnownPathsBypassRedirectLookup(t *testing.T) {
+	db := &lookupCountingDB{mockDB: newMockDB()}
+	h := (&Server{db: db}).RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+	if res.Code != http.StatusOK || res.Body.String() != defaultRobotsTxt {
+		t.Fatalf("expected the default robots.txt, got %d %q", res.Code, res.Body.String())
+	}
+	if ct := res.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+	if res.Code != http.StatusNoContent || res.Header().Get("Cache-Control") != "public, max-age=86400" {
+		t.Fatalf("expected a cacheable 204, got %d %v", res.Code, res.Header())
+	}
+
+	if db.lookups != 0 {
+		t.Fatalf("expected no redirect lookups, got %d", db.lookups)
+	}
+}
+
+func TestWellKnownFilesFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	robots := filepath.Join(dir, "robots.txt")
+	favicon := filepath.Join(dir, "favicon.ico")
+	icon := []byte{0, 0, 1, 0, 1, 0, 16, 16}
+	if err := os.WriteFile(robots, []byte("User-agent: *\nAllow: /\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(favicon, icon, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	app, err := NewServerWithService(newMockDB(), Config{Port: 8080, RobotsTxtPath: robots, FaviconPath: favicon})
+	if err != nil {
+		t.Fatalf("NewServerWithService failed: %v", err)
+	}
+	h := app.RegisterRoutes()
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+	if res.Body.String() != "User-agent: *\nAllow: /\n" {
+		t.Fatalf("expected the configured robots.txt, got %q", res.Body.String())
+	}
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+	if res.Code != http.StatusOK || res.Body.String() != string(icon) || res.Header().Get("Content-Type") != "image/x-icon" {
+		t.Fatalf("expected the configured icon, got %d %q %v", res.Code, res.Body.String(), res.Header())
+	}
+}
@@ -0,0 +1,62 @@
+// Package linkrules holds the rules the shortener applies to custom aliases
+// and destination URLs, so tools outside the HTTP server (the CLI, the gRPC
+// service, external importers) accept and reject exactly what it does.
+package linkrules
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// AliasPattern is the shape of a custom alias, before any code prefix.
+var AliasPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{4,32}$`)
+
+// reservedAliases match AliasPattern but are fixed top-level routes, or
+// shadow GET /api/v1/urls/{code}, so a link under one of them could never be
+// reached.
+var reservedAliases = []string{"debug", "expiring", "health", "metrics", "version"}
+
+// IsReserved reports whether code is taken by a fixed route, in any case.
+func IsReserved(code string) bool {
+	return slices.Contains(reservedAliases, strings.ToLower(code))
+}
+
+// ValidateAlias reports why alias cannot be used as a custom alias, or nil
+// when it can.
+func ValidateAlias(alias string) error {
+	if !AliasPattern.MatchString(alias) {
+		return fmt.Errorf("custom_alias must match %s", AliasPattern.String())
+	}
+	if IsReserved(alias) {
+		return fmt.Errorf("custom_alias %q is reserved", alias)
+	}
+	return nil
+}
+
+// NormalizeURL trims raw and checks that it is an absolute http or https URL
+// with a host, returning it in the form it is stored.
+func NormalizeURL(raw string) (string, error) {
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" {
+		return "", errors.New("url is required")
+	}
+
+	parsed, err := url.Parse(trimmed)
+	if err != nil {
+		return "", errors.New("invalid url")
+	}
+
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", errors.New("url must start with http:// or https://")
+	}
+
+	if parsed.Host == "" {
+		return "", errors.New("url host is required")
+	}
+
+	return parsed.String(), nil
+}
@@ -0,0 +1,47 @@
+package linkrules
+
+import "testing"
+
+func TestValidateAlias(t *testing.T) {
+	tests := []struct {
+		alias string
+		ok    bool
+	}{
+		{"docs01", true},
+		{"spring_sale-2030", true},
+		{"abc", false},
+		{"has space", false},
+		{"emoji🙂", false},
+		{"a23456789012345678901234567890123", false},
+		{"health", false},
+		{"Metrics", false},
+		{"healthy", true},
+	}
+	for _, tt := range tests {
+		if err := ValidateAlias(tt.alias); (err == nil) != tt.ok {
+			t.Errorf("ValidateAlias(%q) = %v, want ok=%t", tt.alias, err, tt.ok)
+		}
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw, want string
+		ok        bool
+	}{
+		{"https://docs.example.org/guide", "https://docs.example.org/guide", true},
+		{"  http://docs.example.org/a?b=c  ", "http://docs.example.org/a?b=c", true},
+		{"", "", false},
+		{"   ", "", false},
+		{"ftp://docs.example.org", "", false},
+		{"docs.example.org/guide", "", false},
+		{"https://", "", false},
+		{"https://docs.example.org/%zz", "", false},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeURL(tt.raw)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("NormalizeURL(%q) = %q, %v; want %q, ok=%t", tt.raw, got, err, tt.want, tt.ok)
+		}
+	}
+}